@@ -1,2 +1,3 @@
 #!/bin/bash
-go build -tags $1 -o server .
+BUILD=$(git describe --tags --always --dirty 2>/dev/null || echo dev)
+go build -tags $1 -ldflags "-X github.com/polynetwork/poly-relayer/msg.BUILD=$BUILD" -o server .
@@ -0,0 +1,261 @@
+/*
+ * Copyright (C) 2021 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package bus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/polynetwork/bridge-common/log"
+	"github.com/polynetwork/poly-relayer/msg"
+)
+
+const (
+	DEFAULT_VISIBILITY_TIMEOUT = 10 * time.Minute
+	POLL_INTERVAL              = 200 * time.Millisecond
+	BLOCK_INTERVAL             = 5 * time.Second // Max blocking time of a redis pop, to check for the exit signal
+)
+
+// Length of the lease id prefixed to the in-flight members
+const leaseIdSize = 17
+
+// Move the queue head into the consumer in-flight set, scored by the visibility deadline. The member is prefixed
+// with the lease id, so the byte identical messages are leased and acked separately.
+// KEYS: queue, in-flight set, consumers; ARGV: deadline, lease id
+var popInflight = redis.NewScript(`
+local v = redis.call('LPOP', KEYS[1])
+if v then
+	redis.call('ZADD', KEYS[2], ARGV[1], ARGV[2] .. v)
+	redis.call('SADD', KEYS[3], KEYS[2])
+end
+return v
+`)
+
+// Put the expired in-flight messages back to the queue head, the messages replaced by re-pushes are dropped
+// KEYS: in-flight set, queue, replaced; ARGV: now, lease id size
+var reapInflight = redis.NewScript(`
+local items = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1])
+local count = 0
+for i = #items, 1, -1 do
+	redis.call('ZREM', KEYS[1], items[i])
+	local v = string.sub(items[i], tonumber(ARGV[2]) + 1)
+	if redis.call('HDEL', KEYS[3], v) == 0 then
+		redis.call('LPUSH', KEYS[2], v)
+		count = count + 1
+	end
+end
+return count
+`)
+
+// Raw encoding of the popped tx, the lease deadline in milliseconds if leased, and the lease id if in-flight
+type lease struct {
+	raw      string
+	deadline int64
+	id       string
+}
+
+// New lease id of an in-flight message, hex encoded random bytes with a colon
+func newLeaseId() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:]) + ":"
+}
+
+func (l lease) member() string {
+	return l.id + l.raw
+}
+
+// Track the raw encoding of the popped txs, which is used to ack them later
+type leases struct {
+	sync.Mutex
+	items map[*msg.Tx]lease
+}
+
+func (l *leases) put(tx *msg.Tx, raw string) {
+	l.hold(tx, lease{raw: raw})
+}
+
+func (l *leases) take(tx *msg.Tx) (raw string, ok bool) {
+	v, ok := l.release(tx)
+	return v.raw, ok
+}
+
+func (l *leases) hold(tx *msg.Tx, v lease) {
+	l.Lock()
+	defer l.Unlock()
+	if l.items == nil {
+		l.items = map[*msg.Tx]lease{}
+	}
+	l.items[tx] = v
+}
+
+func (l *leases) release(tx *msg.Tx) (v lease, ok bool) {
+	l.Lock()
+	defer l.Unlock()
+	v, ok = l.items[tx]
+	if ok {
+		delete(l.items, tx)
+	}
+	return
+}
+
+// Default consumer name of the running instance
+func ConsumerName() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+// RedisReliableTxBus delivers txs at least once: a popped tx stays in the consumer in-flight set until
+// it's acked, and will be put back to the queue if not acked before the visibility timeout.
+type RedisReliableTxBus struct {
+	*RedisTxBus
+	consumer string
+	timeout  time.Duration
+	leases   leases
+	mu       sync.Mutex
+	reaped   time.Time
+}
+
+func NewRedisReliableTxBus(bus *RedisTxBus, consumer string, timeout time.Duration) *RedisReliableTxBus {
+	if consumer == "" {
+		consumer = ConsumerName()
+	}
+	if timeout == 0 {
+		timeout = DEFAULT_VISIBILITY_TIMEOUT
+	}
+	return &RedisReliableTxBus{RedisTxBus: bus, consumer: consumer, timeout: timeout}
+}
+
+func (b *RedisReliableTxBus) inflightKey() string {
+	return fmt.Sprintf("%s:inflight:%s", b.Key.Key(), b.consumer)
+}
+
+func (b *RedisReliableTxBus) consumersKey() string {
+	return fmt.Sprintf("%s:consumers", b.Key.Key())
+}
+
+func (b *RedisReliableTxBus) Pop(ctx context.Context) (*msg.Tx, error) {
+	return b.PopTimed(ctx, 0)
+}
+
+// PopTimed moves the queue head into the in-flight set. The move is a lua script as the in-flight member is scored
+// by the visibility deadline, so the empty queue is polled every POLL_INTERVAL: blocking commands can not run in
+// scripts, BLMOVE requires redis 6.2, and BRPOPLPUSH pops the tail while the queue is consumed from the head by the
+// plain bus. Polling costs one script call per idle consumer per interval. Expired in-flight txs are reaped inline,
+// at most once per tenth of the visibility timeout.
+func (b *RedisReliableTxBus) PopTimed(ctx context.Context, duration time.Duration) (*msg.Tx, error) {
+	var deadline time.Time
+	if duration > 0 {
+		deadline = time.Now().Add(duration)
+	}
+	for {
+		b.reap(ctx)
+		expiry := time.Now().Add(b.timeout).UnixNano() / int64(time.Millisecond)
+		id := newLeaseId()
+		res, err := popInflight.Run(ctx, b.db, []string{b.Key.Key(), b.inflightKey(), b.consumersKey()}, expiry, id).Result()
+		if err != nil && err != redis.Nil {
+			return nil, fmt.Errorf("Failed to pop message %v", err)
+		}
+		if raw, ok := res.(string); ok && raw != "" {
+			tx := new(msg.Tx)
+			err = tx.Decode(raw)
+			if err != nil {
+				return nil, err
+			}
+			b.leases.hold(tx, lease{raw: raw, id: id})
+			return tx, nil
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return nil, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(POLL_INTERVAL):
+		}
+	}
+}
+
+// Ack removes the tx from the in-flight set, and its index which is kept till then
+func (b *RedisReliableTxBus) Ack(ctx context.Context, tx *msg.Tx) error {
+	l, ok := b.leases.release(tx)
+	if !ok {
+		return nil
+	}
+	n, err := b.db.ZRem(ctx, b.inflightKey(), l.member()).Result()
+	if err != nil {
+		b.leases.hold(tx, l)
+		return fmt.Errorf("Failed to ack message %v", err)
+	}
+	if n == 0 {
+		log.Warn("Acked tx was already put back for visibility timeout", "key", b.Key.Key(), "poly_hash", tx.PolyHash, "src_hash", tx.SrcHash)
+		return nil
+	}
+	b.unindex(ctx, l.raw, tx)
+	return nil
+}
+
+func (b *RedisReliableTxBus) reap(ctx context.Context) {
+	b.mu.Lock()
+	if time.Since(b.reaped) < b.timeout/10 {
+		b.mu.Unlock()
+		return
+	}
+	b.reaped = time.Now()
+	b.mu.Unlock()
+	_, err := b.Reap(ctx)
+	if err != nil {
+		log.Error("Failed to reap in-flight txs", "key", b.Key.Key(), "err", err)
+	}
+}
+
+// Reap puts the expired in-flight txs of all the consumers back to the queue
+func (b *RedisReliableTxBus) Reap(ctx context.Context) (count int64, err error) {
+	keys, err := b.db.SMembers(ctx, b.consumersKey()).Result()
+	if err != nil {
+		return
+	}
+	now := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+	for _, key := range keys {
+		n, err := reapInflight.Run(ctx, b.db, []string{key, b.Key.Key(), listReplacedKey(b.Key.Key())}, now, leaseIdSize).Int64()
+		if err != nil {
+			return count, err
+		}
+		if n > 0 {
+			log.Warn("Put back in-flight txs for visibility timeout", "key", key, "count", n)
+		}
+		count += n
+	}
+	return
+}
+
+// Inflight returns the in-flight tx count of the consumer
+func (b *RedisReliableTxBus) Inflight(ctx context.Context) (uint64, error) {
+	v, err := b.db.ZCard(ctx, b.inflightKey()).Result()
+	if err != nil {
+		return 0, fmt.Errorf("Get in-flight tx count error %v", err)
+	}
+	return uint64(v), nil
+}
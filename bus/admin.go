@@ -0,0 +1,451 @@
+/*
+ * Copyright (C) 2021 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package bus
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/polynetwork/bridge-common/util"
+	"github.com/polynetwork/poly-relayer/msg"
+)
+
+type queueKind int
+
+const (
+	QUEUE_LIST queueKind = iota
+	QUEUE_ZSET
+	QUEUE_HASH
+)
+
+// Queue names used by the queue admin commands
+const (
+	QUEUE_TX             = "tx"         // Plain chain tx queue
+	QUEUE_SORTED         = "sorted"     // Chain tx queue sorted by height
+	QUEUE_DELAYED        = "delayed"    // Chain delayed tx queue scored by due time
+	QUEUE_LEGACY_DELAYED = "delayed_tx" // Shared delayed tx queue of early versions
+	QUEUE_PATCH          = "patch"      // Patch tx queue of the chain
+	QUEUE_DLQ            = "dlq"        // Dead letter queue
+	QUEUE_SKIP           = "skip"       // Skipped tx hashes
+)
+
+// Queue is a raw bus key with its data structure
+type Queue struct {
+	Name string
+	Key  string
+	Kind queueKind
+	Raw  bool // Values are plain strings instead of encoded txs
+}
+
+// Raw key of the queue
+type queueKey string
+
+func (k queueKey) Key() string {
+	return string(k)
+}
+
+// Index of the queue entries by the tx idempotency key kept by the bus, empty if not indexed
+func (q Queue) indexKey() string {
+	if q.Name == QUEUE_TX && q.Kind == QUEUE_LIST || q.Name == QUEUE_SORTED && q.Kind == QUEUE_ZSET {
+		return queueIndexKey(queueKey(q.Key))
+	}
+	return ""
+}
+
+// NewQueue returns the bus queue of the name, chain and tx type, with the hash tagged key layout of redis cluster
+func NewQueue(name string, chainId uint64, txType msg.TxType, hashTag bool) (q Queue, err error) {
+	switch name {
+	case QUEUE_TX:
+		q = Queue{name, (&TxQueueKey{chainId, txType, hashTag}).Key(), QUEUE_LIST, false}
+	case QUEUE_SORTED:
+		q = Queue{name, (&SortedTxQueueKey{chainId, txType, hashTag}).Key(), QUEUE_ZSET, false}
+	case QUEUE_DELAYED:
+		q = Queue{name, (&DelayedTxQueueKey{chainId, txType, hashTag}).Key(), QUEUE_ZSET, false}
+	case QUEUE_LEGACY_DELAYED:
+		q = Queue{name, String("delayed_tx").Key(), QUEUE_ZSET, false}
+	case QUEUE_PATCH:
+		q = Queue{name, NewPatchKey(chainId).Key(), QUEUE_LIST, false}
+	case QUEUE_DLQ:
+		q = Queue{name, (&DeadLetterKey{chainId, txType, hashTag}).Key(), QUEUE_HASH, false}
+	case QUEUE_SKIP:
+		q = Queue{name, String("skip_map").Key(), QUEUE_HASH, true}
+	default:
+		err = fmt.Errorf("Unsupported queue %s", name)
+	}
+	return
+}
+
+// TxQueues returns the queues holding the encoded txs of the chains, in-flight txs and stream entries are not
+// included, they are upgraded when decoded.
+func TxQueues(chains []uint64, hashTag bool) (queues []Queue) {
+	q, _ := NewQueue(QUEUE_LEGACY_DELAYED, 0, 0, hashTag)
+	queues = append(queues, q)
+	for _, chain := range chains {
+		for _, name := range []string{QUEUE_TX, QUEUE_SORTED, QUEUE_DELAYED, QUEUE_DLQ} {
+			for _, ty := range []msg.TxType{msg.SRC, msg.POLY} {
+				if name == QUEUE_SORTED && ty == msg.POLY || name == QUEUE_DELAYED && ty == msg.SRC {
+					continue
+				}
+				q, _ = NewQueue(name, chain, ty, hashTag)
+				queues = append(queues, q)
+			}
+		}
+		q, _ = NewQueue(QUEUE_PATCH, chain, 0, hashTag)
+		queues = append(queues, q)
+	}
+	return
+}
+
+// QueueEntry is an item of the raw queue, undecodable txs are kept in the value
+type QueueEntry struct {
+	Index int     `json:"-"`
+	Field string  `json:",omitempty"` // Hash field
+	Score float64 `json:",omitempty"` // Sorted set score
+	Value string  `json:",omitempty"`
+	Tx    *msg.Tx `json:",omitempty"`
+	raw   string
+}
+
+// Match checks the hash against the entry tx hashes and the hash field
+func (e *QueueEntry) Match(hash string) bool {
+	hash = util.LowerHex(hash)
+	if hash == "" {
+		return false
+	}
+	if util.LowerHex(e.Field) == hash {
+		return true
+	}
+	if e.Tx == nil {
+		return false
+	}
+	for _, h := range []string{e.Tx.SrcHash, e.Tx.PolyHash, e.Tx.DstHash} {
+		if util.LowerHex(h) == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// QueueAdmin inspects and modifies the raw bus queues
+type QueueAdmin interface {
+	Len(ctx context.Context, q Queue) (int, error)
+	// Range returns the entries in queue order from the offset, all the rest entries when limit is zero
+	Range(ctx context.Context, q Queue, offset, limit int) ([]*QueueEntry, error)
+	// Add appends to lists, inserts to sorted sets with the entry score and sets the entry field of hashes, the
+	// entries of the same tx queued in the indexed tx and sorted queues are replaced like the bus pushes
+	Add(ctx context.Context, q Queue, entries ...*QueueEntry) error
+	Remove(ctx context.Context, q Queue, entry *QueueEntry) (bool, error)
+	Rescore(ctx context.Context, q Queue, entry *QueueEntry, score float64) (bool, error)
+}
+
+func decodeEntry(q Queue, e *QueueEntry) *QueueEntry {
+	if q.Raw {
+		e.Value = e.raw
+		return e
+	}
+	tx := new(msg.Tx)
+	if err := tx.Decode(e.raw); err != nil {
+		e.Value = e.raw
+	} else {
+		e.Tx = tx
+	}
+	return e
+}
+
+// Idempotency key of the entry tx, empty if not decoded
+func entryId(e *QueueEntry) string {
+	if e.Tx == nil {
+		return ""
+	}
+	return e.Tx.IdempotencyKey()
+}
+
+func encodeEntry(c *msg.Codec, q Queue, e *QueueEntry) (field, value string, err error) {
+	field, value = e.Field, e.Value
+	if e.Tx != nil {
+		value = c.Encode(e.Tx)
+		if field == "" {
+			field = DeadLetterId(e.Tx)
+		}
+	}
+	if q.Kind == QUEUE_HASH && field == "" {
+		err = fmt.Errorf("Missing hash field of queue entry for %s", q.Key)
+	}
+	return
+}
+
+func page(size, offset, limit int) (start, end int) {
+	if offset > size {
+		offset = size
+	}
+	end = size
+	if limit > 0 && offset+limit < size {
+		end = offset + limit
+	}
+	return offset, end
+}
+
+func sortedFields(fields map[string]string) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type RedisQueueAdmin struct {
+	db    redis.UniversalClient
+	codec *msg.Codec
+}
+
+func NewRedisQueueAdmin(db redis.UniversalClient) *RedisQueueAdmin {
+	return &RedisQueueAdmin{db: db}
+}
+
+func (a *RedisQueueAdmin) Len(ctx context.Context, q Queue) (size int, err error) {
+	var v int64
+	switch q.Kind {
+	case QUEUE_LIST:
+		v, err = a.db.LLen(ctx, q.Key).Result()
+	case QUEUE_ZSET:
+		v, err = a.db.ZCard(ctx, q.Key).Result()
+	case QUEUE_HASH:
+		v, err = a.db.HLen(ctx, q.Key).Result()
+	}
+	if err != nil {
+		return 0, fmt.Errorf("Failed to get queue %s length %v", q.Key, err)
+	}
+	return int(v), nil
+}
+
+func (a *RedisQueueAdmin) Range(ctx context.Context, q Queue, offset, limit int) (entries []*QueueEntry, err error) {
+	stop := int64(-1)
+	if limit > 0 {
+		stop = int64(offset + limit - 1)
+	}
+	switch q.Kind {
+	case QUEUE_LIST:
+		var items []string
+		items, err = a.db.LRange(ctx, q.Key, int64(offset), stop).Result()
+		for i, item := range items {
+			entries = append(entries, decodeEntry(q, &QueueEntry{Index: offset + i, raw: item}))
+		}
+	case QUEUE_ZSET:
+		var items []redis.Z
+		items, err = a.db.ZRangeWithScores(ctx, q.Key, int64(offset), stop).Result()
+		for i, item := range items {
+			entries = append(entries, decodeEntry(q, &QueueEntry{Index: offset + i, Score: item.Score, raw: fmt.Sprint(item.Member)}))
+		}
+	case QUEUE_HASH:
+		var fields map[string]string
+		fields, err = a.db.HGetAll(ctx, q.Key).Result()
+		keys := sortedFields(fields)
+		start, end := page(len(keys), offset, limit)
+		for i := start; i < end; i++ {
+			entries = append(entries, decodeEntry(q, &QueueEntry{Index: i, Field: keys[i], raw: fields[keys[i]]}))
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read queue %s %v", q.Key, err)
+	}
+	return
+}
+
+func (a *RedisQueueAdmin) Add(ctx context.Context, q Queue, entries ...*QueueEntry) (err error) {
+	for _, e := range entries {
+		field, value, err := encodeEntry(a.codec, q, e)
+		if err != nil {
+			return err
+		}
+		// Indexed queues are updated the same way as the bus pushes, replacing the entry of the same tx
+		index := q.indexKey()
+		switch {
+		case q.Kind == QUEUE_LIST && index != "":
+			err = pushList.Run(ctx, a.db, []string{q.Key, index, listReplacedKey(q.Key)}, value, entryId(e), "0").Err()
+		case q.Kind == QUEUE_LIST:
+			err = a.db.RPush(ctx, q.Key, value).Err()
+		case q.Kind == QUEUE_ZSET && index != "":
+			sorted := &RedisSortedTxBus{Key: queueKey(q.Key)}
+			err = pushSorted.Run(ctx, a.db, sorted.keys(), e.Score, value, entryId(e), "", "").Err()
+		case q.Kind == QUEUE_ZSET:
+			err = a.db.ZAdd(ctx, q.Key, &redis.Z{Score: e.Score, Member: value}).Err()
+		case q.Kind == QUEUE_HASH:
+			err = a.db.HSet(ctx, q.Key, field, value).Err()
+		}
+		if err != nil && err != redis.Nil {
+			return fmt.Errorf("Failed to add entry to queue %s %v", q.Key, err)
+		}
+	}
+	return
+}
+
+func (a *RedisQueueAdmin) Remove(ctx context.Context, q Queue, e *QueueEntry) (ok bool, err error) {
+	var n int64
+	index := q.indexKey()
+	switch {
+	case q.Kind == QUEUE_LIST:
+		n, err = a.db.LRem(ctx, q.Key, 1, e.raw).Result()
+		if err == nil && n > 0 && index != "" && entryId(e) != "" {
+			err = unindexTx.Run(ctx, a.db, []string{index, listReplacedKey(q.Key)}, e.raw, entryId(e)).Err()
+		}
+	case q.Kind == QUEUE_ZSET && index != "":
+		sorted := &RedisSortedTxBus{Key: queueKey(q.Key)}
+		n, err = dropSorted.Run(ctx, a.db, sorted.keys(), e.raw, entryId(e), "").Int64()
+	case q.Kind == QUEUE_ZSET:
+		n, err = a.db.ZRem(ctx, q.Key, e.raw).Result()
+	case q.Kind == QUEUE_HASH:
+		n, err = a.db.HDel(ctx, q.Key, e.Field).Result()
+	}
+	if err != nil {
+		return false, fmt.Errorf("Failed to remove entry from queue %s %v", q.Key, err)
+	}
+	return n > 0, nil
+}
+
+func (a *RedisQueueAdmin) Rescore(ctx context.Context, q Queue, e *QueueEntry, score float64) (ok bool, err error) {
+	if q.Kind != QUEUE_ZSET {
+		return false, fmt.Errorf("Queue %s is not sorted", q.Key)
+	}
+	err = a.db.ZScore(ctx, q.Key, e.raw).Err()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err == nil {
+		err = a.db.ZAddXX(ctx, q.Key, &redis.Z{Score: score, Member: e.raw}).Err()
+	}
+	if err != nil {
+		return false, fmt.Errorf("Failed to rescore entry of queue %s %v", q.Key, err)
+	}
+	return true, nil
+}
+
+type StoreQueueAdmin struct {
+	store Store
+	codec *msg.Codec
+}
+
+func NewStoreQueueAdmin(store Store) *StoreQueueAdmin {
+	return &StoreQueueAdmin{store: store}
+}
+
+func (a *StoreQueueAdmin) Len(ctx context.Context, q Queue) (size int, err error) {
+	err = a.store.View(func(tx StoreTx) error {
+		switch q.Kind {
+		case QUEUE_LIST:
+			size = tx.LLen(q.Key)
+		case QUEUE_ZSET:
+			size = tx.ZCard(q.Key)
+		case QUEUE_HASH:
+			size = len(tx.HGetAll(q.Key))
+		}
+		return nil
+	})
+	return
+}
+
+func (a *StoreQueueAdmin) Range(ctx context.Context, q Queue, offset, limit int) (entries []*QueueEntry, err error) {
+	err = a.store.View(func(tx StoreTx) error {
+		switch q.Kind {
+		case QUEUE_LIST:
+			items := tx.LRange(q.Key)
+			start, end := page(len(items), offset, limit)
+			for i := start; i < end; i++ {
+				entries = append(entries, &QueueEntry{Index: i, raw: items[i]})
+			}
+		case QUEUE_ZSET:
+			items := tx.ZRangeByScore(q.Key, math.Inf(-1), math.Inf(1), 0)
+			start, end := page(len(items), offset, limit)
+			for i := start; i < end; i++ {
+				entries = append(entries, &QueueEntry{Index: i, Score: items[i].Score, raw: items[i].Member})
+			}
+		case QUEUE_HASH:
+			fields := tx.HGetAll(q.Key)
+			keys := sortedFields(fields)
+			start, end := page(len(keys), offset, limit)
+			for i := start; i < end; i++ {
+				entries = append(entries, &QueueEntry{Index: i, Field: keys[i], raw: fields[keys[i]]})
+			}
+		}
+		return nil
+	})
+	for _, e := range entries {
+		decodeEntry(q, e)
+	}
+	return
+}
+
+func (a *StoreQueueAdmin) Add(ctx context.Context, q Queue, entries ...*QueueEntry) error {
+	return a.store.Update(func(tx StoreTx) error {
+		for _, e := range entries {
+			field, value, err := encodeEntry(a.codec, q, e)
+			if err != nil {
+				return err
+			}
+			index := q.indexKey()
+			switch {
+			case q.Kind == QUEUE_LIST:
+				pushStoreList(tx, q.Key, index, value, entryId(e), false)
+			case q.Kind == QUEUE_ZSET && index != "":
+				(&StoreSortedTxBus{Key: queueKey(q.Key)}).push(tx, value, entryId(e), e.Score, nil)
+			case q.Kind == QUEUE_ZSET:
+				tx.ZAdd(q.Key, value, e.Score)
+			case q.Kind == QUEUE_HASH:
+				tx.HSet(q.Key, field, value)
+			}
+		}
+		return nil
+	})
+}
+
+func (a *StoreQueueAdmin) Remove(ctx context.Context, q Queue, e *QueueEntry) (ok bool, err error) {
+	err = a.store.Update(func(tx StoreTx) error {
+		index := q.indexKey()
+		switch {
+		case q.Kind == QUEUE_LIST:
+			ok = lrem(tx, q.Key, e.raw)
+			if ok {
+				unindexStore(tx, q.Key, index, e.raw, entryId(e))
+			}
+		case q.Kind == QUEUE_ZSET && index != "":
+			ok = (&StoreSortedTxBus{Key: queueKey(q.Key)}).drop(tx, e.raw, entryId(e))
+		case q.Kind == QUEUE_ZSET:
+			ok = tx.ZRem(q.Key, e.raw) > 0
+		case q.Kind == QUEUE_HASH:
+			ok = tx.HDel(q.Key, e.Field) > 0
+		}
+		return nil
+	})
+	return
+}
+
+func (a *StoreQueueAdmin) Rescore(ctx context.Context, q Queue, e *QueueEntry, score float64) (ok bool, err error) {
+	if q.Kind != QUEUE_ZSET {
+		return false, fmt.Errorf("Queue %s is not sorted", q.Key)
+	}
+	err = a.store.Update(func(tx StoreTx) error {
+		if _, ok = tx.ZScore(q.Key, e.raw); ok {
+			tx.ZAdd(q.Key, e.raw, score)
+		}
+		return nil
+	})
+	return
+}
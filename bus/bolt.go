@@ -0,0 +1,405 @@
+/*
+ * Copyright (C) 2021 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package bus
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	boltLists     = []byte("lists")
+	boltListMetas = []byte("list_metas")
+	boltZSets     = []byte("zsets")
+	boltHashes    = []byte("hashes")
+	boltValues    = []byte("values")
+
+	boltMembers = []byte("m")
+	boltScores  = []byte("s")
+)
+
+// List element indexes start from the middle of uint64, so that both sides can grow
+const boltListOrigin = uint64(1) << 62
+
+// BoltStore persists the bus data in an embedded bbolt database file. The file is locked exclusively by the
+// process holding it open, so the commands on the bus can not run along with the relayer using it.
+type BoltStore struct {
+	notifier
+	db *bolt.DB
+}
+
+func NewBoltStore(path string) (s *BoltStore, err error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("Bolt db %s is locked by another process, e.g. the running relayer, stop it to access the bus", path)
+	} else if err != nil {
+		return nil, fmt.Errorf("Failed to open bolt db %s %v", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltLists, boltListMetas, boltZSets, boltHashes, boltValues} {
+			_, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Failed to init bolt db %s %v", path, err)
+	}
+	return &BoltStore{db: db}, nil
+}
+
+func (s *BoltStore) View(f func(StoreTx) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		t := &boltTx{tx: tx}
+		err := f(t)
+		if err == nil {
+			err = t.err
+		}
+		return err
+	})
+}
+
+func (s *BoltStore) Update(f func(StoreTx) error) error {
+	t := &boltTx{dirty: map[string]bool{}}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		t.tx = tx
+		err := f(t)
+		if err == nil {
+			err = t.err
+		}
+		return err
+	})
+	if err == nil {
+		s.Notify(t.dirty)
+	}
+	return err
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// boltTx keeps the first error of the operations, which fails the whole transaction
+type boltTx struct {
+	tx    *bolt.Tx
+	dirty map[string]bool
+	err   error
+}
+
+func (t *boltTx) fail(err error) {
+	if err != nil && t.err == nil {
+		t.err = err
+	}
+}
+
+func (t *boltTx) touch(key string) {
+	if t.dirty != nil {
+		t.dirty[key] = true
+	}
+}
+
+// Get the sub bucket of the key, create it when required
+func (t *boltTx) bucket(root []byte, key string, create bool) *bolt.Bucket {
+	b := t.tx.Bucket(root)
+	if b == nil {
+		t.fail(fmt.Errorf("Bolt bucket %s missing", root))
+		return nil
+	}
+	if !create {
+		return b.Bucket([]byte(key))
+	}
+	sub, err := b.CreateBucketIfNotExists([]byte(key))
+	t.fail(err)
+	return sub
+}
+
+func uint64Bytes(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func (t *boltTx) listMeta(key string) (head, tail uint64) {
+	v := t.tx.Bucket(boltListMetas).Get([]byte(key))
+	if len(v) != 16 {
+		return boltListOrigin, boltListOrigin
+	}
+	return binary.BigEndian.Uint64(v[:8]), binary.BigEndian.Uint64(v[8:])
+}
+
+func (t *boltTx) setListMeta(key string, head, tail uint64) {
+	t.fail(t.tx.Bucket(boltListMetas).Put([]byte(key), append(uint64Bytes(head), uint64Bytes(tail)...)))
+}
+
+func (t *boltTx) LPush(key string, values ...string) {
+	b := t.bucket(boltLists, key, true)
+	if b == nil {
+		return
+	}
+	t.touch(key)
+	head, tail := t.listMeta(key)
+	for _, v := range values {
+		head--
+		t.fail(b.Put(uint64Bytes(head), []byte(v)))
+	}
+	t.setListMeta(key, head, tail)
+}
+
+func (t *boltTx) RPush(key string, values ...string) {
+	b := t.bucket(boltLists, key, true)
+	if b == nil {
+		return
+	}
+	t.touch(key)
+	head, tail := t.listMeta(key)
+	for _, v := range values {
+		t.fail(b.Put(uint64Bytes(tail), []byte(v)))
+		tail++
+	}
+	t.setListMeta(key, head, tail)
+}
+
+func (t *boltTx) LPop(key string) (value string, ok bool) {
+	head, tail := t.listMeta(key)
+	if head >= tail {
+		return
+	}
+	b := t.bucket(boltLists, key, false)
+	if b == nil {
+		return
+	}
+	k := uint64Bytes(head)
+	value, ok = string(b.Get(k)), true
+	t.touch(key)
+	t.fail(b.Delete(k))
+	t.setListMeta(key, head+1, tail)
+	return
+}
+
+func (t *boltTx) LRange(key string) (values []string) {
+	b := t.bucket(boltLists, key, false)
+	if b == nil {
+		return
+	}
+	b.ForEach(func(k, v []byte) error {
+		values = append(values, string(v))
+		return nil
+	})
+	return
+}
+
+func (t *boltTx) LLen(key string) int {
+	head, tail := t.listMeta(key)
+	return int(tail - head)
+}
+
+// Encode the score to keep the float order in bytes comparison
+func encodeScore(score float64) []byte {
+	bits := math.Float64bits(score)
+	if bits&(1<<63) != 0 {
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+	return uint64Bytes(bits)
+}
+
+func decodeScore(b []byte) float64 {
+	bits := binary.BigEndian.Uint64(b)
+	if bits&(1<<63) != 0 {
+		bits &^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return math.Float64frombits(bits)
+}
+
+func (t *boltTx) zset(key string, create bool) (members, scores *bolt.Bucket) {
+	b := t.bucket(boltZSets, key, create)
+	if b == nil {
+		return
+	}
+	if !create {
+		return b.Bucket(boltMembers), b.Bucket(boltScores)
+	}
+	members, err := b.CreateBucketIfNotExists(boltMembers)
+	t.fail(err)
+	scores, err = b.CreateBucketIfNotExists(boltScores)
+	t.fail(err)
+	return
+}
+
+func (t *boltTx) ZAdd(key, member string, score float64) {
+	members, scores := t.zset(key, true)
+	if members == nil || scores == nil {
+		return
+	}
+	t.touch(key)
+	if v := members.Get([]byte(member)); v != nil {
+		t.fail(scores.Delete(append(append([]byte{}, v...), member...)))
+	}
+	s := encodeScore(score)
+	t.fail(members.Put([]byte(member), s))
+	t.fail(scores.Put(append(s, member...), nil))
+}
+
+func (t *boltTx) ZScore(key, member string) (score float64, ok bool) {
+	members, _ := t.zset(key, false)
+	if members == nil {
+		return
+	}
+	v := members.Get([]byte(member))
+	if v == nil {
+		return
+	}
+	return decodeScore(v), true
+}
+
+func (t *boltTx) ZRem(key string, members ...string) (count int) {
+	m, s := t.zset(key, false)
+	if m == nil || s == nil {
+		return
+	}
+	for _, member := range members {
+		v := m.Get([]byte(member))
+		if v == nil {
+			continue
+		}
+		t.touch(key)
+		t.fail(s.Delete(append(append([]byte{}, v...), member...)))
+		t.fail(m.Delete([]byte(member)))
+		count++
+	}
+	return
+}
+
+func (t *boltTx) ZRangeByScore(key string, min, max float64, limit int) (items []Z) {
+	_, scores := t.zset(key, false)
+	if scores == nil {
+		return
+	}
+	c := scores.Cursor()
+	for k, _ := c.Seek(encodeScore(min)); k != nil; k, _ = c.Next() {
+		score := decodeScore(k[:8])
+		if score > max {
+			break
+		}
+		items = append(items, Z{Member: string(k[8:]), Score: score})
+		if limit > 0 && len(items) >= limit {
+			break
+		}
+	}
+	return
+}
+
+func (t *boltTx) ZCard(key string) int {
+	members, _ := t.zset(key, false)
+	if members == nil {
+		return 0
+	}
+	return members.Stats().KeyN
+}
+
+func (t *boltTx) HSet(key, field, value string) {
+	b := t.bucket(boltHashes, key, true)
+	if b == nil {
+		return
+	}
+	t.touch(key)
+	t.fail(b.Put([]byte(field), []byte(value)))
+}
+
+func (t *boltTx) HGet(key, field string) (value string, ok bool) {
+	b := t.bucket(boltHashes, key, false)
+	if b == nil {
+		return
+	}
+	v := b.Get([]byte(field))
+	if v == nil {
+		return
+	}
+	return string(v), true
+}
+
+func (t *boltTx) HDel(key string, fields ...string) (count int) {
+	b := t.bucket(boltHashes, key, false)
+	if b == nil {
+		return
+	}
+	for _, field := range fields {
+		if b.Get([]byte(field)) == nil {
+			continue
+		}
+		t.touch(key)
+		t.fail(b.Delete([]byte(field)))
+		count++
+	}
+	return
+}
+
+func (t *boltTx) HGetAll(key string) map[string]string {
+	res := map[string]string{}
+	b := t.bucket(boltHashes, key, false)
+	if b == nil {
+		return res
+	}
+	b.ForEach(func(k, v []byte) error {
+		res[string(k)] = string(v)
+		return nil
+	})
+	return res
+}
+
+func (t *boltTx) Set(key, value string, ttl time.Duration) {
+	expiry := uint64(0)
+	if ttl > 0 {
+		expiry = uint64(time.Now().Add(ttl).UnixNano())
+	}
+	t.touch(key)
+	t.fail(t.tx.Bucket(boltValues).Put([]byte(key), append(uint64Bytes(expiry), value...)))
+}
+
+func (t *boltTx) Get(key string) (string, bool) {
+	v := t.tx.Bucket(boltValues).Get([]byte(key))
+	if len(v) < 8 {
+		return "", false
+	}
+	expiry := binary.BigEndian.Uint64(v[:8])
+	if expiry > 0 && expiry < uint64(time.Now().UnixNano()) {
+		return "", false
+	}
+	return string(v[8:]), true
+}
+
+func (t *boltTx) Del(key string) bool {
+	b := t.tx.Bucket(boltValues)
+	if b.Get([]byte(key)) == nil {
+		return false
+	}
+	t.touch(key)
+	t.fail(b.Delete([]byte(key)))
+	return true
+}
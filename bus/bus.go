@@ -43,13 +43,34 @@ func NewPatchKey(chainId uint64) String {
 	return String(fmt.Sprintf("patch:%d", chainId))
 }
 
+// Hash tag the chain queue keys of the redis cluster clients, so that the keys of the same chain queue,
+// e.g. the queue and its in-flight set, stay in one slot for the multi-key operations.
+func queueSlot(chainId uint64, txType msg.TxType, hashTag bool) string {
+	if hashTag {
+		return fmt.Sprintf("{%v:%v}", chainId, txType)
+	}
+	return fmt.Sprintf("%v:%v", chainId, txType)
+}
+
+// Check whether the keys are hash tagged for the redis client
+func isCluster(db redis.UniversalClient) bool {
+	_, ok := db.(*redis.ClusterClient)
+	return ok
+}
+
+// HashTag returns whether the queue keys of the bus config are hash tagged
+func HashTag(conf *config.BusConfig) bool {
+	return isRedis(conf) && conf.Config != nil && conf.Config.Cluster
+}
+
 type TxQueueKey struct {
 	ChainId uint64
 	TxType  msg.TxType
+	HashTag bool // Redis cluster key layout
 }
 
 func (k *TxQueueKey) Key() string {
-	return fmt.Sprintf("%s:relayer:bus:%v:%v", base.ENV, k.ChainId, k.TxType)
+	return fmt.Sprintf("%s:relayer:bus:%s", base.ENV, queueSlot(k.ChainId, k.TxType, k.HashTag))
 }
 
 func GetQueue(tx *msg.Tx) *TxQueueKey {
@@ -59,6 +80,61 @@ func GetQueue(tx *msg.Tx) *TxQueueKey {
 	}
 }
 
+// Target queue of the tx with the key layout of the redis client
+func queueOf(db redis.UniversalClient, tx *msg.Tx) *TxQueueKey {
+	key := GetQueue(tx)
+	key.HashTag = isCluster(db)
+	return key
+}
+
+// Hash of the queue entries by the tx idempotency key, re-pushed txs replace the indexed entries
+func queueIndexKey(key Key) string {
+	return fmt.Sprintf("%s:index", key.Key())
+}
+
+// Index of the chain list queue, the patch queues are filled by the operators and not indexed
+func listIndexKey(key Key) string {
+	if _, ok := key.(*TxQueueKey); ok {
+		return queueIndexKey(key)
+	}
+	return ""
+}
+
+// Hash of the indexed entries replaced by re-pushes after they left the list, e.g. in-flight in the reliable bus,
+// to their idempotency keys. The replaced in-flight entries are dropped instead of put back on the visibility timeout.
+func listReplacedKey(key string) string {
+	return fmt.Sprintf("%s:replaced", key)
+}
+
+// Push the tx and remove the queued entry of the same idempotency key, the entry is marked replaced if it already
+// left the queue.
+// KEYS: queue, index, replaced; ARGV: member, idempotency key, push to head
+var pushList = redis.NewScript(`
+if ARGV[2] ~= '' then
+	local old = redis.call('HGET', KEYS[2], ARGV[2])
+	if old and redis.call('LREM', KEYS[1], 1, old) == 0 then
+		redis.call('HSET', KEYS[3], old, ARGV[2])
+	end
+	redis.call('HSET', KEYS[2], ARGV[2], ARGV[1])
+end
+if ARGV[3] == '1' then
+	return redis.call('LPUSH', KEYS[1], ARGV[1])
+end
+return redis.call('RPUSH', KEYS[1], ARGV[1])
+`)
+
+// Remove the index of the popped entry if not replaced yet, and its replaced mark if any
+// KEYS: index, replaced(optional); ARGV: member, idempotency key
+var unindexTx = redis.NewScript(`
+if KEYS[2] then
+	redis.call('HDEL', KEYS[2], ARGV[1])
+end
+if redis.call('HGET', KEYS[1], ARGV[2]) == ARGV[1] then
+	return redis.call('HDEL', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
 type Bus interface {
 	Pop() (msg.Message, error)
 	Push(msg.Message) error
@@ -74,24 +150,26 @@ type TxBus interface {
 	PushBack(context.Context, *msg.Tx) error
 	Len(context.Context) (uint64, error)
 	LenOf(context.Context, uint64, msg.TxType) (uint64, error)
+	Ack(context.Context, *msg.Tx) error
 	Topic() string
 }
 
 type RedisTxBus struct {
 	Key
-	db *redis.Client
+	db    redis.UniversalClient
+	codec *msg.Codec
 }
 
-func NewRedisTxBus(db *redis.Client, chainId uint64, txType msg.TxType) *RedisTxBus {
+func NewRedisTxBus(db redis.UniversalClient, chainId uint64, txType msg.TxType) *RedisTxBus {
 	bus := &RedisTxBus{
 		db:  db,
-		Key: &TxQueueKey{ChainId: chainId, TxType: txType},
+		Key: &TxQueueKey{ChainId: chainId, TxType: txType, HashTag: isCluster(db)},
 	}
 	return bus
 }
 
-func NewRedisPatchTxBus(db *redis.Client, chainId uint64) *RedisTxBus {
-	return &RedisTxBus{NewPatchKey(chainId), db}
+func NewRedisPatchTxBus(db redis.UniversalClient, chainId uint64) *RedisTxBus {
+	return &RedisTxBus{Key: NewPatchKey(chainId), db: db}
 }
 
 func (b *RedisTxBus) Topic() (topic string) {
@@ -103,7 +181,31 @@ func (b *RedisTxBus) Pop(ctx context.Context) (*msg.Tx, error) {
 }
 
 func (b *RedisTxBus) PopTimed(ctx context.Context, duration time.Duration) (*msg.Tx, error) {
-	res, err := b.db.BLPop(ctx, duration, b.Key.Key()).Result()
+	var deadline time.Time
+	if duration > 0 {
+		deadline = time.Now().Add(duration)
+	}
+	var (
+		res []string
+		err error
+	)
+	for {
+		// Block in short rounds, a blocking command is not interrupted by the context
+		block := BLOCK_INTERVAL
+		if !deadline.IsZero() {
+			block = time.Until(deadline)
+			if block <= 0 {
+				return nil, nil
+			}
+		}
+		res, err = b.db.BLPop(ctx, block, b.Key.Key()).Result()
+		if err != redis.Nil {
+			break
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
 	if err != nil {
 		return nil, fmt.Errorf("Failed to pop message %v", err)
 	}
@@ -113,42 +215,70 @@ func (b *RedisTxBus) PopTimed(ctx context.Context, duration time.Duration) (*msg
 	}
 	tx := new(msg.Tx)
 	err = tx.Decode(res[1])
+	if err == nil {
+		b.unindex(ctx, res[1], tx)
+	}
 	return tx, err
 }
 
-func (b *RedisTxBus) PushToChain(ctx context.Context, tx *msg.Tx) error {
-	_, err := b.db.RPush(ctx, GetQueue(tx).Key(), tx.Encode()).Result()
-	if err != nil {
+// Remove the index of the tx which left the queue, a failure only lets a later push of the tx keep both entries
+func (b *RedisTxBus) unindex(ctx context.Context, raw string, tx *msg.Tx) {
+	index, id := listIndexKey(b.Key), tx.IdempotencyKey()
+	if index == "" || id == "" {
+		return
+	}
+	err := unindexTx.Run(ctx, b.db, []string{index, listReplacedKey(b.Key.Key())}, raw, id).Err()
+	if err != nil && err != redis.Nil {
+		log.Error("Failed to remove queued tx index", "key", index, "id", id, "err", err)
+	}
+}
+
+// Push the tx to the list, the queued entry of the same tx is replaced
+func (b *RedisTxBus) push(ctx context.Context, key Key, tx *msg.Tx, head bool) error {
+	index, id := listIndexKey(key), tx.IdempotencyKey()
+	var err error
+	if index == "" {
+		value := b.codec.Encode(tx)
+		if head {
+			err = b.db.LPush(ctx, key.Key(), value).Err()
+		} else {
+			err = b.db.RPush(ctx, key.Key(), value).Err()
+		}
+	} else {
+		front := "0"
+		if head {
+			front = "1"
+		}
+		err = pushList.Run(ctx, b.db, []string{key.Key(), index, listReplacedKey(key.Key())}, b.codec.Encode(tx), id, front).Err()
+	}
+	if err != nil && err != redis.Nil {
 		return fmt.Errorf("Failed to push message %v", err)
 	}
 	return nil
 }
 
+func (b *RedisTxBus) PushToChain(ctx context.Context, tx *msg.Tx) error {
+	return b.push(ctx, queueOf(b.db, tx), tx, false)
+}
+
 func (b *RedisTxBus) Patch(ctx context.Context, tx *msg.Tx) (err error) {
 	chain := tx.SrcChainId
 	if tx.Type() == msg.POLY {
 		chain = base.POLY
 	}
-	_, err = b.db.RPush(ctx, NewPatchKey(chain).Key(), tx.Encode()).Result()
-	if err != nil {
-		return fmt.Errorf("Failed to push message %v", err)
-	}
-	return nil
+	return b.push(ctx, NewPatchKey(chain), tx, false)
 }
 
 func (b *RedisTxBus) Push(ctx context.Context, tx *msg.Tx) error {
-	_, err := b.db.RPush(ctx, b.Key.Key(), tx.Encode()).Result()
-	if err != nil {
-		return fmt.Errorf("Failed to push message %v", err)
-	}
-	return nil
+	return b.push(ctx, b.Key, tx, false)
 }
 
 func (b *RedisTxBus) PushBack(ctx context.Context, tx *msg.Tx) error {
-	_, err := b.db.LPush(ctx, GetQueue(tx).Key(), tx.Encode()).Result()
-	if err != nil {
-		return fmt.Errorf("Failed to push message %v", err)
-	}
+	return b.push(ctx, queueOf(b.db, tx), tx, true)
+}
+
+// Plain list queue drops the message once popped, nothing to ack here
+func (b *RedisTxBus) Ack(ctx context.Context, tx *msg.Tx) error {
 	return nil
 }
 
@@ -161,7 +291,7 @@ func (b *RedisTxBus) Len(ctx context.Context) (uint64, error) {
 }
 
 func (b *RedisTxBus) LenOf(ctx context.Context, chain uint64, ty msg.TxType) (uint64, error) {
-	key := &TxQueueKey{chain, ty}
+	key := &TxQueueKey{chain, ty, isCluster(b.db)}
 	v, err := b.db.LLen(ctx, key.Key()).Result()
 	if err != nil {
 		return 0, fmt.Errorf("Get chain tx queue length error %v", err)
@@ -193,6 +323,25 @@ func (b *TxBusWithFilter) Pop(ctx context.Context) (*msg.Tx, uint64, error) {
 	}
 }
 
+func (b *TxBusWithFilter) Claim(ctx context.Context, height uint64) (*msg.Tx, uint64, error) {
+	for {
+		tx, score, err := b.SortedTxBus.Claim(ctx, height)
+		if err != nil || tx == nil {
+			return tx, score, err
+		}
+		if b.filter.Check(tx) {
+			log.Debug("Filter passes tx", "chain", tx.DstChainId, "src_proxy", tx.SrcProxy, "dst_proxy", tx.DstProxy)
+			return tx, score, nil
+		} else {
+			log.Warn("Filter ignores tx", "tx", tx.Encode())
+			err = b.SortedTxBus.Ack(ctx, tx)
+			if err != nil {
+				log.Error("Failed to ack filtered tx", "err", err)
+			}
+		}
+	}
+}
+
 type BusWithFilter struct {
 	TxBus
 	filter *config.FilterConfig
@@ -202,6 +351,10 @@ func WithTxFilter(bus TxBus, filter *config.FilterConfig) *BusWithFilter {
 	return &BusWithFilter{bus, filter}
 }
 
+func (b *BusWithFilter) Consumer(name string) TxBus {
+	return &BusWithFilter{ForConsumer(b.TxBus, name), b.filter}
+}
+
 func (b *BusWithFilter) Pop(ctx context.Context) (*msg.Tx, error) {
 	for {
 		tx, err := b.TxBus.Pop(ctx)
@@ -213,6 +366,10 @@ func (b *BusWithFilter) Pop(ctx context.Context) (*msg.Tx, error) {
 			return tx, nil
 		} else {
 			log.Warn("Filter ignores tx", "tx", tx.Encode())
+			err = b.TxBus.Ack(ctx, tx)
+			if err != nil {
+				log.Error("Failed to ack filtered tx", "err", err)
+			}
 		}
 	}
 }
@@ -24,21 +24,50 @@ import (
 	"time"
 
 	"github.com/go-redis/redis/v8"
+	"github.com/polynetwork/bridge-common/base"
+	"github.com/polynetwork/bridge-common/log"
 	"github.com/polynetwork/poly-relayer/msg"
 )
 
+// Pop the due entries atomically
+var popDue = redis.NewScript(`
+local items = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for i = 1, #items do
+	redis.call('ZREM', KEYS[1], items[i])
+end
+return items
+`)
+
+type DelayedTxQueueKey TxQueueKey
+
+func (k *DelayedTxQueueKey) Key() string {
+	return fmt.Sprintf("%s:relayer:delayed_bus:%s", base.ENV, queueSlot(k.ChainId, k.TxType, k.HashTag))
+}
+
 type DelayedTxBus interface {
 	Delay(context.Context, *msg.Tx, int64) error
-	Pop(context.Context) (*msg.Tx, int64, error)
+	PopDue(context.Context, int64) ([]*msg.Tx, error)
 	Len(context.Context) (uint64, error)
+	Topic() string
 }
 
 type RedisDelayedTxBus struct {
 	Key
-	db *redis.Client
+	db    redis.UniversalClient
+	codec *msg.Codec
 }
 
-func NewRedisDelayedTxBus(db *redis.Client) *RedisDelayedTxBus {
+// Delayed tx queue of the target chain and tx type
+func NewRedisDelayedTxBus(db redis.UniversalClient, chainId uint64, txType msg.TxType) *RedisDelayedTxBus {
+	bus := &RedisDelayedTxBus{
+		db:  db,
+		Key: &DelayedTxQueueKey{ChainId: chainId, TxType: txType, HashTag: isCluster(db)},
+	}
+	return bus
+}
+
+// Shared delayed tx queue of all chains used by early versions, kept to drain the remaining entries
+func NewRedisLegacyDelayedTxBus(db redis.UniversalClient) *RedisDelayedTxBus {
 	bus := &RedisDelayedTxBus{
 		db:  db,
 		Key: String("delayed_tx"),
@@ -50,6 +79,7 @@ func (b *RedisDelayedTxBus) Topic() (topic string) {
 	return b.Key.Key()
 }
 
+// Len returns the count of the due entries
 func (b *RedisDelayedTxBus) Len(ctx context.Context) (uint64, error) {
 	v, err := b.db.ZCount(ctx, b.Key.Key(), "0", strconv.Itoa(int(time.Now().Unix()))).Result()
 	if err != nil {
@@ -62,22 +92,29 @@ func (b *RedisDelayedTxBus) Delay(ctx context.Context, msg *msg.Tx, delay int64)
 	_, err = b.db.ZAdd(ctx, b.Key.Key(),
 		&redis.Z{
 			Score:  float64(delay),
-			Member: msg.Encode(),
+			Member: b.codec.Encode(msg),
 		},
 	).Result()
 	return
 }
 
-func (b *RedisDelayedTxBus) Pop(ctx context.Context) (tx *msg.Tx, score int64, err error) {
-	res, err := b.db.BZPopMin(ctx, 0, b.Key.Key()).Result()
+// PopDue pops at most count entries whose delay timestamp has passed
+func (b *RedisDelayedTxBus) PopDue(ctx context.Context, count int64) (txs []*msg.Tx, err error) {
+	res, err := scriptStrings(popDue.Run(ctx, b.db, []string{b.Key.Key()}, time.Now().Unix(), count))
 	if err != nil {
+		if err == redis.Nil {
+			err = nil
+		}
 		return
 	}
-	if res == nil {
-		return
+	for _, item := range res {
+		tx := new(msg.Tx)
+		e := tx.Decode(item)
+		if e != nil {
+			log.Error("Failed to decode delayed tx", "body", item, "err", e)
+			continue
+		}
+		txs = append(txs, tx)
 	}
-	score = int64(res.Score)
-	tx = new(msg.Tx)
-	err = tx.Decode(res.Member.(string))
 	return
 }
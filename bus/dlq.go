@@ -0,0 +1,207 @@
+/*
+ * Copyright (C) 2021 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package bus
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/polynetwork/bridge-common/base"
+	"github.com/polynetwork/bridge-common/log"
+	"github.com/polynetwork/bridge-common/util"
+	"github.com/polynetwork/poly-relayer/msg"
+)
+
+// Total attempts budget key of RetryBudget
+const RETRY_BUDGET_TOTAL = "*"
+
+type DeadLetterKey TxQueueKey
+
+func (k *DeadLetterKey) Key() string {
+	return fmt.Sprintf("%s:relayer:dlq:%s", base.ENV, queueSlot(k.ChainId, k.TxType, k.HashTag))
+}
+
+// Dead letter entries are indexed by the tx hash of the queue type
+func DeadLetterId(tx *msg.Tx) string {
+	if tx.TxType == msg.SRC {
+		return util.LowerHex(tx.SrcHash)
+	}
+	return util.LowerHex(tx.PolyHash)
+}
+
+type DeadLetterBus interface {
+	Put(context.Context, *msg.Tx) error
+	Get(context.Context, string) (*msg.Tx, error)
+	List(context.Context) ([]*msg.Tx, error)
+	Remove(context.Context, ...string) (int64, error)
+	Len(context.Context) (uint64, error)
+	Topic() string
+}
+
+type RedisDeadLetterBus struct {
+	Key
+	db    redis.UniversalClient
+	codec *msg.Codec
+}
+
+func NewRedisDeadLetterBus(db redis.UniversalClient, chainId uint64, txType msg.TxType) *RedisDeadLetterBus {
+	return &RedisDeadLetterBus{
+		db:  db,
+		Key: &DeadLetterKey{ChainId: chainId, TxType: txType, HashTag: isCluster(db)},
+	}
+}
+
+func (b *RedisDeadLetterBus) Topic() string {
+	return b.Key.Key()
+}
+
+func (b *RedisDeadLetterBus) Put(ctx context.Context, tx *msg.Tx) (err error) {
+	_, err = b.db.HSet(ctx, b.Key.Key(), DeadLetterId(tx), b.codec.Encode(tx)).Result()
+	if err != nil {
+		return fmt.Errorf("Failed to put tx to dead letter queue %v", err)
+	}
+	return
+}
+
+func (b *RedisDeadLetterBus) Get(ctx context.Context, id string) (tx *msg.Tx, err error) {
+	res, err := b.db.HGet(ctx, b.Key.Key(), util.LowerHex(id)).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get dead letter tx %v", err)
+	}
+	tx = new(msg.Tx)
+	err = tx.Decode(res)
+	return
+}
+
+// List all the dead letter txs, sorted by id
+func (b *RedisDeadLetterBus) List(ctx context.Context) (txs []*msg.Tx, err error) {
+	res, err := b.db.HGetAll(ctx, b.Key.Key()).Result()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list dead letter txs %v", err)
+	}
+	ids := make([]string, 0, len(res))
+	for id := range res {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		tx := new(msg.Tx)
+		e := tx.Decode(res[id])
+		if e != nil {
+			log.Error("Failed to decode dead letter tx", "id", id, "err", e)
+			continue
+		}
+		txs = append(txs, tx)
+	}
+	return
+}
+
+func (b *RedisDeadLetterBus) Remove(ctx context.Context, ids ...string) (count int64, err error) {
+	if len(ids) == 0 {
+		return b.db.Del(ctx, b.Key.Key()).Result()
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = util.LowerHex(id)
+	}
+	return b.db.HDel(ctx, b.Key.Key(), keys...).Result()
+}
+
+func (b *RedisDeadLetterBus) Len(ctx context.Context) (uint64, error) {
+	v, err := b.db.HLen(ctx, b.Key.Key()).Result()
+	if err != nil {
+		return 0, fmt.Errorf("Get dead letter queue length error %v", err)
+	}
+	return uint64(v), nil
+}
+
+// RetryBudget limits the failures per error class of a tx, RETRY_BUDGET_TOTAL limits the total attempts.
+// Classes without a budget retry forever.
+type RetryBudget map[string]int
+
+func (b RetryBudget) Exceeded(tx *msg.Tx) bool {
+	if len(b) == 0 {
+		return false
+	}
+	if max, ok := b[RETRY_BUDGET_TOTAL]; ok && max > 0 && tx.Attempts > max {
+		return true
+	}
+	for class, count := range tx.Failures {
+		if max, ok := b[class]; ok && max > 0 && count > max {
+			return true
+		}
+	}
+	return false
+}
+
+func deadLetter(ctx context.Context, dlq DeadLetterBus, tx *msg.Tx) error {
+	log.Warn("Moving tx to dead letter queue for retry budget exceeded", "topic", dlq.Topic(), "poly_hash", tx.PolyHash,
+		"src_hash", tx.SrcHash, "attempts", tx.Attempts, "error_class", tx.ErrorClass, "last_error", tx.LastError)
+	return dlq.Put(ctx, tx)
+}
+
+type DelayedTxBusWithBudget struct {
+	DelayedTxBus
+	dlq    DeadLetterBus
+	budget RetryBudget
+}
+
+// WithRetryBudget moves the txs exceeding the budget to the dead letter queue instead of delaying them
+func WithRetryBudget(bus DelayedTxBus, dlq DeadLetterBus, budget RetryBudget) DelayedTxBus {
+	if len(budget) == 0 {
+		return bus
+	}
+	return &DelayedTxBusWithBudget{bus, dlq, budget}
+}
+
+func (b *DelayedTxBusWithBudget) Delay(ctx context.Context, tx *msg.Tx, delay int64) error {
+	if b.budget.Exceeded(tx) {
+		return deadLetter(ctx, b.dlq, tx)
+	}
+	return b.DelayedTxBus.Delay(ctx, tx, delay)
+}
+
+type SortedTxBusWithBudget struct {
+	SortedTxBus
+	dlq    DeadLetterBus
+	budget RetryBudget
+}
+
+// WithSortedRetryBudget moves the requeued txs exceeding the budget to the dead letter queue
+func WithSortedRetryBudget(bus SortedTxBus, dlq DeadLetterBus, budget RetryBudget) SortedTxBus {
+	if len(budget) == 0 {
+		return bus
+	}
+	return &SortedTxBusWithBudget{bus, dlq, budget}
+}
+
+func (b *SortedTxBusWithBudget) Requeue(ctx context.Context, tx *msg.Tx, height uint64) (err error) {
+	if !b.budget.Exceeded(tx) {
+		return b.SortedTxBus.Requeue(ctx, tx, height)
+	}
+	err = deadLetter(ctx, b.dlq, tx)
+	if err != nil {
+		return
+	}
+	return b.SortedTxBus.Ack(ctx, tx)
+}
@@ -0,0 +1,328 @@
+/*
+ * Copyright (C) 2021 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package bus
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/polynetwork/bridge-common/base"
+	"github.com/polynetwork/bridge-common/log"
+	"github.com/polynetwork/poly-relayer/config"
+	"github.com/polynetwork/poly-relayer/msg"
+)
+
+const (
+	BACKEND_REDIS  = "redis"
+	BACKEND_MEMORY = "memory"
+	BACKEND_BOLT   = "bolt"
+)
+
+var (
+	stores   = map[string]Store{}
+	storesMu sync.Mutex
+)
+
+func backend(conf *config.BusConfig) string {
+	if conf.Backend == "" {
+		return BACKEND_REDIS
+	}
+	return conf.Backend
+}
+
+// CheckConfig validates the bus config and probes the backend if asked, problems are reported with the
+// json path of the setting relative to the bus config.
+func CheckConfig(conf *config.BusConfig, probe bool, report func(path, msg string)) {
+	switch backend(conf) {
+	case BACKEND_REDIS:
+		if conf.Config == nil || (conf.Config.Addr == "" && len(conf.Config.Addrs) == 0) {
+			report("Config.Addr", "redis address is required for redis backend")
+			return
+		}
+		if conf.Config.Cluster && conf.Config.DB != 0 {
+			report("Config.DB", "redis cluster supports only db 0")
+		}
+		if conf.Config.Cluster && conf.Config.MasterName != "" {
+			report("Config.MasterName", "redis sentinel master name can not be used with cluster mode")
+		}
+		if len(conf.Config.Addrs) > 1 && !conf.Config.Cluster && conf.Config.MasterName == "" {
+			report("Config.Addrs", "multiple redis addresses require cluster mode or sentinel master name")
+		}
+	case BACKEND_BOLT:
+		if conf.Path == "" {
+			report("Path", "data file path is required for bolt backend")
+			return
+		}
+	case BACKEND_MEMORY:
+	default:
+		report("Backend", fmt.Sprintf("unsupported backend %s", conf.Backend))
+		return
+	}
+	if _, err := msg.NewCodec(conf.Codec, conf.Compression); err != nil {
+		report("Codec", err.Error())
+	}
+	if !probe {
+		return
+	}
+	if isRedis(conf) {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := New(conf).Ping(ctx).Err(); err != nil {
+			report("Config", fmt.Sprintf("redis is not reachable: %v", err))
+		}
+	} else if _, err := OpenStore(conf); err != nil {
+		report("Path", fmt.Sprintf("failed to open bus store: %v", err))
+	}
+}
+
+// Open the shared store of the bus config, the store is shared across the handlers in the process
+func OpenStore(conf *config.BusConfig) (store Store, err error) {
+	name := backend(conf)
+	key := fmt.Sprintf("%s:%s:%s", name, conf.Snapshot, conf.Path)
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	store, ok := stores[key]
+	if ok {
+		return
+	}
+	switch name {
+	case BACKEND_MEMORY:
+		store, err = NewMemoryStore(conf.Snapshot, time.Duration(conf.SnapshotInterval)*time.Second)
+	case BACKEND_BOLT:
+		if conf.Path == "" {
+			err = fmt.Errorf("Missing data file path for bolt bus backend")
+			break
+		}
+		store, err = NewBoltStore(conf.Path)
+	default:
+		err = fmt.Errorf("Unsupported bus store backend %s", name)
+	}
+	if err == nil {
+		stores[key] = store
+	}
+	return
+}
+
+// Close the opened stores, memory store snapshots are saved and bolt files are released here
+func CloseStores() {
+	storesMu.Lock()
+	defer storesMu.Unlock()
+	for key, store := range stores {
+		err := store.Close()
+		if err != nil {
+			log.Error("Failed to close bus store", "store", key, "err", err)
+		}
+		delete(stores, key)
+	}
+}
+
+func mustOpenStore(conf *config.BusConfig) Store {
+	store, err := OpenStore(conf)
+	if err != nil {
+		log.Fatal("Failed to open bus store", "backend", backend(conf), "err", err)
+	}
+	return store
+}
+
+// CheckShared returns an error when the bus can not be accessed from other processes, e.g. the memory backend
+// which lives in the relayer process only. The bolt store is opened here to fail early with an error when the
+// file is locked by the running relayer, as bolt allows only one process to open the file at a time.
+func CheckShared(conf *config.BusConfig) (err error) {
+	if conf == nil {
+		return fmt.Errorf("Missing bus config")
+	}
+	switch backend(conf) {
+	case BACKEND_MEMORY:
+		err = fmt.Errorf("Bus backend %s lives in the relayer process only, use a redis or bolt backend instead", BACKEND_MEMORY)
+	case BACKEND_BOLT:
+		_, err = OpenStore(conf)
+	}
+	return
+}
+
+func isRedis(conf *config.BusConfig) bool {
+	return backend(conf) == BACKEND_REDIS
+}
+
+func visibilityTimeout(conf *config.BusConfig) time.Duration {
+	return time.Duration(conf.VisibilityTimeout) * time.Second
+}
+
+// Tx codec of the bus config, nil for the default json encoding
+func codec(conf *config.BusConfig) *msg.Codec {
+	c, err := msg.NewCodec(conf.Codec, conf.Compression)
+	if err != nil {
+		log.Fatal("Invalid bus tx codec", "codec", conf.Codec, "compression", conf.Compression, "err", err)
+	}
+	return c
+}
+
+// Create chain tx queue per bus config
+func NewTxBus(conf *config.BusConfig, chainId uint64, txType msg.TxType) TxBus {
+	if !isRedis(conf) {
+		b := NewStoreTxBus(mustOpenStore(conf), chainId, txType)
+		b.codec = codec(conf)
+		if conf.Reliable {
+			b.WithAck(conf.Consumer, visibilityTimeout(conf))
+		}
+		return b
+	}
+	if conf.Stream != nil && txType == msg.POLY {
+		b := NewRedisStreamTxBus(New(conf), chainId, txType, conf.Stream, conf.Consumer, visibilityTimeout(conf))
+		b.codec = codec(conf)
+		b.list.codec = b.codec
+		return b
+	}
+	b := NewRedisTxBus(New(conf), chainId, txType)
+	b.codec = codec(conf)
+	if conf.Reliable {
+		return NewRedisReliableTxBus(b, conf.Consumer, visibilityTimeout(conf))
+	}
+	return b
+}
+
+// Create patch tx queue per bus config
+func NewPatchTxBus(conf *config.BusConfig, chainId uint64) TxBus {
+	if !isRedis(conf) {
+		b := NewStorePatchTxBus(mustOpenStore(conf), chainId)
+		b.codec = codec(conf)
+		if conf.Reliable {
+			b.WithAck(conf.Consumer, visibilityTimeout(conf))
+		}
+		return b
+	}
+	b := NewRedisPatchTxBus(New(conf), chainId)
+	b.codec = codec(conf)
+	if conf.Reliable {
+		return NewRedisReliableTxBus(b, conf.Consumer, visibilityTimeout(conf))
+	}
+	return b
+}
+
+// Create chain sorted tx queue per bus config
+func NewSortedTxBus(conf *config.BusConfig, chainId uint64, txType msg.TxType) SortedTxBus {
+	if !isRedis(conf) {
+		b := NewStoreSortedTxBus(mustOpenStore(conf), chainId, txType)
+		b.timeout = visibilityTimeout(conf)
+		b.codec = codec(conf)
+		return b
+	}
+	b := NewRedisSortedTxBus(New(conf), chainId, txType)
+	b.timeout = visibilityTimeout(conf)
+	b.codec = codec(conf)
+	return b
+}
+
+// Create chain delayed tx queue per bus config
+func NewDelayedTxBus(conf *config.BusConfig, chainId uint64, txType msg.TxType) DelayedTxBus {
+	if !isRedis(conf) {
+		b := NewStoreDelayedTxBus(mustOpenStore(conf), chainId, txType)
+		b.codec = codec(conf)
+		return b
+	}
+	b := NewRedisDelayedTxBus(New(conf), chainId, txType)
+	b.codec = codec(conf)
+	return b
+}
+
+// Create the legacy shared delayed tx queue per bus config
+func NewLegacyDelayedTxBus(conf *config.BusConfig) DelayedTxBus {
+	if !isRedis(conf) {
+		b := NewStoreLegacyDelayedTxBus(mustOpenStore(conf))
+		b.codec = codec(conf)
+		return b
+	}
+	b := NewRedisLegacyDelayedTxBus(New(conf))
+	b.codec = codec(conf)
+	return b
+}
+
+// Create dead letter queue per bus config
+func NewDeadLetterBus(conf *config.BusConfig, chainId uint64, txType msg.TxType) DeadLetterBus {
+	if !isRedis(conf) {
+		b := NewStoreDeadLetterBus(mustOpenStore(conf), chainId, txType)
+		b.codec = codec(conf)
+		return b
+	}
+	b := NewRedisDeadLetterBus(New(conf), chainId, txType)
+	b.codec = codec(conf)
+	return b
+}
+
+// Create chain height store per bus config
+func NewChainStore(conf *config.BusConfig, key Key, interval uint64) ChainStore {
+	if !isRedis(conf) {
+		return NewStoreChainStore(key, mustOpenStore(conf), interval)
+	}
+	return NewRedisChainStore(key, New(conf), interval)
+}
+
+// Create tx skip check per bus config
+func NewSkipCheck(conf *config.BusConfig) SkipCheck {
+	if !isRedis(conf) {
+		return NewStoreSkipCheck(mustOpenStore(conf))
+	}
+	return NewRedisSkipCheck(New(conf))
+}
+
+// Create role status store per bus config
+func NewRoleStatusStore(conf *config.BusConfig) RoleStatusStore {
+	if !isRedis(conf) {
+		return NewStoreRoleStatusStore(mustOpenStore(conf))
+	}
+	return NewRedisRoleStatusStore(New(conf))
+}
+
+// Create nonce store per bus config
+func NewNonceStore(conf *config.BusConfig) NonceStore {
+	if !isRedis(conf) {
+		return NewStoreNonceStore(mustOpenStore(conf))
+	}
+	return NewRedisNonceStore(New(conf))
+}
+
+// Create queue admin per bus config
+func NewQueueAdmin(conf *config.BusConfig) QueueAdmin {
+	if !isRedis(conf) {
+		a := NewStoreQueueAdmin(mustOpenStore(conf))
+		a.codec = codec(conf)
+		return a
+	}
+	a := NewRedisQueueAdmin(New(conf))
+	a.codec = codec(conf)
+	return a
+}
+
+// Create leader election of the singleton role per bus config
+func NewLeader(conf *config.BusConfig, role string) *Leader {
+	ttl := time.Duration(conf.LeaderTTL) * time.Second
+	if !isRedis(conf) {
+		return NewStoreLeader(mustOpenStore(conf), role, ttl)
+	}
+	return NewRedisLeader(New(conf), role, ttl)
+}
+
+// Retry budget per config, testnet drops txs after 1000 attempts by default
+func NewRetryBudget(budget map[string]int) RetryBudget {
+	if budget == nil && base.ENV == "testnet" {
+		return RetryBudget{RETRY_BUDGET_TOTAL: 1000}
+	}
+	return RetryBudget(budget)
+}
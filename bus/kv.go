@@ -0,0 +1,144 @@
+/*
+ * Copyright (C) 2021 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package bus
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Store is a transactional key value store with the redis like data structures used by the buses,
+// it backs the buses when redis is not available.
+type Store interface {
+	View(func(StoreTx) error) error
+	Update(func(StoreTx) error) error
+	// Wait returns a channel which will be closed once the key is updated
+	Wait(key string) <-chan struct{}
+	Close() error
+}
+
+type StoreTx interface {
+	// List
+	LPush(key string, values ...string)
+	RPush(key string, values ...string)
+	LPop(key string) (string, bool)
+	LRange(key string) []string
+	LLen(key string) int
+
+	// Sorted set, members of the same score are ordered by member
+	ZAdd(key, member string, score float64)
+	ZScore(key, member string) (float64, bool)
+	ZRem(key string, members ...string) int
+	ZRangeByScore(key string, min, max float64, limit int) []Z
+	ZCard(key string) int
+
+	// Hash
+	HSet(key, field, value string)
+	HGet(key, field string) (string, bool)
+	HDel(key string, fields ...string) int
+	HGetAll(key string) map[string]string
+
+	// String with optional ttl
+	Set(key, value string, ttl time.Duration)
+	Get(key string) (string, bool)
+	Del(key string) bool
+}
+
+// Remove the first occurrence of the value from the list, rotating the list to keep the order of the rest
+func lrem(t StoreTx, key, value string) (ok bool) {
+	for range t.LRange(key) {
+		v, _ := t.LPop(key)
+		if !ok && v == value {
+			ok = true
+			continue
+		}
+		t.RPush(key, v)
+	}
+	return
+}
+
+type Z struct {
+	Member string
+	Score  float64
+}
+
+func sortZ(items []Z) {
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Score == items[j].Score {
+			return items[i].Member < items[j].Member
+		}
+		return items[i].Score < items[j].Score
+	})
+}
+
+// notifier wakes up the blocking pops waiting on the updated keys
+type notifier struct {
+	sync.Mutex
+	waits map[string]chan struct{}
+}
+
+func (n *notifier) Wait(key string) <-chan struct{} {
+	n.Lock()
+	defer n.Unlock()
+	if n.waits == nil {
+		n.waits = map[string]chan struct{}{}
+	}
+	ch, ok := n.waits[key]
+	if !ok {
+		ch = make(chan struct{})
+		n.waits[key] = ch
+	}
+	return ch
+}
+
+func (n *notifier) Notify(keys map[string]bool) {
+	n.Lock()
+	defer n.Unlock()
+	for key := range keys {
+		if ch, ok := n.waits[key]; ok {
+			close(ch)
+			delete(n.waits, key)
+		}
+	}
+}
+
+// waitStore blocks till the key gets updated, the poll interval elapsed or the deadline reached.
+// It returns false when the deadline is reached or the context is done.
+func waitStore(ctx context.Context, store Store, key string, deadline time.Time) bool {
+	wait := POLL_INTERVAL * 5
+	if !deadline.IsZero() {
+		left := time.Until(deadline)
+		if left <= 0 {
+			return false
+		}
+		if left < wait {
+			wait = left
+		}
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-store.Wait(key):
+	case <-timer.C:
+	}
+	return true
+}
@@ -0,0 +1,501 @@
+/*
+ * Copyright (C) 2021 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package bus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/polynetwork/bridge-common/base"
+	"github.com/polynetwork/bridge-common/log"
+)
+
+const (
+	ROLE_POLY_SYNC   = "poly_sync"
+	ROLE_HEADER_SYNC = "header_sync"
+	ROLE_VALIDATOR   = "validator"
+
+	DEFAULT_LEADER_TTL = 30 * time.Second
+)
+
+var ErrLeadershipLost = fmt.Errorf("Leadership lost")
+
+// Take the leadership if free or already held by the owner, a new fencing token is issued for each term
+var acquireLeader = redis.NewScript(`
+local owner = redis.call('GET', KEYS[1])
+if owner and owner ~= ARGV[1] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return redis.call('INCR', KEYS[2])
+`)
+
+// Extend the leadership only if the owner and the fencing token still match
+var refreshLeader = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] and redis.call('GET', KEYS[2]) == ARGV[3] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// Release the leadership only if held by the owner
+var releaseLeader = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// Singleton role name of the chain
+func ChainRole(role string, chainId uint64) string {
+	return fmt.Sprintf("%s:%d", role, chainId)
+}
+
+type LeaderKey struct {
+	Role    string
+	HashTag bool // Redis cluster key layout
+}
+
+func (k LeaderKey) Key() string {
+	if k.HashTag {
+		return fmt.Sprintf("%s:relayer:leader:{%s}", base.ENV, k.Role)
+	}
+	return fmt.Sprintf("%s:relayer:leader:%s", base.ENV, k.Role)
+}
+
+// Fencing token counter of the role, never expires to keep the tokens increasing across terms
+func (k LeaderKey) fenceKey() string {
+	return k.Key() + ":fence"
+}
+
+// Status reports of the instances campaigning for the role
+func (k LeaderKey) candidatesKey() string {
+	return k.Key() + ":candidates"
+}
+
+// Backend of the leader election
+type leaderStore interface {
+	// Returns the fencing token of the new term, zero if the leadership is held by others
+	acquire(ctx context.Context, owner string, ttl time.Duration) (uint64, error)
+	refresh(ctx context.Context, owner string, token uint64, ttl time.Duration) (bool, error)
+	release(ctx context.Context, owner string) error
+	// Returns the current leader and the latest fencing token
+	leader(ctx context.Context) (string, uint64, error)
+	report(ctx context.Context, owner, status string) error
+	candidates(ctx context.Context) (map[string]string, error)
+	prune(ctx context.Context, owners ...string) error
+}
+
+type redisLeaderStore struct {
+	key LeaderKey
+	db  redis.UniversalClient
+}
+
+func (s *redisLeaderStore) keys() []string {
+	return []string{s.key.Key(), s.key.fenceKey()}
+}
+
+func (s *redisLeaderStore) acquire(ctx context.Context, owner string, ttl time.Duration) (uint64, error) {
+	token, err := acquireLeader.Run(ctx, s.db, s.keys(), owner, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("Failed to acquire leadership %v", err)
+	}
+	return uint64(token), nil
+}
+
+func (s *redisLeaderStore) refresh(ctx context.Context, owner string, token uint64, ttl time.Duration) (bool, error) {
+	ok, err := refreshLeader.Run(ctx, s.db, s.keys(), owner, ttl.Milliseconds(), token).Int64()
+	if err != nil {
+		return false, fmt.Errorf("Failed to refresh leadership %v", err)
+	}
+	return ok == 1, nil
+}
+
+func (s *redisLeaderStore) release(ctx context.Context, owner string) error {
+	_, err := releaseLeader.Run(ctx, s.db, s.keys()[:1], owner).Result()
+	if err != nil {
+		return fmt.Errorf("Failed to release leadership %v", err)
+	}
+	return nil
+}
+
+func (s *redisLeaderStore) leader(ctx context.Context) (owner string, token uint64, err error) {
+	res, err := s.db.MGet(ctx, s.keys()...).Result()
+	if err != nil {
+		return "", 0, fmt.Errorf("Failed to get leader %v", err)
+	}
+	owner, _ = res[0].(string)
+	fence, _ := res[1].(string)
+	token, _ = strconv.ParseUint(fence, 10, 64)
+	return
+}
+
+func (s *redisLeaderStore) report(ctx context.Context, owner, status string) error {
+	_, err := s.db.HSet(ctx, s.key.candidatesKey(), owner, status).Result()
+	if err != nil {
+		return fmt.Errorf("Failed to report leader candidate status %v", err)
+	}
+	return nil
+}
+
+func (s *redisLeaderStore) candidates(ctx context.Context) (map[string]string, error) {
+	res, err := s.db.HGetAll(ctx, s.key.candidatesKey()).Result()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get leader candidates %v", err)
+	}
+	return res, nil
+}
+
+func (s *redisLeaderStore) prune(ctx context.Context, owners ...string) error {
+	_, err := s.db.HDel(ctx, s.key.candidatesKey(), owners...).Result()
+	return err
+}
+
+type storeLeaderStore struct {
+	key   LeaderKey
+	store Store
+}
+
+func (s *storeLeaderStore) acquire(ctx context.Context, owner string, ttl time.Duration) (token uint64, err error) {
+	err = s.store.Update(func(t StoreTx) error {
+		if current, ok := t.Get(s.key.Key()); ok && current != owner {
+			return nil
+		}
+		fence, _ := t.Get(s.key.fenceKey())
+		token, _ = strconv.ParseUint(fence, 10, 64)
+		token++
+		t.Set(s.key.Key(), owner, ttl)
+		t.Set(s.key.fenceKey(), strconv.FormatUint(token, 10), 0)
+		return nil
+	})
+	return
+}
+
+func (s *storeLeaderStore) refresh(ctx context.Context, owner string, token uint64, ttl time.Duration) (ok bool, err error) {
+	err = s.store.Update(func(t StoreTx) error {
+		current, _ := t.Get(s.key.Key())
+		fence, _ := t.Get(s.key.fenceKey())
+		if current != owner || fence != strconv.FormatUint(token, 10) {
+			return nil
+		}
+		t.Set(s.key.Key(), owner, ttl)
+		ok = true
+		return nil
+	})
+	return
+}
+
+func (s *storeLeaderStore) release(ctx context.Context, owner string) error {
+	return s.store.Update(func(t StoreTx) error {
+		if current, _ := t.Get(s.key.Key()); current == owner {
+			t.Del(s.key.Key())
+		}
+		return nil
+	})
+}
+
+func (s *storeLeaderStore) leader(ctx context.Context) (owner string, token uint64, err error) {
+	err = s.store.View(func(t StoreTx) error {
+		owner, _ = t.Get(s.key.Key())
+		fence, _ := t.Get(s.key.fenceKey())
+		token, _ = strconv.ParseUint(fence, 10, 64)
+		return nil
+	})
+	return
+}
+
+func (s *storeLeaderStore) report(ctx context.Context, owner, status string) error {
+	return s.store.Update(func(t StoreTx) error {
+		t.HSet(s.key.candidatesKey(), owner, status)
+		return nil
+	})
+}
+
+func (s *storeLeaderStore) candidates(ctx context.Context) (res map[string]string, err error) {
+	err = s.store.View(func(t StoreTx) error {
+		res = t.HGetAll(s.key.candidatesKey())
+		return nil
+	})
+	return
+}
+
+func (s *storeLeaderStore) prune(ctx context.Context, owners ...string) error {
+	return s.store.Update(func(t StoreTx) error {
+		t.HDel(s.key.candidatesKey(), owners...)
+		return nil
+	})
+}
+
+// Candidate is the status report of an instance campaigning for the role
+type Candidate struct {
+	Owner   string
+	Leading bool
+	Token   uint64 // Fencing token of the term when leading
+	Height  uint64 // Progress of the role, the height to resume from when standing by
+	Latest  uint64 // Latest height of the chain seen by the instance
+	Updated int64
+}
+
+// Lag of the progress behind the chain
+func (c *Candidate) Lag() uint64 {
+	if c.Latest > c.Height {
+		return c.Latest - c.Height
+	}
+	return 0
+}
+
+type termKey struct{}
+
+// Term is the context of a leadership term, it's canceled once the leadership is lost or resigned
+type Term struct {
+	context.Context
+	Token  uint64 // Fencing token, increases across the terms of the role
+	leader *Leader
+	cancel context.CancelFunc
+	mu     sync.Mutex
+	valid  time.Time // Deadline of the leadership since the last successful refresh
+}
+
+func (t *Term) Value(key interface{}) interface{} {
+	if key == (termKey{}) {
+		return t
+	}
+	return t.Context.Value(key)
+}
+
+// Fence verifies the term is still the current one of the role, the term is ended when it's not
+func (t *Term) Fence(ctx context.Context) error {
+	if t.Err() != nil {
+		return ErrLeadershipLost
+	}
+	t.mu.Lock()
+	valid := t.valid
+	t.mu.Unlock()
+	if time.Now().After(valid) {
+		t.lose("lease expired")
+		return ErrLeadershipLost
+	}
+	owner, token, err := t.leader.store.leader(ctx)
+	if err != nil {
+		return err
+	}
+	if owner != t.leader.owner || token != t.Token {
+		t.lose("fenced")
+		return ErrLeadershipLost
+	}
+	return nil
+}
+
+func (t *Term) lose(reason string) {
+	if t.Err() == nil {
+		log.Warn("Lost leadership", "role", t.leader.role, "owner", t.leader.owner, "token", t.Token, "reason", reason)
+	}
+	t.cancel()
+}
+
+// Leadership term carried by the context
+func termOf(ctx context.Context) (*Term, bool) {
+	term, ok := ctx.Value(termKey{}).(*Term)
+	return term, ok
+}
+
+// Fence checks the leadership term carried by the context, contexts out of any term always pass. It's a
+// check before acting, the writes to be guarded are fenced atomically by the stores, see ChainStore.Fence.
+func Fence(ctx context.Context) error {
+	term, ok := termOf(ctx)
+	if !ok {
+		return nil
+	}
+	return term.Fence(ctx)
+}
+
+// Leader elects a single leader of the role among the instances sharing the bus
+type Leader struct {
+	role  string
+	owner string // Unique per instance and election
+	ttl   time.Duration
+	store leaderStore
+	mu    sync.Mutex
+	term  *Term
+}
+
+func newLeader(role string, ttl time.Duration, store leaderStore) *Leader {
+	if ttl == 0 {
+		ttl = DEFAULT_LEADER_TTL
+	}
+	nonce := make([]byte, 8)
+	rand.Read(nonce)
+	return &Leader{
+		role:  role,
+		owner: fmt.Sprintf("%s-%s", ConsumerName(), hex.EncodeToString(nonce)),
+		ttl:   ttl,
+		store: store,
+	}
+}
+
+func NewRedisLeader(db redis.UniversalClient, role string, ttl time.Duration) *Leader {
+	return newLeader(role, ttl, &redisLeaderStore{key: LeaderKey{role, isCluster(db)}, db: db})
+}
+
+func NewStoreLeader(store Store, role string, ttl time.Duration) *Leader {
+	return newLeader(role, ttl, &storeLeaderStore{key: LeaderKey{Role: role}, store: store})
+}
+
+func (l *Leader) Role() string {
+	return l.role
+}
+
+func (l *Leader) Owner() string {
+	return l.owner
+}
+
+// Current term, nil when not leading
+func (l *Leader) Term() *Term {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.term == nil || l.term.Err() != nil {
+		return nil
+	}
+	return l.term
+}
+
+// Current leader and the latest fencing token of the role
+func (l *Leader) Leader(ctx context.Context) (string, uint64, error) {
+	return l.store.leader(ctx)
+}
+
+// Report the status of the instance, reports older than three ttls are considered gone
+func (l *Leader) Report(ctx context.Context, height, latest uint64) error {
+	c := &Candidate{Owner: l.owner, Height: height, Latest: latest, Updated: time.Now().Unix()}
+	if term := l.Term(); term != nil {
+		c.Leading = true
+		c.Token = term.Token
+	}
+	data, _ := json.Marshal(c)
+	return l.store.report(ctx, l.owner, string(data))
+}
+
+// Candidates lists the live instances of the role reported recently, stale reports are removed
+func (l *Leader) Candidates(ctx context.Context) (list []*Candidate, err error) {
+	res, err := l.store.candidates(ctx)
+	if err != nil {
+		return
+	}
+	deadline := time.Now().Add(-3 * l.ttl).Unix()
+	stale := []string{}
+	for owner, value := range res {
+		c := new(Candidate)
+		if json.Unmarshal([]byte(value), c) != nil || c.Updated < deadline {
+			stale = append(stale, owner)
+			continue
+		}
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Owner < list[j].Owner })
+	if len(stale) > 0 {
+		err = l.store.prune(ctx, stale...)
+	}
+	return
+}
+
+// Campaign blocks until the leadership is acquired or the context is canceled. The leadership is
+// refreshed in background until the returned term is ended, which releases the leadership.
+func (l *Leader) Campaign(ctx context.Context, wg *sync.WaitGroup) (*Term, error) {
+	interval := l.ttl / 3
+	announced := false
+	for {
+		start := time.Now()
+		token, err := l.store.acquire(ctx, l.owner, l.ttl)
+		if err != nil {
+			log.Error("Leader election error", "role", l.role, "err", err)
+		} else if token > 0 {
+			term := &Term{Token: token, leader: l, valid: start.Add(l.ttl)}
+			term.Context, term.cancel = context.WithCancel(ctx)
+			l.mu.Lock()
+			l.term = term
+			l.mu.Unlock()
+			log.Info("Acquired leadership", "role", l.role, "owner", l.owner, "token", token)
+			wg.Add(1)
+			go l.keep(term, wg)
+			return term, nil
+		} else if !announced {
+			owner, token, _ := l.store.leader(ctx)
+			log.Info("Standing by for leadership", "role", l.role, "leader", owner, "token", token)
+			announced = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Resign ends the current term
+func (l *Leader) Resign() {
+	term := l.Term()
+	if term != nil {
+		log.Info("Resigning leadership", "role", l.role, "owner", l.owner, "token", term.Token)
+		term.cancel()
+	}
+}
+
+func (l *Leader) keep(term *Term, wg *sync.WaitGroup) {
+	defer wg.Done()
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-term.Done():
+			err := l.store.release(context.Background(), l.owner)
+			if err != nil {
+				log.Error("Failed to release leadership", "role", l.role, "err", err)
+			}
+			return
+		case <-ticker.C:
+			start := time.Now()
+			term.mu.Lock()
+			valid := term.valid
+			term.mu.Unlock()
+			if start.After(valid) {
+				// Paused or disconnected for longer than the ttl, others might have taken over
+				term.lose("lease expired")
+				continue
+			}
+			ok, err := l.store.refresh(term, l.owner, term.Token, l.ttl)
+			if err != nil {
+				log.Error("Failed to refresh leadership", "role", l.role, "err", err)
+			} else if !ok {
+				term.lose("taken over")
+			} else {
+				term.mu.Lock()
+				term.valid = start.Add(l.ttl)
+				term.mu.Unlock()
+			}
+		}
+	}
+}
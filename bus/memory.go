@@ -0,0 +1,385 @@
+/*
+ * Copyright (C) 2021 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package bus
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/polynetwork/bridge-common/log"
+)
+
+type memoryValue struct {
+	Value  string
+	Expiry int64 `json:",omitempty"` // Unix nano, never expires when zero
+}
+
+type memoryData struct {
+	Lists  map[string][]string
+	ZSets  map[string]map[string]float64
+	Hashes map[string]map[string]string
+	Values map[string]memoryValue
+}
+
+func newMemoryData() *memoryData {
+	return &memoryData{
+		Lists:  map[string][]string{},
+		ZSets:  map[string]map[string]float64{},
+		Hashes: map[string]map[string]string{},
+		Values: map[string]memoryValue{},
+	}
+}
+
+// Copy the state of the key and return the function to restore it
+func (d *memoryData) backup(key string) func() {
+	list, hasList := d.Lists[key]
+	list = append([]string(nil), list...)
+	zset, hasZSet := d.ZSets[key]
+	zsetCopy := make(map[string]float64, len(zset))
+	for k, v := range zset {
+		zsetCopy[k] = v
+	}
+	hash, hasHash := d.Hashes[key]
+	hashCopy := make(map[string]string, len(hash))
+	for k, v := range hash {
+		hashCopy[k] = v
+	}
+	value, hasValue := d.Values[key]
+	return func() {
+		delete(d.Lists, key)
+		delete(d.ZSets, key)
+		delete(d.Hashes, key)
+		delete(d.Values, key)
+		if hasList {
+			d.Lists[key] = list
+		}
+		if hasZSet {
+			d.ZSets[key] = zsetCopy
+		}
+		if hasHash {
+			d.Hashes[key] = hashCopy
+		}
+		if hasValue {
+			d.Values[key] = value
+		}
+	}
+}
+
+// MemoryStore keeps everything in process memory, and optionally saves snapshots to disk periodically
+type MemoryStore struct {
+	notifier
+	mu       sync.RWMutex
+	data     *memoryData
+	path     string
+	version  uint64
+	saved    uint64
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// Create a memory store, the snapshot will be loaded from and saved to the path if specified
+func NewMemoryStore(path string, interval time.Duration) (s *MemoryStore, err error) {
+	s = &MemoryStore{data: newMemoryData(), path: path, done: make(chan struct{})}
+	if path == "" {
+		return
+	}
+	err = s.load()
+	if err != nil {
+		return nil, err
+	}
+	if interval == 0 {
+		interval = 10 * time.Second
+	}
+	go s.snapshots(interval)
+	return
+}
+
+func (s *MemoryStore) load() (err error) {
+	data, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to read memory store snapshot %v", err)
+	}
+	d := newMemoryData()
+	// Snapshots were saved in json before the binary tx encoding, which is not valid utf8 for json strings
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		err = json.Unmarshal(data, d)
+	} else {
+		err = gob.NewDecoder(bytes.NewReader(data)).Decode(d)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to parse memory store snapshot %v", err)
+	}
+	s.data = d
+	log.Info("Loaded memory store snapshot", "path", s.path)
+	return
+}
+
+func (s *MemoryStore) snapshots(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			err := s.Save()
+			if err != nil {
+				log.Error("Failed to save memory store snapshot", "path", s.path, "err", err)
+			}
+		}
+	}
+}
+
+// Save the snapshot to disk if there are any changes since last save
+func (s *MemoryStore) Save() (err error) {
+	if s.path == "" {
+		return
+	}
+	s.mu.RLock()
+	version := s.version
+	if version == s.saved {
+		s.mu.RUnlock()
+		return
+	}
+	var buf bytes.Buffer
+	err = gob.NewEncoder(&buf).Encode(s.data)
+	s.mu.RUnlock()
+	if err != nil {
+		return
+	}
+	tmp := s.path + ".tmp"
+	err = ioutil.WriteFile(tmp, buf.Bytes(), 0600)
+	if err != nil {
+		return
+	}
+	err = os.Rename(tmp, s.path)
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	s.saved = version
+	s.mu.Unlock()
+	return
+}
+
+func (s *MemoryStore) View(f func(StoreTx) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return f(&memoryTx{data: s.data})
+}
+
+func (s *MemoryStore) Update(f func(StoreTx) error) (err error) {
+	s.mu.Lock()
+	tx := &memoryTx{data: s.data, writable: true, dirty: map[string]bool{}}
+	err = f(tx)
+	if err != nil {
+		for i := len(tx.undo) - 1; i >= 0; i-- {
+			tx.undo[i]()
+		}
+		s.mu.Unlock()
+		return
+	}
+	if len(tx.dirty) > 0 {
+		s.version++
+	}
+	s.mu.Unlock()
+	s.Notify(tx.dirty)
+	return
+}
+
+func (s *MemoryStore) Close() (err error) {
+	s.stopOnce.Do(func() {
+		close(s.done)
+		err = s.Save()
+	})
+	return
+}
+
+type memoryTx struct {
+	data     *memoryData
+	writable bool
+	dirty    map[string]bool
+	undo     []func()
+}
+
+func (t *memoryTx) touch(key string) {
+	if !t.writable {
+		panic("write operation in read only store transaction")
+	}
+	if t.dirty[key] {
+		return
+	}
+	t.dirty[key] = true
+	t.undo = append(t.undo, t.data.backup(key))
+}
+
+func (t *memoryTx) LPush(key string, values ...string) {
+	t.touch(key)
+	list := t.data.Lists[key]
+	for _, v := range values {
+		list = append([]string{v}, list...)
+	}
+	t.data.Lists[key] = list
+}
+
+func (t *memoryTx) RPush(key string, values ...string) {
+	t.touch(key)
+	t.data.Lists[key] = append(t.data.Lists[key], values...)
+}
+
+func (t *memoryTx) LPop(key string) (string, bool) {
+	list := t.data.Lists[key]
+	if len(list) == 0 {
+		return "", false
+	}
+	t.touch(key)
+	if len(list) == 1 {
+		delete(t.data.Lists, key)
+	} else {
+		t.data.Lists[key] = list[1:]
+	}
+	return list[0], true
+}
+
+func (t *memoryTx) LRange(key string) []string {
+	return append([]string(nil), t.data.Lists[key]...)
+}
+
+func (t *memoryTx) LLen(key string) int {
+	return len(t.data.Lists[key])
+}
+
+func (t *memoryTx) ZAdd(key, member string, score float64) {
+	t.touch(key)
+	zset, ok := t.data.ZSets[key]
+	if !ok {
+		zset = map[string]float64{}
+		t.data.ZSets[key] = zset
+	}
+	zset[member] = score
+}
+
+func (t *memoryTx) ZScore(key, member string) (score float64, ok bool) {
+	score, ok = t.data.ZSets[key][member]
+	return
+}
+
+func (t *memoryTx) ZRem(key string, members ...string) (count int) {
+	zset := t.data.ZSets[key]
+	for _, member := range members {
+		if _, ok := zset[member]; ok {
+			t.touch(key)
+			delete(zset, member)
+			count++
+		}
+	}
+	if count > 0 && len(zset) == 0 {
+		delete(t.data.ZSets, key)
+	}
+	return
+}
+
+func (t *memoryTx) ZRangeByScore(key string, min, max float64, limit int) (items []Z) {
+	for member, score := range t.data.ZSets[key] {
+		if score >= min && score <= max {
+			items = append(items, Z{Member: member, Score: score})
+		}
+	}
+	sortZ(items)
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+	return
+}
+
+func (t *memoryTx) ZCard(key string) int {
+	return len(t.data.ZSets[key])
+}
+
+func (t *memoryTx) HSet(key, field, value string) {
+	t.touch(key)
+	hash, ok := t.data.Hashes[key]
+	if !ok {
+		hash = map[string]string{}
+		t.data.Hashes[key] = hash
+	}
+	hash[field] = value
+}
+
+func (t *memoryTx) HGet(key, field string) (value string, ok bool) {
+	value, ok = t.data.Hashes[key][field]
+	return
+}
+
+func (t *memoryTx) HDel(key string, fields ...string) (count int) {
+	hash := t.data.Hashes[key]
+	for _, field := range fields {
+		if _, ok := hash[field]; ok {
+			t.touch(key)
+			delete(hash, field)
+			count++
+		}
+	}
+	if count > 0 && len(hash) == 0 {
+		delete(t.data.Hashes, key)
+	}
+	return
+}
+
+func (t *memoryTx) HGetAll(key string) map[string]string {
+	res := map[string]string{}
+	for k, v := range t.data.Hashes[key] {
+		res[k] = v
+	}
+	return res
+}
+
+func (t *memoryTx) Set(key, value string, ttl time.Duration) {
+	t.touch(key)
+	v := memoryValue{Value: value}
+	if ttl > 0 {
+		v.Expiry = time.Now().Add(ttl).UnixNano()
+	}
+	t.data.Values[key] = v
+}
+
+func (t *memoryTx) Get(key string) (string, bool) {
+	v, ok := t.data.Values[key]
+	if !ok || (v.Expiry > 0 && v.Expiry < time.Now().UnixNano()) {
+		return "", false
+	}
+	return v.Value, true
+}
+
+func (t *memoryTx) Del(key string) bool {
+	_, ok := t.data.Values[key]
+	if ok {
+		t.touch(key)
+		delete(t.data.Values, key)
+	}
+	return ok
+}
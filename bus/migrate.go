@@ -0,0 +1,367 @@
+/*
+ * Copyright (C) 2021 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package bus
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/polynetwork/bridge-common/base"
+	"github.com/polynetwork/bridge-common/log"
+	"github.com/polynetwork/poly-relayer/config"
+	"github.com/polynetwork/poly-relayer/msg"
+)
+
+const MIGRATE_BATCH = 100
+
+// Replace the list items, ARGV: old1, new1, old2, new2...
+var migrateList = redis.NewScript(`
+local updates = {}
+for i = 1, #ARGV, 2 do
+	updates[ARGV[i]] = ARGV[i+1]
+end
+local n = 0
+for i, v in ipairs(redis.call('LRANGE', KEYS[1], 0, -1)) do
+	local new = updates[v]
+	if new then
+		redis.call('LSET', KEYS[1], i-1, new)
+		n = n + 1
+	end
+end
+return n
+`)
+
+// Replace the sorted set members keeping the scores, ARGV: old1, new1, old2, new2...
+var migrateZSet = redis.NewScript(`
+local n = 0
+for i = 1, #ARGV, 2 do
+	local score = redis.call('ZSCORE', KEYS[1], ARGV[i])
+	if score then
+		redis.call('ZREM', KEYS[1], ARGV[i])
+		redis.call('ZADD', KEYS[1], score, ARGV[i+1])
+		n = n + 1
+	end
+end
+return n
+`)
+
+// Replace the hash values if unchanged, ARGV: field1, old1, new1, field2, old2, new2...
+var migrateHash = redis.NewScript(`
+local n = 0
+for i = 1, #ARGV, 3 do
+	if redis.call('HGET', KEYS[1], ARGV[i]) == ARGV[i+1] then
+		redis.call('HSET', KEYS[1], ARGV[i], ARGV[i+2])
+		n = n + 1
+	end
+end
+return n
+`)
+
+// MigrateStats counts the migrated txs per queue
+type MigrateStats struct {
+	Key      string
+	Total    int
+	Migrated int
+	Failed   int
+}
+
+// upgrade returns the txs of the raw items re-encoded with the codec, items failed to decode are counted and kept as is
+func upgrade(c *msg.Codec, key string, items []string, stats *MigrateStats) (updates map[string]string) {
+	updates = map[string]string{}
+	for _, item := range items {
+		stats.Total++
+		v, changed, err := c.Upgrade(item)
+		if err != nil {
+			stats.Failed++
+			log.Error("Failed to upgrade queued tx", "key", key, "body", item, "err", err)
+			continue
+		}
+		if changed {
+			updates[item] = v
+		}
+	}
+	return
+}
+
+// MigrateTxs rewrites the queued txs of the chains in place with the current tx envelope version and the configured codec
+func MigrateTxs(ctx context.Context, conf *config.BusConfig, chains []uint64) (stats []*MigrateStats, err error) {
+	chains = append([]uint64{base.POLY}, chains...)
+	seen := map[uint64]bool{}
+	var unique []uint64
+	for _, chain := range chains {
+		if !seen[chain] {
+			seen[chain] = true
+			unique = append(unique, chain)
+		}
+	}
+	hashTag := HashTag(conf)
+	queues := TxQueues(unique, hashTag)
+	for _, chain := range unique {
+		// The index values are the encoded queue entries, which should be migrated the same way
+		queues = append(queues, Queue{QUEUE_SORTED, queueIndexKey(&SortedTxQueueKey{chain, msg.SRC, hashTag}), QUEUE_HASH, false})
+		for _, ty := range []msg.TxType{msg.SRC, msg.POLY} {
+			queues = append(queues, Queue{QUEUE_TX, queueIndexKey(&TxQueueKey{chain, ty, hashTag}), QUEUE_HASH, false})
+		}
+	}
+	for _, q := range queues {
+		s := &MigrateStats{Key: q.Key}
+		if isRedis(conf) {
+			err = migrateRedis(ctx, New(conf), codec(conf), q, s)
+		} else {
+			err = migrateStore(mustOpenStore(conf), codec(conf), q, s)
+		}
+		if err != nil {
+			return
+		}
+		if s.Total > 0 {
+			stats = append(stats, s)
+		}
+	}
+	return
+}
+
+func migrateRedis(ctx context.Context, db redis.UniversalClient, c *msg.Codec, q Queue, stats *MigrateStats) (err error) {
+	var (
+		items  []string
+		fields map[string]string
+	)
+	switch q.Kind {
+	case QUEUE_LIST:
+		items, err = db.LRange(ctx, q.Key, 0, -1).Result()
+	case QUEUE_ZSET:
+		items, err = db.ZRange(ctx, q.Key, 0, -1).Result()
+	case QUEUE_HASH:
+		fields, err = db.HGetAll(ctx, q.Key).Result()
+		for _, v := range fields {
+			items = append(items, v)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to read queue %s %v", q.Key, err)
+	}
+	updates := upgrade(c, q.Key, items, stats)
+
+	var args []interface{}
+	flush := func() error {
+		if len(args) == 0 {
+			return nil
+		}
+		script := migrateList
+		switch q.Kind {
+		case QUEUE_ZSET:
+			script = migrateZSet
+		case QUEUE_HASH:
+			script = migrateHash
+		}
+		n, err := script.Run(ctx, db, []string{q.Key}, args...).Int64()
+		if err != nil {
+			return fmt.Errorf("Failed to migrate queue %s %v", q.Key, err)
+		}
+		stats.Migrated += int(n)
+		args = nil
+		return nil
+	}
+	if q.Kind == QUEUE_HASH {
+		for field, v := range fields {
+			if upgraded, ok := updates[v]; ok {
+				args = append(args, field, v, upgraded)
+			}
+			if len(args) >= MIGRATE_BATCH*3 {
+				if err = flush(); err != nil {
+					return
+				}
+			}
+		}
+	} else {
+		for v, upgraded := range updates {
+			args = append(args, v, upgraded)
+			if len(args) >= MIGRATE_BATCH*2 {
+				if err = flush(); err != nil {
+					return
+				}
+			}
+		}
+	}
+	return flush()
+}
+
+func migrateStore(store Store, c *msg.Codec, q Queue, stats *MigrateStats) error {
+	return store.Update(func(tx StoreTx) error {
+		switch q.Kind {
+		case QUEUE_LIST:
+			items := tx.LRange(q.Key)
+			updates := upgrade(c, q.Key, items, stats)
+			if len(updates) == 0 {
+				return nil
+			}
+			for range items {
+				v, _ := tx.LPop(q.Key)
+				if upgraded, ok := updates[v]; ok {
+					v = upgraded
+					stats.Migrated++
+				}
+				tx.RPush(q.Key, v)
+			}
+		case QUEUE_ZSET:
+			items := tx.ZRangeByScore(q.Key, math.Inf(-1), math.Inf(1), 0)
+			raws := make([]string, len(items))
+			for i, item := range items {
+				raws[i] = item.Member
+			}
+			updates := upgrade(c, q.Key, raws, stats)
+			for _, item := range items {
+				if upgraded, ok := updates[item.Member]; ok {
+					tx.ZRem(q.Key, item.Member)
+					tx.ZAdd(q.Key, upgraded, item.Score)
+					stats.Migrated++
+				}
+			}
+		case QUEUE_HASH:
+			fields := tx.HGetAll(q.Key)
+			var raws []string
+			for _, v := range fields {
+				raws = append(raws, v)
+			}
+			updates := upgrade(c, q.Key, raws, stats)
+			for field, v := range fields {
+				if upgraded, ok := updates[v]; ok {
+					tx.HSet(q.Key, field, upgraded)
+					stats.Migrated++
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Kinds of the keys holding the chain queue slot
+var slotKeyKinds = []string{"bus", "sorted_bus", "delayed_bus", "dlq", "stream", "leader"}
+
+// retagKey returns the key in the layout with or without the hash tagged slot, false for the keys without a slot
+func retagKey(key string, hashTag bool) (string, bool) {
+	prefix := base.ENV + ":relayer:"
+	if !strings.HasPrefix(key, prefix) {
+		return "", false
+	}
+	for _, kind := range slotKeyKinds {
+		rest := strings.TrimPrefix(key, prefix+kind+":")
+		if rest == key {
+			continue
+		}
+		var slot, suffix string
+		if strings.HasPrefix(rest, "{") {
+			end := strings.Index(rest, "}")
+			if end < 0 {
+				return "", false
+			}
+			slot, suffix = rest[1:end], rest[end+1:]
+		} else if kind == "leader" {
+			// Role names may have colons, while the suffixes are known
+			slot = rest
+			for _, s := range []string{":fence", ":candidates"} {
+				if strings.HasSuffix(rest, s) {
+					slot, suffix = strings.TrimSuffix(rest, s), s
+				}
+			}
+		} else {
+			parts := strings.SplitN(rest, ":", 3)
+			if len(parts) < 2 {
+				return "", false
+			}
+			slot = parts[0] + ":" + parts[1]
+			if len(parts) == 3 {
+				suffix = ":" + parts[2]
+			}
+		}
+		if hashTag {
+			slot = "{" + slot + "}"
+		}
+		return prefix + kind + ":" + slot + suffix, true
+	}
+	return "", false
+}
+
+// MigrateKeys moves the redis queue and leader keys to the key layout of the config, which hash tags the slots
+// in cluster mode, e.g. after the data of a single node redis is imported into a cluster. The keys are moved
+// one by one with dump and restore, so the relayers should be stopped during the migration.
+func MigrateKeys(ctx context.Context, conf *config.BusConfig) (moved []string, err error) {
+	if !isRedis(conf) {
+		return nil, fmt.Errorf("Key layout migration is only for redis backend")
+	}
+	db := New(conf)
+	if db == nil {
+		return nil, fmt.Errorf("Missing redis address of bus config")
+	}
+	var (
+		keys []string
+		mu   sync.Mutex
+	)
+	scan := func(ctx context.Context, c redis.UniversalClient) error {
+		iter := c.Scan(ctx, 0, base.ENV+":relayer:*", MIGRATE_BATCH).Iterator()
+		for iter.Next(ctx) {
+			mu.Lock()
+			keys = append(keys, iter.Val())
+			mu.Unlock()
+		}
+		return iter.Err()
+	}
+	if cluster, ok := db.(*redis.ClusterClient); ok {
+		err = cluster.ForEachMaster(ctx, func(ctx context.Context, c *redis.Client) error { return scan(ctx, c) })
+	} else {
+		err = scan(ctx, db)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to scan the bus keys %v", err)
+	}
+
+	hashTag := HashTag(conf)
+	for _, key := range keys {
+		target, ok := retagKey(key, hashTag)
+		if !ok || target == key {
+			continue
+		}
+		data, err := db.Dump(ctx, key).Result()
+		if err == redis.Nil {
+			continue
+		} else if err != nil {
+			return moved, fmt.Errorf("Failed to dump key %s %v", key, err)
+		}
+		ttl, err := db.PTTL(ctx, key).Result()
+		if err != nil {
+			return moved, fmt.Errorf("Failed to get ttl of key %s %v", key, err)
+		}
+		if ttl < 0 {
+			ttl = 0
+		}
+		_, err = db.Restore(ctx, target, ttl, data).Result()
+		if err != nil {
+			return moved, fmt.Errorf("Failed to restore key %s to %s %v", key, target, err)
+		}
+		_, err = db.Del(ctx, key).Result()
+		if err != nil {
+			return moved, fmt.Errorf("Failed to delete migrated key %s %v", key, err)
+		}
+		log.Info("Moved bus key", "from", key, "to", target)
+		moved = append(moved, target)
+	}
+	return
+}
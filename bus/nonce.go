@@ -0,0 +1,90 @@
+/*
+ * Copyright (C) 2021 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package bus
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const NONCES = String("nonces")
+
+// NonceStore backs up the next nonces of the submitter accounts
+type NonceStore interface {
+	SetNonce(ctx context.Context, chain uint64, address string, nonce uint64) error
+	// GetNonce returns the next nonce of the account, zero when unknown
+	GetNonce(ctx context.Context, chain uint64, address string) (uint64, error)
+}
+
+func nonceField(chain uint64, address string) string {
+	return fmt.Sprintf("%d/%s", chain, strings.ToLower(address))
+}
+
+type RedisNonceStore struct {
+	db redis.UniversalClient
+}
+
+func NewRedisNonceStore(db redis.UniversalClient) *RedisNonceStore {
+	return &RedisNonceStore{db: db}
+}
+
+func (s *RedisNonceStore) SetNonce(ctx context.Context, chain uint64, address string, nonce uint64) error {
+	_, err := s.db.HSet(ctx, NONCES.Key(), nonceField(chain, address), nonce).Result()
+	if err != nil {
+		return fmt.Errorf("Failed to save nonce of %s %v", address, err)
+	}
+	return nil
+}
+
+func (s *RedisNonceStore) GetNonce(ctx context.Context, chain uint64, address string) (uint64, error) {
+	n, err := s.db.HGet(ctx, NONCES.Key(), nonceField(chain, address)).Uint64()
+	if err == redis.Nil {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("Failed to get nonce of %s %v", address, err)
+	}
+	return n, nil
+}
+
+type StoreNonceStore struct {
+	store Store
+}
+
+func NewStoreNonceStore(store Store) *StoreNonceStore {
+	return &StoreNonceStore{store: store}
+}
+
+func (s *StoreNonceStore) SetNonce(ctx context.Context, chain uint64, address string, nonce uint64) error {
+	return s.store.Update(func(t StoreTx) error {
+		t.HSet(NONCES.Key(), nonceField(chain, address), strconv.FormatUint(nonce, 10))
+		return nil
+	})
+}
+
+func (s *StoreNonceStore) GetNonce(ctx context.Context, chain uint64, address string) (n uint64, err error) {
+	err = s.store.View(func(t StoreTx) error {
+		value, _ := t.HGet(NONCES.Key(), nonceField(chain, address))
+		n, _ = strconv.ParseUint(value, 10, 64)
+		return nil
+	})
+	return
+}
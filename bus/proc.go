@@ -20,6 +20,7 @@ package bus
 import (
 	"context"
 	"fmt"
+	"runtime/debug"
 	"time"
 
 	"github.com/polynetwork/bridge-common/log"
@@ -59,3 +60,34 @@ func Retry(ctx context.Context, f func() error, interval time.Duration, count in
 		}
 	}
 }
+
+type failureKey struct{}
+
+// WithFailure returns a context which reports the failures of the role goroutines running with it
+func WithFailure(ctx context.Context, report func(error)) context.Context {
+	return context.WithValue(ctx, failureKey{}, report)
+}
+
+// Guard should be deferred by the long running role goroutines. It recovers the panic or detects the
+// goroutine exiting before the context is done, and reports it to the supervisor carried by the context.
+// The panic is raised again when no supervisor is found.
+func Guard(ctx context.Context, name string) {
+	var err error
+	r := recover()
+	if r != nil {
+		log.Error("Role goroutine panic", "name", name, "err", r, "stack", string(debug.Stack()))
+		err = fmt.Errorf("%s panic: %v", name, r)
+	} else if ctx.Err() == nil {
+		err = fmt.Errorf("%s exited unexpectedly", name)
+	} else {
+		return
+	}
+	report, ok := ctx.Value(failureKey{}).(func(error))
+	if ok {
+		report(err)
+	} else if r != nil {
+		panic(r)
+	} else {
+		log.Error("Role goroutine exited unexpectedly", "name", name)
+	}
+}
@@ -19,33 +19,55 @@ package bus
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/polynetwork/bridge-common/util"
 	"github.com/polynetwork/bridge-common/log"
+	"github.com/polynetwork/poly-relayer/config"
 )
 
 type RedisConn struct {
-	Conn    *redis.Client
-	options *redis.Options
+	Conn    redis.UniversalClient
+	options *redis.UniversalOptions
+	cluster bool
 }
 
 func (c *RedisConn) Key() string {
-	return fmt.Sprintf("%s:%d", c.options.Addr, c.options.DB)
+	return fmt.Sprintf("%s:%s:%d:%v", c.options.MasterName, strings.Join(c.options.Addrs, ","), c.options.DB, c.cluster)
 }
 
+// Create the client explicitly per the config, as the universal client would switch to a cluster client
+// for multiple addresses and leave the queue keys without the hash tags.
 func (c *RedisConn) Create() (interface{}, error) {
-	c.Conn = redis.NewClient(c.options)
+	switch {
+	case c.options.MasterName != "":
+		c.Conn = redis.NewFailoverClient(c.options.Failover())
+	case c.cluster:
+		c.Conn = redis.NewClusterClient(c.options.Cluster())
+	case len(c.options.Addrs) == 1:
+		c.Conn = redis.NewClient(c.options.Simple())
+	default:
+		return nil, fmt.Errorf("Multiple redis addresses %v require cluster mode or sentinel master name", c.options.Addrs)
+	}
 	return c, nil
 }
 
-func New(options *redis.Options) *redis.Client {
-	if options.Addr == "" {
+// New creates the shared redis client per bus config: failover client when sentinel master name specified,
+// cluster client when cluster mode enabled, or single node client otherwise.
+func New(conf *config.BusConfig) redis.UniversalClient {
+	if len(conf.Redis.Addrs) == 0 {
 		log.Warn("Skipping redis connection for missing url")
 		return nil
 	}
-	c, _ := util.Single(&RedisConn{
-		options: options,
+	cluster := conf.Config != nil && conf.Config.Cluster
+	c, err := util.Single(&RedisConn{
+		options: conf.Redis,
+		cluster: cluster,
 	})
+	if err != nil {
+		log.Error("Failed to create redis client", "err", err)
+		return nil
+	}
 	return c.(*RedisConn).Conn
 }
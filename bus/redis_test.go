@@ -0,0 +1,172 @@
+package bus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+
+	"github.com/polynetwork/poly-relayer/msg"
+)
+
+// Redis client of an in process redis server, to run the lua scripts of the redis buses
+func testRedis(t *testing.T) redis.UniversalClient {
+	server := miniredis.RunT(t)
+	db := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestRedisSortedTxBus(t *testing.T) {
+	db := testRedis(t)
+	ctx := context.Background()
+	b := NewRedisSortedTxBus(db, 2, msg.SRC)
+	b.timeout = 20 * time.Millisecond
+	other := NewRedisSortedTxBus(db, 2, msg.SRC)
+	b.Push(ctx, &msg.Tx{TxType: msg.SRC, SrcHash: "01"}, 10)
+	b.Push(ctx, &msg.Tx{TxType: msg.SRC, SrcHash: "02"}, 20)
+
+	tx, _, err := b.Claim(ctx, 5)
+	if err != nil || tx != nil {
+		t.Fatalf("Tx above the height should not be claimed, tx %v err %v", tx, err)
+	}
+	tx, score, err := b.Claim(ctx, 20)
+	if err != nil || tx == nil || tx.SrcHash != "01" || score != 10 {
+		t.Fatalf("Lowest tx should be claimed first, tx %v score %v err %v", tx, score, err)
+	}
+	txs, err := b.PeekReady(ctx, 20, 10)
+	if err != nil || len(txs) != 1 || txs[0].SrcHash != "02" {
+		t.Fatalf("Claimed tx should not be visible to peek, txs %v err %v", txs, err)
+	}
+
+	// The ack of an expired lease does not drop the tx claimed by another consumer
+	time.Sleep(30 * time.Millisecond)
+	claimed, _, _ := other.Claim(ctx, 10)
+	if claimed == nil || claimed.SrcHash != "01" {
+		t.Fatalf("Tx of the expired lease should be claimed again, tx %v", claimed)
+	}
+	b.Ack(ctx, tx)
+	if size, _ := b.Len(ctx); size != 2 {
+		t.Fatalf("Ack of the expired lease should not remove the tx, size %v", size)
+	}
+	other.Ack(ctx, claimed)
+	if size, _ := b.Len(ctx); size != 1 {
+		t.Fatalf("Ack of the held lease should remove the tx, size %v", size)
+	}
+
+	// The requeue of an expired lease is skipped
+	tx, _, _ = b.Claim(ctx, 20)
+	time.Sleep(30 * time.Millisecond)
+	claimed, _, _ = other.Claim(ctx, 20)
+	if tx == nil || claimed == nil || claimed.SrcHash != "02" {
+		t.Fatalf("Tx of the expired lease should be claimed again, tx %v", claimed)
+	}
+	b.Requeue(ctx, tx, 40)
+	if txs, _ = b.Range(ctx, 20, 10); len(txs) != 1 {
+		t.Fatalf("Requeue of the expired lease should be skipped, txs %v", txs)
+	}
+	other.Requeue(ctx, claimed, 40)
+	if txs, _ = b.Range(ctx, 20, 10); len(txs) != 0 {
+		t.Fatalf("Requeue of the held lease should move the tx, txs %v", txs)
+	}
+	if txs, _ = b.PeekReady(ctx, 40, 10); len(txs) != 1 || txs[0].SrcHash != "02" {
+		t.Fatalf("Requeued tx should be released, txs %v", txs)
+	}
+
+	db.ZAdd(ctx, b.Key.Key(), &redis.Z{Score: 1, Member: "invalid"})
+	tx, _, err = b.Claim(ctx, 5)
+	if err != nil || tx != nil {
+		t.Fatalf("Invalid entry should be skipped by claim, tx %v err %v", tx, err)
+	}
+	if size, _ := b.Len(ctx); size != 1 {
+		t.Fatalf("Invalid entry should be dropped, size %v", size)
+	}
+}
+
+func TestRedisReliableTxBus(t *testing.T) {
+	db := testRedis(t)
+	ctx := context.Background()
+	b := NewRedisReliableTxBus(NewRedisTxBus(db, 2, msg.POLY), "test", 20*time.Millisecond)
+
+	// Byte identical txs without idempotency key are leased separately
+	tx := &msg.Tx{TxType: msg.POLY, DstChainId: 2}
+	b.Push(ctx, tx)
+	b.Push(ctx, tx)
+	first, err := b.PopTimed(ctx, 100*time.Millisecond)
+	if err != nil || first == nil {
+		t.Fatalf("Tx should be popped, err %v", err)
+	}
+	second, _ := b.PopTimed(ctx, 100*time.Millisecond)
+	if second == nil {
+		t.Fatalf("Duplicate tx should be popped")
+	}
+	if n, _ := b.Inflight(ctx); n != 2 {
+		t.Fatalf("Duplicate txs should be in-flight separately, count %v", n)
+	}
+	b.Ack(ctx, first)
+	if n, _ := b.Inflight(ctx); n != 1 {
+		t.Fatalf("Ack should drop only its own lease, count %v", n)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	n, err := b.Reap(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("Expired in-flight tx should be put back, count %v err %v", n, err)
+	}
+	tx, _ = b.PopTimed(ctx, 100*time.Millisecond)
+	if tx == nil || tx.DstChainId != 2 {
+		t.Fatalf("Put back tx should be delivered again with the lease id stripped, tx %v", tx)
+	}
+	b.Ack(ctx, second)
+	if n, _ := b.Inflight(ctx); n != 1 {
+		t.Fatalf("Ack of the expired lease should not drop the new lease, count %v", n)
+	}
+	b.Ack(ctx, tx)
+	if n, _ := b.Inflight(ctx); n != 0 {
+		t.Fatalf("Acked tx should leave the in-flight set, count %v", n)
+	}
+}
+
+func TestRedisReliableTxBusRepush(t *testing.T) {
+	db := testRedis(t)
+	ctx := context.Background()
+	b := NewRedisReliableTxBus(NewRedisTxBus(db, 2, msg.POLY), "test", 20*time.Millisecond)
+	replaced := listReplacedKey(b.Key.Key())
+
+	// Re-push while in-flight, the acked entry leaves the re-pushed one queued
+	b.Push(ctx, &msg.Tx{TxType: msg.POLY, PolyHash: "01", DstChainId: 2})
+	tx, _ := b.PopTimed(ctx, 100*time.Millisecond)
+	b.Push(ctx, &msg.Tx{TxType: msg.POLY, PolyHash: "01", DstChainId: 2, Attempts: 1})
+	b.Ack(ctx, tx)
+	if n, _ := db.HLen(ctx, replaced).Result(); n != 0 {
+		t.Fatalf("Ack should clear the replaced mark, count %v", n)
+	}
+	tx, _ = b.PopTimed(ctx, 100*time.Millisecond)
+	if tx == nil || tx.Attempts != 1 {
+		t.Fatalf("Re-pushed tx should be delivered after the ack, tx %v", tx)
+	}
+
+	// Re-push while in-flight, the expired entry is dropped instead of put back
+	b.Push(ctx, &msg.Tx{TxType: msg.POLY, PolyHash: "01", DstChainId: 2, Attempts: 2})
+	time.Sleep(30 * time.Millisecond)
+	n, err := b.Reap(ctx)
+	if err != nil || n != 0 {
+		t.Fatalf("Replaced in-flight tx should not be put back, count %v err %v", n, err)
+	}
+	if size, _ := b.Len(ctx); size != 1 {
+		t.Fatalf("Only the re-pushed tx should be queued, size %v", size)
+	}
+	if n, _ := db.HLen(ctx, replaced).Result(); n != 0 {
+		t.Fatalf("Reap should clear the replaced mark, count %v", n)
+	}
+	tx, _ = b.PopTimed(ctx, 100*time.Millisecond)
+	if tx == nil || tx.Attempts != 2 {
+		t.Fatalf("Re-pushed tx should be delivered, tx %v", tx)
+	}
+	b.Ack(ctx, tx)
+	if n, _ := db.HLen(ctx, queueIndexKey(b.Key)).Result(); n != 0 {
+		t.Fatalf("Acked tx should be unindexed, count %v", n)
+	}
+}
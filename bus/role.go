@@ -0,0 +1,270 @@
+/*
+ * Copyright (C) 2021 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package bus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	ROLE_STATE_RUNNING    = "running"
+	ROLE_STATE_RESTARTING = "restarting"
+	ROLE_STATE_FAILED     = "failed"
+	ROLE_STATE_STOPPED    = "stopped"
+	ROLE_STATE_PAUSED     = "paused"
+
+	ROLE_STATUS     = String("role_status")
+	ROLE_CONTROL    = String("role_control")
+	CONFIG_RELOAD   = String("config_reload") // Counter of the config reload requests
+	ROLE_STATUS_TTL = time.Minute             // Status reports older than the ttl are considered gone with the instance
+)
+
+// RoleStatus is the running state of a role in a relayer instance
+type RoleStatus struct {
+	Instance  string
+	Role      string
+	Chain     uint64
+	State     string
+	Restarts  int    // Total restarts
+	Failures  int    // Consecutive failures
+	LastError string `json:",omitempty"`
+	Since     int64  // Time of the last state change
+	Updated   int64
+}
+
+func (s *RoleStatus) field() string {
+	return fmt.Sprintf("%s/%s/%d", s.Instance, s.Role, s.Chain)
+}
+
+// RoleControl is the desired state of a role on a chain set by the operators at runtime, it overrides
+// the roles file for all the relayer instances and is kept until changed.
+type RoleControl struct {
+	Role     string
+	Chain    uint64
+	State    string // ROLE_STATE_RUNNING, ROLE_STATE_STOPPED or ROLE_STATE_PAUSED
+	Operator string
+	Reason   string `json:",omitempty"`
+	Updated  int64
+}
+
+func (c *RoleControl) field() string {
+	return fmt.Sprintf("%s/%d", c.Role, c.Chain)
+}
+
+// RoleStatusStore keeps the role status reports of the relayer instances and the role controls
+type RoleStatusStore interface {
+	ReportRoles(context.Context, []*RoleStatus) error
+	ListRoles(context.Context) ([]*RoleStatus, error)
+	ControlRole(context.Context, *RoleControl) error // Remove the control with empty state
+	RoleControls(context.Context) ([]*RoleControl, error)
+	RequestReload(context.Context) (uint64, error) // Request the running instances to reload the config
+	ReloadRequests(context.Context) (uint64, error)
+}
+
+// Decode the role controls sorted by chain and role
+func parseRoleControls(values map[string]string) (list []*RoleControl) {
+	for _, value := range values {
+		control := new(RoleControl)
+		if json.Unmarshal([]byte(value), control) == nil {
+			list = append(list, control)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Chain != list[j].Chain {
+			return list[i].Chain < list[j].Chain
+		}
+		return list[i].Role < list[j].Role
+	})
+	return
+}
+
+// Decode the live role status reports sorted by chain, role and instance, returns the stale ones as well
+func parseRoleStatus(values map[string]string) (list []*RoleStatus, stale []string) {
+	deadline := time.Now().Add(-ROLE_STATUS_TTL).Unix()
+	for field, value := range values {
+		status := new(RoleStatus)
+		if json.Unmarshal([]byte(value), status) != nil || status.Updated < deadline {
+			stale = append(stale, field)
+			continue
+		}
+		list = append(list, status)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if a.Chain != b.Chain {
+			return a.Chain < b.Chain
+		}
+		if a.Role != b.Role {
+			return a.Role < b.Role
+		}
+		return a.Instance < b.Instance
+	})
+	return
+}
+
+type RedisRoleStatusStore struct {
+	db redis.UniversalClient
+}
+
+func NewRedisRoleStatusStore(db redis.UniversalClient) *RedisRoleStatusStore {
+	return &RedisRoleStatusStore{db: db}
+}
+
+func (s *RedisRoleStatusStore) ReportRoles(ctx context.Context, list []*RoleStatus) error {
+	values := make([]interface{}, 0, 2*len(list))
+	for _, status := range list {
+		data, _ := json.Marshal(status)
+		values = append(values, status.field(), string(data))
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	_, err := s.db.HSet(ctx, ROLE_STATUS.Key(), values...).Result()
+	if err != nil {
+		return fmt.Errorf("Failed to report role status %v", err)
+	}
+	return nil
+}
+
+func (s *RedisRoleStatusStore) ListRoles(ctx context.Context) ([]*RoleStatus, error) {
+	values, err := s.db.HGetAll(ctx, ROLE_STATUS.Key()).Result()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list role status %v", err)
+	}
+	list, stale := parseRoleStatus(values)
+	if len(stale) > 0 {
+		s.db.HDel(ctx, ROLE_STATUS.Key(), stale...)
+	}
+	return list, nil
+}
+
+func (s *RedisRoleStatusStore) ControlRole(ctx context.Context, control *RoleControl) (err error) {
+	if control.State == "" {
+		_, err = s.db.HDel(ctx, ROLE_CONTROL.Key(), control.field()).Result()
+	} else {
+		data, _ := json.Marshal(control)
+		_, err = s.db.HSet(ctx, ROLE_CONTROL.Key(), control.field(), string(data)).Result()
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to update role control %v", err)
+	}
+	return nil
+}
+
+func (s *RedisRoleStatusStore) RoleControls(ctx context.Context) ([]*RoleControl, error) {
+	values, err := s.db.HGetAll(ctx, ROLE_CONTROL.Key()).Result()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list role controls %v", err)
+	}
+	return parseRoleControls(values), nil
+}
+
+func (s *RedisRoleStatusStore) RequestReload(ctx context.Context) (uint64, error) {
+	n, err := s.db.Incr(ctx, CONFIG_RELOAD.Key()).Uint64()
+	if err != nil {
+		return 0, fmt.Errorf("Failed to request config reload %v", err)
+	}
+	return n, nil
+}
+
+func (s *RedisRoleStatusStore) ReloadRequests(ctx context.Context) (uint64, error) {
+	n, err := s.db.Get(ctx, CONFIG_RELOAD.Key()).Uint64()
+	if err == redis.Nil {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("Failed to get config reload requests %v", err)
+	}
+	return n, nil
+}
+
+type StoreRoleStatusStore struct {
+	store Store
+}
+
+func NewStoreRoleStatusStore(store Store) *StoreRoleStatusStore {
+	return &StoreRoleStatusStore{store: store}
+}
+
+func (s *StoreRoleStatusStore) ReportRoles(ctx context.Context, list []*RoleStatus) error {
+	return s.store.Update(func(t StoreTx) error {
+		for _, status := range list {
+			data, _ := json.Marshal(status)
+			t.HSet(ROLE_STATUS.Key(), status.field(), string(data))
+		}
+		return nil
+	})
+}
+
+func (s *StoreRoleStatusStore) ListRoles(ctx context.Context) (list []*RoleStatus, err error) {
+	err = s.store.Update(func(t StoreTx) error {
+		var stale []string
+		list, stale = parseRoleStatus(t.HGetAll(ROLE_STATUS.Key()))
+		if len(stale) > 0 {
+			t.HDel(ROLE_STATUS.Key(), stale...)
+		}
+		return nil
+	})
+	return
+}
+
+func (s *StoreRoleStatusStore) ControlRole(ctx context.Context, control *RoleControl) error {
+	return s.store.Update(func(t StoreTx) error {
+		if control.State == "" {
+			t.HDel(ROLE_CONTROL.Key(), control.field())
+		} else {
+			data, _ := json.Marshal(control)
+			t.HSet(ROLE_CONTROL.Key(), control.field(), string(data))
+		}
+		return nil
+	})
+}
+
+func (s *StoreRoleStatusStore) RoleControls(ctx context.Context) (list []*RoleControl, err error) {
+	err = s.store.View(func(t StoreTx) error {
+		list = parseRoleControls(t.HGetAll(ROLE_CONTROL.Key()))
+		return nil
+	})
+	return
+}
+
+func (s *StoreRoleStatusStore) RequestReload(ctx context.Context) (n uint64, err error) {
+	err = s.store.Update(func(t StoreTx) error {
+		value, _ := t.Get(CONFIG_RELOAD.Key())
+		n, _ = strconv.ParseUint(value, 10, 64)
+		n++
+		t.Set(CONFIG_RELOAD.Key(), strconv.FormatUint(n, 10), 0)
+		return nil
+	})
+	return
+}
+
+func (s *StoreRoleStatusStore) ReloadRequests(ctx context.Context) (n uint64, err error) {
+	err = s.store.View(func(t StoreTx) error {
+		value, _ := t.Get(CONFIG_RELOAD.Key())
+		n, _ = strconv.ParseUint(value, 10, 64)
+		return nil
+	})
+	return
+}
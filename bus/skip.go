@@ -19,24 +19,119 @@ package bus
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/polynetwork/bridge-common/log"
 	"github.com/polynetwork/poly-relayer/msg"
 )
 
+const SKIP_AUDIT_LIMIT = 1000
+
 type SkipCheck interface {
-	Skip(context.Context, *msg.Tx) error
+	Skip(context.Context, *SkipEntry) error
+	// Unskip removes the skip entry of the hash, the operator and reason of the entry are recorded in the audit trail
+	Unskip(context.Context, *SkipEntry) (bool, error)
+	ListSkip(context.Context) ([]*SkipEntry, error)
+	// SkipAudit returns the latest skip and unskip records
+	SkipAudit(context.Context, int) ([]*SkipAudit, error)
 	CheckSkip(context.Context, *msg.Tx) (bool, error)
 }
 
+// SkipEntry marks a src or poly tx hash to skip, legacy entries with value "true" skip on all chains forever
+type SkipEntry struct {
+	Hash     string
+	Operator string `json:",omitempty"`
+	Reason   string `json:",omitempty"`
+	Created  int64  `json:",omitempty"` // Unix seconds
+	Expiry   int64  `json:",omitempty"` // Unix seconds, never expires when zero
+	DstChain uint64 `json:",omitempty"` // Only skip the txs to the dst chain, all chains when zero
+}
+
+func parseSkipEntry(hash, value string) *SkipEntry {
+	entry := &SkipEntry{Hash: hash}
+	if value != "true" {
+		err := json.Unmarshal([]byte(value), entry)
+		if err != nil {
+			log.Error("Failed to parse skip entry", "hash", hash, "value", value, "err", err)
+		}
+		entry.Hash = hash
+	}
+	return entry
+}
+
+func (e *SkipEntry) Expired(now time.Time) bool {
+	return e.Expiry > 0 && now.Unix() >= e.Expiry
+}
+
+// Match checks the entry against the tx, the entries scoped to a dst chain only match the txs to the chain
+func (e *SkipEntry) Match(tx *msg.Tx, now time.Time) bool {
+	if e.Expired(now) {
+		return false
+	}
+	return e.DstChain == 0 || e.DstChain == tx.DstChainId
+}
+
+// SkipAudit records a skip or unskip operation
+type SkipAudit struct {
+	Action string // skip or unskip
+	Time   int64
+	Entry  *SkipEntry
+}
+
+func skipRecord(action string, entry *SkipEntry) (hash, value, audit string, err error) {
+	hashes := formatHashes(entry.Hash)
+	if len(hashes) == 0 {
+		return "", "", "", fmt.Errorf("Missing skip hash")
+	}
+	hash = hashes[0]
+	entry.Hash = hash
+	now := time.Now().Unix()
+	if entry.Created == 0 {
+		entry.Created = now
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	value = string(data)
+	data, err = json.Marshal(&SkipAudit{Action: action, Time: now, Entry: entry})
+	audit = string(data)
+	return
+}
+
+func parseSkipAudits(items []string) (audits []*SkipAudit) {
+	for _, item := range items {
+		audit := new(SkipAudit)
+		err := json.Unmarshal([]byte(item), audit)
+		if err != nil {
+			log.Error("Failed to parse skip audit", "value", item, "err", err)
+			continue
+		}
+		audits = append(audits, audit)
+	}
+	return
+}
+
+func sortSkipEntries(entries []*SkipEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Created == entries[j].Created {
+			return entries[i].Hash < entries[j].Hash
+		}
+		return entries[i].Created < entries[j].Created
+	})
+}
+
 type RedisSkipCheck struct {
 	Key
-	db *redis.Client
+	db redis.UniversalClient
 }
 
-func NewRedisSkipCheck(db *redis.Client) *RedisSkipCheck {
+func NewRedisSkipCheck(db redis.UniversalClient) *RedisSkipCheck {
 	return &RedisSkipCheck{String("skip_map"), db}
 }
 
@@ -51,25 +146,83 @@ func formatHashes(strs ...string) []string {
 	return hashes
 }
 
-func (b *RedisSkipCheck) Skip(ctx context.Context, tx *msg.Tx) (err error) {
-	hashes := formatHashes(tx.SrcHash, tx.PolyHash)
-	for _, hash := range hashes {
-		_, err = b.db.HSet(ctx, b.Key.Key(), hash, "true").Result()
-		if err != nil {
-			log.Error("Failed to skip tx", "err", err, "hash", hash)
-		} else {
-			log.Info("Tx marked to skip", "hash", hash)
-		}
+func (b *RedisSkipCheck) auditKey() string {
+	return String("skip_audit").Key()
+}
+
+func (b *RedisSkipCheck) audit(ctx context.Context, audit string) {
+	_, err := b.db.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.RPush(ctx, b.auditKey(), audit)
+		p.LTrim(ctx, b.auditKey(), -SKIP_AUDIT_LIMIT, -1)
+		return nil
+	})
+	if err != nil {
+		log.Error("Failed to record skip audit", "audit", audit, "err", err)
 	}
+}
+
+func (b *RedisSkipCheck) Skip(ctx context.Context, entry *SkipEntry) (err error) {
+	hash, value, audit, err := skipRecord("skip", entry)
+	if err != nil {
+		return
+	}
+	_, err = b.db.HSet(ctx, b.Key.Key(), hash, value).Result()
+	if err != nil {
+		return fmt.Errorf("Failed to skip tx %s %v", hash, err)
+	}
+	b.audit(ctx, audit)
+	log.Info("Tx marked to skip", "hash", hash, "operator", entry.Operator, "reason", entry.Reason, "expiry", entry.Expiry, "dst_chain", entry.DstChain)
 	return
 }
 
+func (b *RedisSkipCheck) Unskip(ctx context.Context, entry *SkipEntry) (ok bool, err error) {
+	hash, _, audit, err := skipRecord("unskip", entry)
+	if err != nil {
+		return
+	}
+	n, err := b.db.HDel(ctx, b.Key.Key(), hash).Result()
+	if err != nil {
+		return false, fmt.Errorf("Failed to unskip tx %s %v", hash, err)
+	}
+	if n > 0 {
+		b.audit(ctx, audit)
+		log.Info("Tx unmarked to skip", "hash", hash, "operator", entry.Operator, "reason", entry.Reason)
+	}
+	return n > 0, nil
+}
+
+func (b *RedisSkipCheck) ListSkip(ctx context.Context) (entries []*SkipEntry, err error) {
+	res, err := b.db.HGetAll(ctx, b.Key.Key()).Result()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list skipped txs %v", err)
+	}
+	for hash, value := range res {
+		entries = append(entries, parseSkipEntry(hash, value))
+	}
+	sortSkipEntries(entries)
+	return
+}
+
+func (b *RedisSkipCheck) SkipAudit(ctx context.Context, limit int) ([]*SkipAudit, error) {
+	res, err := b.db.LRange(ctx, b.auditKey(), int64(-limit), -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read skip audit %v", err)
+	}
+	return parseSkipAudits(res), nil
+}
+
 func (b *RedisSkipCheck) CheckSkip(ctx context.Context, tx *msg.Tx) (skip bool, err error) {
 	hashes := formatHashes(tx.SrcHash, tx.PolyHash)
-	var res string
+	now := time.Now()
 	for _, hash := range hashes {
-		res, err = b.db.HGet(ctx, b.Key.Key(), hash).Result()
-		if res == "true" {
+		res, e := b.db.HGet(ctx, b.Key.Key(), hash).Result()
+		if e != nil {
+			if e != redis.Nil {
+				err = e
+			}
+			continue
+		}
+		if parseSkipEntry(hash, res).Match(tx, now) {
 			return true, nil
 		}
 	}
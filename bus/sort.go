@@ -21,39 +21,165 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/polynetwork/bridge-common/base"
+	"github.com/polynetwork/bridge-common/log"
 	"github.com/polynetwork/poly-relayer/msg"
 )
 
 type SortedTxQueueKey TxQueueKey
 
 func (k *SortedTxQueueKey) Key() string {
-	return fmt.Sprintf("%s:relayer:sorted_bus:%v:%v", base.ENV, k.ChainId, k.TxType)
+	return fmt.Sprintf("%s:relayer:sorted_bus:%s", base.ENV, queueSlot(k.ChainId, k.TxType, k.HashTag))
+}
+
+// Lease the first ready entry which is not leased by others
+// KEYS: queue, lease; ARGV: height, now, lease deadline
+var claimSorted = redis.NewScript(`
+redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', ARGV[2])
+local offset = 0
+while true do
+	local items = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'WITHSCORES', 'LIMIT', offset, 100)
+	if #items == 0 then
+		return {}
+	end
+	for i = 1, #items, 2 do
+		if not redis.call('ZSCORE', KEYS[2], items[i]) then
+			redis.call('ZADD', KEYS[2], ARGV[3], items[i])
+			return {items[i], items[i + 1]}
+		end
+	end
+	offset = offset + 100
+end
+`)
+
+// Read the ready entries which are not leased by others, expired leases are ignored
+// KEYS: queue, lease; ARGV: height, now, count
+var peekSorted = redis.NewScript(`
+local res = {}
+local count = tonumber(ARGV[3])
+local offset = 0
+while #res < count do
+	local items = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', offset, 100)
+	if #items == 0 then
+		break
+	end
+	for i = 1, #items do
+		local deadline = tonumber(redis.call('ZSCORE', KEYS[2], items[i]))
+		if not deadline or deadline <= tonumber(ARGV[2]) then
+			res[#res + 1] = items[i]
+			if #res >= count then
+				break
+			end
+		end
+	end
+	offset = offset + 100
+end
+return res
+`)
+
+// Add the tx and replace the previous entry of the same idempotency key. The lease of the replaced entry is
+// cleared, so the tx is visible again and the ack of the lease holder does not drop it. A requeue by the lease
+// holder is skipped if the lease was lost, e.g. the tx was re-pushed meanwhile.
+// KEYS: queue, lease, index; ARGV: score, member, idempotency key, requeued member, lease deadline
+var pushSorted = redis.NewScript(`
+if ARGV[4] ~= '' then
+	if tonumber(redis.call('ZSCORE', KEYS[2], ARGV[4])) ~= tonumber(ARGV[5]) then
+		return 0
+	end
+	redis.call('ZREM', KEYS[1], ARGV[4])
+	redis.call('ZREM', KEYS[2], ARGV[4])
+end
+if ARGV[3] ~= '' then
+	local old = redis.call('HGET', KEYS[3], ARGV[3])
+	if old and old ~= ARGV[2] then
+		redis.call('ZREM', KEYS[1], old)
+		redis.call('ZREM', KEYS[2], old)
+	end
+	redis.call('HSET', KEYS[3], ARGV[3], ARGV[2])
+end
+redis.call('ZREM', KEYS[2], ARGV[2])
+return redis.call('ZADD', KEYS[1], ARGV[1], ARGV[2])
+`)
+
+// Remove the entry and its index if not replaced yet. With a lease deadline, the entry is removed only if the
+// lease is still held, otherwise it was re-pushed or is visible to other consumers again.
+// KEYS: queue, lease, index; ARGV: member, idempotency key, lease deadline
+var dropSorted = redis.NewScript(`
+if ARGV[3] ~= '' and tonumber(redis.call('ZSCORE', KEYS[2], ARGV[1])) ~= tonumber(ARGV[3]) then
+	return 0
+end
+local n = redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('ZREM', KEYS[2], ARGV[1])
+if ARGV[2] ~= '' and redis.call('HGET', KEYS[3], ARGV[2]) == ARGV[1] then
+	redis.call('HDEL', KEYS[3], ARGV[2])
+end
+return n
+`)
+
+// Read the array reply of the lua script
+func scriptStrings(cmd *redis.Cmd) (items []string, err error) {
+	res, err := cmd.Result()
+	if err != nil {
+		return
+	}
+	values, ok := res.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Unexpected script reply %v", res)
+	}
+	for _, v := range values {
+		item, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("Unexpected script reply item %v", v)
+		}
+		items = append(items, item)
+	}
+	return
 }
 
 type SortedTxBus interface {
 	Push(context.Context, *msg.Tx, uint64) error
 	Range(context.Context, uint64, int64) ([]*msg.Tx, error)
 	Pop(context.Context) (*msg.Tx, uint64, error)
+	Claim(context.Context, uint64) (*msg.Tx, uint64, error)
+	Ack(context.Context, *msg.Tx) error
+	Requeue(context.Context, *msg.Tx, uint64) error
+	PeekReady(context.Context, uint64, int64) ([]*msg.Tx, error)
 	Len(context.Context) (uint64, error)
 	Topic() string
 }
 
 type RedisSortedTxBus struct {
 	Key
-	db *redis.Client
+	db      redis.UniversalClient
+	timeout time.Duration
+	leases  leases
+	codec   *msg.Codec
 }
 
-func NewRedisSortedTxBus(db *redis.Client, chainId uint64, txType msg.TxType) *RedisSortedTxBus {
+func NewRedisSortedTxBus(db redis.UniversalClient, chainId uint64, txType msg.TxType) *RedisSortedTxBus {
 	bus := &RedisSortedTxBus{
 		db:  db,
-		Key: &SortedTxQueueKey{ChainId: chainId, TxType: txType},
+		Key: &SortedTxQueueKey{ChainId: chainId, TxType: txType, HashTag: isCluster(db)},
 	}
 	return bus
 }
 
+func (b *RedisSortedTxBus) leaseKey() string {
+	return fmt.Sprintf("%s:lease", b.Key.Key())
+}
+
+// Index of the entries by the tx idempotency key, re-pushed txs replace the indexed entries
+func (b *RedisSortedTxBus) indexKey() string {
+	return queueIndexKey(b.Key)
+}
+
+func (b *RedisSortedTxBus) keys() []string {
+	return []string{b.Key.Key(), b.leaseKey(), b.indexKey()}
+}
+
 func (b *RedisSortedTxBus) Topic() (topic string) {
 	return b.Key.Key()
 }
@@ -66,20 +192,19 @@ func (b *RedisSortedTxBus) Len(ctx context.Context) (uint64, error) {
 	return uint64(v), nil
 }
 
+// Push the tx at the height, the queued entry of the same tx is replaced
 func (b *RedisSortedTxBus) Push(ctx context.Context, msg *msg.Tx, height uint64) (err error) {
-	_, err = b.db.ZAdd(ctx, b.Key.Key(),
-		&redis.Z{
-			Score:  float64(height),
-			Member: msg.Encode(),
-		},
-	).Result()
-	return
+	err = pushSorted.Run(ctx, b.db, b.keys(), height, b.codec.Encode(msg), msg.IdempotencyKey(), "", "").Err()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("Failed to push sorted tx %v", err)
+	}
+	return nil
 }
 
 func (b *RedisSortedTxBus) Range(ctx context.Context, height uint64, count int64) (txs []*msg.Tx, err error) {
 	max := strconv.Itoa(int(height))
 	res, err := b.db.ZRangeByScore(ctx, b.Key.Key(),
-		&redis.ZRangeBy{Max: max, Count: count},
+		&redis.ZRangeBy{Min: "-inf", Max: max, Count: count},
 	).Result()
 	if err != nil {
 		return
@@ -100,7 +225,18 @@ func (b *RedisSortedTxBus) Range(ctx context.Context, height uint64, count int64
 }
 
 func (b *RedisSortedTxBus) Pop(ctx context.Context) (tx *msg.Tx, score uint64, err error) {
-	res, err := b.db.BZPopMin(ctx, 0, b.Key.Key()).Result()
+	var res *redis.ZWithKey
+	for {
+		// Block in short rounds, a blocking command is not interrupted by the context
+		res, err = b.db.BZPopMin(ctx, BLOCK_INTERVAL, b.Key.Key()).Result()
+		if err != redis.Nil {
+			break
+		}
+		if ctx.Err() != nil {
+			err = ctx.Err()
+			return
+		}
+	}
 	if err != nil {
 		return
 	}
@@ -108,7 +244,110 @@ func (b *RedisSortedTxBus) Pop(ctx context.Context) (tx *msg.Tx, score uint64, e
 		return
 	}
 	score = uint64(res.Score)
+	raw := res.Member.(string)
 	tx = new(msg.Tx)
-	err = tx.Decode(res.Member.(string))
+	err = tx.Decode(raw)
+	if err == nil {
+		err = dropSorted.Run(ctx, b.db, b.keys(), raw, tx.IdempotencyKey(), "").Err()
+	}
+	return
+}
+
+// Lease deadline of the claims made now
+func (b *RedisSortedTxBus) deadline() int64 {
+	timeout := b.timeout
+	if timeout == 0 {
+		timeout = DEFAULT_VISIBILITY_TIMEOUT
+	}
+	return time.Now().Add(timeout).UnixNano() / int64(time.Millisecond)
+}
+
+// Claim leases the first tx whose score is not above the height, the tx stays in the queue until acked or requeued,
+// and is visible to other consumers again once the lease expires. Undecodable entries are dropped.
+func (b *RedisSortedTxBus) Claim(ctx context.Context, height uint64) (tx *msg.Tx, score uint64, err error) {
+	for {
+		deadline := b.deadline()
+		res, err := scriptStrings(claimSorted.Run(ctx, b.db, []string{b.Key.Key(), b.leaseKey()},
+			height, time.Now().UnixNano()/int64(time.Millisecond), deadline))
+		if err == redis.Nil || (err == nil && len(res) < 2) {
+			return nil, 0, nil
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("Failed to claim sorted tx %v", err)
+		}
+		value, err := strconv.ParseFloat(res[1], 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("Invalid sorted tx score %s %v", res[1], err)
+		}
+		tx = new(msg.Tx)
+		err = tx.Decode(res[0])
+		if err != nil {
+			log.Error("Dropping invalid sorted tx", "key", b.Key.Key(), "body", res[0], "err", err)
+			err = dropSorted.Run(ctx, b.db, b.keys(), res[0], "", deadline).Err()
+			if err != nil {
+				return nil, 0, fmt.Errorf("Failed to drop invalid sorted tx %v", err)
+			}
+			continue
+		}
+		b.leases.hold(tx, lease{raw: res[0], deadline: deadline})
+		return tx, uint64(value), nil
+	}
+}
+
+// Ack removes the claimed tx from the queue, unless it was re-pushed or the lease expired
+func (b *RedisSortedTxBus) Ack(ctx context.Context, tx *msg.Tx) (err error) {
+	l, ok := b.leases.release(tx)
+	if !ok {
+		return
+	}
+	n, err := dropSorted.Run(ctx, b.db, b.keys(), l.raw, tx.IdempotencyKey(), l.deadline).Int64()
+	if err != nil {
+		b.leases.hold(tx, l)
+		return fmt.Errorf("Failed to ack sorted tx %v", err)
+	}
+	if n == 0 {
+		log.Warn("Acked sorted tx was re-pushed or its lease expired", "key", b.Key.Key(), "poly_hash", tx.PolyHash, "src_hash", tx.SrcHash)
+	}
+	return
+}
+
+// Requeue replaces the claimed tx with its latest state at the new height and releases the lease, the re-pushed
+// entry is kept instead if any.
+func (b *RedisSortedTxBus) Requeue(ctx context.Context, tx *msg.Tx, height uint64) (err error) {
+	l, ok := b.leases.release(tx)
+	deadline := ""
+	if ok {
+		deadline = strconv.FormatInt(l.deadline, 10)
+	}
+	err = pushSorted.Run(ctx, b.db, b.keys(), height, b.codec.Encode(tx), tx.IdempotencyKey(), l.raw, deadline).Err()
+	if err != nil {
+		if ok {
+			b.leases.hold(tx, l)
+		}
+		return fmt.Errorf("Failed to requeue sorted tx %v", err)
+	}
+	return
+}
+
+// PeekReady returns at most count txs which are ready at the height and not claimed by others, without leasing them.
+// Undecodable entries are skipped and left for Claim to drop.
+func (b *RedisSortedTxBus) PeekReady(ctx context.Context, height uint64, count int64) (txs []*msg.Tx, err error) {
+	res, err := scriptStrings(peekSorted.Run(ctx, b.db, []string{b.Key.Key(), b.leaseKey()},
+		height, time.Now().UnixNano()/int64(time.Millisecond), count))
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to peek sorted txs %v", err)
+	}
+	for _, item := range res {
+		tx := new(msg.Tx)
+		e := tx.Decode(item)
+		if e != nil {
+			log.Warn("Skipping invalid sorted tx", "key", b.Key.Key(), "body", item, "err", e)
+			continue
+		}
+		txs = append(txs, tx)
+	}
 	return
 }
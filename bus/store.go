@@ -4,17 +4,14 @@ import (
 	"context"
 	"fmt"
 	"strconv"
-	"sync"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/polynetwork/bridge-common/base"
-	"github.com/polynetwork/bridge-common/log"
 )
 
 const (
-	POLY_SYNC = String("poly_sync_running")
-
 	KEY_HEIGHT_HEADER       ChainHeightType = "header_sync"       // chain sync mark
 	KEY_HEIGHT_CHAIN_HEADER ChainHeightType = "chain_header_sync" // chain sync state
 	KEY_HEIGHT_HEADER_RESET ChainHeightType = "header_sync_reset" // chain sync reset
@@ -29,6 +26,31 @@ type ChainStore interface {
 	UpdateHeight(context.Context, uint64) error
 	GetHeight(context.Context) (uint64, error)
 	HeightMark(uint64) error
+	// Fence binds the height updates to the leadership term carried by the context. The term token is
+	// stored along with the height, and the updates with an older token are rejected atomically, ending the term.
+	Fence(context.Context) error
+}
+
+// Update the height only if the fencing token is not older than the one of the latest term, the height is
+// left untouched when empty to claim the fence only
+var fencedHeight = redis.NewScript(`
+local fence = tonumber(redis.call('GET', KEYS[2]) or '0')
+if tonumber(ARGV[2]) < fence then
+	return 0
+end
+redis.call('SET', KEYS[2], ARGV[2])
+if ARGV[1] ~= '' then
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+// Fencing token key of the height, hash tagged to stay in the slot of the height key
+func heightFenceKey(key string) string {
+	if strings.Contains(key, "{") {
+		return key + ":fence"
+	}
+	return "{" + key + "}:fence"
 }
 
 type ChainHeightKey struct {
@@ -43,11 +65,12 @@ func (k ChainHeightKey) Key() string {
 
 type RedisChainStore struct {
 	Key
-	db    *redis.Client
+	db    redis.UniversalClient
 	timer *time.Ticker
+	term  *Term
 }
 
-func NewRedisChainStore(key Key, db *redis.Client, interval uint64) *RedisChainStore {
+func NewRedisChainStore(key Key, db redis.UniversalClient, interval uint64) *RedisChainStore {
 	if interval == 0 {
 		interval = 5
 	}
@@ -60,6 +83,9 @@ func NewRedisChainStore(key Key, db *redis.Client, interval uint64) *RedisChainS
 }
 
 func (s *RedisChainStore) UpdateHeight(ctx context.Context, height uint64) error {
+	if s.term != nil {
+		return s.fenced(ctx, strconv.FormatUint(height, 10))
+	}
 	_, err := s.db.Set(ctx, s.Key.Key(), height, 0).Result()
 	if err != nil {
 		return fmt.Errorf("Failed to update height %v", err)
@@ -67,6 +93,28 @@ func (s *RedisChainStore) UpdateHeight(ctx context.Context, height uint64) error
 	return nil
 }
 
+func (s *RedisChainStore) Fence(ctx context.Context) error {
+	term, ok := termOf(ctx)
+	if !ok {
+		return nil
+	}
+	s.term = term
+	return s.fenced(ctx, "")
+}
+
+func (s *RedisChainStore) fenced(ctx context.Context, height string) error {
+	key := s.Key.Key()
+	ok, err := fencedHeight.Run(ctx, s.db, []string{key, heightFenceKey(key)}, height, s.term.Token).Int64()
+	if err != nil {
+		return fmt.Errorf("Failed to update height %v", err)
+	}
+	if ok != 1 {
+		s.term.lose("fenced by height update")
+		return ErrLeadershipLost
+	}
+	return nil
+}
+
 func (s *RedisChainStore) HeightMark(height uint64) error {
 	select {
 	case <-s.timer.C:
@@ -85,51 +133,3 @@ func (s *RedisChainStore) GetHeight(ctx context.Context) (height uint64, err err
 	height = uint64(h)
 	return
 }
-
-// A simple redis lock used to hint running status, avoid concurrencies
-type Lock struct {
-	key Key
-	db  *redis.Client
-	ctx context.Context
-	wg  *sync.WaitGroup
-}
-
-func NewStatusLock(db *redis.Client, key Key) *Lock {
-	return &Lock{key: key, db: db, ctx: context.Background()}
-}
-
-func (l *Lock) Start(ctx context.Context, wg *sync.WaitGroup) (ok bool, err error) {
-	l.wg = wg
-	l.ctx = ctx
-	ok, err = l.db.SetNX(context.Background(), l.key.Key(), time.Now(), 60*time.Second).Result()
-	if ok {
-		go l.start()
-	}
-	return
-}
-
-func (l *Lock) start() {
-	defer l.stop()
-	l.wg.Add(1)
-	timer := time.NewTicker(10 * time.Second)
-	defer timer.Stop()
-	for {
-		select {
-		case <-l.ctx.Done():
-			return
-		case <-timer.C:
-			_, err := l.db.Set(context.Background(), l.key.Key(), time.Now(), 60*time.Second).Result()
-			if err != nil {
-				log.Error("Failed to update redis status lock", "key", l.key.Key())
-			}
-		}
-	}
-}
-
-func (l *Lock) stop() {
-	_, err := l.db.Del(context.Background(), l.key.Key()).Result()
-	if err != nil {
-		log.Error("Failed to remove redis status lock", "key", l.key.Key())
-	}
-	l.wg.Done()
-}
@@ -0,0 +1,780 @@
+/*
+ * Copyright (C) 2021 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package bus
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/polynetwork/bridge-common/base"
+	"github.com/polynetwork/bridge-common/log"
+	"github.com/polynetwork/bridge-common/util"
+	"github.com/polynetwork/poly-relayer/msg"
+)
+
+func nowMs() float64 {
+	return float64(time.Now().UnixNano() / int64(time.Millisecond))
+}
+
+func decodeTx(raw string) (tx *msg.Tx, err error) {
+	tx = new(msg.Tx)
+	err = tx.Decode(raw)
+	return
+}
+
+// StoreTxBus is the list queue on a Store, works as RedisReliableTxBus when consumer is set
+type StoreTxBus struct {
+	Key
+	store    Store
+	consumer string
+	timeout  time.Duration
+	leases   leases
+	codec    *msg.Codec
+}
+
+func NewStoreTxBus(store Store, chainId uint64, txType msg.TxType) *StoreTxBus {
+	return &StoreTxBus{Key: &TxQueueKey{ChainId: chainId, TxType: txType}, store: store}
+}
+
+func NewStorePatchTxBus(store Store, chainId uint64) *StoreTxBus {
+	return &StoreTxBus{Key: NewPatchKey(chainId), store: store}
+}
+
+// Enable ack based at least once delivery
+func (b *StoreTxBus) WithAck(consumer string, timeout time.Duration) *StoreTxBus {
+	if consumer == "" {
+		consumer = ConsumerName()
+	}
+	if timeout == 0 {
+		timeout = DEFAULT_VISIBILITY_TIMEOUT
+	}
+	b.consumer = consumer
+	b.timeout = timeout
+	return b
+}
+
+func (b *StoreTxBus) inflightKey() string {
+	return fmt.Sprintf("%s:inflight:%s", b.Key.Key(), b.consumer)
+}
+
+func (b *StoreTxBus) consumersKey() string {
+	return fmt.Sprintf("%s:consumers", b.Key.Key())
+}
+
+func (b *StoreTxBus) Topic() string {
+	return b.Key.Key()
+}
+
+func (b *StoreTxBus) Pop(ctx context.Context) (*msg.Tx, error) {
+	return b.PopTimed(ctx, 0)
+}
+
+func (b *StoreTxBus) PopTimed(ctx context.Context, duration time.Duration) (*msg.Tx, error) {
+	var deadline time.Time
+	if duration > 0 {
+		deadline = time.Now().Add(duration)
+	}
+	key := b.Key.Key()
+	for {
+		var (
+			raw string
+			ok  bool
+		)
+		id := newLeaseId()
+		err := b.store.Update(func(tx StoreTx) error {
+			if b.consumer != "" {
+				b.reap(tx)
+			}
+			raw, ok = tx.LPop(key)
+			if ok && b.consumer != "" {
+				tx.ZAdd(b.inflightKey(), id+raw, nowMs()+float64(b.timeout/time.Millisecond))
+				tx.HSet(b.consumersKey(), b.inflightKey(), b.consumer)
+			} else if ok {
+				b.unindex(tx, raw)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Failed to pop message %v", err)
+		}
+		if ok {
+			tx, err := decodeTx(raw)
+			if err == nil && b.consumer != "" {
+				b.leases.hold(tx, lease{raw: raw, id: id})
+			}
+			return tx, err
+		}
+		if !waitStore(ctx, b.store, key, deadline) {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("Failed to pop message %v", ctx.Err())
+			}
+			return nil, nil
+		}
+	}
+}
+
+// Put the expired in-flight messages of all the consumers back to the queue head
+func (b *StoreTxBus) reap(tx StoreTx) {
+	now := nowMs()
+	for inflight := range tx.HGetAll(b.consumersKey()) {
+		items := tx.ZRangeByScore(inflight, math.Inf(-1), now, 0)
+		for i := len(items) - 1; i >= 0; i-- {
+			tx.ZRem(inflight, items[i].Member)
+			raw := items[i].Member[leaseIdSize:]
+			if tx.HDel(listReplacedKey(b.Key.Key()), raw) == 0 {
+				tx.LPush(b.Key.Key(), raw)
+			}
+		}
+		if len(items) > 0 {
+			log.Warn("Put back in-flight txs for visibility timeout", "key", inflight, "count", len(items))
+		}
+	}
+}
+
+func (b *StoreTxBus) Ack(ctx context.Context, tx *msg.Tx) error {
+	l, ok := b.leases.release(tx)
+	if !ok {
+		return nil
+	}
+	return b.store.Update(func(t StoreTx) error {
+		if t.ZRem(b.inflightKey(), l.member()) == 0 {
+			log.Warn("Acked tx was already put back for visibility timeout", "key", b.Key.Key(), "poly_hash", tx.PolyHash, "src_hash", tx.SrcHash)
+		} else {
+			b.unindex(t, l.raw)
+		}
+		return nil
+	})
+}
+
+// Push to the list and remove the queued entry of the same idempotency key, same as the redis pushList script
+func pushStoreList(t StoreTx, key, index, member, id string, front bool) {
+	if index != "" && id != "" {
+		if old, ok := t.HGet(index, id); ok && !lrem(t, key, old) {
+			t.HSet(listReplacedKey(key), old, id)
+		}
+		t.HSet(index, id, member)
+	}
+	if front {
+		t.LPush(key, member)
+	} else {
+		t.RPush(key, member)
+	}
+}
+
+// Remove the index of the entry which left the list if not replaced yet, same as the redis unindexTx script
+func unindexStore(t StoreTx, key, index, member, id string) {
+	if index == "" || id == "" {
+		return
+	}
+	t.HDel(listReplacedKey(key), member)
+	if v, ok := t.HGet(index, id); ok && v == member {
+		t.HDel(index, id)
+	}
+}
+
+func (b *StoreTxBus) unindex(t StoreTx, raw string) {
+	if tx, err := decodeTx(raw); err == nil {
+		unindexStore(t, b.Key.Key(), listIndexKey(b.Key), raw, tx.IdempotencyKey())
+	}
+}
+
+func (b *StoreTxBus) push(key Key, tx *msg.Tx, front bool) error {
+	return b.store.Update(func(t StoreTx) error {
+		pushStoreList(t, key.Key(), listIndexKey(key), b.codec.Encode(tx), tx.IdempotencyKey(), front)
+		return nil
+	})
+}
+
+func (b *StoreTxBus) Push(ctx context.Context, tx *msg.Tx) error {
+	return b.push(b.Key, tx, false)
+}
+
+func (b *StoreTxBus) PushToChain(ctx context.Context, tx *msg.Tx) error {
+	return b.push(GetQueue(tx), tx, false)
+}
+
+func (b *StoreTxBus) PushBack(ctx context.Context, tx *msg.Tx) error {
+	return b.push(GetQueue(tx), tx, true)
+}
+
+func (b *StoreTxBus) Patch(ctx context.Context, tx *msg.Tx) error {
+	chain := tx.SrcChainId
+	if tx.Type() == msg.POLY {
+		chain = base.POLY
+	}
+	return b.push(NewPatchKey(chain), tx, false)
+}
+
+func (b *StoreTxBus) len(key string) (count uint64, err error) {
+	err = b.store.View(func(tx StoreTx) error {
+		count = uint64(tx.LLen(key))
+		return nil
+	})
+	return
+}
+
+func (b *StoreTxBus) Len(ctx context.Context) (uint64, error) {
+	return b.len(b.Key.Key())
+}
+
+func (b *StoreTxBus) LenOf(ctx context.Context, chain uint64, ty msg.TxType) (uint64, error) {
+	return b.len((&TxQueueKey{ChainId: chain, TxType: ty}).Key())
+}
+
+type StoreSortedTxBus struct {
+	Key
+	store   Store
+	timeout time.Duration
+	leases  leases
+	codec   *msg.Codec
+}
+
+func NewStoreSortedTxBus(store Store, chainId uint64, txType msg.TxType) *StoreSortedTxBus {
+	return &StoreSortedTxBus{Key: &SortedTxQueueKey{ChainId: chainId, TxType: txType}, store: store}
+}
+
+func (b *StoreSortedTxBus) leaseKey() string {
+	return fmt.Sprintf("%s:lease", b.Key.Key())
+}
+
+func (b *StoreSortedTxBus) indexKey() string {
+	return queueIndexKey(b.Key)
+}
+
+// Check whether the entry is still leased with the deadline
+func (b *StoreSortedTxBus) held(t StoreTx, l lease) bool {
+	deadline, ok := t.ZScore(b.leaseKey(), l.raw)
+	return ok && deadline == float64(l.deadline)
+}
+
+// Add the entry and replace the previous entry of the same idempotency key, same as the redis pushSorted script
+func (b *StoreSortedTxBus) push(t StoreTx, member, id string, score float64, requeued *lease) {
+	key := b.Key.Key()
+	if requeued != nil {
+		if !b.held(t, *requeued) {
+			return
+		}
+		t.ZRem(key, requeued.raw)
+		t.ZRem(b.leaseKey(), requeued.raw)
+	}
+	if id != "" {
+		old, ok := t.HGet(b.indexKey(), id)
+		if ok && old != member {
+			t.ZRem(key, old)
+			t.ZRem(b.leaseKey(), old)
+		}
+		t.HSet(b.indexKey(), id, member)
+	}
+	t.ZRem(b.leaseKey(), member)
+	t.ZAdd(key, member, score)
+}
+
+// Remove the entry and its index if not replaced yet
+func (b *StoreSortedTxBus) drop(t StoreTx, raw, id string) (ok bool) {
+	ok = t.ZRem(b.Key.Key(), raw) > 0
+	t.ZRem(b.leaseKey(), raw)
+	if id != "" {
+		if v, indexed := t.HGet(b.indexKey(), id); indexed && v == raw {
+			t.HDel(b.indexKey(), id)
+		}
+	}
+	return
+}
+
+func (b *StoreSortedTxBus) Topic() string {
+	return b.Key.Key()
+}
+
+func (b *StoreSortedTxBus) Len(ctx context.Context) (count uint64, err error) {
+	err = b.store.View(func(tx StoreTx) error {
+		count = uint64(tx.ZCard(b.Key.Key()))
+		return nil
+	})
+	return
+}
+
+func (b *StoreSortedTxBus) Push(ctx context.Context, tx *msg.Tx, height uint64) error {
+	return b.store.Update(func(t StoreTx) error {
+		b.push(t, b.codec.Encode(tx), tx.IdempotencyKey(), float64(height), nil)
+		return nil
+	})
+}
+
+func (b *StoreSortedTxBus) Range(ctx context.Context, height uint64, count int64) (txs []*msg.Tx, err error) {
+	var items []Z
+	err = b.store.View(func(tx StoreTx) error {
+		items = tx.ZRangeByScore(b.Key.Key(), math.Inf(-1), float64(height), int(count))
+		return nil
+	})
+	for _, item := range items {
+		tx, e := decodeTx(item.Member)
+		if e != nil {
+			err = e
+		}
+		txs = append(txs, tx)
+	}
+	return
+}
+
+func (b *StoreSortedTxBus) Pop(ctx context.Context) (tx *msg.Tx, score uint64, err error) {
+	key := b.Key.Key()
+	for {
+		var (
+			items     []Z
+			decodeErr error
+		)
+		err = b.store.Update(func(t StoreTx) error {
+			items = t.ZRangeByScore(key, math.Inf(-1), math.Inf(1), 1)
+			if len(items) > 0 {
+				tx, decodeErr = decodeTx(items[0].Member)
+				id := ""
+				if decodeErr == nil {
+					id = tx.IdempotencyKey()
+				}
+				b.drop(t, items[0].Member, id)
+			}
+			return nil
+		})
+		if err != nil {
+			return
+		}
+		if len(items) > 0 {
+			return tx, uint64(items[0].Score), decodeErr
+		}
+		if !waitStore(ctx, b.store, key, time.Time{}) {
+			return nil, 0, ctx.Err()
+		}
+	}
+}
+
+// Lease deadline of the claims made now
+func (b *StoreSortedTxBus) deadline() int64 {
+	timeout := b.timeout
+	if timeout == 0 {
+		timeout = DEFAULT_VISIBILITY_TIMEOUT
+	}
+	return int64(nowMs()) + int64(timeout/time.Millisecond)
+}
+
+// Claim leases the first ready tx which is not leased by others, same as the redis claimSorted script.
+// Undecodable entries are dropped.
+func (b *StoreSortedTxBus) Claim(ctx context.Context, height uint64) (tx *msg.Tx, score uint64, err error) {
+	deadline := b.deadline()
+	var raw string
+	err = b.store.Update(func(t StoreTx) error {
+		now := nowMs()
+		leased := map[string]bool{}
+		for _, item := range t.ZRangeByScore(b.leaseKey(), math.Inf(-1), math.Inf(1), 0) {
+			if item.Score > now {
+				leased[item.Member] = true
+			} else {
+				t.ZRem(b.leaseKey(), item.Member)
+			}
+		}
+		for _, item := range t.ZRangeByScore(b.Key.Key(), math.Inf(-1), float64(height), 0) {
+			if leased[item.Member] {
+				continue
+			}
+			v, e := decodeTx(item.Member)
+			if e != nil {
+				log.Error("Dropping invalid sorted tx", "key", b.Key.Key(), "body", item.Member, "err", e)
+				b.drop(t, item.Member, "")
+				continue
+			}
+			t.ZAdd(b.leaseKey(), item.Member, float64(deadline))
+			tx, score, raw = v, uint64(item.Score), item.Member
+			return nil
+		}
+		return nil
+	})
+	if err != nil || tx == nil {
+		return nil, 0, err
+	}
+	b.leases.hold(tx, lease{raw: raw, deadline: deadline})
+	return
+}
+
+// PeekReady returns at most count ready txs which are not claimed by others, same as the redis peekSorted script
+func (b *StoreSortedTxBus) PeekReady(ctx context.Context, height uint64, count int64) (txs []*msg.Tx, err error) {
+	err = b.store.View(func(t StoreTx) error {
+		now := nowMs()
+		for _, item := range t.ZRangeByScore(b.Key.Key(), math.Inf(-1), float64(height), 0) {
+			if int64(len(txs)) >= count {
+				break
+			}
+			if deadline, leased := t.ZScore(b.leaseKey(), item.Member); leased && deadline > now {
+				continue
+			}
+			tx, e := decodeTx(item.Member)
+			if e != nil {
+				log.Warn("Skipping invalid sorted tx", "key", b.Key.Key(), "body", item.Member, "err", e)
+				continue
+			}
+			txs = append(txs, tx)
+		}
+		return nil
+	})
+	return
+}
+
+func (b *StoreSortedTxBus) Ack(ctx context.Context, tx *msg.Tx) error {
+	l, ok := b.leases.release(tx)
+	if !ok {
+		return nil
+	}
+	return b.store.Update(func(t StoreTx) error {
+		if !b.held(t, l) {
+			log.Warn("Acked sorted tx was re-pushed or its lease expired", "key", b.Key.Key(), "poly_hash", tx.PolyHash, "src_hash", tx.SrcHash)
+			return nil
+		}
+		b.drop(t, l.raw, tx.IdempotencyKey())
+		return nil
+	})
+}
+
+func (b *StoreSortedTxBus) Requeue(ctx context.Context, tx *msg.Tx, height uint64) error {
+	l, ok := b.leases.release(tx)
+	return b.store.Update(func(t StoreTx) error {
+		var requeued *lease
+		if ok {
+			requeued = &l
+		}
+		b.push(t, b.codec.Encode(tx), tx.IdempotencyKey(), float64(height), requeued)
+		return nil
+	})
+}
+
+type StoreDelayedTxBus struct {
+	Key
+	store Store
+	codec *msg.Codec
+}
+
+func NewStoreDelayedTxBus(store Store, chainId uint64, txType msg.TxType) *StoreDelayedTxBus {
+	return &StoreDelayedTxBus{Key: &DelayedTxQueueKey{ChainId: chainId, TxType: txType}, store: store}
+}
+
+func NewStoreLegacyDelayedTxBus(store Store) *StoreDelayedTxBus {
+	return &StoreDelayedTxBus{Key: String("delayed_tx"), store: store}
+}
+
+func (b *StoreDelayedTxBus) Topic() string {
+	return b.Key.Key()
+}
+
+func (b *StoreDelayedTxBus) Len(ctx context.Context) (count uint64, err error) {
+	err = b.store.View(func(tx StoreTx) error {
+		count = uint64(len(tx.ZRangeByScore(b.Key.Key(), 0, float64(time.Now().Unix()), 0)))
+		return nil
+	})
+	return
+}
+
+func (b *StoreDelayedTxBus) Delay(ctx context.Context, tx *msg.Tx, delay int64) error {
+	return b.store.Update(func(t StoreTx) error {
+		t.ZAdd(b.Key.Key(), b.codec.Encode(tx), float64(delay))
+		return nil
+	})
+}
+
+func (b *StoreDelayedTxBus) PopDue(ctx context.Context, count int64) (txs []*msg.Tx, err error) {
+	var items []Z
+	err = b.store.Update(func(t StoreTx) error {
+		items = t.ZRangeByScore(b.Key.Key(), math.Inf(-1), float64(time.Now().Unix()), int(count))
+		for _, item := range items {
+			t.ZRem(b.Key.Key(), item.Member)
+		}
+		return nil
+	})
+	for _, item := range items {
+		tx, e := decodeTx(item.Member)
+		if e != nil {
+			log.Error("Failed to decode delayed tx", "body", item.Member, "err", e)
+			continue
+		}
+		txs = append(txs, tx)
+	}
+	return
+}
+
+type StoreChainStore struct {
+	Key
+	store Store
+	timer *time.Ticker
+	term  *Term
+}
+
+func NewStoreChainStore(key Key, store Store, interval uint64) *StoreChainStore {
+	if interval == 0 {
+		interval = 5
+	}
+	return &StoreChainStore{
+		Key:   key,
+		store: store,
+		timer: time.NewTicker(time.Duration(interval) * time.Second),
+	}
+}
+
+func (s *StoreChainStore) UpdateHeight(ctx context.Context, height uint64) error {
+	if s.term != nil {
+		return s.fenced(strconv.FormatUint(height, 10))
+	}
+	return s.store.Update(func(tx StoreTx) error {
+		tx.Set(s.Key.Key(), strconv.FormatUint(height, 10), 0)
+		return nil
+	})
+}
+
+func (s *StoreChainStore) Fence(ctx context.Context) error {
+	term, ok := termOf(ctx)
+	if !ok {
+		return nil
+	}
+	s.term = term
+	return s.fenced("")
+}
+
+func (s *StoreChainStore) fenced(height string) error {
+	ok := false
+	err := s.store.Update(func(tx StoreTx) error {
+		key := heightFenceKey(s.Key.Key())
+		v, _ := tx.Get(key)
+		fence, _ := strconv.ParseUint(v, 10, 64)
+		if s.term.Token < fence {
+			return nil
+		}
+		ok = true
+		tx.Set(key, strconv.FormatUint(s.term.Token, 10), 0)
+		if height != "" {
+			tx.Set(s.Key.Key(), height, 0)
+		}
+		return nil
+	})
+	if err == nil && !ok {
+		s.term.lose("fenced by height update")
+		err = ErrLeadershipLost
+	}
+	return err
+}
+
+func (s *StoreChainStore) HeightMark(height uint64) error {
+	select {
+	case <-s.timer.C:
+	default:
+		return nil
+	}
+	return s.UpdateHeight(context.Background(), height)
+}
+
+func (s *StoreChainStore) GetHeight(ctx context.Context) (height uint64, err error) {
+	var (
+		v  string
+		ok bool
+	)
+	err = s.store.View(func(tx StoreTx) error {
+		v, ok = tx.Get(s.Key.Key())
+		return nil
+	})
+	if err == nil && !ok {
+		err = fmt.Errorf("Get chain height error %s not found", s.Key.Key())
+	}
+	if err != nil {
+		return
+	}
+	h, _ := strconv.Atoi(v)
+	height = uint64(h)
+	return
+}
+
+type StoreSkipCheck struct {
+	Key
+	store Store
+}
+
+func NewStoreSkipCheck(store Store) *StoreSkipCheck {
+	return &StoreSkipCheck{String("skip_map"), store}
+}
+
+func (b *StoreSkipCheck) auditKey() string {
+	return String("skip_audit").Key()
+}
+
+func (b *StoreSkipCheck) audit(t StoreTx, audit string) {
+	t.RPush(b.auditKey(), audit)
+	for t.LLen(b.auditKey()) > SKIP_AUDIT_LIMIT {
+		t.LPop(b.auditKey())
+	}
+}
+
+func (b *StoreSkipCheck) Skip(ctx context.Context, entry *SkipEntry) error {
+	hash, value, audit, err := skipRecord("skip", entry)
+	if err != nil {
+		return err
+	}
+	err = b.store.Update(func(t StoreTx) error {
+		t.HSet(b.Key.Key(), hash, value)
+		b.audit(t, audit)
+		return nil
+	})
+	if err == nil {
+		log.Info("Tx marked to skip", "hash", hash, "operator", entry.Operator, "reason", entry.Reason, "expiry", entry.Expiry, "dst_chain", entry.DstChain)
+	}
+	return err
+}
+
+func (b *StoreSkipCheck) Unskip(ctx context.Context, entry *SkipEntry) (ok bool, err error) {
+	hash, _, audit, err := skipRecord("unskip", entry)
+	if err != nil {
+		return
+	}
+	err = b.store.Update(func(t StoreTx) error {
+		ok = t.HDel(b.Key.Key(), hash) > 0
+		if ok {
+			b.audit(t, audit)
+		}
+		return nil
+	})
+	if ok && err == nil {
+		log.Info("Tx unmarked to skip", "hash", hash, "operator", entry.Operator, "reason", entry.Reason)
+	}
+	return
+}
+
+func (b *StoreSkipCheck) ListSkip(ctx context.Context) (entries []*SkipEntry, err error) {
+	err = b.store.View(func(t StoreTx) error {
+		for hash, value := range t.HGetAll(b.Key.Key()) {
+			entries = append(entries, parseSkipEntry(hash, value))
+		}
+		return nil
+	})
+	sortSkipEntries(entries)
+	return
+}
+
+func (b *StoreSkipCheck) SkipAudit(ctx context.Context, limit int) (audits []*SkipAudit, err error) {
+	var items []string
+	err = b.store.View(func(t StoreTx) error {
+		items = t.LRange(b.auditKey())
+		return nil
+	})
+	if limit > 0 && len(items) > limit {
+		items = items[len(items)-limit:]
+	}
+	return parseSkipAudits(items), err
+}
+
+func (b *StoreSkipCheck) CheckSkip(ctx context.Context, tx *msg.Tx) (skip bool, err error) {
+	hashes := formatHashes(tx.SrcHash, tx.PolyHash)
+	now := time.Now()
+	err = b.store.View(func(t StoreTx) error {
+		for _, hash := range hashes {
+			if v, ok := t.HGet(b.Key.Key(), hash); ok && parseSkipEntry(hash, v).Match(tx, now) {
+				skip = true
+			}
+		}
+		return nil
+	})
+	return
+}
+
+type StoreDeadLetterBus struct {
+	Key
+	store Store
+	codec *msg.Codec
+}
+
+func NewStoreDeadLetterBus(store Store, chainId uint64, txType msg.TxType) *StoreDeadLetterBus {
+	return &StoreDeadLetterBus{Key: &DeadLetterKey{ChainId: chainId, TxType: txType}, store: store}
+}
+
+func (b *StoreDeadLetterBus) Topic() string {
+	return b.Key.Key()
+}
+
+func (b *StoreDeadLetterBus) Put(ctx context.Context, tx *msg.Tx) error {
+	return b.store.Update(func(t StoreTx) error {
+		t.HSet(b.Key.Key(), DeadLetterId(tx), b.codec.Encode(tx))
+		return nil
+	})
+}
+
+func (b *StoreDeadLetterBus) Get(ctx context.Context, id string) (tx *msg.Tx, err error) {
+	var (
+		raw string
+		ok  bool
+	)
+	err = b.store.View(func(t StoreTx) error {
+		raw, ok = t.HGet(b.Key.Key(), util.LowerHex(id))
+		return nil
+	})
+	if err != nil || !ok {
+		return
+	}
+	return decodeTx(raw)
+}
+
+func (b *StoreDeadLetterBus) List(ctx context.Context) (txs []*msg.Tx, err error) {
+	var res map[string]string
+	err = b.store.View(func(t StoreTx) error {
+		res = t.HGetAll(b.Key.Key())
+		return nil
+	})
+	ids := make([]string, 0, len(res))
+	for id := range res {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		tx, e := decodeTx(res[id])
+		if e != nil {
+			log.Error("Failed to decode dead letter tx", "id", id, "err", e)
+			continue
+		}
+		txs = append(txs, tx)
+	}
+	return
+}
+
+func (b *StoreDeadLetterBus) Remove(ctx context.Context, ids ...string) (count int64, err error) {
+	err = b.store.Update(func(t StoreTx) error {
+		if len(ids) == 0 {
+			for id := range t.HGetAll(b.Key.Key()) {
+				ids = append(ids, id)
+			}
+		} else {
+			for i, id := range ids {
+				ids[i] = util.LowerHex(id)
+			}
+		}
+		count = int64(t.HDel(b.Key.Key(), ids...))
+		return nil
+	})
+	return
+}
+
+func (b *StoreDeadLetterBus) Len(ctx context.Context) (count uint64, err error) {
+	err = b.store.View(func(t StoreTx) error {
+		count = uint64(len(t.HGetAll(b.Key.Key())))
+		return nil
+	})
+	return
+}
@@ -0,0 +1,621 @@
+package bus
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/polynetwork/bridge-common/base"
+
+	"github.com/polynetwork/poly-relayer/msg"
+)
+
+// Run the test against each of the store backends
+func testStores(t *testing.T, f func(*testing.T, Store)) {
+	t.Run("memory", func(t *testing.T) {
+		store, _ := NewMemoryStore("", 0)
+		defer store.Close()
+		f(t, store)
+	})
+	t.Run("bolt", func(t *testing.T) {
+		store, err := NewBoltStore(filepath.Join(t.TempDir(), "bus.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+		f(t, store)
+	})
+}
+
+func TestStoreTxBus(t *testing.T) {
+	testStores(t, testStoreTxBus)
+}
+
+func testStoreTxBus(t *testing.T, store Store) {
+	b := NewStoreTxBus(store, 2, msg.POLY)
+	ctx := context.Background()
+
+	tx, err := b.PopTimed(ctx, 100*time.Millisecond)
+	if err != nil || tx != nil {
+		t.Fatalf("Timed pop on empty queue should give nothing, tx %v err %v", tx, err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		b.Push(ctx, &msg.Tx{TxType: msg.POLY, PolyHash: "01", DstChainId: 2})
+	}()
+	tx, err = b.Pop(ctx)
+	if err != nil || tx == nil || tx.PolyHash != "01" {
+		t.Fatalf("Blocking pop should be woken up by push, tx %v err %v", tx, err)
+	}
+
+	b.WithAck("test", 50*time.Millisecond)
+	b.Push(ctx, &msg.Tx{TxType: msg.POLY, PolyHash: "02", DstChainId: 2})
+	tx, _ = b.Pop(ctx)
+	time.Sleep(100 * time.Millisecond)
+	tx, _ = b.PopTimed(ctx, 100*time.Millisecond)
+	if tx == nil || tx.PolyHash != "02" {
+		t.Fatalf("Un-acked tx should be delivered again after visibility timeout")
+	}
+	b.Ack(ctx, tx)
+	tx, _ = b.PopTimed(ctx, 100*time.Millisecond)
+	if tx != nil {
+		t.Fatalf("Acked tx should not be delivered again")
+	}
+
+	b.Push(ctx, &msg.Tx{TxType: msg.POLY, PolyHash: "03", DstChainId: 2})
+	b.Push(ctx, &msg.Tx{TxType: msg.POLY, PolyHash: "04", DstChainId: 2})
+	b.Push(ctx, &msg.Tx{TxType: msg.POLY, PolyHash: "03", DstChainId: 2, Attempts: 1})
+	if size, _ := b.Len(ctx); size != 2 {
+		t.Fatalf("Re-pushed tx should replace the queued entry, size %v", size)
+	}
+	tx, _ = b.Pop(ctx)
+	b.Push(ctx, tx)
+	b.Ack(ctx, tx)
+	tx, _ = b.PopTimed(ctx, 100*time.Millisecond)
+	if tx == nil || tx.PolyHash != "03" || tx.Attempts != 1 {
+		t.Fatalf("Unexpected popped tx %v", tx)
+	}
+	b.Ack(ctx, tx)
+	tx, _ = b.PopTimed(ctx, 100*time.Millisecond)
+	if tx == nil || tx.PolyHash != "04" {
+		t.Fatalf("Re-push of the in-flight tx should be delivered after the ack, tx %v", tx)
+	}
+	b.Ack(ctx, tx)
+
+	// The replaced in-flight entry is dropped instead of put back on the visibility timeout
+	b.Push(ctx, &msg.Tx{TxType: msg.POLY, PolyHash: "05", DstChainId: 2})
+	b.Pop(ctx)
+	b.Push(ctx, &msg.Tx{TxType: msg.POLY, PolyHash: "05", DstChainId: 2, Attempts: 1})
+	time.Sleep(100 * time.Millisecond)
+	tx, _ = b.PopTimed(ctx, 100*time.Millisecond)
+	if tx == nil || tx.PolyHash != "05" || tx.Attempts != 1 {
+		t.Fatalf("Re-pushed tx should be delivered, tx %v", tx)
+	}
+	b.Ack(ctx, tx)
+	tx, _ = b.PopTimed(ctx, 100*time.Millisecond)
+	if tx != nil {
+		t.Fatalf("Replaced in-flight tx should not be put back, tx %v", tx)
+	}
+}
+
+func TestStoreSortedTxBus(t *testing.T) {
+	testStores(t, testStoreSortedTxBus)
+}
+
+func testStoreSortedTxBus(t *testing.T, store Store) {
+	b := NewStoreSortedTxBus(store, 2, msg.SRC)
+	ctx := context.Background()
+	b.Push(ctx, &msg.Tx{TxType: msg.SRC, SrcHash: "01"}, 10)
+	b.Push(ctx, &msg.Tx{TxType: msg.SRC, SrcHash: "02"}, 20)
+
+	tx, _, _ := b.Claim(ctx, 5)
+	if tx != nil {
+		t.Fatalf("Tx above the height should not be claimed")
+	}
+	tx, score, _ := b.Claim(ctx, 20)
+	if tx == nil || tx.SrcHash != "01" || score != 10 {
+		t.Fatalf("Lowest tx should be claimed first")
+	}
+	txs, _ := b.PeekReady(ctx, 20, 10)
+	if len(txs) != 1 || txs[0].SrcHash != "02" {
+		t.Fatalf("Claimed tx should not be visible to peek, txs %v", txs)
+	}
+	if txs, _ = b.PeekReady(ctx, 15, 10); len(txs) != 0 {
+		t.Fatalf("Tx above the height should not be visible to peek, txs %v", txs)
+	}
+	other, score, _ := b.Claim(ctx, 20)
+	if other == nil || other.SrcHash != "02" || score != 20 {
+		t.Fatalf("Claimed tx should not be claimed again")
+	}
+	b.Requeue(ctx, tx, 30)
+	b.Ack(ctx, other)
+	tx, score, _ = b.Claim(ctx, 30)
+	if tx == nil || tx.SrcHash != "01" || score != 30 {
+		t.Fatalf("Requeued tx should be moved to the new height")
+	}
+	b.Ack(ctx, tx)
+	if size, _ := b.Len(ctx); size != 0 {
+		t.Fatalf("Acked tx should be removed, size %v", size)
+	}
+
+	store.Update(func(t StoreTx) error {
+		t.ZAdd(b.Key.Key(), "invalid", 1)
+		return nil
+	})
+	b.Push(ctx, &msg.Tx{TxType: msg.SRC, SrcHash: "03"}, 2)
+	tx, _, err := b.Claim(ctx, 5)
+	if err != nil || tx == nil || tx.SrcHash != "03" {
+		t.Fatalf("Invalid entry should be skipped by claim, tx %v err %v", tx, err)
+	}
+	if size, _ := b.Len(ctx); size != 1 {
+		t.Fatalf("Invalid entry should be dropped, size %v", size)
+	}
+}
+
+func TestStoreSortedTxBusDedup(t *testing.T) {
+	testStores(t, testStoreSortedTxBusDedup)
+}
+
+func testStoreSortedTxBusDedup(t *testing.T, store Store) {
+	b := NewStoreSortedTxBus(store, 2, msg.SRC)
+	ctx := context.Background()
+	b.Push(ctx, &msg.Tx{TxType: msg.SRC, SrcChainId: 2, TxId: "01", SrcHash: "aa"}, 10)
+	b.Push(ctx, &msg.Tx{TxType: msg.SRC, SrcChainId: 2, TxId: "02", SrcHash: "aa"}, 10)
+	b.Push(ctx, &msg.Tx{TxType: msg.SRC, SrcChainId: 2, TxId: "01", SrcHash: "aa", Attempts: 1}, 15)
+	if size, _ := b.Len(ctx); size != 2 {
+		t.Fatalf("Re-pushed tx should replace the queued entry, size %v", size)
+	}
+
+	tx, score, _ := b.Claim(ctx, 20)
+	if tx == nil || tx.TxId != "02" || score != 10 {
+		t.Fatalf("Unexpected claimed tx %v score %v", tx, score)
+	}
+	b.Push(ctx, &msg.Tx{TxType: msg.SRC, SrcChainId: 2, TxId: "02", SrcHash: "aa", Attempts: 2}, 12)
+	b.Ack(ctx, tx)
+	if size, _ := b.Len(ctx); size != 2 {
+		t.Fatalf("Ack should not remove the re-pushed entry, size %v", size)
+	}
+	tx, score, _ = b.Claim(ctx, 20)
+	if tx == nil || tx.TxId != "02" || tx.Attempts != 2 || score != 12 {
+		t.Fatalf("Re-pushed entry of the claimed tx should be visible, tx %v score %v", tx, score)
+	}
+
+	b.Push(ctx, tx, 12)
+	b.Requeue(ctx, tx, 30)
+	b.Ack(ctx, tx)
+	other, score, _ := b.Claim(ctx, 20)
+	if other == nil || other.TxId != "02" || score != 12 {
+		t.Fatalf("Unchanged re-push of the claimed tx should be kept, tx %v score %v", other, score)
+	}
+
+	tx, _, _ = b.Pop(ctx)
+	if tx == nil || tx.TxId != "02" || tx.Attempts != 2 {
+		t.Fatalf("Unexpected popped tx %v", tx)
+	}
+	b.Push(ctx, tx, 5)
+	if size, _ := b.Len(ctx); size != 2 {
+		t.Fatalf("Popped tx should be pushed again, size %v", size)
+	}
+}
+
+func TestStoreDelayedTxBus(t *testing.T) {
+	testStores(t, testStoreDelayedTxBus)
+}
+
+func testStoreDelayedTxBus(t *testing.T, store Store) {
+	b := NewStoreDelayedTxBus(store, 2, msg.POLY)
+	ctx := context.Background()
+	b.Delay(ctx, &msg.Tx{TxType: msg.POLY, PolyHash: "01"}, time.Now().Unix()-1)
+	b.Delay(ctx, &msg.Tx{TxType: msg.POLY, PolyHash: "02"}, time.Now().Unix()+100)
+	txs, _ := b.PopDue(ctx, 10)
+	if len(txs) != 1 || txs[0].PolyHash != "01" {
+		t.Fatalf("Only due txs should be popped")
+	}
+	txs, _ = b.PopDue(ctx, 10)
+	if len(txs) != 0 {
+		t.Fatalf("Popped txs should be removed")
+	}
+}
+
+func TestMemoryStoreSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bus.snapshot")
+	store, err := NewMemoryStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	b := NewStoreTxBus(store, 2, msg.POLY)
+	b.codec, _ = msg.NewCodec(msg.ENCODING_BINARY, msg.COMPRESSION_ZSTD)
+	b.Push(ctx, &msg.Tx{TxType: msg.POLY, PolyHash: "01", SrcProofHex: "ff00fe"})
+	NewStoreChainStore(ChainHeightKey{ChainId: 2, Type: KEY_HEIGHT_TX}, store, 0).UpdateHeight(ctx, 100)
+	err = store.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = NewMemoryStore(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	tx, _ := NewStoreTxBus(store, 2, msg.POLY).PopTimed(ctx, 100*time.Millisecond)
+	if tx == nil || tx.PolyHash != "01" || tx.SrcProofHex != "ff00fe" {
+		t.Fatalf("Snapshot should keep the binary encoded tx queue, got %v", tx)
+	}
+	height, _ := NewStoreChainStore(ChainHeightKey{ChainId: 2, Type: KEY_HEIGHT_TX}, store, 0).GetHeight(ctx)
+	if height != 100 {
+		t.Fatalf("Snapshot should keep the chain height, got %v", height)
+	}
+}
+
+func TestStoreRollback(t *testing.T) {
+	testStores(t, testStoreRollback)
+}
+
+func testStoreRollback(t *testing.T, store Store) {
+	store.Update(func(tx StoreTx) error {
+		tx.RPush("list", "a")
+		return nil
+	})
+	store.Update(func(tx StoreTx) error {
+		tx.RPush("list", "b")
+		tx.HSet("hash", "k", "v")
+		return context.Canceled
+	})
+	store.View(func(tx StoreTx) error {
+		if tx.LLen("list") != 1 {
+			t.Fatalf("Failed update should be rolled back")
+		}
+		if _, ok := tx.HGet("hash", "k"); ok {
+			t.Fatalf("Failed update should be rolled back")
+		}
+		return nil
+	})
+}
+
+func TestBoltStoreReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bus.db")
+	store, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	b := NewStoreSortedTxBus(store, 2, msg.SRC)
+	b.Push(ctx, &msg.Tx{TxType: msg.SRC, SrcHash: "01"}, 10)
+	b.Push(ctx, &msg.Tx{TxType: msg.SRC, SrcHash: "02"}, 5)
+	NewStoreTxBus(store, 2, msg.POLY).Push(ctx, &msg.Tx{TxType: msg.POLY, PolyHash: "01"})
+	store.Close()
+
+	store, err = NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	tx, err := NewStoreTxBus(store, 2, msg.POLY).PopTimed(ctx, 100*time.Millisecond)
+	if err != nil || tx == nil || tx.PolyHash != "01" {
+		t.Fatalf("Bolt store should keep the tx queue, tx %v err %v", tx, err)
+	}
+	tx, score, _ := NewStoreSortedTxBus(store, 2, msg.SRC).Claim(ctx, 100)
+	if tx == nil || tx.SrcHash != "02" || score != 5 {
+		t.Fatalf("Bolt store should keep the sorted tx queue in order, tx %v score %v", tx, score)
+	}
+}
+
+func TestBoltStoreLocked(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bus.db")
+	store, err := NewBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	_, err = NewBoltStore(path)
+	if err == nil || !strings.Contains(err.Error(), "locked by another process") {
+		t.Fatalf("Expected locked bolt db error, got %v", err)
+	}
+}
+
+func TestBoltStoreScoreOrder(t *testing.T) {
+	store, err := NewBoltStore(filepath.Join(t.TempDir(), "bus.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	store.Update(func(tx StoreTx) error {
+		for member, score := range map[string]float64{"a": -100, "b": -1.5, "c": 0, "d": 2, "e": 1e10} {
+			tx.ZAdd("zset", member, score)
+		}
+		tx.ZAdd("zset", "a", -200)
+		return nil
+	})
+	store.View(func(tx StoreTx) error {
+		items := tx.ZRangeByScore("zset", -150, 3, 0)
+		if len(items) != 3 || items[0].Member != "b" || items[1].Member != "c" || items[2].Member != "d" || items[0].Score != -1.5 {
+			t.Fatalf("Unexpected zset range %v", items)
+		}
+		if tx.ZCard("zset") != 5 {
+			t.Fatalf("Updated member should not be duplicated")
+		}
+		return nil
+	})
+}
+
+func TestStoreMigrateTxs(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		legacy := `{"TxType":2,"PolyHash":"01","DstChainId":2}`
+		key := (&TxQueueKey{ChainId: 2, TxType: msg.POLY}).Key()
+		store.Update(func(tx StoreTx) error {
+			tx.RPush(key, legacy, "invalid")
+			return nil
+		})
+		stats := &MigrateStats{}
+		err := migrateStore(store, nil, Queue{QUEUE_TX, key, QUEUE_LIST, false}, stats)
+		if err != nil || stats.Total != 2 || stats.Migrated != 1 || stats.Failed != 1 {
+			t.Fatalf("Unexpected migrate stats %+v err %v", stats, err)
+		}
+		store.View(func(tx StoreTx) error {
+			items := tx.LRange(key)
+			if len(items) != 2 || items[0] == legacy || items[1] != "invalid" {
+				t.Fatalf("Legacy tx should be rewritten in place, items %v", items)
+			}
+			return nil
+		})
+	})
+}
+
+func TestRetagKey(t *testing.T) {
+	cases := []struct {
+		plain  string
+		tagged string
+	}{
+		{(&TxQueueKey{2, msg.POLY, false}).Key(), (&TxQueueKey{2, msg.POLY, true}).Key()},
+		{(&SortedTxQueueKey{2, msg.SRC, false}).Key() + ":index", (&SortedTxQueueKey{2, msg.SRC, true}).Key() + ":index"},
+		{(&TxQueueKey{2, msg.POLY, false}).Key() + ":inflight:host-1", (&TxQueueKey{2, msg.POLY, true}).Key() + ":inflight:host-1"},
+		{LeaderKey{ChainRole(ROLE_POLY_SYNC, 2), false}.fenceKey(), LeaderKey{ChainRole(ROLE_POLY_SYNC, 2), true}.fenceKey()},
+		{LeaderKey{ROLE_POLY_SYNC, false}.Key(), LeaderKey{ROLE_POLY_SYNC, true}.Key()},
+	}
+	for _, c := range cases {
+		if key, ok := retagKey(c.plain, true); !ok || key != c.tagged {
+			t.Fatalf("Unexpected tagged key of %s: %s", c.plain, key)
+		}
+		if key, ok := retagKey(c.tagged, false); !ok || key != c.plain {
+			t.Fatalf("Unexpected plain key of %s: %s", c.tagged, key)
+		}
+	}
+	if _, ok := retagKey(NewPatchKey(2).Key(), true); ok {
+		t.Fatalf("Patch key has no slot to tag")
+	}
+}
+
+func TestStoreQueueAdmin(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		b := NewStoreTxBus(store, 2, msg.POLY)
+		for _, hash := range []string{"01", "02", "03"} {
+			b.Push(ctx, &msg.Tx{TxType: msg.POLY, PolyHash: hash})
+		}
+		admin := NewStoreQueueAdmin(store)
+		q, _ := NewQueue(QUEUE_TX, 2, msg.POLY, false)
+		entries, err := admin.Range(ctx, q, 1, 1)
+		if err != nil || len(entries) != 1 || !entries[0].Match("0x02") || entries[0].Index != 1 {
+			t.Fatalf("Unexpected queue page %v err %v", entries, err)
+		}
+		ok, _ := admin.Remove(ctx, q, entries[0])
+		if !ok {
+			t.Fatalf("Entry should be removed")
+		}
+		entries, _ = admin.Range(ctx, q, 0, 0)
+		if len(entries) != 2 || entries[0].Tx.PolyHash != "01" || entries[1].Tx.PolyHash != "03" {
+			t.Fatalf("Remove should keep the order of the rest entries %v", entries)
+		}
+
+		delayed, _ := NewQueue(QUEUE_DELAYED, 2, msg.POLY, false)
+		entries[0].Score = 100
+		err = admin.Add(ctx, delayed, entries[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries, _ = admin.Range(ctx, delayed, 0, 0)
+		if len(entries) != 1 || entries[0].Score != 100 {
+			t.Fatalf("Entry should be added to the delayed queue %v", entries)
+		}
+		ok, _ = admin.Rescore(ctx, delayed, entries[0], 200)
+		entries, _ = admin.Range(ctx, delayed, 0, 0)
+		if !ok || entries[0].Score != 200 {
+			t.Fatalf("Entry should be rescored %v", entries)
+		}
+
+		sorted, _ := NewQueue(QUEUE_SORTED, 2, msg.SRC, false)
+		src := &msg.Tx{TxType: msg.SRC, SrcChainId: 2, TxId: "01"}
+		admin.Add(ctx, sorted, &QueueEntry{Tx: src, Score: 10})
+		sb := NewStoreSortedTxBus(store, 2, msg.SRC)
+		sb.Push(ctx, &msg.Tx{TxType: msg.SRC, SrcChainId: 2, TxId: "01", Attempts: 1}, 20)
+		entries, _ = admin.Range(ctx, sorted, 0, 0)
+		if len(entries) != 1 || entries[0].Score != 20 {
+			t.Fatalf("Bus push should replace the entry added to the sorted queue %v", entries)
+		}
+		ok, _ = admin.Remove(ctx, sorted, entries[0])
+		indexed := true
+		store.View(func(tx StoreTx) error {
+			_, indexed = tx.HGet(sorted.indexKey(), src.IdempotencyKey())
+			return nil
+		})
+		if !ok || indexed {
+			t.Fatalf("Removed entry should be dropped from the index")
+		}
+	})
+}
+
+func TestStoreSkipCheck(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		skip := NewStoreSkipCheck(store)
+		store.Update(func(tx StoreTx) error {
+			tx.HSet(skip.Key.Key(), "01", "true")
+			return nil
+		})
+		skip.Skip(ctx, &SkipEntry{Hash: "02", Operator: "ops", Reason: "stuck", DstChain: 2})
+		skip.Skip(ctx, &SkipEntry{Hash: "03", Expiry: time.Now().Unix() - 1})
+
+		for _, c := range []struct {
+			tx   *msg.Tx
+			skip bool
+		}{
+			{&msg.Tx{PolyHash: "01", DstChainId: 3}, true},
+			{&msg.Tx{PolyHash: "02", DstChainId: 2}, true},
+			{&msg.Tx{PolyHash: "02", DstChainId: 3}, false},
+			{&msg.Tx{PolyHash: "02"}, false},
+			{&msg.Tx{PolyHash: "03"}, false},
+		} {
+			if skipped, _ := skip.CheckSkip(ctx, c.tx); skipped != c.skip {
+				t.Fatalf("Unexpected skip check %v of tx %+v", skipped, c.tx)
+			}
+		}
+
+		ok, _ := skip.Unskip(ctx, &SkipEntry{Hash: "02", Operator: "ops"})
+		entries, _ := skip.ListSkip(ctx)
+		if !ok || len(entries) != 2 {
+			t.Fatalf("Unskipped entry should be removed, entries %v", entries)
+		}
+		audits, _ := skip.SkipAudit(ctx, 0)
+		if len(audits) != 3 || audits[2].Action != "unskip" || audits[2].Entry.Operator != "ops" {
+			t.Fatalf("Unexpected skip audit %v", audits)
+		}
+	})
+}
+
+func TestStoreLeader(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		wg := &sync.WaitGroup{}
+		a := NewStoreLeader(store, ROLE_POLY_SYNC, 300*time.Millisecond)
+		b := NewStoreLeader(store, ROLE_POLY_SYNC, 300*time.Millisecond)
+		first, err := a.Campaign(ctx, wg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		standby, stop := context.WithTimeout(ctx, 500*time.Millisecond)
+		if _, err = b.Campaign(standby, wg); err == nil {
+			t.Fatalf("Leadership should not be taken while held by others")
+		}
+		stop()
+		if err = Fence(first); err != nil {
+			t.Fatalf("Leader should pass the fence, err %v", err)
+		}
+		key := ChainHeightKey{ChainId: base.POLY, Type: KEY_HEIGHT_TX}
+		stale := NewStoreChainStore(key, store, 0)
+		if err = stale.Fence(first); err != nil || stale.UpdateHeight(ctx, 10) != nil {
+			t.Fatalf("Leader should update the fenced height, err %v", err)
+		}
+		a.Report(ctx, 10, 12)
+		b.Report(ctx, 8, 12)
+		candidates, err := b.Candidates(ctx)
+		if err != nil || len(candidates) != 2 {
+			t.Fatalf("Both candidates should be listed, err %v", err)
+		}
+		for _, c := range candidates {
+			if c.Leading != (c.Owner == a.Owner()) || (c.Leading && c.Token != first.Token) || (!c.Leading && c.Lag() != 4) {
+				t.Fatalf("Unexpected candidate status %+v", c)
+			}
+		}
+
+		// Simulate a take over while the leader is paused
+		store.Update(func(tx StoreTx) error {
+			tx.Del(LeaderKey{Role: ROLE_POLY_SYNC}.Key())
+			return nil
+		})
+		second, err := b.Campaign(ctx, wg)
+		if err != nil || second.Token <= first.Token {
+			t.Fatalf("New term should have a greater fencing token, err %v", err)
+		}
+		state := NewStoreChainStore(key, store, 0)
+		if err = state.Fence(second); err != nil {
+			t.Fatalf("New leader should claim the height fence, err %v", err)
+		}
+		if err = stale.UpdateHeight(ctx, 11); err != ErrLeadershipLost || first.Err() == nil {
+			t.Fatalf("Stale leader should be rejected by the fenced height, err %v", err)
+		}
+		if height, _ := state.GetHeight(ctx); height != 10 || state.UpdateHeight(ctx, 12) != nil {
+			t.Fatalf("Unexpected fenced height %d", height)
+		}
+		if err = Fence(first); err != ErrLeadershipLost || first.Err() == nil {
+			t.Fatalf("Stale leader should be fenced and stopped, err %v", err)
+		}
+
+		b.Resign()
+		<-second.Done()
+		third, err := a.Campaign(ctx, wg)
+		if err != nil || third.Token <= second.Token {
+			t.Fatalf("Standby should take over after resign, err %v", err)
+		}
+		cancel()
+		wg.Wait()
+	})
+}
+
+func TestStoreRoleStatus(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		s := NewStoreRoleStatusStore(store)
+		now := time.Now().Unix()
+		err := s.ReportRoles(ctx, []*RoleStatus{
+			{Instance: "a", Role: "TxCommit", Chain: 2, State: ROLE_STATE_RUNNING, Updated: now},
+			{Instance: "a", Role: "HeaderSync", Chain: 2, State: ROLE_STATE_FAILED, Failures: 5, Updated: now},
+			{Instance: "b", Role: "TxCommit", Chain: 2, State: ROLE_STATE_RUNNING, Updated: now - 120},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		list, err := s.ListRoles(ctx)
+		if err != nil || len(list) != 2 {
+			t.Fatalf("Stale role status should be pruned, err %v", err)
+		}
+		if list[0].Role != "HeaderSync" || list[0].State != ROLE_STATE_FAILED || list[0].Failures != 5 {
+			t.Fatalf("Unexpected role status %+v", list[0])
+		}
+		store.View(func(tx StoreTx) error {
+			if len(tx.HGetAll(ROLE_STATUS.Key())) != 2 {
+				t.Fatalf("Stale role status should be removed from the store")
+			}
+			return nil
+		})
+
+		s.ControlRole(ctx, &RoleControl{Role: "TxCommit", Chain: 2, State: ROLE_STATE_PAUSED})
+		s.ControlRole(ctx, &RoleControl{Role: "HeaderSync", Chain: 2, State: ROLE_STATE_STOPPED})
+		s.ControlRole(ctx, &RoleControl{Role: "TxCommit", Chain: 2})
+		controls, err := s.RoleControls(ctx)
+		if err != nil || len(controls) != 1 || controls[0].Role != "HeaderSync" || controls[0].State != ROLE_STATE_STOPPED {
+			t.Fatalf("Role control should be removed with empty state, err %v", err)
+		}
+
+		s.RequestReload(ctx)
+		if n, err := s.RequestReload(ctx); err != nil || n != 2 {
+			t.Fatalf("Reload requests should be counted, err %v", err)
+		}
+		if n, err := s.ReloadRequests(ctx); err != nil || n != 2 {
+			t.Fatalf("Unexpected reload requests %v, err %v", n, err)
+		}
+	})
+}
+
+func TestStoreNonce(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+		s := NewStoreNonceStore(store)
+		n, err := s.GetNonce(ctx, 2, "0xAbC")
+		if err != nil || n != 0 {
+			t.Fatalf("Unexpected nonce of unknown account %d %v", n, err)
+		}
+		s.SetNonce(ctx, 2, "0xAbC", 12)
+		s.SetNonce(ctx, 6, "0xabc", 3)
+		n, err = s.GetNonce(ctx, 2, "0xabc")
+		if err != nil || n != 12 {
+			t.Fatalf("Unexpected nonce %d %v", n, err)
+		}
+	})
+}
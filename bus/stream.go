@@ -0,0 +1,396 @@
+/*
+ * Copyright (C) 2021 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package bus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/polynetwork/bridge-common/base"
+	"github.com/polynetwork/bridge-common/log"
+	"github.com/polynetwork/poly-relayer/config"
+	"github.com/polynetwork/poly-relayer/msg"
+)
+
+const (
+	DEFAULT_STREAM_GROUP = "relayer"
+	STREAM_TX_FIELD      = "tx"
+	STREAM_CLAIM_BATCH   = 10
+)
+
+// Count the entries not yet delivered to the consumer group
+var streamUndelivered = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+local last
+for _, group in ipairs(redis.call('XINFO', 'GROUPS', KEYS[1])) do
+	local info = {}
+	for i = 1, #group, 2 do
+		info[group[i]] = group[i+1]
+	end
+	if info['name'] == ARGV[1] then
+		last = info['last-delivered-id']
+	end
+end
+if not last then
+	return redis.call('XLEN', KEYS[1])
+end
+local items = redis.call('XRANGE', KEYS[1], last, '+')
+if #items > 0 and items[1][1] == last then
+	return #items - 1
+end
+return #items
+`)
+
+// Move the entries of the legacy list queue into the stream, and drop the list index
+var streamMigrate = redis.NewScript(`
+local items = redis.call('LRANGE', KEYS[1], 0, -1)
+for _, v in ipairs(items) do
+	redis.call('XADD', KEYS[2], '*', ARGV[1], v)
+end
+redis.call('DEL', KEYS[1], KEYS[3])
+return #items
+`)
+
+// Append the tx and delete the entry of the same idempotency key, a deleted pending entry is dropped when claimed
+// KEYS: stream, index; ARGV: field, member, idempotency key, max length, exact trim
+var addStream = redis.NewScript(`
+local args = {'XADD', KEYS[1]}
+if ARGV[4] ~= '0' then
+	args[#args + 1] = 'MAXLEN'
+	if ARGV[5] ~= '1' then
+		args[#args + 1] = '~'
+	end
+	args[#args + 1] = ARGV[4]
+end
+args[#args + 1] = '*'
+args[#args + 1] = ARGV[1]
+args[#args + 1] = ARGV[2]
+local id = redis.call(unpack(args))
+if ARGV[3] ~= '' then
+	local old = redis.call('HGET', KEYS[2], ARGV[3])
+	if old then
+		redis.call('XDEL', KEYS[1], old)
+	end
+	redis.call('HSET', KEYS[2], ARGV[3], id)
+end
+return id
+`)
+
+type StreamKey TxQueueKey
+
+func (k *StreamKey) Key() string {
+	return fmt.Sprintf("%s:relayer:stream:%s", base.ENV, queueSlot(k.ChainId, k.TxType, k.HashTag))
+}
+
+// ConsumerTxBus tracks the deliveries per named consumer
+type ConsumerTxBus interface {
+	TxBus
+	Consumer(name string) TxBus
+}
+
+// PendingTxBus reports the delivered but not yet acked txs per consumer
+type PendingTxBus interface {
+	Pending(context.Context) (map[string]int64, error)
+}
+
+// ForConsumer returns the view of the bus for the named consumer, or the bus itself if not supported
+func ForConsumer(bus TxBus, name string) TxBus {
+	if b, ok := bus.(ConsumerTxBus); ok {
+		return b.Consumer(name)
+	}
+	return bus
+}
+
+// State shared by the consumer views of the same stream
+type streamState struct {
+	leases  leases
+	mu      sync.Mutex
+	ready   bool
+	claimed time.Time
+}
+
+// RedisStreamTxBus delivers txs with redis streams consumer groups. The delivered entries stay in the
+// consumer pending list till acked, and can be claimed by other consumers once idle for the claim timeout.
+type RedisStreamTxBus struct {
+	Key
+	db       redis.UniversalClient
+	list     *RedisTxBus
+	group    string
+	consumer string
+	timeout  time.Duration
+	maxLen   int64
+	exact    bool
+	state    *streamState
+	codec    *msg.Codec
+}
+
+func NewRedisStreamTxBus(db redis.UniversalClient, chainId uint64, txType msg.TxType, conf *config.StreamConfig, consumer string, timeout time.Duration) *RedisStreamTxBus {
+	if consumer == "" {
+		consumer = ConsumerName()
+	}
+	if conf.ClaimTimeout > 0 {
+		timeout = time.Duration(conf.ClaimTimeout) * time.Second
+	}
+	if timeout == 0 {
+		timeout = DEFAULT_VISIBILITY_TIMEOUT
+	}
+	group := conf.Group
+	if group == "" {
+		group = DEFAULT_STREAM_GROUP
+	}
+	return &RedisStreamTxBus{
+		Key:      &StreamKey{ChainId: chainId, TxType: txType, HashTag: isCluster(db)},
+		db:       db,
+		list:     NewRedisTxBus(db, chainId, txType),
+		group:    group,
+		consumer: consumer,
+		timeout:  timeout,
+		maxLen:   conf.MaxLen,
+		exact:    conf.ExactTrim,
+		state:    new(streamState),
+	}
+}
+
+func (b *RedisStreamTxBus) Topic() string {
+	return b.Key.Key()
+}
+
+// Consumer returns a view of the stream for the named consumer, which shares the leases with the bus
+func (b *RedisStreamTxBus) Consumer(name string) TxBus {
+	view := *b
+	view.consumer = fmt.Sprintf("%s:%s", b.consumer, name)
+	return &view
+}
+
+// Create the consumer group and move the legacy list entries into the stream
+func (b *RedisStreamTxBus) init(ctx context.Context) (err error) {
+	b.state.mu.Lock()
+	defer b.state.mu.Unlock()
+	if b.state.ready {
+		return
+	}
+	_, err = b.db.XGroupCreateMkStream(ctx, b.Key.Key(), b.group, "0").Result()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("Failed to create stream consumer group %v", err)
+	}
+	n, err := streamMigrate.Run(ctx, b.db, []string{b.list.Key.Key(), b.Key.Key(), queueIndexKey(b.list.Key)}, STREAM_TX_FIELD).Int64()
+	if err != nil {
+		return fmt.Errorf("Failed to migrate list queue to stream %v", err)
+	}
+	if n > 0 {
+		log.Info("Moved legacy list queue txs to stream", "key", b.Key.Key(), "count", n)
+	}
+	b.state.ready = true
+	return nil
+}
+
+func (b *RedisStreamTxBus) reset() {
+	b.state.mu.Lock()
+	b.state.ready = false
+	b.state.mu.Unlock()
+}
+
+// Claim one of the entries idle for the claim timeout from the other consumers
+func (b *RedisStreamTxBus) claim(ctx context.Context) (*redis.XMessage, error) {
+	b.state.mu.Lock()
+	if time.Since(b.state.claimed) < b.timeout/10 {
+		b.state.mu.Unlock()
+		return nil, nil
+	}
+	b.state.claimed = time.Now()
+	b.state.mu.Unlock()
+
+	pending, err := b.db.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: b.Key.Key(), Group: b.group, Start: "-", End: "+", Count: STREAM_CLAIM_BATCH,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to check stream pending entries %v", err)
+	}
+	for _, p := range pending {
+		if p.Idle < b.timeout {
+			continue
+		}
+		res, err := b.db.XClaim(ctx, &redis.XClaimArgs{
+			Stream: b.Key.Key(), Group: b.group, Consumer: b.consumer, MinIdle: b.timeout, Messages: []string{p.ID},
+		}).Result()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to claim stream entry %v", err)
+		}
+		if len(res) > 0 {
+			log.Warn("Claimed idle stream entry", "key", b.Key.Key(), "id", p.ID, "from", p.Consumer, "to", b.consumer, "deliveries", p.RetryCount)
+			// More entries might be waiting to be claimed
+			b.state.mu.Lock()
+			b.state.claimed = time.Time{}
+			b.state.mu.Unlock()
+			return &res[0], nil
+		}
+	}
+	return nil, nil
+}
+
+func (b *RedisStreamTxBus) Pop(ctx context.Context) (*msg.Tx, error) {
+	return b.PopTimed(ctx, 0)
+}
+
+func (b *RedisStreamTxBus) PopTimed(ctx context.Context, duration time.Duration) (*msg.Tx, error) {
+	var deadline time.Time
+	if duration > 0 {
+		deadline = time.Now().Add(duration)
+	}
+	for {
+		err := b.init(ctx)
+		if err != nil {
+			return nil, err
+		}
+		entry, err := b.claim(ctx)
+		if err != nil {
+			log.Error("Failed to claim idle stream entries", "key", b.Key.Key(), "err", err)
+		}
+		if entry == nil {
+			block := BLOCK_INTERVAL
+			if !deadline.IsZero() {
+				block = time.Until(deadline)
+				if block <= 0 {
+					return nil, nil
+				}
+			}
+			res, err := b.db.XReadGroup(ctx, &redis.XReadGroupArgs{
+				Group: b.group, Consumer: b.consumer, Streams: []string{b.Key.Key(), ">"}, Count: 1, Block: block,
+			}).Result()
+			if err == redis.Nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				continue
+			}
+			if err != nil {
+				if strings.HasPrefix(err.Error(), "NOGROUP") {
+					b.reset()
+					continue
+				}
+				return nil, fmt.Errorf("Failed to pop message %v", err)
+			}
+			if len(res) == 0 || len(res[0].Messages) == 0 {
+				continue
+			}
+			entry = &res[0].Messages[0]
+		}
+		raw, _ := entry.Values[STREAM_TX_FIELD].(string)
+		tx := new(msg.Tx)
+		err = tx.Decode(raw)
+		if err != nil {
+			log.Error("Dropping invalid stream entry", "key", b.Key.Key(), "id", entry.ID, "err", err)
+			b.db.XAck(ctx, b.Key.Key(), b.group, entry.ID)
+			continue
+		}
+		b.state.leases.put(tx, entry.ID)
+		return tx, nil
+	}
+}
+
+// Ack removes the entry from the consumer pending list
+func (b *RedisStreamTxBus) Ack(ctx context.Context, tx *msg.Tx) error {
+	id, ok := b.state.leases.take(tx)
+	if !ok {
+		return nil
+	}
+	n, err := b.db.XAck(ctx, b.Key.Key(), b.group, id).Result()
+	if err != nil {
+		b.state.leases.put(tx, id)
+		return fmt.Errorf("Failed to ack message %v", err)
+	}
+	if n == 0 {
+		log.Warn("Acked stream entry was not pending", "key", b.Key.Key(), "id", id, "poly_hash", tx.PolyHash)
+	}
+	if key := tx.IdempotencyKey(); key != "" {
+		err = unindexTx.Run(ctx, b.db, []string{queueIndexKey(b.Key)}, id, key).Err()
+		if err != nil && err != redis.Nil {
+			log.Error("Failed to remove stream entry index", "key", b.Key.Key(), "id", id, "err", err)
+		}
+	}
+	return nil
+}
+
+// Append the tx to the stream, the undelivered or pending entry of the same tx is deleted
+func (b *RedisStreamTxBus) add(ctx context.Context, key Key, tx *msg.Tx) error {
+	exact := "0"
+	if b.exact {
+		exact = "1"
+	}
+	err := addStream.Run(ctx, b.db, []string{key.Key(), queueIndexKey(key)},
+		STREAM_TX_FIELD, b.codec.Encode(tx), tx.IdempotencyKey(), b.maxLen, exact).Err()
+	if err != nil {
+		return fmt.Errorf("Failed to push message %v", err)
+	}
+	return nil
+}
+
+func (b *RedisStreamTxBus) Push(ctx context.Context, tx *msg.Tx) error {
+	return b.add(ctx, b.Key, tx)
+}
+
+func (b *RedisStreamTxBus) PushToChain(ctx context.Context, tx *msg.Tx) error {
+	key := StreamKey(*queueOf(b.db, tx))
+	return b.add(ctx, &key, tx)
+}
+
+// Streams only append, the tx will be delivered after the existing entries
+func (b *RedisStreamTxBus) PushBack(ctx context.Context, tx *msg.Tx) error {
+	return b.PushToChain(ctx, tx)
+}
+
+// Patch queues stay on lists
+func (b *RedisStreamTxBus) Patch(ctx context.Context, tx *msg.Tx) error {
+	return b.list.Patch(ctx, tx)
+}
+
+func (b *RedisStreamTxBus) undelivered(ctx context.Context, key string) (uint64, error) {
+	v, err := streamUndelivered.Run(ctx, b.db, []string{key}, b.group).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("Get chain tx stream length error %v", err)
+	}
+	return uint64(v), nil
+}
+
+// Len returns the count of entries not yet delivered to the group
+func (b *RedisStreamTxBus) Len(ctx context.Context) (uint64, error) {
+	return b.undelivered(ctx, b.Key.Key())
+}
+
+func (b *RedisStreamTxBus) LenOf(ctx context.Context, chain uint64, ty msg.TxType) (uint64, error) {
+	key := &StreamKey{chain, ty, isCluster(b.db)}
+	return b.undelivered(ctx, key.Key())
+}
+
+// Pending returns the pending entry count per consumer of the group
+func (b *RedisStreamTxBus) Pending(ctx context.Context) (map[string]int64, error) {
+	res, err := b.db.XPending(ctx, b.Key.Key(), b.group).Result()
+	if err != nil {
+		if err == redis.Nil || strings.HasPrefix(err.Error(), "NOGROUP") {
+			return map[string]int64{}, nil
+		}
+		return nil, fmt.Errorf("Get stream pending entries error %v", err)
+	}
+	return res.Consumers, nil
+}
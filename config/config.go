@@ -18,14 +18,22 @@
 package config
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 	"github.com/polynetwork/bridge-common/base"
+	"github.com/polynetwork/bridge-common/log"
 	"github.com/polynetwork/bridge-common/tools"
 	"github.com/polynetwork/bridge-common/util"
 	"github.com/polynetwork/bridge-common/wallet"
@@ -34,11 +42,12 @@ import (
 )
 
 var (
-	CONFIG      *Config
 	WALLET_PATH string
 	CONFIG_PATH string
 	ENCRYPTED   bool
 	PLAIN       bool
+
+	passphrase []byte
 )
 
 type Config struct {
@@ -48,24 +57,31 @@ type Config struct {
 	Chains map[uint64]*ChainConfig
 
 	// Http
-	Host string
-	Port int
-
-	ValidMethods []string
-	validMethods map[string]bool
-	chains       map[uint64]bool
-	Bridge       []string
+	Host       string
+	Port       int
+	AdminToken string // Bearer token required by the http admin endpoints, which are disabled when unspecified
+
+	ValidMethods    []string
+	validMethods    map[string]bool
+	chains          map[uint64]bool
+	path            string // Config file path
+	rolesPath       string // Roles file path
+	roles           bool   // Roles applied, only the wallets of the active roles are unlocked
+	Bridge          []string
+	ShutdownTimeout uint64 // Seconds to wait for the roles to stop gracefully on exit, 30 when unspecified
+	MaxRoleFailures int    // Consecutive failures before a role is marked failed and no longer restarted, 5 when unspecified
 
 	Validators struct {
-		Src []uint64
-		Dst []uint64
+		Src          []uint64
+		Dst          []uint64
 		PauseCommand []string
 		DialTargets  []string
 		DialTemplate string
-		DingUrl         string
-		HuyiUrl         string
-		HuyiAccount     string
-		HuyiPassword    string
+		DingUrl      string
+		HuyiUrl      string
+		HuyiAccount  string
+		HuyiPassword string
+		Leader       bool // Run with leader election on the bus, only one instance validates while the others stand by
 	}
 }
 
@@ -84,20 +100,38 @@ func New(path string) (config *Config, err error) {
 		return nil, fmt.Errorf("Read config file error %v", err)
 	}
 	if ENCRYPTED {
-		var passphrase []byte
-		if PLAIN {
-			passphrase, err = msg.ReadInput("passphrase")
-		} else {
-			passphrase, err = msg.ReadPassword("passphrase")
+		// Passphrase is kept to reload the config without prompt
+		if passphrase == nil && PASSPHRASE_SECRET != "" {
+			passphrase, err = readPassphrase(PASSPHRASE_SECRET)
+			if err != nil {
+				return nil, fmt.Errorf("Read config passphrase error %v", err)
+			}
+		}
+		if passphrase == nil {
+			if PLAIN {
+				passphrase, err = msg.ReadInput("passphrase")
+			} else {
+				passphrase, err = msg.ReadPassword("passphrase")
+			}
+			if err != nil { return nil, err }
+		}
+		if !msg.Encrypted(data) {
+			log.Warn("Config file is encrypted in the legacy format, migrate it with the reencrypt command", "path", path)
+		}
+		data, err = msg.DecryptData(data, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("Decrypt config file error %v", err)
 		}
-		if err != nil { return nil, err }
-		data = msg.Decrypt(data, passphrase)
 	}
-	config = &Config{chains: map[uint64]bool{}}
+	config = &Config{chains: map[uint64]bool{}, path: path}
 	err = json.Unmarshal(data, config)
 	if err != nil {
 		return nil, fmt.Errorf("Parse config file error %v", err)
 	}
+	err = config.override(os.Environ())
+	if err != nil {
+		return nil, err
+	}
 	if config.Env != base.ENV {
 		util.Fatal("Config env(%s) and build env(%s) does not match!", config.Env, base.ENV)
 	}
@@ -131,6 +165,8 @@ type ChainConfig struct {
 	CheckFee          bool
 	Defer             int
 	Wallet            *wallet.Config
+	WalletSecret      *SecretConfig // Secret provider of the wallet passwords unspecified in the wallet config
+	Signer            *SignerConfig // Remote signer holding the submitter account keys
 	SrcFilter         *FilterConfig
 	DstFilter         *FilterConfig
 
@@ -153,10 +189,11 @@ type ListenerConfig struct {
 }
 
 type PolySubmitterConfig struct {
-	ChainId uint64
-	Nodes   []string
-	Procs   int
-	Wallet  *wallet.Config
+	ChainId      uint64
+	Nodes        []string
+	Procs        int
+	Wallet       *wallet.Config
+	WalletSecret *SecretConfig // Secret provider of the wallet password unspecified in the wallet config
 }
 
 func (c *PolySubmitterConfig) Fill(o *PolySubmitterConfig) *PolySubmitterConfig {
@@ -169,6 +206,7 @@ func (c *PolySubmitterConfig) Fill(o *PolySubmitterConfig) *PolySubmitterConfig
 	}
 	if o.Wallet == nil {
 		o.Wallet = c.Wallet
+		o.WalletSecret = c.WalletSecret
 	} else {
 		o.Wallet.Path = GetConfigPath(WALLET_PATH, o.Wallet.Path)
 	}
@@ -176,12 +214,16 @@ func (c *PolySubmitterConfig) Fill(o *PolySubmitterConfig) *PolySubmitterConfig
 }
 
 type SubmitterConfig struct {
-	ChainId     uint64
-	Nodes       []string
-	ExtraNodes  []string
-	CCMContract string
-	CCDContract string
-	Wallet      *wallet.Config
+	ChainId      uint64
+	Nodes        []string
+	ExtraNodes   []string
+	CCMContract  string
+	CCDContract  string
+	Wallet       *wallet.Config
+	WalletSecret *SecretConfig // Secret provider of the wallet passwords unspecified in the wallet config
+	Signer       *SignerConfig // Remote signer holding the account keys, used along with the wallet accounts
+
+	NonceGapTimeout int // Seconds before a nonce gap is filled with a cancel tx, 300 when unspecified, negative to disable
 }
 
 type WalletConfig struct {
@@ -191,24 +233,136 @@ type WalletConfig struct {
 }
 
 type BusConfig struct {
-	Redis                *redis.Options `json:"-"`
+	Redis                *redis.UniversalOptions `json:"-"`
 	HeightUpdateInterval uint64
-	Config               *struct {
-		Network    string
-		Addr       string
-		Username   string
-		Password   string
-		DB         int
-		MaxRetries int
+	Reliable             bool          // Ack based at least once delivery for tx queues
+	VisibilityTimeout    uint64        // Seconds before an un-acked tx is put back to the queue
+	Consumer             string        // Consumer name of the instance, use hostname-pid when unspecified
+	Backend              string        // Bus backend: redis(default), memory or bolt, the commands on the bolt bus run only with the relayer stopped
+	Path                 string        // Data file path of bolt backend
+	Snapshot             string        // Snapshot file path of memory backend, no snapshot when unspecified
+	SnapshotInterval     uint64        // Seconds between memory backend snapshots
+	Stream               *StreamConfig // Poly tx queues on redis streams with consumer groups when specified
+	Codec                string        // Tx encoding on the bus: json(default), bin, or legacy to keep writing the plain json txs of version 0 until all the instances are upgraded
+	Compression          string        // Compression of the bin tx encoding: none(default) or zstd
+	LeaderTTL            uint64        // Seconds before the leadership of a singleton role expires without refresh, 30 when unspecified
+	Config               *RedisConfig
+}
+
+type RedisConfig struct {
+	Network          string
+	Addr             string
+	Addrs            []string // Seed addresses of the sentinel or cluster nodes
+	MasterName       string   // Sentinel master name, uses failover client when specified
+	Cluster          bool     // Cluster mode, queue keys are hash tagged to keep multi-key operations in one slot
+	Username         string
+	Password         string
+	SentinelPassword string
+	DB               int
+	MaxRetries       int
+	PoolSize         int
+	MinIdleConns     int
+	DialTimeout      uint64 // Seconds
+	ReadTimeout      uint64 // Seconds
+	WriteTimeout     uint64 // Seconds
+	PoolTimeout      uint64 // Seconds
+	IdleTimeout      uint64 // Seconds
+	TLS              *TLSConfig
+}
+
+type TLSConfig struct {
+	CA                 string // CA certificate file path, system roots when unspecified
+	Cert               string // Client certificate file path
+	Key                string // Client key file path
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// Remote signer config, the keys are held by the signing service
+type SignerConfig struct {
+	Url      string     // Signer endpoint
+	Api      string     // clef for the clef compatible json rpc(default), or http for the simple http signing api
+	Accounts []string   // Signer accounts to submit with, all the accounts listed by the signer when unspecified
+	TLS      *TLSConfig // Client certificate for mutual tls, required unless insecure
+	Timeout  int        // Request timeout in seconds
+	Insecure bool       // Allow plain http and no client certificate, only for the signers on the local host
+}
+
+type StreamConfig struct {
+	Group        string // Consumer group name, "relayer" when unspecified
+	ClaimTimeout uint64 // Seconds before a pending entry can be claimed by other consumers, VisibilityTimeout when unspecified
+	MaxLen       int64  // Trim the stream to the max length on push, no trimming when zero
+	ExactTrim    bool   // Trim to the exact max length instead of the approximate one
+}
+
+func (c *BusConfig) Init() (err error) {
+	c.Redis = new(redis.UniversalOptions)
+	if c.Config == nil {
+		return
+	}
+	o := c.Config
+	if o.Cluster && o.DB != 0 {
+		return fmt.Errorf("Redis cluster supports only db 0, got db %v", o.DB)
+	}
+	if o.Cluster && o.MasterName != "" {
+		return fmt.Errorf("Redis sentinel master name can not be used with cluster mode")
+	}
+	if len(o.Addrs) > 1 && !o.Cluster && o.MasterName == "" {
+		return fmt.Errorf("Multiple redis addresses require cluster mode or sentinel master name, got %v", o.Addrs)
+	}
+	c.Redis.Addrs = o.Addrs
+	if len(c.Redis.Addrs) == 0 && o.Addr != "" {
+		c.Redis.Addrs = []string{o.Addr}
+	}
+	c.Redis.MasterName = o.MasterName
+	c.Redis.Username = o.Username
+	c.Redis.Password = o.Password
+	c.Redis.SentinelPassword = o.SentinelPassword
+	c.Redis.DB = o.DB
+	c.Redis.MaxRetries = o.MaxRetries
+	c.Redis.PoolSize = o.PoolSize
+	c.Redis.MinIdleConns = o.MinIdleConns
+	c.Redis.DialTimeout = time.Duration(o.DialTimeout) * time.Second
+	c.Redis.ReadTimeout = time.Duration(o.ReadTimeout) * time.Second
+	c.Redis.WriteTimeout = time.Duration(o.WriteTimeout) * time.Second
+	c.Redis.PoolTimeout = time.Duration(o.PoolTimeout) * time.Second
+	c.Redis.IdleTimeout = time.Duration(o.IdleTimeout) * time.Second
+	if o.Network != "" && o.Network != "tcp" {
+		dialer := &net.Dialer{Timeout: c.Redis.DialTimeout, KeepAlive: 5 * time.Minute}
+		c.Redis.Dialer = func(ctx context.Context, _, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, o.Network, addr)
+		}
 	}
+	if o.TLS != nil {
+		c.Redis.TLSConfig, err = o.TLS.Load()
+		if err != nil {
+			return fmt.Errorf("Failed to load redis tls config %v", err)
+		}
+	}
+	return
 }
 
-func (c *BusConfig) Init() {
-	c.Redis = new(redis.Options)
-	if c.Config != nil {
-		v, _ := json.Marshal(c.Config)
-		json.Unmarshal(v, c.Redis)
+// Load the tls config with the certificate files
+func (c *TLSConfig) Load() (conf *tls.Config, err error) {
+	conf = &tls.Config{ServerName: c.ServerName, InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.CA != "" {
+		ca, err := ioutil.ReadFile(c.CA)
+		if err != nil {
+			return nil, err
+		}
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("No valid certificate found in CA file %s", c.CA)
+		}
 	}
+	if c.Cert != "" || c.Key != "" {
+		cert, err := tls.LoadX509KeyPair(c.Cert, c.Key)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return
 }
 
 type HeaderSyncConfig struct {
@@ -216,6 +370,7 @@ type HeaderSyncConfig struct {
 	Timeout int
 	Buffer  int
 	Enabled bool
+	Leader  bool // Run with leader election, only one instance syncs the chain headers while the others stand by
 	Poly    *PolySubmitterConfig
 	*ListenerConfig
 	Bus *BusConfig
@@ -236,6 +391,7 @@ type SrcTxCommitConfig struct {
 	Bus             *BusConfig
 	Poly            *PolySubmitterConfig
 	Filter          *FilterConfig
+	RetryBudget     map[string]int // Max failures per error class before moving tx to dead letter queue, "*" for total attempts
 }
 
 type PolyTxSyncConfig struct {
@@ -253,6 +409,8 @@ type PolyTxCommitConfig struct {
 	CheckFee         bool
 	Bus              *BusConfig
 	Filter           *FilterConfig
+	DrainDelayed     bool           // Drain the chain delayed tx queue in this handler as well as the poly tx listener
+	RetryBudget      map[string]int // Max failures per error class before moving tx to dead letter queue, "*" for total attempts
 }
 
 func (c *Config) Active(chain uint64) bool {
@@ -260,6 +418,41 @@ func (c *Config) Active(chain uint64) bool {
 }
 
 func (c *Config) Init() (err error) {
+	err = c.setup()
+	if err != nil {
+		return
+	}
+	Use(c)
+	return
+}
+
+// Global config, swapped atomically on reload
+var current atomic.Value
+
+// Current returns the global config, read it again instead of holding it to see the reloaded config
+func Current() *Config {
+	c, _ := current.Load().(*Config)
+	return c
+}
+
+// Use the config as the global config
+func Use(c *Config) {
+	tools.DingUrl = c.Validators.DingUrl
+	current.Store(c)
+}
+
+// Prepare the settings and load the wallet secrets, the config is not used as the global config
+func (c *Config) setup() (err error) {
+	err = c.Prepare()
+	if err != nil {
+		return
+	}
+	return c.LoadSecrets()
+}
+
+// Prepare fills the defaults and the inherited settings, without loading the wallet secrets or using the config
+// as the global config.
+func (c *Config) Prepare() (err error) {
 	if c.Host == "" {
 		c.Host = "0.0.0.0"
 	}
@@ -267,7 +460,10 @@ func (c *Config) Init() (err error) {
 		c.Port = 6500
 	}
 	if c.Bus != nil {
-		c.Bus.Init()
+		err = c.Bus.Init()
+		if err != nil {
+			return
+		}
 	}
 
 	if c.Poly != nil {
@@ -283,10 +479,6 @@ func (c *Config) Init() (err error) {
 			return
 		}
 	}
-
-	tools.DingUrl = c.Validators.DingUrl
-
-	CONFIG = c
 	return
 }
 
@@ -405,15 +597,19 @@ func (c *ChainConfig) FillSubmitter(o *SubmitterConfig) *SubmitterConfig {
 	}
 	if o.Wallet == nil {
 		o.Wallet = c.Wallet
+		o.WalletSecret = c.WalletSecret
 	} else {
 		o.Wallet.Path = GetConfigPath(WALLET_PATH, o.Wallet.Path)
-		if len(o.Wallet.Nodes) == 0 {
+		if len(o.Wallet.Nodes) == 0 && c.Wallet != nil {
 			o.Wallet.Nodes = c.Wallet.Nodes
 		}
 		for _, p := range o.Wallet.KeyStoreProviders {
 			p.Path = GetConfigPath(WALLET_PATH, p.Path)
 		}
 	}
+	if o.Signer == nil {
+		o.Signer = c.Signer
+	}
 
 	if o.CCMContract == "" {
 		o.CCMContract = c.CCMContract
@@ -84,6 +84,8 @@ func (c *FilterConfig) Check(tx *msg.Tx) bool {
 	if c == nil {
 		return true
 	}
+	settings.RLock()
+	defer settings.RUnlock()
 	return filter(c.SrcProxyFilter, c.SrcProxies, tx.SrcProxy) && filter(c.DstProxyFilter, c.DstProxies, tx.DstProxy) &&
 		filterOut(c.AddressFilter, c.Addresses, tx.SrcAddress) && filterOut(c.AddressFilter, c.Addresses, tx.DstAddress)
 }
@@ -0,0 +1,304 @@
+/*
+ * Copyright (C) 2021 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	ENV_PREFIX = "RELAYER"
+	REF_FILE   = "file:" // Value read from the file, with the trailing line break trimmed
+	REF_ENV    = "env:"  // Value read from the environment variable
+	REDACTED   = "******"
+)
+
+// Override the config values with the environment variables named by the upper cased json path joined
+// with underscores, like RELAYER_BUS_CONFIG_PASSWORD or RELAYER_CHAINS_2_NODES. Lists of strings are
+// comma separated. Then the file and env references in the string values are resolved.
+func (c *Config) override(environ []string) (err error) {
+	env := map[string]string{}
+	for _, kv := range environ {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 2 && strings.HasPrefix(parts[0], ENV_PREFIX+"_") {
+			env[parts[0]] = parts[1]
+		}
+	}
+	if len(env) > 0 {
+		err = overrideValue(reflect.ValueOf(c).Elem(), ENV_PREFIX, env)
+		if err != nil {
+			return
+		}
+	}
+	return resolveValue(reflect.ValueOf(c).Elem(), "$")
+}
+
+// Check whether any of the variables is under the prefix, variable names are case insensitive
+func hasPrefix(env map[string]string, prefix string) bool {
+	for name := range env {
+		if strings.HasPrefix(strings.ToUpper(name), prefix+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+func lookup(env map[string]string, name string) (string, bool) {
+	for variable, value := range env {
+		if strings.ToUpper(variable) == name {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+func overrideValue(v reflect.Value, name string, env map[string]string) (err error) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			if v.Type().Elem().Kind() != reflect.Struct || !hasPrefix(env, name) {
+				return
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return overrideValue(v.Elem(), name, env)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" || f.Tag.Get("json") == "-" {
+				continue
+			}
+			field := name
+			if !f.Anonymous {
+				field = name + "_" + strings.ToUpper(f.Name)
+			}
+			err = overrideValue(v.Field(i), field, env)
+			if err != nil {
+				return
+			}
+		}
+	case reflect.Map:
+		// Override the existing entries and add the new ones
+		keys := map[string]reflect.Value{}
+		for _, key := range v.MapKeys() {
+			keys[strings.ToUpper(fmt.Sprint(key.Interface()))] = key
+		}
+		for variable := range env {
+			if strings.HasPrefix(strings.ToUpper(variable), name+"_") {
+				segment := strings.SplitN(variable[len(name)+1:], "_", 2)[0]
+				if _, ok := keys[strings.ToUpper(segment)]; !ok {
+					key := reflect.New(v.Type().Key()).Elem()
+					if setValue(key, segment) == nil {
+						keys[strings.ToUpper(segment)] = key
+					}
+				}
+			}
+		}
+		if len(keys) > 0 && v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for upper, key := range keys {
+			value := reflect.New(v.Type().Elem()).Elem()
+			if current := v.MapIndex(key); current.IsValid() {
+				value.Set(current)
+			}
+			err = overrideValue(value, name+"_"+upper, env)
+			if err != nil {
+				return
+			}
+			if !value.IsZero() {
+				v.SetMapIndex(key, value)
+			}
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			for i := 0; i < v.Len(); i++ {
+				err = overrideValue(v.Index(i), fmt.Sprintf("%s_%d", name, i), env)
+				if err != nil {
+					return
+				}
+			}
+			return
+		}
+		fallthrough
+	default:
+		if value, ok := lookup(env, name); ok {
+			err = setValue(v, value)
+			if err != nil {
+				return fmt.Errorf("Invalid config value in %s %v", name, err)
+			}
+		}
+	}
+	return
+}
+
+func setValue(v reflect.Value, value string) (err error) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(value)
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		n, err = strconv.ParseInt(value, 10, 64)
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		n, err = strconv.ParseUint(value, 10, 64)
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		var n float64
+		n, err = strconv.ParseFloat(value, 64)
+		v.SetFloat(n)
+	case reflect.Slice:
+		list := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list).Convert(v.Type()))
+	default:
+		err = fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return
+}
+
+// Resolve the file and env references in the string values
+func resolveValue(v reflect.Value, path string) (err error) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			return resolveValue(v.Elem(), path)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" || f.Tag.Get("json") == "-" {
+				continue
+			}
+			field := path
+			if !f.Anonymous {
+				field = path + "." + f.Name
+			}
+			err = resolveValue(v.Field(i), field)
+			if err != nil {
+				return
+			}
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(v.MapIndex(key))
+			err = resolveValue(value, fmt.Sprintf("%s.%v", path, key.Interface()))
+			if err != nil {
+				return
+			}
+			v.SetMapIndex(key, value)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			err = resolveValue(v.Index(i), fmt.Sprintf("%s.%d", path, i))
+			if err != nil {
+				return
+			}
+		}
+	case reflect.String:
+		value, err := resolve(v.String())
+		if err != nil {
+			return fmt.Errorf("Failed to resolve config value of %s %v", path, err)
+		}
+		v.SetString(value)
+	}
+	return
+}
+
+func resolve(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, REF_FILE):
+		data, err := ioutil.ReadFile(strings.TrimPrefix(value, REF_FILE))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case strings.HasPrefix(value, REF_ENV):
+		name := strings.TrimPrefix(value, REF_ENV)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value, nil
+	}
+	return value, nil
+}
+
+// Check whether the config field holds secrets
+func isSecret(name string) bool {
+	switch name {
+	case "DingUrl", "HuyiUrl", "KeyPwd", "Passwords", "KeyProviders":
+		return true
+	}
+	for _, word := range []string{"Password", "PrivateKey", "Token", "Secret"} {
+		if strings.Contains(name, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted returns the config in json with the secrets masked, including every item of the secret lists and maps
+func (c *Config) Redacted() ([]byte, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	err = json.Unmarshal(data, &value)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(redact(value, false), "", "  ")
+}
+
+func redact(value interface{}, secret bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = redact(item, secret || isSecret(key))
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redact(item, secret)
+		}
+	case string:
+		if secret && v != "" {
+			return REDACTED
+		}
+	}
+	return value
+}
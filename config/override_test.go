@@ -0,0 +1,182 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/polynetwork/bridge-common/wallet"
+)
+
+func TestOverride(t *testing.T) {
+	cases := []struct {
+		name  string
+		env   []string
+		check func(*Config) bool
+	}{
+		{"string", []string{"RELAYER_ENV=testnet"}, func(c *Config) bool { return c.Env == "testnet" }},
+		{"int", []string{"RELAYER_PORT=8080"}, func(c *Config) bool { return c.Port == 8080 }},
+		{"bool", []string{"RELAYER_VALIDATORS_LEADER=true"}, func(c *Config) bool { return c.Validators.Leader }},
+		{"list", []string{"RELAYER_BRIDGE=a, b,,c"}, func(c *Config) bool {
+			return reflect.DeepEqual(c.Bridge, []string{"a", "b", "c"})
+		}},
+		{"nil struct", []string{"RELAYER_BUS_CONFIG_PASSWORD=pass"}, func(c *Config) bool {
+			return c.Bus != nil && c.Bus.Config != nil && c.Bus.Config.Password == "pass"
+		}},
+		{"existing map entry", []string{"RELAYER_CHAINS_2_CCMCONTRACT=0x02"}, func(c *Config) bool {
+			return c.Chains[2].CCMContract == "0x02" && c.Chains[2].Nodes[0] == "http://node"
+		}},
+		{"new map entry", []string{"RELAYER_CHAINS_6_NODES=http://a,http://b"}, func(c *Config) bool {
+			return c.Chains[6] != nil && len(c.Chains[6].Nodes) == 2
+		}},
+		{"other prefix", []string{"OTHER_ENV=devnet"}, func(c *Config) bool { return c.Env == "mainnet" }},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Config{Env: "mainnet", Chains: map[uint64]*ChainConfig{2: {Nodes: []string{"http://node"}}}}
+			err := c.override(tc.env)
+			if err != nil {
+				t.Fatalf("Failed to override config %v", err)
+			}
+			if !tc.check(c) {
+				t.Fatalf("Unexpected config after override %v", tc.env)
+			}
+		})
+	}
+
+	c := new(Config)
+	err := c.override([]string{"RELAYER_PORT=port"})
+	if err == nil {
+		t.Fatalf("Expected invalid int value to be rejected")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	err := ioutil.WriteFile(path, []byte("from-file\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("RELAYER_TEST_SECRET", "from-env")
+	defer os.Unsetenv("RELAYER_TEST_SECRET")
+
+	cases := []struct {
+		value  string
+		expect string
+		fail   bool
+	}{
+		{"plain", "plain", false},
+		{REF_FILE + path, "from-file", false},
+		{REF_ENV + "RELAYER_TEST_SECRET", "from-env", false},
+		{REF_FILE + path + ".missing", "", true},
+		{REF_ENV + "RELAYER_TEST_MISSING", "", true},
+	}
+	for _, tc := range cases {
+		c := &Config{
+			AdminToken: tc.value,
+			Chains: map[uint64]*ChainConfig{
+				2: {Wallet: &wallet.Config{KeyStoreProviders: []*wallet.KeyStoreProviderConfig{
+					{Passwords: map[string]string{"0x01": tc.value}},
+				}}},
+			},
+		}
+		err := c.override(nil)
+		if tc.fail {
+			if err == nil {
+				t.Fatalf("Expected reference %s to fail", tc.value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Failed to resolve %s %v", tc.value, err)
+		}
+		if c.AdminToken != tc.expect || c.Chains[2].Wallet.KeyStoreProviders[0].Passwords["0x01"] != tc.expect {
+			t.Fatalf("Unexpected resolved value of %s", tc.value)
+		}
+	}
+}
+
+// Fill every exported string with a distinct value, and collect the values of the secret fields
+func fillConfig(v reflect.Value, name string, secret bool, secrets map[string]string, count *int) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		fillConfig(v.Elem(), name, secret, secrets, count)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" || f.Tag.Get("json") == "-" {
+				continue
+			}
+			fillConfig(v.Field(i), f.Name, secret || secretFields[f.Name], secrets, count)
+		}
+	case reflect.Map:
+		v.Set(reflect.MakeMap(v.Type()))
+		key := reflect.New(v.Type().Key()).Elem()
+		setValue(key, "1")
+		value := reflect.New(v.Type().Elem()).Elem()
+		fillConfig(value, name, secret, secrets, count)
+		v.SetMapIndex(key, value)
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), 2, 2))
+		for i := 0; i < v.Len(); i++ {
+			fillConfig(v.Index(i), name, secret, secrets, count)
+		}
+	case reflect.String:
+		*count++
+		value := fmt.Sprintf("value-%d-%s", *count, name)
+		v.SetString(value)
+		if secret {
+			secrets[value] = name
+		}
+	}
+}
+
+// Fields known to hold secrets, maintained apart from isSecret to catch missed ones
+var secretFields = map[string]bool{
+	"AdminToken":       true,
+	"DingUrl":          true,
+	"HuyiUrl":          true,
+	"HuyiPassword":     true,
+	"Password":         true,
+	"SentinelPassword": true,
+	"Passwords":        true,
+	"KeyProviders":     true,
+	"PrivateKey":       true,
+	"Token":            true,
+	"WalletSecret":     true,
+	"KeyPwd":           true,
+}
+
+func TestRedacted(t *testing.T) {
+	c := new(Config)
+	secrets := map[string]string{}
+	count := 0
+	fillConfig(reflect.ValueOf(c).Elem(), "", false, secrets, &count)
+	if len(secrets) == 0 {
+		t.Fatalf("No secret fields filled")
+	}
+	data, err := c.Redacted()
+	if err != nil {
+		t.Fatalf("Failed to redact config %v", err)
+	}
+	output := string(data)
+	for value, name := range secrets {
+		if strings.Contains(output, value) {
+			t.Errorf("Secret field %s is not masked", name)
+		}
+	}
+	if !strings.Contains(output, REDACTED) || !strings.Contains(output, "-CCMContract") {
+		t.Fatalf("Unexpected redacted config %s", output)
+	}
+	if c.AdminToken == REDACTED {
+		t.Fatalf("Redacted should not modify the config")
+	}
+}
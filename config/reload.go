@@ -0,0 +1,149 @@
+/*
+ * Copyright (C) 2021 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Guards the data level settings which are updated in place on reload
+var settings sync.RWMutex
+
+// Reload parses the config and roles files again and validates the new config against the current one.
+// The new config is prepared but not used as the global config.
+func (c *Config) Reload() (o *Config, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Failed to parse config file %v", r)
+		}
+	}()
+	o, err = New(c.path)
+	if err != nil {
+		return
+	}
+	if c.rolesPath != "" {
+		err = o.ReadRoles(c.rolesPath)
+		if err != nil {
+			return
+		}
+	}
+	err = o.setup()
+	if err != nil {
+		return
+	}
+	if !sameJson(c.Bus, o.Bus) {
+		return nil, fmt.Errorf("Bus config change requires a restart")
+	}
+	return
+}
+
+// RoleChanged checks whether the role config changed beyond the data level settings and the listener nodes,
+// which means the role has to be restarted to apply the change.
+func RoleChanged(a, b interface{}) bool {
+	return !sameJson(roleSettings(a), roleSettings(b))
+}
+
+// Copy the role config without the roles file switch and the data level settings
+func roleSettings(conf interface{}) interface{} {
+	v := reflect.ValueOf(conf)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return conf
+	}
+	c := reflect.New(v.Elem().Type())
+	c.Elem().Set(v.Elem())
+	for _, name := range []string{"Enabled", "CheckFee"} {
+		if f := c.Elem().FieldByName(name); f.IsValid() {
+			f.Set(reflect.Zero(f.Type()))
+		}
+	}
+	// Filter updates in place, while adding or removing it requires a restart
+	if f := c.Elem().FieldByName("Filter"); f.IsValid() && !f.IsNil() {
+		f.Set(reflect.ValueOf(new(FilterConfig)))
+	}
+	// Listener nodes are switched in place
+	if f := c.Elem().FieldByName("ListenerConfig"); f.IsValid() && !f.IsNil() {
+		listener := *f.Interface().(*ListenerConfig)
+		listener.Nodes = nil
+		f.Set(reflect.ValueOf(&listener))
+	}
+	return c.Interface()
+}
+
+// ListenerNodes returns the listener nodes of the role config, nil for the roles without a listener
+func ListenerNodes(conf interface{}) []string {
+	v := reflect.ValueOf(conf)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	if f := v.Elem().FieldByName("ListenerConfig"); f.IsValid() && !f.IsNil() {
+		return f.Interface().(*ListenerConfig).Nodes
+	}
+	return nil
+}
+
+// NodesChanged checks whether the listener nodes of the role config changed
+func NodesChanged(a, b interface{}) bool {
+	return !sameJson(ListenerNodes(a), ListenerNodes(b))
+}
+
+func sameJson(a, b interface{}) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return string(x) == string(y)
+}
+
+// Update the filter settings in place
+func (c *FilterConfig) Update(o *FilterConfig) {
+	if c == nil || o == nil {
+		return
+	}
+	settings.Lock()
+	defer settings.Unlock()
+	c.SrcProxyFilter, c.DstProxyFilter, c.AddressFilter = o.SrcProxyFilter, o.DstProxyFilter, o.AddressFilter
+	c.SrcProxies, c.DstProxies, c.Addresses = o.SrcProxies, o.DstProxies, o.Addresses
+}
+
+// SetNodes updates the listener nodes in place once the listener switched to them
+func (c *ListenerConfig) SetNodes(nodes []string) {
+	settings.Lock()
+	c.Nodes = nodes
+	settings.Unlock()
+}
+
+// Update the data level settings in place
+func (c *SrcTxCommitConfig) Update(o *SrcTxCommitConfig) {
+	c.Filter.Update(o.Filter)
+}
+
+// Update the data level settings in place
+func (c *PolyTxCommitConfig) Update(o *PolyTxCommitConfig) {
+	c.Filter.Update(o.Filter)
+	settings.Lock()
+	c.CheckFee = o.CheckFee
+	settings.Unlock()
+}
+
+// FeeCheck returns whether to check the fee before submitting the poly txs
+func (c *PolyTxCommitConfig) FeeCheck() bool {
+	settings.RLock()
+	defer settings.RUnlock()
+	return c.CheckFee
+}
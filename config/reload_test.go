@@ -0,0 +1,45 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRoleChanged(t *testing.T) {
+	role := func(nodes []string, ccm string, enabled bool) *SrcTxSyncConfig {
+		return &SrcTxSyncConfig{
+			ListenerConfig: &ListenerConfig{ChainId: 2, Nodes: nodes, CCMContract: ccm},
+			Enabled:        enabled,
+		}
+	}
+	a := role([]string{"http://a"}, "0x01", false)
+	cases := []struct {
+		name  string
+		b     *SrcTxSyncConfig
+		role  bool
+		nodes bool
+	}{
+		{"same", role([]string{"http://a"}, "0x01", false), false, false},
+		{"enabled", role([]string{"http://a"}, "0x01", true), false, false},
+		{"nodes", role([]string{"http://a", "http://b"}, "0x01", false), false, true},
+		{"contract", role([]string{"http://a"}, "0x02", false), true, false},
+		{"no listener", &SrcTxSyncConfig{}, true, true},
+	}
+	for _, tc := range cases {
+		if RoleChanged(a, tc.b) != tc.role || NodesChanged(a, tc.b) != tc.nodes {
+			t.Fatalf("Unexpected role change check of case %s", tc.name)
+		}
+	}
+	if !reflect.DeepEqual(a.Nodes, []string{"http://a"}) {
+		t.Fatalf("Role change check should not modify the config")
+	}
+
+	b := role([]string{"http://b"}, "0x01", false)
+	a.SetNodes(ListenerNodes(b))
+	if RoleChanged(a, b) || NodesChanged(a, b) {
+		t.Fatalf("Unexpected role change after the nodes updated")
+	}
+	if ListenerNodes(&PolyTxCommitConfig{}) != nil {
+		t.Fatalf("Unexpected listener nodes of the role without a listener")
+	}
+}
@@ -25,6 +25,15 @@ import (
 	"github.com/polynetwork/bridge-common/base"
 )
 
+// Role names as in the roles file
+const (
+	ROLE_HEADER_SYNC = "HeaderSync"
+	ROLE_TX_LISTEN   = "TxListen"
+	ROLE_TX_COMMIT   = "TxCommit"
+	ROLE_POLY_LISTEN = "PolyListen"
+	ROLE_POLY_COMMIT = "PolyCommit"
+)
+
 type Role struct {
 	HeaderSync bool // header sync
 	TxListen   bool // chain(src) -> mq
@@ -35,21 +44,31 @@ type Role struct {
 
 type Roles map[uint64]Role
 
-func (c *Config) ReadRoles(path string) (err error) {
+func LoadRoles(path string) (roles Roles, err error) {
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
-		return fmt.Errorf("Read roles file error %v", err)
+		return nil, fmt.Errorf("Read roles file error %v", err)
 	}
-	roles := Roles{}
+	roles = Roles{}
 	err = json.Unmarshal(data, &roles)
 	if err != nil {
-		return fmt.Errorf("Parse roles file error %v", err)
+		return nil, fmt.Errorf("Parse roles file error %v", err)
+	}
+	return
+}
+
+func (c *Config) ReadRoles(path string) (err error) {
+	roles, err := LoadRoles(path)
+	if err != nil {
+		return
 	}
 	c.ApplyRoles(roles)
+	c.rolesPath = path
 	return
 }
 
 func (c *Config) ApplyRoles(roles Roles) {
+	c.roles = true
 	for id, role := range roles {
 		c.chains[id] = true
 		if id == base.POLY {
@@ -0,0 +1,408 @@
+/*
+ * Copyright (C) 2021 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/polynetwork/bridge-common/wallet"
+)
+
+const (
+	SECRET_ENV   = "env"   // Environment variables
+	SECRET_FILE  = "file"  // Files, like the docker or kubernetes secrets
+	SECRET_AGENT = "agent" // Local secret agent on a unix socket, unlocked once by the operator
+	SECRET_VAULT = "vault" // Vault over http
+
+	ENV_AGENT_SOCKET = "RELAYER_AGENT_SOCKET"
+	ENV_VAULT_ADDR   = "RELAYER_VAULT_ADDR"
+	ENV_VAULT_TOKEN  = "RELAYER_VAULT_TOKEN"
+
+	AGENT_SOCKET   = "poly-relayer-agent.sock"
+	SECRET_TIMEOUT = 10 * time.Second
+)
+
+// Secret of the config passphrase, like env:NAME, file:PATH, agent:NAME or vault:NAME
+var PASSPHRASE_SECRET string
+
+// SecretProvider looks up the secrets by key, the empty key is for the wallet password while the keystore
+// passwords use the lower cased account addresses as keys.
+type SecretProvider interface {
+	Secret(key string) (string, error)
+}
+
+// SecretConfig selects the secret provider of a wallet
+type SecretConfig struct {
+	Provider string     // env, file, agent or vault
+	Name     string     // Variable name prefix, file or directory path, or secret name in the agent or vault
+	Socket   string     // Agent socket path, RELAYER_AGENT_SOCKET or the default path when unspecified
+	Url      string     // Vault address, RELAYER_VAULT_ADDR when unspecified
+	Token    string     // Vault token, RELAYER_VAULT_TOKEN when unspecified
+	TLS      *TLSConfig // Vault tls config
+	Insecure bool       // Allow the vault address over plain http, only for the vault on the local host
+}
+
+// ParseSecret parses the secret spec in the form of provider:name
+func ParseSecret(spec string) (*SecretConfig, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, fmt.Errorf("Invalid secret %s, expecting provider:name", spec)
+	}
+	return &SecretConfig{Provider: parts[0], Name: parts[1]}, nil
+}
+
+// Load creates the secret provider per the config
+func (c *SecretConfig) Load() (SecretProvider, error) {
+	if c.Name == "" {
+		return nil, fmt.Errorf("Secret name is required for provider %s", c.Provider)
+	}
+	switch c.Provider {
+	case SECRET_ENV:
+		return EnvSecretProvider(c.Name), nil
+	case SECRET_FILE:
+		return FileSecretProvider(c.Name), nil
+	case SECRET_AGENT:
+		socket := c.Socket
+		if socket == "" {
+			socket = os.Getenv(ENV_AGENT_SOCKET)
+		}
+		if socket == "" {
+			socket = DefaultAgentSocket()
+		}
+		return NewAgentSecretProvider(socket, c.Name), nil
+	case SECRET_VAULT:
+		return c.vault()
+	}
+	return nil, fmt.Errorf("Unknown secret provider %s", c.Provider)
+}
+
+func (c *SecretConfig) vault() (p *VaultSecretProvider, err error) {
+	p = &VaultSecretProvider{name: c.Name, url: c.Url, token: c.Token, client: &http.Client{Timeout: SECRET_TIMEOUT}}
+	if p.url == "" {
+		p.url = os.Getenv(ENV_VAULT_ADDR)
+	}
+	if p.token == "" {
+		p.token = os.Getenv(ENV_VAULT_TOKEN)
+	}
+	if p.url == "" {
+		return nil, fmt.Errorf("Vault address is required for secret %s", c.Name)
+	}
+	u, err := url.Parse(p.url)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid vault address %v", err)
+	}
+	if u.Scheme != "https" && !c.Insecure {
+		return nil, fmt.Errorf("Vault address must be https, set Insecure to allow %s", u.Scheme)
+	}
+	if c.TLS != nil {
+		conf, err := c.TLS.Load()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load vault tls config %v", err)
+		}
+		p.client.Transport = &http.Transport{TLSClientConfig: conf}
+	}
+	return
+}
+
+// EnvSecretProvider reads the secrets from the variable named by itself, or suffixed with the upper cased
+// key for the keyed secrets
+type EnvSecretProvider string
+
+func (p EnvSecretProvider) Secret(key string) (string, error) {
+	name := string(p)
+	if key != "" {
+		name = name + "_" + strings.ToUpper(key)
+	}
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return value, nil
+}
+
+// FileSecretProvider reads the secret from the file, or from the file named by the key in the directory
+// for the keyed secrets, like the mounted kubernetes secrets
+type FileSecretProvider string
+
+func (p FileSecretProvider) Secret(key string) (string, error) {
+	path := string(p)
+	if key != "" {
+		path = filepath.Join(path, key)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Response of the secret agent and the vault
+type SecretResponse struct {
+	Data struct {
+		Value string `json:"value"`
+	} `json:"data"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Get the secret over http and decode the response
+func getSecret(client *http.Client, req *http.Request) (string, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	res := new(SecretResponse)
+	err = json.NewDecoder(resp.Body).Decode(res)
+	if err != nil && resp.StatusCode == http.StatusOK {
+		return "", fmt.Errorf("Failed to decode secret response %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("secret request failed with status %d %s", resp.StatusCode, strings.Join(res.Errors, ", "))
+	}
+	return res.Data.Value, nil
+}
+
+// Secret path of the key under the secret name
+func secretPath(name, key string) string {
+	if key == "" {
+		return name
+	}
+	return name + "/" + key
+}
+
+// AgentSecretProvider queries the local secret agent on the unix socket
+type AgentSecretProvider struct {
+	name   string
+	client *http.Client
+}
+
+func NewAgentSecretProvider(socket, name string) *AgentSecretProvider {
+	return &AgentSecretProvider{name: name, client: AgentClient(socket)}
+}
+
+// DefaultAgentSocket gives the agent socket path in the per user runtime directory, or in the private
+// directory next to the config file when XDG_RUNTIME_DIR is not set
+func DefaultAgentSocket() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, AGENT_SOCKET)
+	}
+	return filepath.Join(filepath.Dir(CONFIG_PATH), ".agent", AGENT_SOCKET)
+}
+
+// AgentClient creates the http client to the secret agent on the unix socket, the agent must be run by
+// the same user, so the secrets are never sent to or requested from a socket planted by another user.
+func AgentClient(socket string) *http.Client {
+	return &http.Client{
+		Timeout: SECRET_TIMEOUT,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				conn, err := d.DialContext(ctx, "unix", socket)
+				if err != nil {
+					return nil, err
+				}
+				err = CheckPeer(conn)
+				if err != nil {
+					conn.Close()
+					return nil, fmt.Errorf("Untrusted secret agent socket %s %v", socket, err)
+				}
+				return conn, nil
+			},
+		},
+	}
+}
+
+func (p *AgentSecretProvider) Secret(key string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, "http://agent/v1/secret?name="+url.QueryEscape(secretPath(p.name, key)), nil)
+	if err != nil {
+		return "", err
+	}
+	return getSecret(p.client, req)
+}
+
+// VaultSecretProvider reads the secret value at the path of the vault api, the keyed secrets are under the
+// secret name
+type VaultSecretProvider struct {
+	name   string
+	url    string
+	token  string
+	client *http.Client
+}
+
+func (p *VaultSecretProvider) Secret(key string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(p.url, "/")+"/v1/"+secretPath(p.name, key), nil)
+	if err != nil {
+		return "", err
+	}
+	if p.token != "" {
+		req.Header.Set("X-Vault-Token", p.token)
+	}
+	return getSecret(p.client, req)
+}
+
+// Read the config passphrase with the secret spec
+func readPassphrase(spec string) ([]byte, error) {
+	c, err := ParseSecret(spec)
+	if err != nil {
+		return nil, err
+	}
+	p, err := c.Load()
+	if err != nil {
+		return nil, err
+	}
+	pass, err := p.Secret("")
+	if err != nil {
+		return nil, err
+	}
+	return []byte(pass), nil
+}
+
+// Fill the wallet password and the keystore passwords unspecified in the wallet config with the secrets
+func loadWalletSecrets(w *wallet.Config, c *SecretConfig) (err error) {
+	if w == nil || c == nil {
+		return
+	}
+	p, err := c.Load()
+	if err != nil {
+		return
+	}
+	if w.Path != "" && w.Password == "" {
+		w.Password, err = p.Secret("")
+		if err != nil {
+			return fmt.Errorf("Failed to fetch wallet password %v", err)
+		}
+	}
+	for _, ks := range w.KeyStoreProviders {
+		addresses, err := keyStoreAddresses(ks.Path)
+		if err != nil {
+			return fmt.Errorf("Failed to list keystore accounts in %s %v", ks.Path, err)
+		}
+		for _, address := range addresses {
+			if hasPassword(ks.Passwords, address) {
+				continue
+			}
+			pass, err := p.Secret(address)
+			if err != nil {
+				return fmt.Errorf("Failed to fetch keystore password of %s %v", address, err)
+			}
+			if ks.Passwords == nil {
+				ks.Passwords = map[string]string{}
+			}
+			ks.Passwords[address] = pass
+		}
+	}
+	return
+}
+
+func hasPassword(passwords map[string]string, address string) bool {
+	for addr, pass := range passwords {
+		if strings.EqualFold(addr, address) && pass != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// List the lower cased account addresses in the keystore directory
+func keyStoreAddresses(path string) (list []string, err error) {
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(path, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var key struct {
+			Address string `json:"address"`
+		}
+		if json.Unmarshal(data, &key) != nil || key.Address == "" {
+			continue
+		}
+		list = append(list, "0x"+strings.ToLower(strings.TrimPrefix(key.Address, "0x")))
+	}
+	return
+}
+
+// LoadSecrets fetches the unspecified wallet passwords of the poly and the chains from the secret providers.
+// With the roles applied, only the wallets of the active chains and the enabled roles are unlocked.
+func (c *Config) LoadSecrets() (err error) {
+	loaded := map[*wallet.Config]bool{}
+	load := func(w *wallet.Config, s *SecretConfig) error {
+		if w == nil || s == nil || loaded[w] {
+			return nil
+		}
+		loaded[w] = true
+		return loadWalletSecrets(w, s)
+	}
+	submitters := []*PolySubmitterConfig{}
+	if c.Poly != nil {
+		submitters = append(submitters, &c.Poly.PolySubmitterConfig)
+	}
+	enabled := func(on bool) bool { return on || !c.roles }
+	for id, chain := range c.Chains {
+		if c.roles && !c.Active(id) {
+			continue
+		}
+		err = load(chain.Wallet, chain.WalletSecret)
+		if err != nil {
+			return fmt.Errorf("Chain %d %v", id, err)
+		}
+		if chain.PolyTxCommit != nil && chain.PolyTxCommit.SubmitterConfig != nil && enabled(chain.PolyTxCommit.Enabled) {
+			err = load(chain.PolyTxCommit.Wallet, chain.PolyTxCommit.WalletSecret)
+			if err != nil {
+				return fmt.Errorf("Chain %d %v", id, err)
+			}
+		}
+		if chain.HeaderSync != nil && enabled(chain.HeaderSync.Enabled) {
+			submitters = append(submitters, chain.HeaderSync.Poly)
+		}
+		if chain.SrcTxSync != nil && enabled(chain.SrcTxSync.Enabled) {
+			submitters = append(submitters, chain.SrcTxSync.Poly)
+		}
+		if chain.SrcTxCommit != nil && enabled(chain.SrcTxCommit.Enabled) {
+			submitters = append(submitters, chain.SrcTxCommit.Poly)
+		}
+		if chain.PolyTxCommit != nil && enabled(chain.PolyTxCommit.Enabled) {
+			submitters = append(submitters, chain.PolyTxCommit.Poly)
+		}
+	}
+	for _, s := range submitters {
+		if s != nil {
+			err = load(s.Wallet, s.WalletSecret)
+			if err != nil {
+				return fmt.Errorf("Poly %v", err)
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/polynetwork/bridge-common/wallet"
+)
+
+func TestSecretProviders(t *testing.T) {
+	dir := t.TempDir()
+	os.Setenv("RELAYER_TEST_PASS", "env-pass")
+	os.Setenv("RELAYER_TEST_PASS_0XAB", "env-key-pass")
+	defer os.Unsetenv("RELAYER_TEST_PASS")
+	defer os.Unsetenv("RELAYER_TEST_PASS_0XAB")
+	err := ioutil.WriteFile(filepath.Join(dir, "pass"), []byte("file-pass\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Mkdir(filepath.Join(dir, "keys"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, "keys", "0xab"), []byte("file-key-pass"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		if r.URL.Path != "/v1/relayer/0xab" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"value":"vault-key-pass"}}`))
+	}))
+	defer vault.Close()
+
+	cases := []struct {
+		name   string
+		secret *SecretConfig
+		key    string
+		expect string
+		fail   bool
+	}{
+		{"env", &SecretConfig{Provider: SECRET_ENV, Name: "RELAYER_TEST_PASS"}, "", "env-pass", false},
+		{"env keyed", &SecretConfig{Provider: SECRET_ENV, Name: "RELAYER_TEST_PASS"}, "0xab", "env-key-pass", false},
+		{"env missing", &SecretConfig{Provider: SECRET_ENV, Name: "RELAYER_TEST_MISSING"}, "", "", true},
+		{"file", &SecretConfig{Provider: SECRET_FILE, Name: filepath.Join(dir, "pass")}, "", "file-pass", false},
+		{"file keyed", &SecretConfig{Provider: SECRET_FILE, Name: filepath.Join(dir, "keys")}, "0xab", "file-key-pass", false},
+		{"file missing", &SecretConfig{Provider: SECRET_FILE, Name: filepath.Join(dir, "keys")}, "0xcd", "", true},
+		{"vault", &SecretConfig{Provider: SECRET_VAULT, Name: "relayer", Url: vault.URL, Insecure: true, Token: "token"}, "0xab", "vault-key-pass", false},
+		{"vault missing", &SecretConfig{Provider: SECRET_VAULT, Name: "relayer", Url: vault.URL, Insecure: true, Token: "token"}, "0xcd", "", true},
+		{"vault denied", &SecretConfig{Provider: SECRET_VAULT, Name: "relayer", Url: vault.URL, Insecure: true}, "0xab", "", true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := tc.secret.Load()
+			if err != nil {
+				t.Fatalf("Failed to load secret provider %v", err)
+			}
+			value, err := p.Secret(tc.key)
+			if tc.fail {
+				if err == nil {
+					t.Fatalf("Expected secret lookup to fail, got %s", value)
+				}
+				return
+			}
+			if err != nil || value != tc.expect {
+				t.Fatalf("Unexpected secret %s err %v", value, err)
+			}
+		})
+	}
+
+	_, err = (&SecretConfig{Provider: SECRET_VAULT, Name: "relayer", Url: vault.URL, Token: "token"}).Load()
+	if err == nil {
+		t.Fatalf("Expected vault address over plain http to be rejected")
+	}
+
+	for _, spec := range []string{"env", "env:", "unknown:name"} {
+		c, err := ParseSecret(spec)
+		if err == nil {
+			_, err = c.Load()
+		}
+		if err == nil {
+			t.Fatalf("Expected invalid secret %s to be rejected", spec)
+		}
+	}
+}
+
+func TestLoadWalletSecrets(t *testing.T) {
+	dir := t.TempDir()
+	for name, address := range map[string]string{"a.json": "00000000000000000000000000000000000000AB", "b.json": "0x00000000000000000000000000000000000000cd"} {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(`{"address":"`+address+`"}`), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Setenv("RELAYER_TEST_WALLET_0X00000000000000000000000000000000000000AB", "pass-ab")
+	defer os.Unsetenv("RELAYER_TEST_WALLET_0X00000000000000000000000000000000000000AB")
+
+	w := &wallet.Config{KeyStoreProviders: []*wallet.KeyStoreProviderConfig{{
+		Path:      dir,
+		Passwords: map[string]string{"0x00000000000000000000000000000000000000CD": "pass-cd"},
+	}}}
+	err := loadWalletSecrets(w, &SecretConfig{Provider: SECRET_ENV, Name: "RELAYER_TEST_WALLET"})
+	if err != nil {
+		t.Fatalf("Failed to load wallet secrets %v", err)
+	}
+	passwords := w.KeyStoreProviders[0].Passwords
+	if passwords["0x00000000000000000000000000000000000000ab"] != "pass-ab" || len(passwords) != 2 {
+		t.Fatalf("Unexpected keystore passwords %v", passwords)
+	}
+}
+
+func TestLoadSecretsRoles(t *testing.T) {
+	secret := &SecretConfig{Provider: SECRET_ENV, Name: "RELAYER_TEST_MISSING"}
+	c := &Config{chains: map[uint64]bool{}, Chains: map[uint64]*ChainConfig{
+		2: {Wallet: &wallet.Config{Path: "wallet.dat"}, WalletSecret: secret},
+	}}
+	c.ApplyRoles(Roles{3: {TxListen: true}})
+	if err := c.LoadSecrets(); err != nil {
+		t.Fatalf("Secrets of the inactive chain should not be fetched, err %v", err)
+	}
+	c.ApplyRoles(Roles{2: {TxListen: true}})
+	if err := c.LoadSecrets(); err == nil {
+		t.Fatalf("Secrets of the active chain should be fetched")
+	}
+}
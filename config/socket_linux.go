@@ -0,0 +1,73 @@
+/*
+ * Copyright (C) 2021 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// ListenSocket listens on the unix socket accessible only by the current user. The directory is created
+// private, and the socket is created under the restricted umask, so there is no window for the others to
+// connect before the permission is set.
+func ListenSocket(path string) (listener net.Listener, err error) {
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return
+	}
+	// Remove the stale socket left by the last run, but never the other files
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		os.Remove(path)
+	}
+	mask := syscall.Umask(0177)
+	listener, err = net.Listen("unix", path)
+	syscall.Umask(mask)
+	return
+}
+
+// CheckPeer verifies the process on the other end of the unix socket runs as the current user
+func CheckPeer(conn net.Conn) (err error) {
+	c, ok := conn.(*net.UnixConn)
+	if !ok {
+		return fmt.Errorf("not a unix socket connection")
+	}
+	raw, err := c.SyscallConn()
+	if err != nil {
+		return
+	}
+	var cred *syscall.Ucred
+	ctlErr := raw.Control(func(fd uintptr) {
+		cred, err = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if ctlErr != nil {
+		return ctlErr
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to get peer credentials %v", err)
+	}
+	if int(cred.Uid) != os.Getuid() {
+		return fmt.Errorf("peer uid %d does not match the current uid %d", cred.Uid, os.Getuid())
+	}
+	return
+}
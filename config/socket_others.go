@@ -0,0 +1,37 @@
+//go:build !linux
+// +build !linux
+
+/*
+ * Copyright (C) 2021 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package config
+
+import (
+	"fmt"
+	"net"
+)
+
+// The peer credentials of the unix socket are only checked on linux, the secret agent is not supported on
+// the other platforms.
+
+func ListenSocket(path string) (net.Listener, error) {
+	return nil, fmt.Errorf("secret agent is only supported on linux")
+}
+
+func CheckPeer(conn net.Conn) error {
+	return fmt.Errorf("secret agent is only supported on linux")
+}
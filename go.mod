@@ -3,12 +3,14 @@ module github.com/polynetwork/poly-relayer
 go 1.15
 
 require (
+	github.com/alicebob/miniredis/v2 v2.17.0
 	github.com/btcsuite/btcd v0.22.1
 	github.com/ethereum/go-ethereum v1.10.7
 	github.com/go-redis/redis/v8 v8.11.3
 	github.com/google/uuid v1.3.0 // indirect
 	github.com/jackpal/go-nat-pmp v1.0.2 // indirect
 	github.com/joeqian10/neo-gogogo v1.4.0
+	github.com/klauspost/compress v1.13.6
 	github.com/kr/pretty v0.3.0 // indirect
 	github.com/onflow/cadence v0.23.3-patch.1 // indirect
 	github.com/onflow/flow-go/crypto v0.21.4-0.20211125190211-7b31c986316e // indirect
@@ -29,6 +31,7 @@ require (
 	github.com/spf13/viper v1.10.1 // indirect
 	github.com/starcoinorg/starcoin-go v0.0.0-20220105024102-530daedc128b
 	github.com/urfave/cli/v2 v2.3.0
+	go.etcd.io/bbolt v1.3.4
 	go.uber.org/goleak v1.1.11-0.20210813005559-691160354723 // indirect
 	golang.org/x/crypto v0.0.0-20220722155217-630584e8d5aa
 	golang.org/x/net v0.0.0-20211123203042-d83791d6bcd9 // indirect
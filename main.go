@@ -11,6 +11,7 @@ import (
 
 	"github.com/polynetwork/bridge-common/log"
 	"github.com/polynetwork/bridge-common/wallet"
+	"github.com/polynetwork/poly-relayer/bus"
 	"github.com/polynetwork/poly-relayer/config"
 	"github.com/polynetwork/poly-relayer/msg"
 	"github.com/polynetwork/poly-relayer/relayer"
@@ -33,6 +34,10 @@ func main() {
 			&cli.BoolFlag{
 				Name: "plain",
 			},
+			&cli.StringFlag{
+				Name:  "passphrase",
+				Usage: "secret of the encrypted config passphrase, like env:NAME, file:PATH, agent:NAME or vault:NAME, prompt when unspecified",
+			},
 			&cli.StringFlag{
 				Name:  "log",
 				Value: "",
@@ -276,6 +281,58 @@ func main() {
 						Usage:    "tx hash",
 						Required: true,
 					},
+					&cli.StringFlag{
+						Name:  "reason",
+						Usage: "reason to skip the tx",
+					},
+					&cli.StringFlag{
+						Name:  "operator",
+						Usage: "operator name, current os user by default",
+					},
+					&cli.Int64Flag{
+						Name:  "ttl",
+						Usage: "seconds before the skip mark expires, never expires by default",
+					},
+					&cli.Uint64Flag{
+						Name:  "chain",
+						Usage: "only skip the tx to the dst chain, all chains by default",
+					},
+				},
+			},
+			&cli.Command{
+				Name:   relayer.UNSKIP,
+				Usage:  "Remove the skip mark of tx hash",
+				Action: command(relayer.UNSKIP),
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "hash",
+						Usage:    "tx hash",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:  "reason",
+						Usage: "reason to unskip the tx",
+					},
+					&cli.StringFlag{
+						Name:  "operator",
+						Usage: "operator name, current os user by default",
+					},
+				},
+			},
+			&cli.Command{
+				Name:   relayer.LIST_SKIP,
+				Usage:  "List the tx hashes marked to skip",
+				Action: command(relayer.LIST_SKIP),
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "audit",
+						Usage: "show the skip and unskip audit trail instead",
+					},
+					&cli.IntFlag{
+						Name:  "limit",
+						Usage: "max count of the latest audit records",
+						Value: 100,
+					},
 				},
 			},
 			&cli.Command{
@@ -288,6 +345,10 @@ func main() {
 						Usage:    "tx hash",
 						Required: true,
 					},
+					&cli.Uint64Flag{
+						Name:  "chain",
+						Usage: "dst chain id of the tx",
+					},
 				},
 			},
 			&cli.Command{
@@ -363,6 +424,26 @@ func main() {
 					},
 				},
 			},
+			&cli.Command{
+				Name:   relayer.REENCRYPT_FILE,
+				Usage:  "Migrate a file encrypted in the legacy format to the latest encryption format",
+				Action: command(relayer.REENCRYPT_FILE),
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "file",
+						Usage:    "file path",
+						Required: true,
+					},
+					&cli.BoolFlag{
+						Name:  "newpass",
+						Usage: "change the passphrase, also applies to files in the latest format",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "skip the json check of the decrypted legacy file",
+					},
+				},
+			},
 			&cli.Command{
 				Name:   relayer.APPROVE_SIDECHAIN,
 				Usage:  "Approve side chain",
@@ -522,6 +603,291 @@ func main() {
 					},
 				},
 			},
+			&cli.Command{
+				Name:  "dlq",
+				Usage: "Inspect and replay dead letter txs",
+				Subcommands: []*cli.Command{
+					&cli.Command{
+						Name:   "list",
+						Usage:  "List dead letter txs",
+						Action: command(relayer.DLQ_LIST),
+						Flags:  dlqFlags(),
+					},
+					&cli.Command{
+						Name:   "show",
+						Usage:  "Show dead letter tx details",
+						Action: command(relayer.DLQ_SHOW),
+						Flags: append(dlqFlags(),
+							&cli.StringFlag{
+								Name:     "hash",
+								Usage:    "tx hash",
+								Required: true,
+							},
+						),
+					},
+					&cli.Command{
+						Name:   "requeue",
+						Usage:  "Push dead letter txs back to the tx queue, all txs will be requeued when hash is unspecified",
+						Action: command(relayer.DLQ_REQUEUE),
+						Flags: append(dlqFlags(),
+							&cli.StringFlag{
+								Name:  "hash",
+								Usage: "tx hash",
+							},
+						),
+					},
+					&cli.Command{
+						Name:   "purge",
+						Usage:  "Remove dead letter txs",
+						Action: command(relayer.DLQ_PURGE),
+						Flags: append(dlqFlags(),
+							&cli.StringFlag{
+								Name:  "hash",
+								Usage: "tx hash",
+							},
+							&cli.BoolFlag{
+								Name:  "all",
+								Usage: "remove all txs in the queue",
+							},
+						),
+					},
+				},
+			},
+			&cli.Command{
+				Name:  "bus",
+				Usage: "Bus maintenance",
+				Subcommands: []*cli.Command{
+					&cli.Command{
+						Name:   "migrate",
+						Usage:  "Rewrite the queued txs with the tx envelope version and encoding of the bus codec",
+						Action: command(relayer.BUS_MIGRATE),
+						Flags: []cli.Flag{
+							&cli.Uint64Flag{
+								Name:  "chain",
+								Usage: "only migrate the queues of the chain, all chains when unspecified",
+							},
+							&cli.BoolFlag{
+								Name:  "keys",
+								Usage: "move the redis keys to the key layout of the config instead, hash tagged in cluster mode, with the relayers stopped",
+							},
+						},
+					},
+				},
+			},
+			&cli.Command{
+				Name:  "config",
+				Usage: "Inspect the config and roles files",
+				Subcommands: []*cli.Command{
+					&cli.Command{
+						Name:   "check",
+						Usage:  "Validate the config and roles files together",
+						Action: command(relayer.CONFIG_CHECK),
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "probe",
+								Usage: "probe the bus and node connectivity as well",
+							},
+						},
+					},
+					&cli.Command{
+						Name:   "show",
+						Usage:  "Print the effective config with the env overrides and references applied, secrets redacted",
+						Action: command(relayer.CONFIG_SHOW),
+					},
+				},
+			},
+			&cli.Command{
+				Name:  "secret",
+				Usage: "Run and unlock the local secret agent serving the wallet passwords",
+				Subcommands: []*cli.Command{
+					&cli.Command{
+						Name:   "agent",
+						Usage:  "Serve the secrets of the encrypted secrets file on the unix socket, locked until unlocked",
+						Action: command(relayer.SECRET_AGENT),
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "file",
+								Usage:    "encrypted secrets file of a json object of the secret names and values",
+								Required: true,
+							},
+							agentSocketFlag(),
+						},
+					},
+					&cli.Command{
+						Name:   "unlock",
+						Usage:  "Unlock the secret agent with the passphrase of the secrets file",
+						Action: command(relayer.SECRET_UNLOCK),
+						Flags:  []cli.Flag{agentSocketFlag()},
+					},
+					&cli.Command{
+						Name:   "lock",
+						Usage:  "Lock the secret agent to drop the secrets",
+						Action: command(relayer.SECRET_LOCK),
+						Flags:  []cli.Flag{agentSocketFlag()},
+					},
+				},
+			},
+			&cli.Command{
+				Name:   relayer.RELOAD,
+				Usage:  "Request the running relayer instances to reload the config and roles files",
+				Action: command(relayer.RELOAD),
+			},
+			&cli.Command{
+				Name:  "role",
+				Usage: "List and control the relayer roles at runtime",
+				Subcommands: []*cli.Command{
+					&cli.Command{
+						Name:   "list",
+						Usage:  "List the role status of the running instances and the role controls",
+						Action: command(relayer.ROLE_LIST),
+						Flags: []cli.Flag{
+							&cli.Uint64Flag{
+								Name:  "chain",
+								Usage: "only list the roles of the chain",
+							},
+						},
+					},
+					&cli.Command{
+						Name:   "pause",
+						Usage:  "Pause the role on the chain until resumed",
+						Action: command(relayer.ROLE_PAUSE),
+						Flags:  roleFlags(),
+					},
+					&cli.Command{
+						Name:   "resume",
+						Usage:  "Resume the paused role to follow the roles file again",
+						Action: command(relayer.ROLE_RESUME),
+						Flags:  roleFlags(),
+					},
+					&cli.Command{
+						Name:   "start",
+						Usage:  "Start the role on the chain regardless of the roles file",
+						Action: command(relayer.ROLE_START),
+						Flags:  roleFlags(),
+					},
+					&cli.Command{
+						Name:   "stop",
+						Usage:  "Stop the role on the chain regardless of the roles file",
+						Action: command(relayer.ROLE_STOP),
+						Flags:  roleFlags(),
+					},
+				},
+			},
+			&cli.Command{
+				Name:  "queue",
+				Usage: "Inspect and modify the bus queues",
+				Subcommands: []*cli.Command{
+					&cli.Command{
+						Name:   "list",
+						Usage:  "List the queue entries",
+						Action: command(relayer.QUEUE_LIST),
+						Flags:  append(queueFlags(), pageFlags(20)...),
+					},
+					&cli.Command{
+						Name:   "peek",
+						Usage:  "Show the queue entry details",
+						Action: command(relayer.QUEUE_PEEK),
+						Flags:  append(queueFlags(), pageFlags(1)...),
+					},
+					&cli.Command{
+						Name:   "search",
+						Usage:  "Search the queues for the src, poly or dst hash",
+						Action: command(relayer.QUEUE_SEARCH),
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "queue",
+								Usage: "queue name, all queues of the chain are searched when unspecified",
+							},
+							&cli.Uint64Flag{
+								Name:  "chain",
+								Usage: "queue chain id, all chains when unspecified",
+							},
+							&cli.StringFlag{
+								Name:  "type",
+								Usage: "queue tx type: poly or src",
+								Value: "poly",
+							},
+							&cli.StringFlag{
+								Name:     "hash",
+								Usage:    "src, poly or dst tx hash",
+								Required: true,
+							},
+						},
+					},
+					&cli.Command{
+						Name:   "remove",
+						Usage:  "Remove one entry from the queue",
+						Action: command(relayer.QUEUE_REMOVE),
+						Flags:  append(queueFlags(), selectFlags()...),
+					},
+					&cli.Command{
+						Name:   "move",
+						Usage:  "Move entries to another queue",
+						Action: command(relayer.QUEUE_MOVE),
+						Flags: append(append(queueFlags(), selectFlags()...),
+							&cli.StringFlag{
+								Name:     "to",
+								Usage:    "target queue name",
+								Required: true,
+							},
+							&cli.Uint64Flag{
+								Name:  "to-chain",
+								Usage: "target queue chain id, same as the source queue when unspecified",
+							},
+							&cli.StringFlag{
+								Name:  "to-type",
+								Usage: "target queue tx type, same as the source queue when unspecified",
+							},
+							&cli.Float64Flag{
+								Name:  "score",
+								Usage: "score in the target sorted queue, src height for sorted queue and now for delayed queue by default",
+							},
+							&cli.Int64Flag{
+								Name:  "delay",
+								Usage: "score the entries in the target delayed queue with seconds from now",
+							},
+						),
+					},
+					&cli.Command{
+						Name:   "rescore",
+						Usage:  "Update the scores of the sorted or delayed queue entries",
+						Action: command(relayer.QUEUE_RESCORE),
+						Flags: append(append(queueFlags(), selectFlags()...),
+							&cli.Float64Flag{
+								Name:  "score",
+								Usage: "new score",
+							},
+							&cli.Int64Flag{
+								Name:  "delay",
+								Usage: "new score as seconds from now",
+							},
+						),
+					},
+					&cli.Command{
+						Name:   "export",
+						Usage:  "Export the queue entries as json lines",
+						Action: command(relayer.QUEUE_EXPORT),
+						Flags: append(queueFlags(),
+							&cli.StringFlag{
+								Name:  "file",
+								Usage: "export file path, stdout when unspecified",
+							},
+						),
+					},
+					&cli.Command{
+						Name:   "import",
+						Usage:  "Import the exported json lines to the queue",
+						Action: command(relayer.QUEUE_IMPORT),
+						Flags: append(queueFlags(),
+							&cli.StringFlag{
+								Name:     "file",
+								Usage:    "import file path",
+								Required: true,
+							},
+						),
+					},
+				},
+			},
 		},
 	}
 
@@ -531,6 +897,101 @@ func main() {
 	}
 }
 
+func dlqFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.Uint64Flag{
+			Name:     "chain",
+			Usage:    "queue chain id, dst chain for poly txs and src chain for src txs",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "type",
+			Usage: "queue tx type: poly or src",
+			Value: "poly",
+		},
+	}
+}
+
+func roleFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:     "role",
+			Usage:    "role name: HeaderSync, TxListen, TxCommit, PolyListen or PolyCommit",
+			Required: true,
+		},
+		&cli.Uint64Flag{
+			Name:     "chain",
+			Usage:    "chain id of the role",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "reason",
+			Usage: "reason of the change",
+		},
+		&cli.StringFlag{
+			Name:  "operator",
+			Usage: "operator name, current os user by default",
+		},
+	}
+}
+
+func agentSocketFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "socket",
+		Usage: "secret agent socket path, RELAYER_AGENT_SOCKET or " + config.AGENT_SOCKET + " in XDG_RUNTIME_DIR or the .agent directory next to the config file when unspecified",
+	}
+}
+
+func queueFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:     "queue",
+			Usage:    "queue name: tx, sorted, delayed, delayed_tx, patch, dlq or skip",
+			Required: true,
+		},
+		&cli.Uint64Flag{
+			Name:  "chain",
+			Usage: "queue chain id, dst chain for poly txs and src chain for src txs",
+		},
+		&cli.StringFlag{
+			Name:  "type",
+			Usage: "queue tx type: poly or src",
+			Value: "poly",
+		},
+	}
+}
+
+func pageFlags(limit int) []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{
+			Name:  "offset",
+			Usage: "index of the first entry",
+		},
+		&cli.IntFlag{
+			Name:  "limit",
+			Usage: "max count of the entries, all entries when zero",
+			Value: limit,
+		},
+	}
+}
+
+func selectFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{
+			Name:  "index",
+			Usage: "entry index in the queue",
+		},
+		&cli.StringFlag{
+			Name:  "hash",
+			Usage: "select the entries of the src, poly or dst hash",
+		},
+		&cli.BoolFlag{
+			Name:  "all",
+			Usage: "select all entries of the queue",
+		},
+	}
+}
+
 func start(c *cli.Context) error {
 	config, err := config.New(c.String("config"))
 	if err != nil {
@@ -551,18 +1012,35 @@ func start(c *cli.Context) error {
 	wg := &sync.WaitGroup{}
 	ctx, cancel := context.WithCancel(context.Background())
 	status := 0
-	err = relayer.Start(ctx, wg, config)
+	server, err := relayer.Start(ctx, wg, config)
 	if err == nil {
 		sc := make(chan os.Signal, 10)
 		signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGSTOP, syscall.SIGQUIT)
 		sig := <-sc
+		for sig == syscall.SIGHUP {
+			log.Info("Poly relayer is reloading config with received signal", "signal", sig.String())
+			err = server.Reload()
+			if err != nil {
+				log.Error("Failed to reload config, keep running with the current config", "err", err)
+			}
+			sig = <-sc
+		}
 		log.Info("Poly relayer is exiting with received signal", "signal", sig.String())
+		err = server.Stop()
+		if err != nil {
+			// Exit without waiting for the stuck roles
+			log.Error("Poly relayer is exiting without all roles stopped", "err", err)
+			os.Exit(2)
+		}
 	} else {
 		log.Error("Failed to start relayer service", "err", err)
 		status = 2
+		// Stop the roles started before the failure
+		server.Stop()
 	}
 	cancel()
 	wg.Wait()
+	bus.CloseStores()
 	os.Exit(status)
 	return nil
 }
@@ -575,7 +1053,8 @@ func command(method string) func(*cli.Context) error {
 			if c.String("url") != "" {
 				readConf = false
 			}
-		case relayer.ENCRYPT_FILE, relayer.DECRYPT_FILE, relayer.CREATE_ACCOUNT, relayer.UPDATE_ACCOUNT:
+		case relayer.ENCRYPT_FILE, relayer.DECRYPT_FILE, relayer.REENCRYPT_FILE, relayer.CREATE_ACCOUNT, relayer.UPDATE_ACCOUNT, relayer.CONFIG_CHECK,
+			relayer.CONFIG_SHOW, relayer.SECRET_AGENT, relayer.SECRET_UNLOCK, relayer.SECRET_LOCK:
 			readConf = false
 		}
 		if readConf {
@@ -619,6 +1098,7 @@ func Init(ctx *cli.Context) (err error) {
 	config.CONFIG_PATH = ctx.String("config")
 	config.ENCRYPTED = ctx.Bool("encrypted")
 	config.PLAIN = ctx.Bool("plain")
+	config.PASSPHRASE_SECRET = ctx.String("passphrase")
 
 	log.Init(&log.LogConfig{
 		Path:     ctx.String("log"),
@@ -0,0 +1,493 @@
+package msg
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/polynetwork/bridge-common/chains/bridge"
+)
+
+const (
+	ENCODING_BINARY = "bin"
+	ENCODING_LEGACY = "legacy" // Plain json tx of version 0 without envelope, readable by the instances before the envelope
+
+	COMPRESSION_NONE = ""
+	COMPRESSION_ZSTD = "zstd"
+)
+
+// Binary envelope starts with the magic, which never starts a json document
+const binaryMagic = "\xffTX"
+
+// Max size of the decompressed tx body, to reject corrupted or hostile bus entries
+const maxTxSize = 64 << 20
+
+// Shared zstd encoder and decoder, both are safe for concurrent use with EncodeAll and DecodeAll
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxTxSize))
+)
+
+// Codec encodes the txs on the bus, nil codec uses the json encoding.
+// The decoder accepts all the encodings, including the legacy plain json.
+type Codec struct {
+	Encoding    string
+	Compression string
+}
+
+func NewCodec(encoding, compression string) (c *Codec, err error) {
+	switch encoding {
+	case "", ENCODING_JSON:
+		encoding = ENCODING_JSON
+	case ENCODING_BINARY, ENCODING_LEGACY:
+	default:
+		return nil, fmt.Errorf("Unsupported tx encoding %s", encoding)
+	}
+	switch compression {
+	case COMPRESSION_NONE, "none":
+		compression = COMPRESSION_NONE
+	case COMPRESSION_ZSTD:
+		if encoding != ENCODING_BINARY {
+			return nil, fmt.Errorf("Compression %s is only supported by binary encoding", compression)
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported tx compression %s", compression)
+	}
+	return &Codec{Encoding: encoding, Compression: compression}, nil
+}
+
+func (c *Codec) encoding() string {
+	if c == nil || c.Encoding == ENCODING_JSON || c.Encoding == ENCODING_LEGACY || c.Encoding == "" {
+		return ENCODING_JSON
+	}
+	if c.Compression != COMPRESSION_NONE {
+		return c.Encoding + "+" + c.Compression
+	}
+	return c.Encoding
+}
+
+// Version of the txs written by the codec
+func (c *Codec) version() int {
+	if c != nil && c.Encoding == ENCODING_LEGACY {
+		return 0
+	}
+	return TX_VERSION
+}
+
+func (c *Codec) Encode(tx *Tx) string {
+	if len(tx.SrcProof) > 0 && len(tx.SrcProofHex) == 0 {
+		tx.SrcProofHex = hex.EncodeToString(tx.SrcProof)
+	}
+	enc := c.encoding()
+	if c.version() == 0 {
+		bytes, _ := json.Marshal(*tx)
+		return string(bytes)
+	}
+	if enc == ENCODING_JSON {
+		body, _ := json.Marshal(*tx)
+		bytes, _ := json.Marshal(&Envelope{Version: TX_VERSION, Encoding: ENCODING_JSON, Build: BUILD, Body: body})
+		return string(bytes)
+	}
+	data := encodeBinary(tx)
+	if c.Compression == COMPRESSION_ZSTD {
+		data = zstdEncoder.EncodeAll(data, nil)
+	}
+	w := &binWriter{buf: []byte(binaryMagic)}
+	w.buf = appendUvarint(w.buf, TX_VERSION)
+	w.raw([]byte(enc))
+	w.raw([]byte(BUILD))
+	return string(append(w.buf, data...))
+}
+
+// Upgrade re-encodes the tx with the version and the encoding of the codec, changed is false if it's already up
+// to date. The legacy codec converts the txs back to version 0 for the instances before the envelope.
+func (c *Codec) Upgrade(data string) (upgraded string, changed bool, err error) {
+	e, err := OpenEnvelope(data)
+	if err != nil {
+		return
+	}
+	if e.Version == c.version() && e.Encoding == c.encoding() {
+		return data, false, nil
+	}
+	tx := new(Tx)
+	err = tx.Decode(data)
+	if err != nil {
+		return
+	}
+	return c.Encode(tx), true, nil
+}
+
+func openBinaryEnvelope(data string) (e *Envelope, err error) {
+	r := &binReader{buf: []byte(data[len(binaryMagic):])}
+	version := r.uvarint()
+	enc := r.raw()
+	build := r.raw()
+	if r.err != nil {
+		return nil, fmt.Errorf("Decode binary tx envelope error %v", r.err)
+	}
+	e = &Envelope{Version: int(version), Encoding: string(enc), Build: string(build), Data: r.buf}
+	return
+}
+
+// Decode the body of binary envelope
+func (e *Envelope) decodeBinary(tx *Tx) (err error) {
+	data := e.Data
+	switch e.Encoding {
+	case ENCODING_BINARY:
+	case ENCODING_BINARY + "+" + COMPRESSION_ZSTD:
+		data, err = zstdDecoder.DecodeAll(data, nil)
+		if err != nil {
+			return fmt.Errorf("Decompress tx body error %v", err)
+		}
+	default:
+		return fmt.Errorf("Unsupported tx encoding %s", e.Encoding)
+	}
+	return decodeBinary(data, tx)
+}
+
+// Binary format: sequence of fields, each starts with uvarint key of field number << 3 | wire type.
+// Zero value fields are omitted as the json omitempty does, unknown fields are skipped on decode.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+const (
+	fieldTxType = iota + 1
+	fieldAttempts
+	fieldTxId
+	fieldSrcHash
+	fieldSrcHeight
+	fieldSrcChainId
+	fieldSrcProofBytes
+	fieldSrcProofHex
+	fieldSrcProofHeight
+	fieldSrcParamBytes
+	fieldSrcParam
+	fieldSrcProxy
+	fieldSrcAddress
+	fieldPolyHash
+	fieldPolyHeight
+	fieldPolyKey
+	fieldAnchorProofBytes
+	fieldAnchorProof
+	fieldDstAddress
+	fieldDstHash
+	fieldDstHeight
+	fieldDstChainId
+	fieldDstGasLimit
+	fieldDstGasPrice
+	fieldDstGasPriceX
+	fieldDstPolyEpochStartHeight
+	fieldDstProxy
+	fieldSkipCheckFee
+	fieldSkipped
+	fieldPaidGas
+	fieldCheckFeeStatus
+	fieldToAssetAddress
+	fieldLastError
+	fieldErrorClass
+	fieldFailure
+)
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(buf, b[:binary.PutUvarint(b[:], v)]...)
+}
+
+func appendVarint(buf []byte, v int64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(buf, b[:binary.PutVarint(b[:], v)]...)
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	return append(buf, b[:]...)
+}
+
+type binWriter struct {
+	buf []byte
+}
+
+func (w *binWriter) key(field, wire int) {
+	w.buf = appendUvarint(w.buf, uint64(field<<3|wire))
+}
+
+func (w *binWriter) raw(v []byte) {
+	w.buf = appendUvarint(w.buf, uint64(len(v)))
+	w.buf = append(w.buf, v...)
+}
+
+func (w *binWriter) uvarint(field int, v uint64) {
+	if v != 0 {
+		w.key(field, wireVarint)
+		w.buf = appendUvarint(w.buf, v)
+	}
+}
+
+func (w *binWriter) varint(field int, v int64) {
+	if v != 0 {
+		w.key(field, wireVarint)
+		w.buf = appendVarint(w.buf, v)
+	}
+}
+
+func (w *binWriter) bool(field int, v bool) {
+	if v {
+		w.uvarint(field, 1)
+	}
+}
+
+func (w *binWriter) float(field int, v float64) {
+	if v != 0 {
+		w.key(field, wireFixed64)
+		w.buf = appendUint64(w.buf, math.Float64bits(v))
+	}
+}
+
+func (w *binWriter) bytes(field int, v []byte) {
+	if len(v) > 0 {
+		w.key(field, wireBytes)
+		w.raw(v)
+	}
+}
+
+func (w *binWriter) string(field int, v string) {
+	w.bytes(field, []byte(v))
+}
+
+// Hex strings are kept as raw bytes if they can be restored exactly
+func (w *binWriter) hex(bytesField, stringField int, v string) {
+	if b, err := hex.DecodeString(v); err == nil && hex.EncodeToString(b) == v {
+		w.bytes(bytesField, b)
+	} else {
+		w.string(stringField, v)
+	}
+}
+
+type binReader struct {
+	buf []byte
+	err error
+}
+
+func (r *binReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.err = fmt.Errorf("invalid uvarint")
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *binReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.buf)
+	if n <= 0 {
+		r.err = fmt.Errorf("invalid varint")
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *binReader) fixed64() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.buf) < 8 {
+		r.err = fmt.Errorf("invalid fixed64")
+		return 0
+	}
+	v := binary.LittleEndian.Uint64(r.buf)
+	r.buf = r.buf[8:]
+	return v
+}
+
+func (r *binReader) raw() []byte {
+	size := r.uvarint()
+	if r.err != nil {
+		return nil
+	}
+	if uint64(len(r.buf)) < size {
+		r.err = fmt.Errorf("invalid bytes length %v", size)
+		return nil
+	}
+	v := r.buf[:size]
+	r.buf = r.buf[size:]
+	return v
+}
+
+func (r *binReader) skip(wire int) {
+	switch wire {
+	case wireVarint:
+		r.uvarint()
+	case wireFixed64:
+		r.fixed64()
+	case wireBytes:
+		r.raw()
+	default:
+		r.err = fmt.Errorf("invalid wire type %v", wire)
+	}
+}
+
+func encodeBinary(tx *Tx) []byte {
+	w := new(binWriter)
+	w.varint(fieldTxType, int64(tx.TxType))
+	w.varint(fieldAttempts, int64(tx.Attempts))
+	w.string(fieldTxId, tx.TxId)
+	w.string(fieldSrcHash, tx.SrcHash)
+	w.uvarint(fieldSrcHeight, tx.SrcHeight)
+	w.uvarint(fieldSrcChainId, tx.SrcChainId)
+	w.hex(fieldSrcProofBytes, fieldSrcProofHex, tx.SrcProofHex)
+	w.uvarint(fieldSrcProofHeight, tx.SrcProofHeight)
+	w.hex(fieldSrcParamBytes, fieldSrcParam, tx.SrcParam)
+	w.string(fieldSrcProxy, tx.SrcProxy)
+	w.string(fieldSrcAddress, tx.SrcAddress)
+	w.string(fieldPolyHash, tx.PolyHash)
+	w.uvarint(fieldPolyHeight, uint64(tx.PolyHeight))
+	w.string(fieldPolyKey, tx.PolyKey)
+	w.hex(fieldAnchorProofBytes, fieldAnchorProof, tx.AnchorProof)
+	w.string(fieldDstAddress, tx.DstAddress)
+	w.string(fieldDstHash, tx.DstHash)
+	w.uvarint(fieldDstHeight, tx.DstHeight)
+	w.uvarint(fieldDstChainId, tx.DstChainId)
+	w.uvarint(fieldDstGasLimit, tx.DstGasLimit)
+	w.string(fieldDstGasPrice, tx.DstGasPrice)
+	w.string(fieldDstGasPriceX, tx.DstGasPriceX)
+	w.uvarint(fieldDstPolyEpochStartHeight, uint64(tx.DstPolyEpochStartHeight))
+	w.string(fieldDstProxy, tx.DstProxy)
+	w.bool(fieldSkipCheckFee, tx.SkipCheckFee)
+	w.bool(fieldSkipped, tx.Skipped)
+	w.float(fieldPaidGas, tx.PaidGas)
+	w.varint(fieldCheckFeeStatus, int64(tx.CheckFeeStatus))
+	w.string(fieldToAssetAddress, tx.ToAssetAddress)
+	w.string(fieldLastError, tx.LastError)
+	w.string(fieldErrorClass, tx.ErrorClass)
+	for class, count := range tx.Failures {
+		entry := new(binWriter)
+		entry.raw([]byte(class))
+		entry.buf = appendVarint(entry.buf, int64(count))
+		w.key(fieldFailure, wireBytes)
+		w.raw(entry.buf)
+	}
+	return w.buf
+}
+
+func decodeBinary(data []byte, tx *Tx) error {
+	r := &binReader{buf: data}
+	for len(r.buf) > 0 && r.err == nil {
+		key := r.uvarint()
+		field, wire := int(key>>3), int(key&7)
+		expected := wireBytes
+		switch field {
+		case fieldTxType, fieldAttempts, fieldSrcHeight, fieldSrcChainId, fieldSrcProofHeight, fieldPolyHeight,
+			fieldDstHeight, fieldDstChainId, fieldDstGasLimit, fieldDstPolyEpochStartHeight, fieldSkipCheckFee,
+			fieldSkipped, fieldCheckFeeStatus:
+			expected = wireVarint
+		case fieldPaidGas:
+			expected = wireFixed64
+		}
+		if wire != expected {
+			r.skip(wire)
+			continue
+		}
+		switch field {
+		case fieldTxType:
+			tx.TxType = TxType(r.varint())
+		case fieldAttempts:
+			tx.Attempts = int(r.varint())
+		case fieldTxId:
+			tx.TxId = string(r.raw())
+		case fieldSrcHash:
+			tx.SrcHash = string(r.raw())
+		case fieldSrcHeight:
+			tx.SrcHeight = r.uvarint()
+		case fieldSrcChainId:
+			tx.SrcChainId = r.uvarint()
+		case fieldSrcProofBytes:
+			tx.SrcProofHex = hex.EncodeToString(r.raw())
+		case fieldSrcProofHex:
+			tx.SrcProofHex = string(r.raw())
+		case fieldSrcProofHeight:
+			tx.SrcProofHeight = r.uvarint()
+		case fieldSrcParamBytes:
+			tx.SrcParam = hex.EncodeToString(r.raw())
+		case fieldSrcParam:
+			tx.SrcParam = string(r.raw())
+		case fieldSrcProxy:
+			tx.SrcProxy = string(r.raw())
+		case fieldSrcAddress:
+			tx.SrcAddress = string(r.raw())
+		case fieldPolyHash:
+			tx.PolyHash = string(r.raw())
+		case fieldPolyHeight:
+			tx.PolyHeight = uint32(r.uvarint())
+		case fieldPolyKey:
+			tx.PolyKey = string(r.raw())
+		case fieldAnchorProofBytes:
+			tx.AnchorProof = hex.EncodeToString(r.raw())
+		case fieldAnchorProof:
+			tx.AnchorProof = string(r.raw())
+		case fieldDstAddress:
+			tx.DstAddress = string(r.raw())
+		case fieldDstHash:
+			tx.DstHash = string(r.raw())
+		case fieldDstHeight:
+			tx.DstHeight = r.uvarint()
+		case fieldDstChainId:
+			tx.DstChainId = r.uvarint()
+		case fieldDstGasLimit:
+			tx.DstGasLimit = r.uvarint()
+		case fieldDstGasPrice:
+			tx.DstGasPrice = string(r.raw())
+		case fieldDstGasPriceX:
+			tx.DstGasPriceX = string(r.raw())
+		case fieldDstPolyEpochStartHeight:
+			tx.DstPolyEpochStartHeight = uint32(r.uvarint())
+		case fieldDstProxy:
+			tx.DstProxy = string(r.raw())
+		case fieldSkipCheckFee:
+			tx.SkipCheckFee = r.uvarint() != 0
+		case fieldSkipped:
+			tx.Skipped = r.uvarint() != 0
+		case fieldPaidGas:
+			tx.PaidGas = math.Float64frombits(r.fixed64())
+		case fieldCheckFeeStatus:
+			tx.CheckFeeStatus = bridge.CheckFeeStatus(r.varint())
+		case fieldToAssetAddress:
+			tx.ToAssetAddress = string(r.raw())
+		case fieldLastError:
+			tx.LastError = string(r.raw())
+		case fieldErrorClass:
+			tx.ErrorClass = string(r.raw())
+		case fieldFailure:
+			entry := &binReader{buf: r.raw()}
+			class := string(entry.raw())
+			count := int(entry.varint())
+			if entry.err != nil {
+				return fmt.Errorf("Decode tx failure entry error %v", entry.err)
+			}
+			if tx.Failures == nil {
+				tx.Failures = map[string]int{}
+			}
+			tx.Failures[class] = count
+		default:
+			r.skip(wire)
+		}
+	}
+	if r.err != nil {
+		return fmt.Errorf("Decode binary tx error %v", r.err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package msg
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	pcom "github.com/polynetwork/poly/common"
+	"github.com/polynetwork/poly/native/service/cross_chain_manager/common"
+)
+
+// Fill every json visible field of the tx with a distinct non zero value
+func fullTx(t *testing.T) *Tx {
+	tx := new(Tx)
+	v := reflect.ValueOf(tx).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Tag.Get("json") == "-" {
+			continue
+		}
+		f := v.Field(i)
+		switch f.Kind() {
+		case reflect.String:
+			f.SetString(field.Name)
+		case reflect.Int, reflect.Int64:
+			f.SetInt(int64(-i - 1))
+		case reflect.Uint32, reflect.Uint64:
+			f.SetUint(uint64(i + 1))
+		case reflect.Float64:
+			f.SetFloat(float64(i) + 0.5)
+		case reflect.Bool:
+			f.SetBool(true)
+		case reflect.Map:
+			f.Set(reflect.ValueOf(map[string]int{"rpc": 2, "nonce": 1}))
+		default:
+			t.Fatalf("Unhandled tx field %s of kind %s", field.Name, f.Kind())
+		}
+	}
+	sink := pcom.NewZeroCopySink(nil)
+	(&common.MakeTxParam{TxHash: []byte{1}, FromContractAddress: []byte{2}, ToChainID: 2, Method: "unlock"}).Serialization(sink)
+	tx.SrcParam = hex.EncodeToString(sink.Bytes())
+	tx.SrcProofHex = "00ff" + strings.Repeat("ab", 100)
+	return tx
+}
+
+func TestBinaryCodec(t *testing.T) {
+	tx := fullTx(t)
+	expected, _ := json.Marshal(tx)
+	for _, compression := range []string{COMPRESSION_NONE, COMPRESSION_ZSTD} {
+		c, err := NewCodec(ENCODING_BINARY, compression)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := c.Encode(tx)
+		if len(data) >= len(tx.Encode()) {
+			t.Fatalf("Binary encoding %s should be smaller than json", c.encoding())
+		}
+		decoded := new(Tx)
+		err = decoded.Decode(data)
+		if err != nil {
+			t.Fatalf("Failed to decode binary tx %v", err)
+		}
+		if got, _ := json.Marshal(decoded); string(got) != string(expected) {
+			t.Fatalf("Binary encoding %s should keep all fields\nexpected %s\ngot      %s", c.encoding(), expected, got)
+		}
+
+		_, changed, err := c.Upgrade(data)
+		if err != nil || changed {
+			t.Fatalf("Tx in the codec encoding should not be upgraded, err %v", err)
+		}
+		upgraded, changed, err := c.Upgrade(`{"TxType":2,"PolyHash":"01"}`)
+		if err != nil || !changed || !strings.HasPrefix(upgraded, binaryMagic) {
+			t.Fatalf("Legacy json tx should be converted, err %v", err)
+		}
+		json, changed, err := UpgradeTx(data)
+		if err != nil || !changed || strings.HasPrefix(json, binaryMagic) {
+			t.Fatalf("Binary tx should be converted back to json, err %v", err)
+		}
+	}
+
+	if _, err := NewCodec(ENCODING_JSON, COMPRESSION_ZSTD); err == nil {
+		t.Fatalf("Compression should require binary encoding")
+	}
+}
+
+func TestLegacyCodec(t *testing.T) {
+	c, err := NewCodec(ENCODING_LEGACY, COMPRESSION_NONE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := fullTx(t)
+	data := c.Encode(tx)
+	expected, _ := json.Marshal(tx)
+	if data != string(expected) {
+		t.Fatalf("Legacy codec should write the plain json tx, got %s", data)
+	}
+	_, changed, err := c.Upgrade(data)
+	if err != nil || changed {
+		t.Fatalf("Plain json tx should be kept by the legacy codec, err %v", err)
+	}
+	legacy, changed, err := c.Upgrade(tx.Encode())
+	if err != nil || !changed || legacy != data {
+		t.Fatalf("Tx envelope should be converted back to the plain json tx, err %v", err)
+	}
+}
@@ -18,15 +18,40 @@
 package msg
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"encoding/binary"
 	"fmt"
-	"golang.org/x/term"
 	"io"
 	"syscall"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/term"
 )
 
+const (
+	ENCRYPT_MAGIC   = "PRENC"
+	ENCRYPT_VERSION = 1
+
+	// Argon2id parameters of the new files
+	KDF_TIME    = 3
+	KDF_MEMORY  = 64 * 1024 // KiB
+	KDF_THREADS = 4
+
+	KDF_MAX_TIME   = 16
+	KDF_MAX_MEMORY = 1024 * 1024 // KiB, to reject bad headers asking for a huge allocation
+	SALT_SIZE      = 16
+	KEY_SIZE       = 32
+
+	// Header: magic | version | time(4) | memory(4) | threads(1) | salt, followed by the nonce and the
+	// cipher text. The header and the nonce are authenticated as the additional data.
+	headerSize = len(ENCRYPT_MAGIC) + 1 + 4 + 4 + 1 + SALT_SIZE
+)
+
+var ErrDecrypt = fmt.Errorf("Failed to decrypt, wrong passphrase or corrupted data")
+
 func ReadInput(name string) ([]byte, error) {
 	var input string
 	_, err := fmt.Scanln(&input)
@@ -97,3 +122,94 @@ func Encrypt(data, key []byte) []byte {
 
 	return cipherText
 }
+
+// Encrypted checks whether the data is in the versioned encryption format, otherwise it is taken as the
+// legacy format of Encrypt.
+func Encrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(ENCRYPT_MAGIC))
+}
+
+// Seal encrypts the data with AES-GCM using the key derived from the passphrase with Argon2id. The
+// header carrying the format version, the key derivation parameters and the salt is authenticated with the nonce.
+func Seal(data, passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("Empty passphrase")
+	}
+	header := make([]byte, headerSize)
+	n := copy(header, ENCRYPT_MAGIC)
+	header[n] = ENCRYPT_VERSION
+	binary.BigEndian.PutUint32(header[n+1:], KDF_TIME)
+	binary.BigEndian.PutUint32(header[n+5:], KDF_MEMORY)
+	header[n+9] = KDF_THREADS
+	salt := header[n+10:]
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := newGCM(passphrase, salt, KDF_TIME, KDF_MEMORY, KDF_THREADS)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	out := append(header, nonce...)
+	return aead.Seal(out, nonce, data, out), nil
+}
+
+// Open decrypts the data sealed with Seal, wrong passphrases and tampered data are rejected.
+func Open(cipherText, passphrase []byte) ([]byte, error) {
+	if !Encrypted(cipherText) || len(cipherText) < headerSize {
+		return nil, fmt.Errorf("Unknown encryption format")
+	}
+	n := len(ENCRYPT_MAGIC)
+	if version := cipherText[n]; version != ENCRYPT_VERSION {
+		return nil, fmt.Errorf("Unsupported encryption format version %d", version)
+	}
+	time := binary.BigEndian.Uint32(cipherText[n+1:])
+	memory := binary.BigEndian.Uint32(cipherText[n+5:])
+	threads := cipherText[n+9]
+	if time == 0 || time > KDF_MAX_TIME || memory == 0 || memory > KDF_MAX_MEMORY || threads == 0 {
+		return nil, fmt.Errorf("Invalid key derivation parameters time %d memory %d threads %d", time, memory, threads)
+	}
+	salt := cipherText[n+10 : headerSize]
+
+	aead, err := newGCM(passphrase, salt, time, memory, threads)
+	if err != nil {
+		return nil, err
+	}
+	if len(cipherText) < headerSize+aead.NonceSize()+aead.Overhead() {
+		return nil, fmt.Errorf("Text is too short")
+	}
+	header := cipherText[:headerSize+aead.NonceSize()]
+	nonce := header[headerSize:]
+	data, err := aead.Open(nil, nonce, cipherText[len(header):], header)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return data, nil
+}
+
+func newGCM(passphrase, salt []byte, time, memory uint32, threads uint8) (cipher.AEAD, error) {
+	key := argon2.IDKey(passphrase, salt, time, memory, threads, KEY_SIZE)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// DecryptData decrypts the data in either the versioned format or the legacy format. The legacy format
+// has no integrity check, a wrong passphrase produces garbage instead of an error.
+func DecryptData(cipherText, passphrase []byte) (data []byte, err error) {
+	if Encrypted(cipherText) {
+		return Open(cipherText, passphrase)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Failed to decrypt legacy format %v", r)
+		}
+	}()
+	return Decrypt(append([]byte{}, cipherText...), passphrase), nil
+}
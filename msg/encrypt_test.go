@@ -0,0 +1,54 @@
+package msg
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	data := []byte(`{"Env":"mainnet"}`)
+	pass := []byte("a passphrase of any length")
+	cipherText, err := Seal(data, pass)
+	if err != nil {
+		t.Fatalf("Failed to seal %v", err)
+	}
+	if !Encrypted(cipherText) || bytes.Contains(cipherText, data) {
+		t.Fatalf("Unexpected sealed data %x", cipherText)
+	}
+	plain, err := DecryptData(cipherText, pass)
+	if err != nil || !bytes.Equal(plain, data) {
+		t.Fatalf("Failed to open %v %s", err, plain)
+	}
+
+	_, err = Open(cipherText, []byte("wrong passphrase"))
+	if err != ErrDecrypt {
+		t.Fatalf("Expected wrong passphrase to be rejected, got %v", err)
+	}
+	tampered := append([]byte{}, cipherText...)
+	tampered[len(ENCRYPT_MAGIC)+2] ^= 1
+	_, err = Open(tampered, pass)
+	if err == nil {
+		t.Fatalf("Expected tampered header to be rejected")
+	}
+	_, err = Open(cipherText[:headerSize+4], pass)
+	if err == nil {
+		t.Fatalf("Expected truncated data to be rejected")
+	}
+}
+
+func TestDecryptLegacy(t *testing.T) {
+	data := []byte(`{"Env":"mainnet"}`)
+	pass := []byte("0123456789abcdef")
+	cipherText := Encrypt(data, pass)
+	if Encrypted(cipherText) {
+		t.Fatalf("Legacy data detected as the versioned format")
+	}
+	plain, err := DecryptData(cipherText, pass)
+	if err != nil || !bytes.Equal(plain, data) {
+		t.Fatalf("Failed to decrypt legacy data %v %s", err, plain)
+	}
+	_, err = DecryptData(cipherText, []byte("short"))
+	if err == nil {
+		t.Fatalf("Expected invalid legacy key length to fail")
+	}
+}
@@ -0,0 +1,132 @@
+package msg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// Current version of the encoded tx, bump it with a registered migration when the tx fields change
+	TX_VERSION = 1
+
+	ENCODING_JSON = "json"
+)
+
+// Build of the running relayer, set with -ldflags "-X github.com/polynetwork/poly-relayer/msg.BUILD=..."
+var BUILD = "dev"
+
+var ERR_TX_VERSION = fmt.Errorf("Unsupported encoded tx version")
+
+// Envelope wraps the encoded tx with the schema version, version 0 is the legacy plain json tx without envelope
+type Envelope struct {
+	Version  int             `json:"v"`
+	Encoding string          `json:"enc"`
+	Build    string          `json:"build,omitempty"`
+	Body     json.RawMessage `json:"body"`
+	Data     []byte          `json:"-"` // Body of the binary envelope
+}
+
+// Migration upgrades the json tx body of a version to the next version
+type Migration func(body map[string]interface{}) error
+
+var (
+	migrations   = map[int]Migration{}
+	migrationsMu sync.RWMutex
+)
+
+// RegisterMigration registers the migration from the version to the next version
+func RegisterMigration(from int, m Migration) {
+	migrationsMu.Lock()
+	defer migrationsMu.Unlock()
+	if _, ok := migrations[from]; ok {
+		panic(fmt.Sprintf("Duplicate tx migration from version %v", from))
+	}
+	migrations[from] = m
+}
+
+// Migrations returns the versions with registered migrations
+func Migrations() (versions []int) {
+	migrationsMu.RLock()
+	defer migrationsMu.RUnlock()
+	for v := range migrations {
+		versions = append(versions, v)
+	}
+	sort.Ints(versions)
+	return
+}
+
+func init() {
+	// Version 1 introduced the envelope, the tx body is unchanged
+	RegisterMigration(0, func(body map[string]interface{}) error { return nil })
+}
+
+// Open the envelope, the legacy plain json tx is wrapped as version 0
+func OpenEnvelope(data string) (e *Envelope, err error) {
+	if strings.HasPrefix(data, binaryMagic) {
+		return openBinaryEnvelope(data)
+	}
+	e = new(Envelope)
+	err = json.Unmarshal([]byte(data), e)
+	if err != nil {
+		return nil, fmt.Errorf("Decode tx envelope error %v", err)
+	}
+	if e.Body == nil {
+		return &Envelope{Encoding: ENCODING_JSON, Body: json.RawMessage(data)}, nil
+	}
+	return
+}
+
+// Upgrade the envelope body to the current version with the registered migrations. The migrations work on
+// the json body, so the binary body is converted to json first, and the upgraded envelope is in json.
+func (e *Envelope) Upgrade() (err error) {
+	if e.Version > TX_VERSION {
+		return fmt.Errorf("%w %v, current version %v, build %s", ERR_TX_VERSION, e.Version, TX_VERSION, e.Build)
+	}
+	if e.Version == TX_VERSION {
+		return
+	}
+	body := e.Body
+	if e.Encoding != ENCODING_JSON {
+		// Binary fields keep their numbers across versions, so the body decodes into the current tx fields
+		tx := new(Tx)
+		err = e.decodeBinary(tx)
+		if err != nil {
+			return fmt.Errorf("Decode tx body of version %v error %v", e.Version, err)
+		}
+		body, err = json.Marshal(*tx)
+		if err != nil {
+			return
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	fields := map[string]interface{}{}
+	err = dec.Decode(&fields)
+	if err != nil {
+		return fmt.Errorf("Decode tx body of version %v error %v", e.Version, err)
+	}
+	migrationsMu.RLock()
+	defer migrationsMu.RUnlock()
+	for ; e.Version < TX_VERSION; e.Version++ {
+		m, ok := migrations[e.Version]
+		if !ok {
+			return fmt.Errorf("Missing tx migration from version %v", e.Version)
+		}
+		err = m(fields)
+		if err != nil {
+			return fmt.Errorf("Migrate tx from version %v error %v", e.Version, err)
+		}
+	}
+	e.Body, err = json.Marshal(fields)
+	e.Encoding, e.Data = ENCODING_JSON, nil
+	return
+}
+
+// UpgradeTx re-encodes the tx with the current version in json, changed is false if it's already up to date
+func UpgradeTx(data string) (upgraded string, changed bool, err error) {
+	return (*Codec)(nil).Upgrade(data)
+}
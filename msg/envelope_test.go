@@ -0,0 +1,67 @@
+package msg
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTxEnvelope(t *testing.T) {
+	tx := new(Tx)
+	err := tx.Decode(`{"TxType":2,"Attempts":3,"PolyHash":"01","DstChainId":2}`)
+	if err != nil || tx.PolyHash != "01" || tx.Attempts != 3 || tx.DstChainId != 2 {
+		t.Fatalf("Legacy tx should be decoded, tx %+v err %v", tx, err)
+	}
+
+	data := tx.Encode()
+	e, err := OpenEnvelope(data)
+	if err != nil || e.Version != TX_VERSION || e.Encoding != ENCODING_JSON || e.Build != BUILD {
+		t.Fatalf("Encoded tx should be wrapped in envelope, envelope %+v err %v", e, err)
+	}
+	decoded := new(Tx)
+	err = decoded.Decode(data)
+	if err != nil || decoded.PolyHash != "01" || decoded.Attempts != 3 {
+		t.Fatalf("Encoded tx should be decoded, tx %+v err %v", decoded, err)
+	}
+
+	err = new(Tx).Decode(`{"v":100,"enc":"json","body":{}}`)
+	if !errors.Is(err, ERR_TX_VERSION) {
+		t.Fatalf("Newer tx version should be rejected, err %v", err)
+	}
+
+	upgraded, changed, err := UpgradeTx(`{"TxType":2,"PolyHash":"01"}`)
+	if err != nil || !changed {
+		t.Fatalf("Legacy tx should be upgraded, err %v", err)
+	}
+	_, changed, _ = UpgradeTx(upgraded)
+	if changed {
+		t.Fatalf("Upgraded tx should not be changed again")
+	}
+}
+
+func TestBinaryEnvelopeUpgrade(t *testing.T) {
+	tx := &Tx{TxType: POLY, PolyHash: "01", DstChainId: 2, Attempts: 3}
+	for _, compression := range []string{COMPRESSION_NONE, COMPRESSION_ZSTD} {
+		c, _ := NewCodec(ENCODING_BINARY, compression)
+		// Binary envelope of the previous version
+		e, _ := OpenEnvelope(c.Encode(tx))
+		w := &binWriter{buf: []byte(binaryMagic)}
+		w.buf = appendUvarint(w.buf, TX_VERSION-1)
+		w.raw([]byte(e.Encoding))
+		w.raw([]byte(e.Build))
+		data := string(append(w.buf, e.Data...))
+
+		decoded := new(Tx)
+		err := decoded.Decode(data)
+		if err != nil || decoded.PolyHash != "01" || decoded.DstChainId != 2 || decoded.Attempts != 3 {
+			t.Fatalf("Binary tx of the previous version should be decoded, tx %+v err %v", decoded, err)
+		}
+		upgraded, changed, err := c.Upgrade(data)
+		if err != nil || !changed {
+			t.Fatalf("Binary tx of the previous version should be upgraded, err %v", err)
+		}
+		e, err = OpenEnvelope(upgraded)
+		if err != nil || e.Version != TX_VERSION || e.Encoding != c.encoding() {
+			t.Fatalf("Unexpected upgraded envelope %+v err %v", e, err)
+		}
+	}
+}
@@ -17,7 +17,10 @@
 
 package msg
 
-import "errors"
+import (
+	"errors"
+	"strings"
+)
 
 var (
 	ERR_INVALID_TX            = errors.New("Invalid TX")
@@ -39,4 +42,50 @@ var (
 	ERR_COIN_STORE_NOT_PUBLISHED = errors.New("Account hasn't registered CoinStore for CoinType")
 	ERR_TREASURY_NOT_EXIST       = errors.New("Asset not exist in lock proxy")
 	ERR_SEQUENCE_NUMBER_INVALID  = errors.New("Sequence number is invalid")
+	ERR_NONCE_INVALID            = errors.New("Nonce is invalid")
+)
+
+// Error classes of failed txs
+const (
+	ERR_CLASS_INVALID = "invalid"
+	ERR_CLASS_EXEC    = "exec"
+	ERR_CLASS_FEE     = "fee"
+	ERR_CLASS_BALANCE = "balance"
+	ERR_CLASS_PROOF   = "proof"
+	ERR_CLASS_HEADER  = "header"
+	ERR_CLASS_ASSET   = "asset"
+	ERR_CLASS_NONCE   = "nonce"
+	ERR_CLASS_UNKNOWN = "unknown"
 )
+
+var errorClasses = []struct {
+	class string
+	errs  []error
+}{
+	{ERR_CLASS_INVALID, []error{ERR_INVALID_TX, ERR_TX_BYPASS}},
+	{ERR_CLASS_EXEC, []error{ERR_TX_EXEC_FAILURE, ERR_TX_EXEC_ALWAYS_FAIL}},
+	{ERR_CLASS_FEE, []error{ERR_FEE_CHECK_FAILURE, ERR_PAID_FEE_TOO_LOW}},
+	{ERR_CLASS_BALANCE, []error{ERR_LOW_BALANCE}},
+	{ERR_CLASS_PROOF, []error{ERR_PROOF_UNAVAILABLE, ERR_Tx_VERIFYMERKLEPROOF, ERR_TX_PROOF_MISSING}},
+	{ERR_CLASS_HEADER, []error{ERR_HEADER_INCONSISTENT, ERR_HEADER_MISSING, ERR_HEADER_SUBMIT_FAILURE}},
+	{ERR_CLASS_ASSET, []error{ERR_COIN_STORE_NOT_PUBLISHED, ERR_TREASURY_NOT_EXIST}},
+	{ERR_CLASS_NONCE, []error{ERR_SEQUENCE_NUMBER_INVALID, ERR_NONCE_INVALID}},
+}
+
+// ErrorClass maps the error to its class name
+func ErrorClass(err error) string {
+	if err == nil {
+		return ""
+	}
+	for _, c := range errorClasses {
+		for _, e := range c.errs {
+			if errors.Is(err, e) {
+				return c.class
+			}
+		}
+	}
+	if strings.Contains(err.Error(), "nonce") {
+		return ERR_CLASS_NONCE
+	}
+	return ERR_CLASS_UNKNOWN
+}
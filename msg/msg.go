@@ -101,6 +101,10 @@ type Tx struct {
 	// aptos
 	ToAssetAddress string `json:",omitempty"`
 
+	LastError  string         `json:",omitempty"`
+	ErrorClass string         `json:",omitempty"`
+	Failures   map[string]int `json:",omitempty"` // Failure count per error class
+
 	Extra interface{} `json:"-"`
 }
 
@@ -108,16 +112,60 @@ func (tx *Tx) Type() TxType {
 	return tx.TxType
 }
 
-func (tx *Tx) Encode() string {
-	if len(tx.SrcProof) > 0 && len(tx.SrcProofHex) == 0 {
-		tx.SrcProofHex = hex.EncodeToString(tx.SrcProof)
+// IdempotencyKey identifies the cross chain tx across re-pushes: src chain and tx id for src txs, poly hash for poly txs.
+// It's empty when the tx is not identifiable yet.
+func (tx *Tx) IdempotencyKey() string {
+	switch tx.TxType {
+	case SRC:
+		id := tx.TxId
+		if id == "" {
+			id = tx.SrcHash
+		}
+		if id == "" {
+			return ""
+		}
+		return fmt.Sprintf("%d:%s", tx.SrcChainId, strings.ToLower(strings.TrimPrefix(id, "0x")))
+	case POLY:
+		if tx.PolyHash == "" {
+			return ""
+		}
+		return fmt.Sprintf("poly:%s", strings.ToLower(strings.TrimPrefix(tx.PolyHash, "0x")))
+	}
+	return ""
+}
+
+// Fail records the failure of the last attempt
+func (tx *Tx) Fail(err error) {
+	tx.Attempts++
+	if err == nil {
+		return
+	}
+	tx.LastError = err.Error()
+	tx.ErrorClass = ErrorClass(err)
+	if tx.Failures == nil {
+		tx.Failures = map[string]int{}
 	}
-	bytes, _ := json.Marshal(*tx)
-	return string(bytes)
+	tx.Failures[tx.ErrorClass]++
+}
+
+func (tx *Tx) Encode() string {
+	return (*Codec)(nil).Encode(tx)
 }
 
 func (tx *Tx) Decode(data string) (err error) {
-	err = json.Unmarshal([]byte(data), tx)
+	e, err := OpenEnvelope(data)
+	if err != nil {
+		return
+	}
+	err = e.Upgrade()
+	if err != nil {
+		return
+	}
+	if e.Encoding == ENCODING_JSON {
+		err = json.Unmarshal(e.Body, tx)
+	} else {
+		err = e.decodeBinary(tx)
+	}
 	if err == nil {
 		if len(tx.SrcParam) > 0 && tx.Param == nil {
 			event, err := hex.DecodeString(tx.SrcParam)
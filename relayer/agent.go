@@ -0,0 +1,230 @@
+/*
+ * Copyright (C) 2021 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package relayer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/polynetwork/bridge-common/log"
+	"github.com/urfave/cli/v2"
+
+	"github.com/polynetwork/poly-relayer/config"
+	"github.com/polynetwork/poly-relayer/msg"
+)
+
+// SecretAgent serves the secrets of the encrypted secrets file on the unix socket. It starts locked and
+// serves the secrets once unlocked with the file passphrase, so unattended relayers can read the wallet
+// passwords without the passphrase at hand.
+type SecretAgent struct {
+	file    string
+	mu      sync.RWMutex
+	secrets map[string]string // Nil when locked
+}
+
+func NewSecretAgent(file string) *SecretAgent {
+	return &SecretAgent{file: file}
+}
+
+// Unlock decrypts the secrets file, which holds a json object of the secret names and values
+func (a *SecretAgent) Unlock(passphrase []byte) (err error) {
+	data, err := ioutil.ReadFile(a.file)
+	if err != nil {
+		return
+	}
+	data, err = msg.DecryptData(data, passphrase)
+	if err != nil {
+		return
+	}
+	secrets := map[string]string{}
+	err = json.Unmarshal(data, &secrets)
+	if err != nil {
+		return fmt.Errorf("Failed to parse secrets file, wrong passphrase? %v", err)
+	}
+	a.mu.Lock()
+	a.secrets = secrets
+	a.mu.Unlock()
+	return
+}
+
+func (a *SecretAgent) Lock() {
+	a.mu.Lock()
+	a.secrets = nil
+	a.mu.Unlock()
+}
+
+func (a *SecretAgent) Secret(name string) (value string, err error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.secrets == nil {
+		return "", fmt.Errorf("agent is locked")
+	}
+	value, ok := a.secrets[name]
+	if !ok {
+		// Keyed secrets are looked up with the lower cased keys
+		if i := strings.LastIndex(name, "/"); i >= 0 {
+			value, ok = a.secrets[name[:i]+"/"+strings.ToLower(name[i+1:])]
+		}
+	}
+	if !ok {
+		return "", fmt.Errorf("secret %s not found", name)
+	}
+	return
+}
+
+func (a *SecretAgent) Handler() http.Handler {
+	mux := http.NewServeMux()
+	reply := func(w http.ResponseWriter, status int, value string, err error) {
+		res := new(config.SecretResponse)
+		res.Data.Value = value
+		if err != nil {
+			res.Errors = []string{err.Error()}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(res)
+	}
+	mux.HandleFunc("/v1/secret", func(w http.ResponseWriter, r *http.Request) {
+		value, err := a.Secret(r.URL.Query().Get("name"))
+		if err != nil {
+			reply(w, http.StatusNotFound, "", err)
+			return
+		}
+		reply(w, http.StatusOK, value, nil)
+	})
+	mux.HandleFunc("/v1/unlock", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			reply(w, http.StatusMethodNotAllowed, "", fmt.Errorf("POST is required"))
+			return
+		}
+		passphrase, err := ioutil.ReadAll(r.Body)
+		if err == nil {
+			err = a.Unlock(passphrase)
+		}
+		if err != nil {
+			log.Error("Failed to unlock secret agent", "err", err)
+			reply(w, http.StatusBadRequest, "", err)
+			return
+		}
+		log.Info("Secret agent unlocked")
+		reply(w, http.StatusOK, "", nil)
+	})
+	mux.HandleFunc("/v1/lock", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			reply(w, http.StatusMethodNotAllowed, "", fmt.Errorf("POST is required"))
+			return
+		}
+		a.Lock()
+		log.Info("Secret agent locked")
+		reply(w, http.StatusOK, "", nil)
+	})
+	return mux
+}
+
+func agentSocket(ctx *cli.Context) string {
+	socket := ctx.String("socket")
+	if socket == "" {
+		socket = os.Getenv(config.ENV_AGENT_SOCKET)
+	}
+	if socket == "" {
+		socket = config.DefaultAgentSocket()
+	}
+	return socket
+}
+
+// RunSecretAgent serves the secret agent on the unix socket until interrupted
+func RunSecretAgent(ctx *cli.Context) (err error) {
+	socket := agentSocket(ctx)
+	agent := NewSecretAgent(ctx.String("file"))
+	listener, err := config.ListenSocket(socket)
+	if err != nil {
+		return
+	}
+	server := &http.Server{Handler: agent.Handler()}
+	go func() {
+		sc := make(chan os.Signal, 1)
+		signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+		sig := <-sc
+		log.Info("Secret agent is exiting with received signal", "signal", sig.String())
+		server.Close()
+	}()
+	log.Info("Secret agent is listening, unlock it with the secret unlock command", "socket", socket)
+	err = server.Serve(peerListener{listener})
+	if err == http.ErrServerClosed {
+		err = nil
+	}
+	os.Remove(socket)
+	return
+}
+
+// Listener dropping the connections from the processes of the other users
+type peerListener struct {
+	net.Listener
+}
+
+func (l peerListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		err = config.CheckPeer(conn)
+		if err == nil {
+			return conn, nil
+		}
+		log.Warn("Secret agent rejected connection", "err", err)
+		conn.Close()
+	}
+}
+
+func agentRequest(ctx *cli.Context, path string, body []byte) (err error) {
+	resp, err := config.AgentClient(agentSocket(ctx)).Post("http://agent"+path, "application/octet-stream", bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	res := new(config.SecretResponse)
+	json.NewDecoder(resp.Body).Decode(res)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Agent request failed with status %d %s", resp.StatusCode, strings.Join(res.Errors, ", "))
+	}
+	return
+}
+
+// UnlockSecretAgent unlocks the running secret agent with the passphrase of the secrets file
+func UnlockSecretAgent(ctx *cli.Context) (err error) {
+	pass, err := msg.ReadPassword("passphrase")
+	if err != nil {
+		return
+	}
+	return agentRequest(ctx, "/v1/unlock", pass)
+}
+
+// LockSecretAgent drops the secrets held by the running secret agent
+func LockSecretAgent(ctx *cli.Context) (err error) {
+	return agentRequest(ctx, "/v1/lock", nil)
+}
@@ -0,0 +1,77 @@
+package relayer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/polynetwork/poly-relayer/config"
+	"github.com/polynetwork/poly-relayer/msg"
+)
+
+func TestSecretAgent(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "secrets")
+	pass := []byte("passphrase")
+	data, err := msg.Seal([]byte(`{"relayer":"wallet-pass","relayer/0xab":"key-pass"}`), pass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(file, data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	socket := filepath.Join(dir, "run", config.AGENT_SOCKET)
+	listener, err := config.ListenSocket(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(socket)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("Agent socket should be private to the owner %v", err)
+	}
+	server := &http.Server{Handler: NewSecretAgent(file).Handler()}
+	go server.Serve(peerListener{listener})
+	defer server.Close()
+
+	client := config.AgentClient(socket)
+	post := func(path string, body []byte) int {
+		resp, err := client.Post("http://agent"+path, "application/octet-stream", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("Agent request failed %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	p := config.NewAgentSecretProvider(socket, "relayer")
+
+	_, err = p.Secret("")
+	if err == nil {
+		t.Fatalf("Expected locked agent to refuse the secret")
+	}
+	if post("/v1/unlock", []byte("wrong")) == http.StatusOK {
+		t.Fatalf("Expected wrong passphrase to be rejected")
+	}
+	if post("/v1/unlock", pass) != http.StatusOK {
+		t.Fatalf("Failed to unlock agent")
+	}
+	value, err := p.Secret("")
+	if err != nil || value != "wallet-pass" {
+		t.Fatalf("Unexpected wallet secret %s err %v", value, err)
+	}
+	value, err = p.Secret("0xAB")
+	if err != nil || value != "key-pass" {
+		t.Fatalf("Unexpected keyed secret %s err %v", value, err)
+	}
+	if post("/v1/lock", nil) != http.StatusOK {
+		t.Fatalf("Failed to lock agent")
+	}
+	_, err = p.Secret("")
+	if err == nil {
+		t.Fatalf("Expected locked agent to refuse the secret")
+	}
+}
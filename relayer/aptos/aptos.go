@@ -80,13 +80,15 @@ func (s *Submitter) Start(ctx context.Context, wg *sync.WaitGroup, bus bus.TxBus
 	s.Context = ctx
 	s.wg = wg
 	log.Info("Starting submitter worker", "index", 0, "total", 1, "account", s.wallet.Address, "chain", s.name)
+	s.wg.Add(1)
 	go s.run(s.wallet, bus, delay, composer)
 	return nil
 }
 
 func (s *Submitter) run(wallet *wallet.AptosWallet, mq bus.TxBus, delay bus.DelayedTxBus, compose msg.PolyComposer) error {
-	s.wg.Add(1)
 	defer s.wg.Done()
+	defer bus.Guard(s.Context, "submitter")
+	mq = bus.ForConsumer(mq, wallet.Address)
 	for {
 		select {
 		case <-s.Done():
@@ -103,43 +105,51 @@ func (s *Submitter) run(wallet *wallet.AptosWallet, mq bus.TxBus, delay bus.Dela
 			time.Sleep(time.Second)
 			continue
 		}
-		log.Info("Processing poly tx", "poly_hash", tx.PolyHash, "account", wallet.Address)
-		err = s.ProcessTx(tx, compose)
-		if err == nil {
-			err = s.SubmitTx(tx)
-		}
+		s.process(wallet, tx, mq, delay, compose)
+		err = mq.Ack(context.Background(), tx)
 		if err != nil {
-			log.Error("Process poly tx error", "chain", s.name, "err", err)
-			log.Json(log.ERROR, tx)
-			if errors.Is(err, msg.ERR_INVALID_TX) || errors.Is(err, msg.ERR_TX_BYPASS) {
-				log.Error("Skipped poly tx for error", "poly_hash", tx.PolyHash, "err", err)
-				continue
-			}
-			tx.Attempts++
-			if errors.Is(err, msg.ERR_SEQUENCE_NUMBER_INVALID) {
-				tsp := time.Now().Unix() + 60
-				bus.SafeCall(s.Context, tx, "push to delay queue", func() error { return delay.Delay(context.Background(), tx, tsp) })
-			} else if errors.Is(err, msg.ERR_LOW_BALANCE) {
-				tsp := time.Now().Unix() + 60*10
-				bus.SafeCall(s.Context, tx, "push to delay queue", func() error { return delay.Delay(context.Background(), tx, tsp) })
-			} else if errors.Is(err, msg.ERR_COIN_STORE_NOT_PUBLISHED) {
-				tsp := time.Now().Unix() + 60*10
-				bus.SafeCall(s.Context, tx, "push to delay queue", func() error { return delay.Delay(context.Background(), tx, tsp) })
-			} else if errors.Is(err, msg.ERR_TREASURY_NOT_EXIST) {
-				tsp := time.Now().Unix() + 60*10
-				bus.SafeCall(s.Context, tx, "push to delay queue", func() error { return delay.Delay(context.Background(), tx, tsp) })
-			} else {
-				tsp := time.Now().Unix() + 60*3
-				bus.SafeCall(s.Context, tx, "push to delay queue", func() error { return delay.Delay(context.Background(), tx, tsp) })
-			}
-		} else {
-			log.Info("Submitted poly tx", "poly_hash", tx.PolyHash, "chain", s.name, "dst_hash", tx.DstHash)
+			log.Error("Failed to ack poly tx", "chain", s.name, "poly_hash", tx.PolyHash, "err", err)
+		}
+	}
+}
 
-			// Retry to verify a successful submit
+func (s *Submitter) process(wallet *wallet.AptosWallet, tx *msg.Tx, mq bus.TxBus, delay bus.DelayedTxBus, compose msg.PolyComposer) {
+	log.Info("Processing poly tx", "poly_hash", tx.PolyHash, "account", wallet.Address)
+	err := s.ProcessTx(tx, compose)
+	if err == nil {
+		err = s.SubmitTx(tx)
+	}
+	if err != nil {
+		log.Error("Process poly tx error", "chain", s.name, "err", err)
+		log.Json(log.ERROR, tx)
+		if errors.Is(err, msg.ERR_INVALID_TX) || errors.Is(err, msg.ERR_TX_BYPASS) {
+			log.Error("Skipped poly tx for error", "poly_hash", tx.PolyHash, "err", err)
+			return
+		}
+		tx.Fail(err)
+		if errors.Is(err, msg.ERR_SEQUENCE_NUMBER_INVALID) {
+			tsp := time.Now().Unix() + 60
+			bus.SafeCall(s.Context, tx, "push to delay queue", func() error { return delay.Delay(context.Background(), tx, tsp) })
+		} else if errors.Is(err, msg.ERR_LOW_BALANCE) {
+			tsp := time.Now().Unix() + 60*10
+			bus.SafeCall(s.Context, tx, "push to delay queue", func() error { return delay.Delay(context.Background(), tx, tsp) })
+		} else if errors.Is(err, msg.ERR_COIN_STORE_NOT_PUBLISHED) {
+			tsp := time.Now().Unix() + 60*10
+			bus.SafeCall(s.Context, tx, "push to delay queue", func() error { return delay.Delay(context.Background(), tx, tsp) })
+		} else if errors.Is(err, msg.ERR_TREASURY_NOT_EXIST) {
+			tsp := time.Now().Unix() + 60*10
+			bus.SafeCall(s.Context, tx, "push to delay queue", func() error { return delay.Delay(context.Background(), tx, tsp) })
+		} else {
 			tsp := time.Now().Unix() + 60*3
-			if tx.DstHash != "" {
-				bus.SafeCall(s.Context, tx, "push to delay queue", func() error { return delay.Delay(context.Background(), tx, tsp) })
-			}
+			bus.SafeCall(s.Context, tx, "push to delay queue", func() error { return delay.Delay(context.Background(), tx, tsp) })
+		}
+	} else {
+		log.Info("Submitted poly tx", "poly_hash", tx.PolyHash, "chain", s.name, "dst_hash", tx.DstHash)
+
+		// Retry to verify a successful submit
+		tsp := time.Now().Unix() + 60*3
+		if tx.DstHash != "" {
+			bus.SafeCall(s.Context, tx, "push to delay queue", func() error { return delay.Delay(context.Background(), tx, tsp) })
 		}
 	}
 }
@@ -0,0 +1,338 @@
+/*
+ * Copyright (C) 2021 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package relayer
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/polynetwork/bridge-common/base"
+	"github.com/polynetwork/bridge-common/wallet"
+	"github.com/polynetwork/poly-relayer/bus"
+	"github.com/polynetwork/poly-relayer/config"
+	"github.com/polynetwork/poly-relayer/relayer/eth"
+)
+
+// ConfigProblem is a mistake found in the config or roles file
+type ConfigProblem struct {
+	Path    string // Json path of the setting, prefixed with "roles" for the roles file
+	Message string
+}
+
+type configCheck struct {
+	conf     *config.Config
+	probe    bool
+	probed   map[string]bool
+	problems []*ConfigProblem
+}
+
+// Report the problem, problems of the shared settings are reported once
+func (c *configCheck) report(path, format string, args ...interface{}) {
+	problem := &ConfigProblem{Path: path, Message: fmt.Sprintf(format, args...)}
+	for _, p := range c.problems {
+		if *p == *problem {
+			return
+		}
+	}
+	c.problems = append(c.problems, problem)
+}
+
+// CheckConfig validates the config together with the roles, and probes the bus and the nodes if asked.
+// The roles are applied to the config and the config is prepared during the check, but not used as the global
+// config. The wallet secrets are only fetched when probing.
+func CheckConfig(conf *config.Config, roles config.Roles, probe bool) []*ConfigProblem {
+	c := &configCheck{conf: conf, probe: probe, probed: map[string]bool{}}
+	chains := make([]uint64, 0, len(roles))
+	for id := range roles {
+		chains = append(chains, id)
+		if id != base.POLY && conf.Chains[id] == nil {
+			c.report(fmt.Sprintf("roles.%d", id), "chain %d is not configured in the config file", id)
+		}
+	}
+	sort.Slice(chains, func(i, j int) bool { return chains[i] < chains[j] })
+
+	if conf.Bus == nil {
+		c.report("Bus", "bus config is required")
+	}
+	if conf.Poly == nil {
+		c.report("Poly", "poly chain config is required")
+		return c.problems
+	}
+	checkBus := func(probe bool) {
+		if conf.Bus != nil {
+			bus.CheckConfig(conf.Bus, probe, func(path, msg string) { c.report("Bus."+path, msg) })
+		}
+	}
+	conf.ApplyRoles(roles)
+	if err := c.prepare(); err != nil {
+		c.report("$", "%v", err)
+		// Locate the bus settings rejected by the preparation
+		checkBus(false)
+		return c.problems
+	}
+	if probe {
+		if err := conf.LoadSecrets(); err != nil {
+			c.report("$", "%v", err)
+		}
+	}
+
+	checkBus(probe)
+	for _, id := range chains {
+		c.checkChain(id, roles[id])
+	}
+	return c.problems
+}
+
+// Prepare the config with panics on missing settings recovered as errors
+func (c *configCheck) prepare() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Failed to initialize config %v", r)
+		}
+	}()
+	return c.conf.Prepare()
+}
+
+func (c *configCheck) checkChain(id uint64, role config.Role) {
+	path := fmt.Sprintf("Chains.%d", id)
+	rolePath := fmt.Sprintf("roles.%d", id)
+	enabled := map[string]bool{
+		config.ROLE_HEADER_SYNC: role.HeaderSync,
+		config.ROLE_TX_LISTEN:   role.TxListen,
+		config.ROLE_TX_COMMIT:   role.TxCommit,
+		config.ROLE_POLY_LISTEN: role.PolyListen,
+		config.ROLE_POLY_COMMIT: role.PolyCommit,
+	}
+	names := []string{config.ROLE_HEADER_SYNC, config.ROLE_TX_LISTEN, config.ROLE_TX_COMMIT, config.ROLE_POLY_LISTEN, config.ROLE_POLY_COMMIT}
+
+	if id == base.POLY {
+		for _, name := range names {
+			if enabled[name] && name != config.ROLE_POLY_LISTEN {
+				c.report(rolePath+"."+name, "role %s is not available on poly chain", name)
+			}
+		}
+		if role.PolyListen {
+			c.checkNodes("Poly.Nodes", c.conf.Poly.PolyTxSync.Nodes)
+		}
+		return
+	}
+
+	if role.PolyListen {
+		c.report(rolePath+"."+config.ROLE_POLY_LISTEN, "role %s is only available on poly chain", config.ROLE_POLY_LISTEN)
+	}
+	switch id {
+	case base.OK, base.MATIC, base.HEIMDALL:
+		for _, name := range names {
+			if enabled[name] {
+				c.report(rolePath+"."+name, "role %s is not supported on chain %s and will be ignored", name, base.GetChainName(id))
+			}
+		}
+		return
+	}
+
+	chain := c.conf.Chains[id]
+	for _, name := range []string{config.ROLE_HEADER_SYNC, config.ROLE_TX_LISTEN, config.ROLE_TX_COMMIT} {
+		if enabled[name] && GetListener(id) == nil {
+			c.report(rolePath+"."+name, "no listener implementation for chain %s", base.GetChainName(id))
+		}
+	}
+	if role.HeaderSync {
+		c.checkListener(path, chain.HeaderSync.ListenerConfig, false)
+		c.checkPolySubmitter(path+".HeaderSync.Poly", chain.HeaderSync.Poly)
+	}
+	if role.TxListen {
+		c.checkListener(path, chain.SrcTxSync.ListenerConfig, true)
+	}
+	if role.TxCommit {
+		c.checkListener(path, chain.SrcTxCommit.ListenerConfig, false)
+		c.checkPolySubmitter(path+".SrcTxCommit.Poly", chain.SrcTxCommit.Poly)
+		c.checkFilter(settingPath(path, ".SrcTxCommit.Filter", ".SrcFilter", chain.SrcTxCommit.Filter == chain.SrcFilter), chain.SrcTxCommit.Filter)
+	}
+	if role.PolyCommit {
+		c.checkSubmitter(path, rolePath, chain, chain.PolyTxCommit)
+	}
+}
+
+func (c *configCheck) checkListener(path string, conf *config.ListenerConfig, contract bool) {
+	c.checkNodes(path+".Nodes", conf.Nodes)
+	if contract && conf.CCMContract == "" {
+		c.report(path+".CCMContract", "CCM contract is required to listen the cross chain txs")
+	}
+}
+
+func (c *configCheck) checkPolySubmitter(path string, conf *config.PolySubmitterConfig) {
+	c.checkNodes("Poly.Nodes", conf.Nodes)
+	if conf.Wallet == c.conf.Poly.Wallet {
+		path = "Poly"
+	}
+	if conf.Wallet == nil {
+		c.report(path+".Wallet", "poly wallet is required to submit to poly chain")
+	} else {
+		c.checkFile(path+".Wallet.Path", conf.Wallet.Path)
+	}
+}
+
+func (c *configCheck) checkSubmitter(path, rolePath string, chain *config.ChainConfig, conf *config.PolyTxCommitConfig) {
+	submitter := GetSubmitter(chain.ChainId)
+	if submitter == nil {
+		c.report(rolePath+"."+config.ROLE_POLY_COMMIT, "no submitter implementation for chain %s", base.GetChainName(chain.ChainId))
+		return
+	}
+	c.checkNodes(path+".Nodes", conf.Nodes)
+	if conf.CCMContract == "" {
+		c.report(path+".CCMContract", "CCM contract is required to submit the poly txs")
+	}
+	if _, ok := submitter.(*eth.Submitter); ok && conf.CCDContract == "" {
+		c.report(path+".CCDContract", "CCD contract is required to submit the poly txs")
+	}
+	if conf.Signer != nil {
+		c.checkSigner(settingPath(path, ".PolyTxCommit.Signer", ".Signer", conf.Signer == chain.Signer), conf.Signer, submitter)
+	}
+	if conf.Signer == nil || conf.Wallet != nil {
+		c.checkWallet(settingPath(path, ".PolyTxCommit.Wallet", ".Wallet", conf.Wallet == chain.Wallet), conf.Wallet, submitter)
+	}
+	c.checkPolySubmitter(path+".PolyTxCommit.Poly", conf.Poly)
+	c.checkFilter(settingPath(path, ".PolyTxCommit.Filter", ".DstFilter", conf.Filter == chain.DstFilter), conf.Filter)
+	if conf.CheckFee && len(c.conf.Bridge) == 0 {
+		c.report(path+".CheckFee", "fee check is enabled without any bridge url in Bridge")
+	}
+	if len(c.conf.ValidMethods) == 0 {
+		c.report("ValidMethods", "no valid methods, all the poly txs to %s will be rejected", base.GetChainName(chain.ChainId))
+	}
+}
+
+// Path of the role setting, or the chain setting when inherited
+func settingPath(path, role, chain string, inherited bool) string {
+	if inherited {
+		return path + chain
+	}
+	return path + role
+}
+
+func (c *configCheck) checkWallet(path string, conf *wallet.Config, submitter IChainSubmitter) {
+	if conf == nil {
+		c.report(path, "wallet is required to submit the poly txs")
+		return
+	}
+	if _, ok := submitter.(*eth.Submitter); ok {
+		if len(conf.KeyStoreProviders) == 0 && len(conf.KeyProviders) == 0 {
+			c.report(path+".KeyStoreProviders", "no key store provider for the wallet")
+		}
+		for i, p := range conf.KeyStoreProviders {
+			c.checkFile(fmt.Sprintf("%s.KeyStoreProviders.%d.Path", path, i), p.Path)
+		}
+		return
+	}
+	if conf.Path != "" {
+		c.checkFile(path+".Path", conf.Path)
+	}
+}
+
+func (c *configCheck) checkSigner(path string, conf *config.SignerConfig, submitter IChainSubmitter) {
+	if _, ok := submitter.(*eth.Submitter); !ok {
+		c.report(path, "remote signer is only supported by eth submitters")
+		return
+	}
+	err := eth.ValidateSigner(conf)
+	if err != nil {
+		c.report(path, "%v", err)
+	}
+	if conf.Insecure {
+		c.report(path+".Insecure", "remote signer is insecure, the signing requests are not authenticated")
+	}
+	if conf.TLS != nil {
+		if _, err := conf.TLS.Load(); err != nil {
+			c.report(path+".TLS", "%v", err)
+		}
+		if conf.TLS.InsecureSkipVerify {
+			c.report(path+".TLS.InsecureSkipVerify", "remote signer server certificate is not verified")
+		}
+	}
+	if c.probe && err == nil && !c.probed[conf.Url] {
+		c.probed[conf.Url] = true
+		if _, err := eth.NewRemoteSigner(conf); err != nil {
+			c.report(path, "%v", err)
+		}
+	}
+}
+
+func (c *configCheck) checkFilter(path string, conf *config.FilterConfig) {
+	if conf == nil {
+		return
+	}
+	if conf.SrcProxyFilter && len(conf.SrcProxies) == 0 {
+		c.report(path+".SrcProxies", "src proxy filter is enabled without any proxy, all txs will be filtered out")
+	}
+	if conf.DstProxyFilter && len(conf.DstProxies) == 0 {
+		c.report(path+".DstProxies", "dst proxy filter is enabled without any proxy, all txs will be filtered out")
+	}
+}
+
+func (c *configCheck) checkFile(path, file string) {
+	if file == "" {
+		c.report(path, "file path is required")
+	} else if _, err := os.Stat(file); err != nil {
+		c.report(path, "%v", err)
+	}
+}
+
+// Check the node list, and dial the nodes if probing
+func (c *configCheck) checkNodes(path string, nodes []string) {
+	if len(nodes) == 0 {
+		c.report(path, "no nodes configured")
+		return
+	}
+	if !c.probe {
+		return
+	}
+	for _, node := range nodes {
+		if c.probed[node] {
+			continue
+		}
+		c.probed[node] = true
+		err := dial(node)
+		if err != nil {
+			c.report(path, "node %s is not reachable: %v", node, err)
+		}
+	}
+}
+
+func dial(node string) (err error) {
+	u, err := url.Parse(node)
+	if err != nil {
+		return
+	}
+	host := u.Host
+	if u.Port() == "" {
+		switch u.Scheme {
+		case "https", "wss":
+			host = net.JoinHostPort(u.Hostname(), "443")
+		default:
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+	conn, err := net.DialTimeout("tcp", host, 5*time.Second)
+	if err == nil {
+		conn.Close()
+	}
+	return
+}
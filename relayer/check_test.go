@@ -0,0 +1,66 @@
+package relayer
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/polynetwork/bridge-common/base"
+	"github.com/polynetwork/poly-relayer/config"
+)
+
+func TestCheckConfig(t *testing.T) {
+	const poly = `"Poly": {"Nodes": ["http://127.0.0.1:1"], "PolyTxSync": {"Nodes": ["http://127.0.0.1:1"]}}`
+	const secret = `"Poly": {"Nodes": ["http://127.0.0.1:1"], "Wallet": {"Path": "wallet.dat"},
+		"WalletSecret": {"Provider": "env", "Name": "RELAYER_TEST_MISSING"}}`
+	const bus = `"Bus": {"Backend": "memory"}`
+	const chain = `"Chains": {"2": {"Nodes": ["http://127.0.0.1:1"]}}`
+	cases := []struct {
+		name    string
+		config  string
+		roles   config.Roles
+		probe   bool
+		problem string
+	}{
+		{"valid", bus + `, ` + poly, config.Roles{base.POLY: {PolyListen: true}}, false, ""},
+		{"no bus", poly, config.Roles{base.POLY: {PolyListen: true}}, false, "Bus"},
+		{"redis addrs", `"Bus": {"Backend": "redis", "Config": {"Addrs": ["127.0.0.1:6379", "127.0.0.1:6380"]}}, ` + poly,
+			config.Roles{base.POLY: {PolyListen: true}}, false, "Bus.Config.Addrs"},
+		{"no poly", bus, config.Roles{}, false, "Poly"},
+		{"missing chain", bus + `, ` + poly, config.Roles{2: {TxListen: true}}, false, "roles.2"},
+		{"poly role", bus + `, ` + poly, config.Roles{base.POLY: {PolyCommit: true}}, false, "roles.0.PolyCommit"},
+		{"no contract", bus + `, ` + poly + `, ` + chain, config.Roles{2: {TxListen: true}}, false, "Chains.2.CCMContract"},
+		{"secret not fetched", bus + `, ` + secret, config.Roles{}, false, ""},
+		{"secret fetched", bus + `, ` + secret, config.Roles{}, true, "$"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.json")
+			data := `{"Env": "` + base.ENV + `", ` + tc.config + `}`
+			err := ioutil.WriteFile(path, []byte(data), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			conf, err := config.New(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := config.Current()
+			problems := CheckConfig(conf, tc.roles, tc.probe)
+			if config.Current() != before {
+				t.Fatalf("Config check should not change the global config")
+			}
+			found := false
+			for _, p := range problems {
+				if p.Path == tc.problem {
+					found = true
+				} else if tc.problem == "" {
+					t.Fatalf("Unexpected config problem %s: %s", p.Path, p.Message)
+				}
+			}
+			if tc.problem != "" && !found {
+				t.Fatalf("Expected config problem of %s, got %v", tc.problem, problems)
+			}
+		})
+	}
+}
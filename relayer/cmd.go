@@ -27,11 +27,12 @@ import (
 	"net/url"
 	"os"
 	"os/exec"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/go-redis/redis/v8"
 	"github.com/urfave/cli/v2"
 
 	"github.com/ethereum/go-ethereum/accounts/keystore"
@@ -58,10 +59,13 @@ const (
 	PATCH             = "patch"
 	SKIP              = "skip"
 	CHECK_SKIP        = "checkskip"
+	UNSKIP            = "unskip"
+	LIST_SKIP         = "listskip"
 	CREATE_ACCOUNT    = "createaccount"
 	UPDATE_ACCOUNT    = "updateaccount"
 	ENCRYPT_FILE      = "encryptfile"
 	DECRYPT_FILE      = "decryptfile"
+	REENCRYPT_FILE    = "reencrypt"
 	CHECK_WALLET      = "wallet"
 	ADD_SIDECHAIN     = "addsidechain"
 	SYNC_GENESIS      = "syncgenesis"
@@ -76,6 +80,30 @@ const (
 	VALIDATE          = "validate"
 	VALIDATE_BLOCK    = "validateblock"
 	SET_VALIDATOR_HEIGHT = "setvalidatorblock"
+	DLQ_LIST          = "dlqlist"
+	DLQ_SHOW          = "dlqshow"
+	DLQ_REQUEUE       = "dlqrequeue"
+	DLQ_PURGE         = "dlqpurge"
+	BUS_MIGRATE       = "busmigrate"
+	QUEUE_LIST        = "queuelist"
+	QUEUE_PEEK        = "queuepeek"
+	QUEUE_SEARCH      = "queuesearch"
+	QUEUE_REMOVE      = "queueremove"
+	QUEUE_MOVE        = "queuemove"
+	QUEUE_RESCORE     = "queuerescore"
+	QUEUE_EXPORT      = "queueexport"
+	QUEUE_IMPORT      = "queueimport"
+	ROLE_LIST         = "rolelist"
+	ROLE_PAUSE        = "rolepause"
+	ROLE_RESUME       = "roleresume"
+	ROLE_START        = "rolestart"
+	ROLE_STOP         = "rolestop"
+	RELOAD            = "reload"
+	CONFIG_CHECK      = "configcheck"
+	CONFIG_SHOW       = "configshow"
+	SECRET_AGENT      = "secretagent"
+	SECRET_UNLOCK     = "secretunlock"
+	SECRET_LOCK       = "secretlock"
 )
 
 var _Handlers = map[string]func(*cli.Context) error{}
@@ -88,12 +116,15 @@ func init() {
 	_Handlers[PATCH] = Patch
 	_Handlers[SKIP] = Skip
 	_Handlers[CHECK_SKIP] = CheckSkip
+	_Handlers[UNSKIP] = Unskip
+	_Handlers[LIST_SKIP] = ListSkip
 	_Handlers[RELAY_TX] = RelayTx
 	_Handlers[CHECK_WALLET] = CheckWallet
 	_Handlers[CREATE_ACCOUNT] = CreateAccount
 	_Handlers[UPDATE_ACCOUNT] = UpdateAccount
 	_Handlers[ENCRYPT_FILE] = EncryptFile
 	_Handlers[DECRYPT_FILE] = DecryptFile
+	_Handlers[REENCRYPT_FILE] = ReEncryptFile
 	_Handlers[ADD_SIDECHAIN] = AddSideChain
 	_Handlers[SYNC_GENESIS] = SyncGenesis
 	_Handlers[CREATE_GENESIS] = CreateGenesis
@@ -107,6 +138,30 @@ func init() {
 	_Handlers[VALIDATE] = Validate
 	_Handlers[VALIDATE_BLOCK] = ValidateBlock
 	_Handlers[SET_VALIDATOR_HEIGHT] = SetTxValidatorHeight
+	_Handlers[DLQ_LIST] = DeadLetterList
+	_Handlers[DLQ_SHOW] = DeadLetterShow
+	_Handlers[DLQ_REQUEUE] = DeadLetterRequeue
+	_Handlers[DLQ_PURGE] = DeadLetterPurge
+	_Handlers[BUS_MIGRATE] = BusMigrate
+	_Handlers[QUEUE_LIST] = QueueList
+	_Handlers[QUEUE_PEEK] = QueuePeek
+	_Handlers[QUEUE_SEARCH] = QueueSearch
+	_Handlers[QUEUE_REMOVE] = QueueRemove
+	_Handlers[QUEUE_MOVE] = QueueMove
+	_Handlers[QUEUE_RESCORE] = QueueRescore
+	_Handlers[QUEUE_EXPORT] = QueueExport
+	_Handlers[QUEUE_IMPORT] = QueueImport
+	_Handlers[ROLE_LIST] = RoleList
+	_Handlers[ROLE_PAUSE] = RoleControl(ROLE_ACTION_PAUSE)
+	_Handlers[ROLE_RESUME] = RoleControl(ROLE_ACTION_RESUME)
+	_Handlers[ROLE_START] = RoleControl(ROLE_ACTION_START)
+	_Handlers[ROLE_STOP] = RoleControl(ROLE_ACTION_STOP)
+	_Handlers[RELOAD] = Reload
+	_Handlers[CONFIG_CHECK] = ConfigCheck
+	_Handlers[CONFIG_SHOW] = ConfigShow
+	_Handlers[SECRET_AGENT] = RunSecretAgent
+	_Handlers[SECRET_UNLOCK] = UnlockSecretAgent
+	_Handlers[SECRET_LOCK] = LockSecretAgent
 }
 
 func CheckWallet(ctx *cli.Context) (err error) {
@@ -277,56 +332,101 @@ func relayTx(chain, height uint64, hash, sender string, free bool, price, pricex
 }
 
 type StatusHandler struct {
-	redis *redis.Client
-	poly  *poly.SDK
-	store *bus.RedisChainStore
+	conf   *config.BusConfig
+	poly   *poly.SDK
+	mu     sync.Mutex
+	stores map[bus.ChainHeightKey]bus.ChainStore
 }
 
-func NewStatusHandler(opt *redis.Options) *StatusHandler {
-	client := bus.New(opt)
-	sdk, err := poly.WithOptions(base.POLY, config.CONFIG.Poly.Nodes, time.Minute, 1)
+func NewStatusHandler(conf *config.BusConfig) *StatusHandler {
+	sdk, err := poly.WithOptions(base.POLY, config.Current().Poly.Nodes, time.Minute, 1)
 	if err != nil {
 		log.Error("Failed to initialize poly sdk")
 		panic(err)
 	}
 
-	return &StatusHandler{redis: client, poly: sdk, store: bus.NewRedisChainStore(
-		bus.ChainHeightKey{}, client, 0,
-	)}
+	return &StatusHandler{conf: conf, poly: sdk, stores: map[bus.ChainHeightKey]bus.ChainStore{}}
 }
 
-func (h *StatusHandler) Skip(hash string) (err error) {
-	return bus.NewRedisSkipCheck(h.redis).Skip(context.Background(), &msg.Tx{PolyHash: hash})
+func (h *StatusHandler) store(chain uint64, key bus.ChainHeightType) bus.ChainStore {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	k := bus.ChainHeightKey{ChainId: chain, Type: key}
+	s, ok := h.stores[k]
+	if !ok {
+		s = bus.NewChainStore(h.conf, k, 0)
+		h.stores[k] = s
+	}
+	return s
+}
+
+func (h *StatusHandler) Skip(entry *bus.SkipEntry) (err error) {
+	return bus.NewSkipCheck(h.conf).Skip(context.Background(), entry)
 }
 
-func (h *StatusHandler) CheckSkip(hash string) (skip bool, err error) {
-	return bus.NewRedisSkipCheck(h.redis).CheckSkip(context.Background(), &msg.Tx{PolyHash: hash})
+func (h *StatusHandler) Unskip(entry *bus.SkipEntry) (bool, error) {
+	return bus.NewSkipCheck(h.conf).Unskip(context.Background(), entry)
+}
+
+func (h *StatusHandler) CheckSkip(hash string, chain uint64) (skip bool, err error) {
+	return bus.NewSkipCheck(h.conf).CheckSkip(context.Background(), &msg.Tx{PolyHash: hash, DstChainId: chain})
 }
 
 func (h *StatusHandler) Height(chain uint64, key bus.ChainHeightType) (uint64, error) {
-	h.store.Key = bus.ChainHeightKey{ChainId: chain, Type: key}
-	return h.store.GetHeight(context.Background())
+	return h.store(chain, key).GetHeight(context.Background())
 }
 
 func (h *StatusHandler) SetHeight(chain uint64, key bus.ChainHeightType, height uint64) (err error) {
-	h.store.Key = bus.ChainHeightKey{ChainId: chain, Type: key}
-	return h.store.UpdateHeight(context.Background(), height)
+	return h.store(chain, key).UpdateHeight(context.Background(), height)
 }
 
 func (h *StatusHandler) Len(chain uint64, ty msg.TxType) (uint64, error) {
-	return bus.NewRedisTxBus(h.redis, chain, ty).Len(context.Background())
+	return bus.NewTxBus(h.conf, chain, ty).Len(context.Background())
+}
+
+// Pending returns the delivered but not acked tx count per consumer, nil if not tracked by the bus
+func (h *StatusHandler) Pending(chain uint64, ty msg.TxType) (map[string]int64, error) {
+	b, ok := bus.NewTxBus(h.conf, chain, ty).(bus.PendingTxBus)
+	if !ok {
+		return nil, nil
+	}
+	return b.Pending(context.Background())
 }
 
-func (h *StatusHandler) LenDelayed() (uint64, error) {
-	return bus.NewRedisDelayedTxBus(h.redis).Len(context.Background())
+func (h *StatusHandler) LenDelayed(chain uint64, ty msg.TxType) (uint64, error) {
+	return bus.NewDelayedTxBus(h.conf, chain, ty).Len(context.Background())
+}
+
+func (h *StatusHandler) LenLegacyDelayed() (uint64, error) {
+	return bus.NewLegacyDelayedTxBus(h.conf).Len(context.Background())
 }
 
 func (h *StatusHandler) LenSorted(chain uint64, ty msg.TxType) (uint64, error) {
-	return bus.NewRedisSortedTxBus(h.redis, chain, ty).Len(context.Background())
+	return bus.NewSortedTxBus(h.conf, chain, ty).Len(context.Background())
+}
+
+func (h *StatusHandler) LenDeadLetter(chain uint64, ty msg.TxType) (uint64, error) {
+	return bus.NewDeadLetterBus(h.conf, chain, ty).Len(context.Background())
+}
+
+// Candidates returns the live instances of the singleton role and the latest fencing token
+func (h *StatusHandler) Candidates(role string) ([]*bus.Candidate, uint64, error) {
+	leader := bus.NewLeader(h.conf, role)
+	_, token, err := leader.Leader(context.Background())
+	if err != nil {
+		return nil, 0, err
+	}
+	candidates, err := leader.Candidates(context.Background())
+	return candidates, token, err
+}
+
+// Roles returns the role status reported by the running relayer instances
+func (h *StatusHandler) Roles() ([]*bus.RoleStatus, error) {
+	return bus.NewRoleStatusStore(h.conf).ListRoles(context.Background())
 }
 
 func Status(ctx *cli.Context) (err error) {
-	h := NewStatusHandler(config.CONFIG.Bus.Redis)
+	h := NewStatusHandler(config.Current().Bus)
 	targetChain := ctx.Uint64("chain")
 	for _, chain := range base.CHAINS {
 		if targetChain != 0 && targetChain != chain {
@@ -366,50 +466,247 @@ func Status(ctx *cli.Context) (err error) {
 		qPoly, _ := h.Len(chain, msg.POLY)
 		fmt.Printf("  src tx queue size : %v\n", qSrc)
 		fmt.Printf("  poly tx queue size: %v\n", qPoly)
+		pending, _ := h.Pending(chain, msg.POLY)
+		consumers := make([]string, 0, len(pending))
+		for consumer := range pending {
+			consumers = append(consumers, consumer)
+		}
+		sort.Strings(consumers)
+		for _, consumer := range consumers {
+			fmt.Printf("  poly tx pending of %s: %v\n", consumer, pending[consumer])
+		}
+		qDelayed, _ := h.LenDelayed(chain, msg.POLY)
+		fmt.Printf("  delayed tx queue size: %v\n", qDelayed)
+		dSrc, _ := h.LenDeadLetter(chain, msg.SRC)
+		dPoly, _ := h.LenDeadLetter(chain, msg.POLY)
+		fmt.Printf("  src tx dead letter size : %v\n", dSrc)
+		fmt.Printf("  poly tx dead letter size: %v\n", dPoly)
 	}
-	qDelayed, _ := h.LenDelayed()
+	qDelayed, _ := h.LenLegacyDelayed()
 	fmt.Printf("Status shared:\n")
-	fmt.Printf("  delayed tx queue size: %v\n", qDelayed)
+	fmt.Printf("  legacy delayed tx queue size: %v\n", qDelayed)
+	candidates, token, _ := h.Candidates(bus.ROLE_POLY_SYNC)
+	fmt.Printf("  poly tx listener token: %v\n", token)
+	for _, c := range candidates {
+		state := "standby"
+		if c.Leading {
+			state = "leader"
+		}
+		fmt.Printf("  poly tx listener %s: %s height %v lag %v\n", c.Owner, state, c.Height, c.Lag())
+	}
+	roles, _ := h.Roles()
+	for _, r := range roles {
+		fmt.Printf("  role %s of %s on %s: %s restarts %v failures %v %s\n",
+			r.Role, base.GetChainName(r.Chain), r.Instance, r.State, r.Restarts, r.Failures, r.LastError)
+	}
 	return nil
 }
 
 func SetHeaderSyncHeight(ctx *cli.Context) (err error) {
 	height := uint64(ctx.Int("height"))
 	chain := uint64(ctx.Int("chain"))
-	return NewStatusHandler(config.CONFIG.Bus.Redis).SetHeight(chain, bus.KEY_HEIGHT_HEADER_RESET, height)
+	return NewStatusHandler(config.Current().Bus).SetHeight(chain, bus.KEY_HEIGHT_HEADER_RESET, height)
 }
 
 func SetTxSyncHeight(ctx *cli.Context) (err error) {
 	height := uint64(ctx.Int("height"))
 	chain := uint64(ctx.Int("chain"))
-	return NewStatusHandler(config.CONFIG.Bus.Redis).SetHeight(chain, bus.KEY_HEIGHT_TX, height)
+	return NewStatusHandler(config.Current().Bus).SetHeight(chain, bus.KEY_HEIGHT_TX, height)
 }
 
 func SetTxValidatorHeight(ctx *cli.Context) (err error) {
 	height := uint64(ctx.Int("height"))
 	chain := uint64(ctx.Int("chain"))
-	return NewStatusHandler(config.CONFIG.Bus.Redis).SetHeight(chain, bus.KEY_HEIGHT_VALIDATOR, height)
+	return NewStatusHandler(config.Current().Bus).SetHeight(chain, bus.KEY_HEIGHT_VALIDATOR, height)
+}
+
+// Operator of the admin commands, current os user by default
+func operator(ctx *cli.Context) string {
+	if name := ctx.String("operator"); name != "" {
+		return name
+	}
+	return os.Getenv("USER")
 }
 
 func Skip(ctx *cli.Context) (err error) {
+	entry := &bus.SkipEntry{
+		Hash:     ctx.String("hash"),
+		Operator: operator(ctx),
+		Reason:   ctx.String("reason"),
+		DstChain: ctx.Uint64("chain"),
+	}
+	if ttl := ctx.Int64("ttl"); ttl > 0 {
+		entry.Expiry = time.Now().Unix() + ttl
+	}
+	return NewStatusHandler(config.Current().Bus).Skip(entry)
+}
+
+func Unskip(ctx *cli.Context) (err error) {
 	hash := ctx.String("hash")
-	return NewStatusHandler(config.CONFIG.Bus.Redis).Skip(hash)
+	ok, err := NewStatusHandler(config.Current().Bus).Unskip(&bus.SkipEntry{
+		Hash: hash, Operator: operator(ctx), Reason: ctx.String("reason"),
+	})
+	if err == nil && !ok {
+		err = fmt.Errorf("Hash %s was not marked to skip", hash)
+	}
+	return
+}
+
+func ListSkip(ctx *cli.Context) (err error) {
+	skip := bus.NewSkipCheck(config.Current().Bus)
+	if ctx.Bool("audit") {
+		audits, err := skip.SkipAudit(context.Background(), ctx.Int("limit"))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Skip audit trail, size %v:\n", len(audits))
+		for _, a := range audits {
+			fmt.Printf("  %s %s %s operator: %s reason: %s\n", time.Unix(a.Time, 0).Format(time.RFC3339), a.Action, a.Entry.Hash, a.Entry.Operator, a.Entry.Reason)
+		}
+		return nil
+	}
+	entries, err := skip.ListSkip(context.Background())
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	fmt.Printf("Skipped txs, size %v:\n", len(entries))
+	for _, e := range entries {
+		line := fmt.Sprintf("  %s operator: %s reason: %s", e.Hash, e.Operator, e.Reason)
+		if e.Created > 0 {
+			line += fmt.Sprintf(" created: %s", time.Unix(e.Created, 0).Format(time.RFC3339))
+		}
+		if e.DstChain > 0 {
+			line += fmt.Sprintf(" dst_chain: %s", base.GetChainName(e.DstChain))
+		}
+		if e.Expired(now) {
+			line += " expired"
+		} else if e.Expiry > 0 {
+			line += fmt.Sprintf(" expiry: %s", time.Unix(e.Expiry, 0).Format(time.RFC3339))
+		}
+		fmt.Println(line)
+	}
+	return
+}
+
+func RoleList(ctx *cli.Context) (err error) {
+	store := bus.NewRoleStatusStore(config.Current().Bus)
+	chain := ctx.Uint64("chain")
+	controls, err := store.RoleControls(context.Background())
+	if err != nil {
+		return
+	}
+	roles, err := store.ListRoles(context.Background())
+	if err != nil {
+		return
+	}
+	fmt.Printf("Role controls:\n")
+	for _, c := range controls {
+		if chain == 0 || c.Chain == chain {
+			fmt.Printf("  %s of %s: %s operator: %s reason: %s updated: %s\n", c.Role, base.GetChainName(c.Chain),
+				c.State, c.Operator, c.Reason, time.Unix(c.Updated, 0).Format(time.RFC3339))
+		}
+	}
+	fmt.Printf("Role status:\n")
+	for _, r := range roles {
+		if chain == 0 || r.Chain == chain {
+			fmt.Printf("  %s of %s on %s: %s since: %s restarts %v failures %v %s\n", r.Role, base.GetChainName(r.Chain),
+				r.Instance, r.State, time.Unix(r.Since, 0).Format(time.RFC3339), r.Restarts, r.Failures, r.LastError)
+		}
+	}
+	return
+}
+
+func ConfigCheck(ctx *cli.Context) (err error) {
+	conf, err := config.New(ctx.String("config"))
+	if err != nil {
+		return
+	}
+	roles, err := config.LoadRoles(ctx.String("roles"))
+	if err != nil {
+		return
+	}
+	problems := CheckConfig(conf, roles, ctx.Bool("probe"))
+	if len(problems) == 0 {
+		fmt.Println("Config check passed")
+		return
+	}
+	fmt.Printf("Config problems, size %v:\n", len(problems))
+	for _, p := range problems {
+		fmt.Printf("  %s: %s\n", p.Path, p.Message)
+	}
+	return fmt.Errorf("Config check failed with %d problems", len(problems))
+}
+
+func ConfigShow(ctx *cli.Context) (err error) {
+	conf, err := config.New(ctx.String("config"))
+	if err != nil {
+		return
+	}
+	data, err := conf.Redacted()
+	if err != nil {
+		return
+	}
+	fmt.Println(string(data))
+	return
+}
+
+func Reload(ctx *cli.Context) (err error) {
+	n, err := bus.NewRoleStatusStore(config.Current().Bus).RequestReload(context.Background())
+	if err == nil {
+		fmt.Printf("Config reload request %v sent, running instances reload within %v\n", n, ROLE_STATUS_INTERVAL)
+	}
+	return
+}
+
+func RoleControl(action string) func(*cli.Context) error {
+	return func(ctx *cli.Context) error {
+		control := &bus.RoleControl{
+			Role:     ctx.String("role"),
+			Chain:    ctx.Uint64("chain"),
+			Operator: operator(ctx),
+			Reason:   ctx.String("reason"),
+		}
+		err := ControlRole(bus.NewRoleStatusStore(config.Current().Bus), action, control)
+		if err == nil {
+			fmt.Printf("Role %s of %s %s requested, running instances apply it within %v\n", control.Role,
+				base.GetChainName(control.Chain), action, ROLE_STATUS_INTERVAL)
+		}
+		return err
+	}
 }
 
 func CheckSkip(ctx *cli.Context) (err error) {
 	hash := ctx.String("hash")
-	skip, err := NewStatusHandler(config.CONFIG.Bus.Redis).CheckSkip(hash)
+	skip, err := NewStatusHandler(config.Current().Bus).CheckSkip(hash, ctx.Uint64("chain"))
 	if skip {
 		log.Info("Hash was marked to skip", "hash", hash)
 	}
 	return
 }
 
+// Commands working on the bus shared with the relayer
+var _BusCommands = map[string]bool{
+	STATUS: true, HTTP: true, SET_HEADER_HEIGHT: true, SET_TX_HEIGHT: true, SET_VALIDATOR_HEIGHT: true,
+	PATCH: true, SKIP: true, CHECK_SKIP: true, UNSKIP: true, LIST_SKIP: true,
+	DLQ_LIST: true, DLQ_SHOW: true, DLQ_REQUEUE: true, DLQ_PURGE: true, BUS_MIGRATE: true,
+	QUEUE_LIST: true, QUEUE_PEEK: true, QUEUE_SEARCH: true, QUEUE_REMOVE: true, QUEUE_MOVE: true,
+	QUEUE_RESCORE: true, QUEUE_EXPORT: true, QUEUE_IMPORT: true,
+	ROLE_LIST: true, ROLE_PAUSE: true, ROLE_RESUME: true, ROLE_START: true, ROLE_STOP: true, RELOAD: true,
+}
+
 func HandleCommand(method string, ctx *cli.Context) error {
 	h, ok := _Handlers[method]
 	if !ok {
 		return fmt.Errorf("Unsupported subcommand %s", method)
 	}
+	// The submit api does not touch the bus
+	if _BusCommands[method] && !(method == HTTP && ctx.Bool("submit")) {
+		err := bus.CheckShared(config.Current().Bus)
+		if err != nil {
+			return fmt.Errorf("Command %s requires a shared bus: %v", method, err)
+		}
+	}
 	return h(ctx)
 }
 
@@ -543,7 +840,7 @@ func ValidateBlock(ctx *cli.Context) (err error) {
 			log.Error("Unsupported chain", "chain", id)
 			return nil
 		}
-		conf := config.CONFIG.Chains[id]
+		conf := config.Current().Chains[id]
 		if conf == nil || conf.SrcTxSync == nil || conf.SrcTxSync.ListenerConfig == nil {
 			log.Error("Missing config for chain", "chain", id)
 			return nil
@@ -597,7 +894,7 @@ func Validate(ctx *cli.Context) (err error) {
 				log.Error("Unsupported validation chain", "chain", c)
 				continue
 			}
-			conf, ok := config.CONFIG.Chains[c]
+			conf, ok := config.Current().Chains[c]
 			if !ok || conf.SrcTxSync == nil || conf.SrcTxSync.ListenerConfig == nil {
 				log.Error("Missing config for chain", "chain", c)
 				continue
@@ -618,32 +915,42 @@ func Validate(ctx *cli.Context) (err error) {
 		return ids
 	}
 
-	config.CONFIG.Validators.Src = setup(config.CONFIG.Validators.Src)
-	config.CONFIG.Validators.Dst = setup(config.CONFIG.Validators.Dst)
+	config.Current().Validators.Src = setup(config.Current().Validators.Src)
+	config.Current().Validators.Dst = setup(config.Current().Validators.Dst)
 
-	outputs := make(chan tools.CardEvent, 100)
-	go watchAlarms(outputs)
+	start := func(context.Context) error {
+		outputs := make(chan tools.CardEvent, 100)
+		go watchAlarms(outputs)
 
-	for _, chain := range config.CONFIG.Validators.Dst {
-		err = StartValidator(func(uint64) IValidator { return pl }, listeners[chain], outputs)
-		if err != nil {
-			log.Fatal("Start validator failure", "chain", chain, "err", err)
+		for _, chain := range config.Current().Validators.Dst {
+			err := StartValidator(func(uint64) IValidator { return pl }, listeners[chain], outputs)
+			if err != nil {
+				log.Fatal("Start validator failure", "chain", chain, "err", err)
+			}
 		}
-	}
 
-	if len(config.CONFIG.Validators.Src) > 0 {
-		err = StartValidator(func(id uint64) IValidator {
-			for _, c := range config.CONFIG.Validators.Src {
-				if c == id {
-					return listeners[id]
+		if len(config.Current().Validators.Src) > 0 {
+			err := StartValidator(func(id uint64) IValidator {
+				for _, c := range config.Current().Validators.Src {
+					if c == id {
+						return listeners[id]
+					}
 				}
+				return nil
+			}, pl, outputs)
+			if err != nil {
+				log.Fatal("Start validator failure", "chain", 0, "err", err)
 			}
-			return nil
-		}, pl, outputs)
-		if err != nil {
-			log.Fatal("Start validator failure", "chain", 0, "err", err)
 		}
+		return nil
+	}
+
+	if config.Current().Validators.Leader && config.Current().Bus != nil {
+		// Validators can not be stopped, exit on leadership lost to let the standby instances take over
+		err = runAsLeader(context.Background(), config.Current().Bus, bus.ROLE_VALIDATOR, start)
+		log.Fatal("Validator leadership ended", "err", err)
 	}
+	start(context.Background())
 	<- make(chan bool)
 	return
 }
@@ -690,11 +997,11 @@ func handleAlarm(o tools.CardEvent) {
 		return
 	}
 
-	if !pause || len(config.CONFIG.Validators.PauseCommand) == 0 {
+	if !pause || len(config.Current().Validators.PauseCommand) == 0 {
 		return
 	}
 	go func() {
-		cmd := exec.Command(config.CONFIG.Validators.PauseCommand[0], config.CONFIG.Validators.PauseCommand[1:]...)
+		cmd := exec.Command(config.Current().Validators.PauseCommand[0], config.Current().Validators.PauseCommand[1:]...)
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stdout
 		err := cmd.Run()
@@ -702,11 +1009,11 @@ func handleAlarm(o tools.CardEvent) {
 			log.Error("Run handle event command", "err", err, "event", util.Json(o))
 		}
 	}()
-	go Notify(fmt.Sprintf(config.CONFIG.Validators.DialTemplate, "Poly", info))
+	go Notify(fmt.Sprintf(config.Current().Validators.DialTemplate, "Poly", info))
 }
 
 func Notify(content string) {
-	for _, target := range config.CONFIG.Validators.DialTargets {
+	for _, target := range config.Current().Validators.DialTargets {
 		go Dial(target, content)
 	}
 }
@@ -715,8 +1022,8 @@ func Dial(target, content string) error {
 	v := url.Values{}
 	now := strconv.FormatInt(time.Now().Unix(), 10)
 	h := md5.New()
-	h.Write([]byte(config.CONFIG.Validators.HuyiAccount + config.CONFIG.Validators.HuyiPassword + target + content + now))
-	v.Set("account", config.CONFIG.Validators.HuyiAccount)
+	h.Write([]byte(config.Current().Validators.HuyiAccount + config.Current().Validators.HuyiPassword + target + content + now))
+	v.Set("account", config.Current().Validators.HuyiAccount)
 	v.Set("password", hex.EncodeToString(h.Sum(nil)))
 	v.Set("mobile", target)
 	v.Set("content", content)
@@ -724,7 +1031,7 @@ func Dial(target, content string) error {
 	//body := ioutil.NopCloser(strings.NewReader(v.Encode())) //把form数据编下码
 	body := strings.NewReader(v.Encode())
 	client := &http.Client{}
-	req, err := http.NewRequest("POST", config.CONFIG.Validators.HuyiUrl, body)
+	req, err := http.NewRequest("POST", config.Current().Validators.HuyiUrl, body)
 	if err != nil {
 		return err
 	}
@@ -102,7 +102,7 @@ func (c *Controller) composeDstTx(hash string) (data interface{}, err error) {
 		return
 	}
 	payload := map[string]interface{}{}
-	conf := config.CONFIG.Chains[tx.DstChainId]
+	conf := config.Current().Chains[tx.DstChainId]
 	if conf != nil {
 		payload["dst_ccm"] = conf.CCMContract
 	}
@@ -0,0 +1,150 @@
+/*
+ * Copyright (C) 2021 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package relayer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/polynetwork/bridge-common/base"
+	"github.com/polynetwork/bridge-common/log"
+	"github.com/polynetwork/bridge-common/util"
+	"github.com/polynetwork/poly-relayer/bus"
+	"github.com/polynetwork/poly-relayer/config"
+	"github.com/polynetwork/poly-relayer/msg"
+)
+
+func parseTxType(ty string) (msg.TxType, error) {
+	switch ty {
+	case "", "poly":
+		return msg.POLY, nil
+	case "src":
+		return msg.SRC, nil
+	}
+	return 0, fmt.Errorf("Unsupported tx type %s, should be poly or src", ty)
+}
+
+func deadLetterBus(ctx *cli.Context) (dlq bus.DeadLetterBus, ty msg.TxType, err error) {
+	ty, err = parseTxType(ctx.String("type"))
+	if err != nil {
+		return
+	}
+	dlq = bus.NewDeadLetterBus(config.Current().Bus, ctx.Uint64("chain"), ty)
+	return
+}
+
+func DeadLetterList(ctx *cli.Context) (err error) {
+	dlq, _, err := deadLetterBus(ctx)
+	if err != nil {
+		return
+	}
+	txs, err := dlq.List(context.Background())
+	if err != nil {
+		return
+	}
+	fmt.Printf("Dead letter queue %s, size %v:\n", dlq.Topic(), len(txs))
+	for _, tx := range txs {
+		fmt.Printf("  %s attempts: %v class: %s error: %s\n", bus.DeadLetterId(tx), tx.Attempts, tx.ErrorClass, tx.LastError)
+	}
+	return
+}
+
+func DeadLetterShow(ctx *cli.Context) (err error) {
+	dlq, _, err := deadLetterBus(ctx)
+	if err != nil {
+		return
+	}
+	hash := ctx.String("hash")
+	tx, err := dlq.Get(context.Background(), hash)
+	if err != nil {
+		return
+	}
+	if tx == nil {
+		return fmt.Errorf("Tx %s not found in dead letter queue %s", hash, dlq.Topic())
+	}
+	fmt.Println(util.Verbose(tx))
+	return
+}
+
+// Requeue the dead letter txs with a fresh retry budget
+func DeadLetterRequeue(ctx *cli.Context) (err error) {
+	dlq, ty, err := deadLetterBus(ctx)
+	if err != nil {
+		return
+	}
+	var txs []*msg.Tx
+	hash := ctx.String("hash")
+	if hash == "" {
+		txs, err = dlq.List(context.Background())
+		if err != nil {
+			return
+		}
+	} else {
+		tx, err := dlq.Get(context.Background(), hash)
+		if err != nil {
+			return err
+		}
+		if tx == nil {
+			return fmt.Errorf("Tx %s not found in dead letter queue %s", hash, dlq.Topic())
+		}
+		txs = append(txs, tx)
+	}
+
+	chain := ctx.Uint64("chain")
+	for _, tx := range txs {
+		tx.Attempts = 0
+		tx.Failures = nil
+		if ty == msg.SRC {
+			err = bus.NewSortedTxBus(config.Current().Bus, chain, msg.SRC).Push(context.Background(), tx, tx.SrcProofHeight)
+		} else {
+			err = bus.NewTxBus(config.Current().Bus, chain, msg.POLY).Push(context.Background(), tx)
+		}
+		if err != nil {
+			return
+		}
+		_, err = dlq.Remove(context.Background(), bus.DeadLetterId(tx))
+		if err != nil {
+			return
+		}
+		log.Info("Requeued dead letter tx", "chain", base.GetChainName(chain), "id", bus.DeadLetterId(tx))
+	}
+	return
+}
+
+func DeadLetterPurge(ctx *cli.Context) (err error) {
+	dlq, _, err := deadLetterBus(ctx)
+	if err != nil {
+		return
+	}
+	hash := ctx.String("hash")
+	if hash == "" && !ctx.Bool("all") {
+		return fmt.Errorf("Either hash or all should be specified to purge the dead letter queue")
+	}
+	var ids []string
+	if hash != "" {
+		ids = append(ids, hash)
+	}
+	count, err := dlq.Remove(context.Background(), ids...)
+	if err != nil {
+		return
+	}
+	log.Info("Purged dead letter txs", "topic", dlq.Topic(), "count", count)
+	return
+}
@@ -18,8 +18,13 @@
 package relayer
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"os"
 	"github.com/urfave/cli/v2"
+	"github.com/polynetwork/bridge-common/log"
 	"github.com/polynetwork/poly-relayer/msg"
 )
 
@@ -27,9 +32,10 @@ func EncryptFile(ctx *cli.Context) (err error) {
 	file := ctx.String("file")
 	data, err := ioutil.ReadFile(file)
 	if err != nil { return }
-	pass, err := msg.ReadPassword("passphrase")
+	pass, err := readNewPassword("passphrase")
+	if err != nil { return }
+	cipherData, err := msg.Seal(data, pass)
 	if err != nil { return }
-	cipherData := msg.Encrypt(data, []byte(pass))
 	err = ioutil.WriteFile(file + ".encrypted", cipherData, 0644)
 	return
 }
@@ -40,7 +46,57 @@ func DecryptFile(ctx *cli.Context) (err error) {
 	if err != nil { return }
 	pass, err := msg.ReadPassword("passphrase")
 	if err != nil { return }
-	data := msg.Decrypt(cipherData, []byte(pass))
+	data, err := msg.DecryptData(cipherData, pass)
+	if err != nil { return }
 	err = ioutil.WriteFile(file + ".decrypted", data, 0644)
 	return
-}
\ No newline at end of file
+}
+
+// ReEncryptFile migrates the file encrypted in the legacy format to the versioned format in place, with
+// the passphrase changed optionally. The original file is kept with the ".legacy" suffix.
+func ReEncryptFile(ctx *cli.Context) (err error) {
+	file := ctx.String("file")
+	cipherData, err := ioutil.ReadFile(file)
+	if err != nil { return }
+	if msg.Encrypted(cipherData) && !ctx.Bool("newpass") {
+		return fmt.Errorf("File %s is already in the latest encryption format", file)
+	}
+	pass, err := msg.ReadPassword("passphrase")
+	if err != nil { return }
+	data, err := msg.DecryptData(cipherData, pass)
+	if err != nil { return }
+	if !msg.Encrypted(cipherData) && !json.Valid(data) && !ctx.Bool("force") {
+		return fmt.Errorf("Decrypted data is not valid json, wrong passphrase? Use --force for non json files")
+	}
+	if ctx.Bool("newpass") {
+		pass, err = readNewPassword("new passphrase")
+		if err != nil { return }
+	}
+	newData, err := msg.Seal(data, pass)
+	if err != nil { return }
+
+	if !msg.Encrypted(cipherData) {
+		err = ioutil.WriteFile(file + ".legacy", cipherData, 0600)
+		if err != nil { return }
+	}
+	tmp := file + ".tmp"
+	err = ioutil.WriteFile(tmp, newData, 0644)
+	if err != nil { return }
+	err = os.Rename(tmp, file)
+	if err == nil {
+		log.Info("Re-encrypted file", "file", file)
+	}
+	return
+}
+
+// Read the new passphrase twice to avoid typos
+func readNewPassword(name string) (pass []byte, err error) {
+	pass, err = msg.ReadPassword(name)
+	if err != nil { return }
+	confirm, err := msg.ReadPassword("the same " + name + " again")
+	if err != nil { return }
+	if !bytes.Equal(pass, confirm) {
+		return nil, fmt.Errorf("Passphrases do not match")
+	}
+	return
+}
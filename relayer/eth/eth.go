@@ -37,6 +37,8 @@ type Submitter struct {
 	ccm    common.Address
 	abi    abi.ABI
 	wallet wallet.IWallet
+	skip   bus.SkipCheck
+	nonces *NonceManager
 	// eccd   *eccd_abi.EthCrossChainData
 }
 
@@ -46,12 +48,45 @@ func (s *Submitter) Init(config *config.SubmitterConfig) (err error) {
 	if err != nil {
 		return
 	}
-	if config.Wallet != nil {
-		sdk, err := eth.WithOptions(config.ChainId, config.Wallet.Nodes, time.Minute, 1)
+	if config.Wallet != nil || config.Signer != nil {
+		walletConfig := wallet.Config{Nodes: config.Nodes}
+		if config.Wallet != nil {
+			walletConfig = *config.Wallet
+		}
+		sdk, err := eth.WithOptions(config.ChainId, walletConfig.Nodes, time.Minute, 1)
 		if err != nil {
 			return err
 		}
-		w := wallet.New(config.Wallet, sdk)
+		s.nonces = NewNonceManager(config.ChainId, func() NonceNode { return sdk.Node() }, time.Duration(config.NonceGapTimeout)*time.Second)
+
+		// Account providers are added with the txs signed with the managed nonces. The providers are built here
+		// instead of by the wallet init, as the wallet creates the unwrapped ones from the key configs. The wallet
+		// keeps a remote nonce provider per account which can not be replaced from outside, so it still fetches
+		// the confirmed nonce on each send, and the nonce is then overridden by the wrapped provider on signing.
+		providers := []wallet.Provider{}
+		for _, c := range walletConfig.KeyStoreProviders {
+			providers = append(providers, wallet.NewKeyStoreProvider(c))
+		}
+		for _, k := range walletConfig.KeyProviders {
+			p, err := wallet.NewKeyProvider(k)
+			if err != nil {
+				return fmt.Errorf("create KeyProvider failure, %w", err)
+			}
+			providers = append(providers, p)
+		}
+		if config.Signer != nil {
+			signer, err := NewRemoteSigner(config.Signer)
+			if err != nil {
+				return err
+			}
+			providers = append(providers, signer)
+			log.Info("Using remote signer", "chain", config.ChainId, "url", config.Signer.Url, "accounts", len(signer.Accounts()))
+		}
+		walletConfig.KeyStoreProviders, walletConfig.KeyProviders = nil, nil
+		w := wallet.New(&walletConfig, sdk)
+		for _, p := range providers {
+			w.AddProvider(s.nonces.Wrap(p))
+		}
 		err = w.Init()
 		if err != nil {
 			return err
@@ -85,13 +120,13 @@ func (s *Submitter) submit(tx *msg.Tx) error {
 	if tx.DstGasPrice != "" {
 		gasPrice, ok = new(big.Int).SetString(tx.DstGasPrice, 10)
 		if !ok {
-			return fmt.Errorf("%s submit invalid gas price %s", tx.DstGasPrice)
+			return fmt.Errorf("%s submit invalid gas price %s", s.name, tx.DstGasPrice)
 		}
 	}
 	if tx.DstGasPriceX != "" {
 		gasPriceX, ok = new(big.Float).SetString(tx.DstGasPriceX)
 		if !ok {
-			return fmt.Errorf("%s submit invalid gas priceX %s", tx.DstGasPriceX)
+			return fmt.Errorf("%s submit invalid gas priceX %s", s.name, tx.DstGasPriceX)
 		}
 	}
 	var (
@@ -111,11 +146,21 @@ func (s *Submitter) submit(tx *msg.Tx) error {
 		maxLimit, _ := big.NewFloat(tx.PaidGas).Int(nil)
 		tx.DstHash, err = s.wallet.SendWithMaxLimit(s.sdk.ChainID, account, s.ccm, big.NewInt(0), maxLimit, gasPrice, gasPriceX, tx.DstData)
 	}
+	if IsKnownTx(err) {
+		log.Info("Poly tx already known by the node", "chain", s.name, "poly_hash", tx.PolyHash, "dst_hash", tx.DstHash)
+		err = nil
+	}
+	s.nonces.Complete(tx.DstHash, err)
 	return err
 }
 
 func (s *Submitter) Send(addr common.Address, amount *big.Int, gasLimit uint64, gasPrice *big.Int, gasPriceX *big.Float, data []byte) (hash string, err error) {
-	return s.wallet.Send(addr, amount, gasLimit, gasPrice, gasPriceX, data)
+	hash, err = s.wallet.Send(addr, amount, gasLimit, gasPrice, gasPriceX, data)
+	if IsKnownTx(err) {
+		err = nil
+	}
+	s.nonces.Complete(hash, err)
+	return
 }
 
 func (s *Submitter) Hook(ctx context.Context, wg *sync.WaitGroup, ch <-chan msg.Message) error {
@@ -181,11 +226,11 @@ func (s *Submitter) processPolyTx(tx *msg.Tx) (err error) {
 
 func (s *Submitter) ProcessTx(m *msg.Tx, compose msg.PolyComposer) (err error) {
 	if m.Type() != msg.POLY {
-		return fmt.Errorf("%s desired message is not poly tx %v", m.Type())
+		return fmt.Errorf("%s desired message is not poly tx %v", s.name, m.Type())
 	}
 
 	if m.DstChainId != s.config.ChainId {
-		return fmt.Errorf("%s message dst chain does not match %v", m.DstChainId)
+		return fmt.Errorf("%s message dst chain does not match %v", s.name, m.DstChainId)
 	}
 	m.DstPolyEpochStartHeight, err = s.GetPolyEpochStartHeight()
 	if err != nil {
@@ -224,6 +269,8 @@ func (s *Submitter) SubmitTx(tx *msg.Tx) (err error) {
 			err = fmt.Errorf("%w tx exec error %v", msg.ERR_TX_EXEC_ALWAYS_FAIL, err)
 		} else if strings.Contains(info, "insufficient funds") || strings.Contains(info, "exceeds allowance") {
 			err = msg.ERR_LOW_BALANCE
+		} else if IsNonceError(err) {
+			err = fmt.Errorf("%w %v", msg.ERR_NONCE_INVALID, err)
 		}
 	}
 	return
@@ -238,8 +285,9 @@ func (s *Submitter) Process(m msg.Message, compose msg.PolyComposer) (err error)
 }
 
 func (s *Submitter) run(account accounts.Account, mq bus.TxBus, delay bus.DelayedTxBus, compose msg.PolyComposer) error {
-	s.wg.Add(1)
 	defer s.wg.Done()
+	defer bus.Guard(s.Context, "submitter")
+	mq = bus.ForConsumer(mq, account.Address.Hex())
 	for {
 		select {
 		case <-s.Done():
@@ -257,59 +305,80 @@ func (s *Submitter) run(account accounts.Account, mq bus.TxBus, delay bus.Delaye
 			time.Sleep(time.Second)
 			continue
 		}
-		log.Info("Processing poly tx", "poly_hash", tx.PolyHash, "account", account.Address)
-		tx.DstSender = &account
-		err = s.ProcessTx(tx, compose)
-		if err == nil {
-			err = s.SubmitTx(tx)
+		lowBalance := false
+		if skipped, _ := s.skip.CheckSkip(s.Context, tx); skipped {
+			log.Warn("Skipping poly tx for marked to skip", "chain", s.name, "poly_hash", tx.PolyHash)
+		} else {
+			lowBalance = s.process(account, tx, delay, compose)
 		}
+		err = mq.Ack(context.Background(), tx)
 		if err != nil {
-			log.Error("Process poly tx error", "chain", s.name, "poly_hash", tx.PolyHash, "err", err)
-			log.Json(log.ERROR, tx)
-			if errors.Is(err, msg.ERR_INVALID_TX) || errors.Is(err, msg.ERR_TX_BYPASS) {
-				log.Error("Skipped poly tx for error", "poly_hash", tx.PolyHash, "err", err)
-				continue
-			}
-			tx.Attempts++
-			// TODO: retry with increased gas price?
-			if errors.Is(err, msg.ERR_TX_EXEC_FAILURE) || errors.Is(err, msg.ERR_TX_EXEC_ALWAYS_FAIL) {
-				tsp := time.Now().Unix() + 60*3
-				bus.SafeCall(s.Context, tx, "push to delay queue", func() error { return delay.Delay(context.Background(), tx, tsp) })
-			} else if errors.Is(err, msg.ERR_FEE_CHECK_FAILURE) {
-				tsp := time.Now().Unix() + 10
-				bus.SafeCall(s.Context, tx, "push to delay queue", func() error { return delay.Delay(context.Background(), tx, tsp) })
-			} else if errors.Is(err, msg.ERR_PAID_FEE_TOO_LOW) {
-				tsp := time.Now().Unix() + 60*10
-				bus.SafeCall(s.Context, tx, "push to delay queue", func() error { return delay.Delay(context.Background(), tx, tsp) })
-			} else {
-				tsp := time.Now().Unix() + 1
-				bus.SafeCall(s.Context, tx, "push to delay queue", func() error { return delay.Delay(context.Background(), tx, tsp) })
-				if errors.Is(err, msg.ERR_LOW_BALANCE) {
-					log.Info("Low wallet balance detected", "chain", s.name, "account", account.Address)
-					s.WaitForBalance(account.Address)
-				}
-			}
+			log.Error("Failed to ack poly tx", "chain", s.name, "poly_hash", tx.PolyHash, "err", err)
+		}
+		// Wait after the ack, as the tx is already in the delay queue and should not be delivered again
+		if lowBalance {
+			log.Info("Low wallet balance detected", "chain", s.name, "account", account.Address)
+			s.WaitForBalance(account.Address)
+		}
+	}
+}
+
+// Process and submit the poly tx, returns whether the submit failed for the low balance of the account
+func (s *Submitter) process(account accounts.Account, tx *msg.Tx, delay bus.DelayedTxBus, compose msg.PolyComposer) (lowBalance bool) {
+	log.Info("Processing poly tx", "poly_hash", tx.PolyHash, "account", account.Address)
+	tx.DstSender = &account
+	err := s.ProcessTx(tx, compose)
+	if err == nil {
+		err = s.SubmitTx(tx)
+	}
+	if err != nil {
+		log.Error("Process poly tx error", "chain", s.name, "poly_hash", tx.PolyHash, "err", err)
+		log.Json(log.ERROR, tx)
+		if errors.Is(err, msg.ERR_INVALID_TX) || errors.Is(err, msg.ERR_TX_BYPASS) {
+			log.Error("Skipped poly tx for error", "poly_hash", tx.PolyHash, "err", err)
+			return
+		}
+		tx.Fail(err)
+		// TODO: retry with increased gas price?
+		if errors.Is(err, msg.ERR_TX_EXEC_FAILURE) || errors.Is(err, msg.ERR_TX_EXEC_ALWAYS_FAIL) {
+			tsp := time.Now().Unix() + 60*3
+			bus.SafeCall(s.Context, tx, "push to delay queue", func() error { return delay.Delay(context.Background(), tx, tsp) })
+		} else if errors.Is(err, msg.ERR_FEE_CHECK_FAILURE) {
+			tsp := time.Now().Unix() + 10
+			bus.SafeCall(s.Context, tx, "push to delay queue", func() error { return delay.Delay(context.Background(), tx, tsp) })
+		} else if errors.Is(err, msg.ERR_PAID_FEE_TOO_LOW) {
+			tsp := time.Now().Unix() + 60*10
+			bus.SafeCall(s.Context, tx, "push to delay queue", func() error { return delay.Delay(context.Background(), tx, tsp) })
+		} else if errors.Is(err, msg.ERR_NONCE_INVALID) {
+			// Retry shortly with the resynced nonce
+			tsp := time.Now().Unix() + 5
+			bus.SafeCall(s.Context, tx, "push to delay queue", func() error { return delay.Delay(context.Background(), tx, tsp) })
 		} else {
-			log.Info("Submitted poly tx", "poly_hash", tx.PolyHash, "chain", s.name, "dst_hash", tx.DstHash)
+			tsp := time.Now().Unix() + 1
+			bus.SafeCall(s.Context, tx, "push to delay queue", func() error { return delay.Delay(context.Background(), tx, tsp) })
+			lowBalance = errors.Is(err, msg.ERR_LOW_BALANCE)
+		}
+	} else {
+		log.Info("Submitted poly tx", "poly_hash", tx.PolyHash, "chain", s.name, "dst_hash", tx.DstHash)
 
-			// Retry to verify a successful submit
-			tsp := int64(0)
-			switch s.config.ChainId {
-			case base.MATIC, base.PLT:
-				tsp = time.Now().Unix() + 60*3
-			case base.ARBITRUM, base.XDAI, base.OPTIMISM, base.AVA, base.FANTOM, base.RINKEBY, base.BOBA, base.OASIS,
-				base.KAVA, base.CUBE, base.ZKSYNC, base.CELO, base.CLOVER, base.CONFLUX, base.ASTAR, base.BRISE:
-				tsp = time.Now().Unix() + 60*25
-			case base.BSC, base.HECO, base.OK, base.KCC, base.BYTOM, base.HSC, base.MILKO:
-				tsp = time.Now().Unix() + 60*4
-			case base.ETH:
-				tsp = time.Now().Unix() + 60*6
-			}
-			if tsp > 0 && tx.DstHash != "" {
-				bus.SafeCall(s.Context, tx, "push to delay queue", func() error { return delay.Delay(context.Background(), tx, tsp) })
-			}
+		// Retry to verify a successful submit
+		tsp := int64(0)
+		switch s.config.ChainId {
+		case base.MATIC, base.PLT:
+			tsp = time.Now().Unix() + 60*3
+		case base.ARBITRUM, base.XDAI, base.OPTIMISM, base.AVA, base.FANTOM, base.RINKEBY, base.BOBA, base.OASIS,
+			base.KAVA, base.CUBE, base.ZKSYNC, base.CELO, base.CLOVER, base.CONFLUX, base.ASTAR, base.BRISE:
+			tsp = time.Now().Unix() + 60*25
+		case base.BSC, base.HECO, base.OK, base.KCC, base.BYTOM, base.HSC, base.MILKO:
+			tsp = time.Now().Unix() + 60*4
+		case base.ETH:
+			tsp = time.Now().Unix() + 60*6
+		}
+		if tsp > 0 && tx.DstHash != "" {
+			bus.SafeCall(s.Context, tx, "push to delay queue", func() error { return delay.Delay(context.Background(), tx, tsp) })
 		}
 	}
+	return
 }
 
 func (s *Submitter) WaitForBalance(address common.Address) {
@@ -328,16 +397,22 @@ func (s *Submitter) WaitForBalance(address common.Address) {
 	}
 }
 
-func (s *Submitter) Start(ctx context.Context, wg *sync.WaitGroup, bus bus.TxBus, delay bus.DelayedTxBus, compose msg.PolyComposer) error {
+func (s *Submitter) Start(ctx context.Context, wg *sync.WaitGroup, mq bus.TxBus, delay bus.DelayedTxBus, compose msg.PolyComposer) error {
 	s.Context = ctx
 	s.wg = wg
+	s.skip = bus.NewSkipCheck(config.Current().Bus)
+	if s.nonces != nil {
+		s.nonces.SetStore(bus.NewNonceStore(config.Current().Bus))
+		s.nonces.Start(ctx, wg)
+	}
 	accounts := s.wallet.Accounts()
 	if len(accounts) == 0 {
 		log.Warn("No account available for submitter workers", "chain", s.name)
 	}
 	for i, a := range accounts {
 		log.Info("Starting submitter worker", "index", i, "total", len(accounts), "account", a.Address, "chain", s.name)
-		go s.run(a, bus, delay, compose)
+		s.wg.Add(1)
+		go s.run(a, mq, delay, compose)
 	}
 	return nil
 }
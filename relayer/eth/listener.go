@@ -24,6 +24,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/big"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
@@ -47,7 +48,7 @@ import (
 )
 
 type Listener struct {
-	sdk            *eth.SDK
+	sdk            atomic.Value // *eth.SDK, swapped when the nodes are updated
 	poly           *poly.SDK
 	ccm            common.Address
 	ccd            common.Address
@@ -68,12 +69,21 @@ func (l *Listener) Init(config *config.ListenerConfig, poly *poly.SDK) (err erro
 	l.GetProofHeight = l.getProofHeight
 	l.GetProof = l.getProof
 
-	l.state = bus.NewRedisChainStore(
-		bus.ChainHeightKey{ChainId: config.ChainId, Type: bus.KEY_HEIGHT_HEADER}, bus.New(config.Bus.Redis),
+	l.state = bus.NewChainStore(
+		config.Bus, bus.ChainHeightKey{ChainId: config.ChainId, Type: bus.KEY_HEIGHT_HEADER},
 		config.Bus.HeightUpdateInterval,
 	)
 
-	l.sdk, err = eth.WithOptions(config.ChainId, config.Nodes, time.Minute, 1)
+	return l.UpdateNodes(config.Nodes)
+}
+
+// UpdateNodes switches the listener to the new chain nodes without restarting the role
+func (l *Listener) UpdateNodes(nodes []string) (err error) {
+	sdk, err := eth.WithOptions(l.config.ChainId, nodes, time.Minute, 1)
+	if err != nil {
+		return
+	}
+	l.sdk.Store(sdk)
 	return
 }
 
@@ -90,7 +100,7 @@ func (l *Listener) getProofHeight(txHeight uint64) (height uint64, err error) {
 		if height > 0 {
 			return height - 2, nil
 		}
-		height, err = l.sdk.Node().GetLatestHeight()
+		height, err = l.SDK().Node().GetLatestHeight()
 		if err != nil {
 			return 0, err
 		}
@@ -122,7 +132,7 @@ func (l *Listener) getProof(txId []byte, txHeight uint64) (height uint64, proof
 		// We dont return here, still fetch the proof with tx height
 		height = txHeight
 	}
-	ethProof, e := l.sdk.Node().GetProof(l.ccd.String(), proofKey, height)
+	ethProof, e := l.SDK().Node().GetProof(l.ccd.String(), proofKey, height)
 	if e != nil {
 		return height, nil, e
 	}
@@ -166,7 +176,7 @@ func (l *Listener) Compose(tx *msg.Tx) (err error) {
 }
 
 func (l *Listener) Header(height uint64) (header []byte, hash []byte, err error) {
-	hdr, err := l.sdk.Node().HeaderByNumber(context.Background(), big.NewInt(int64(height)))
+	hdr, err := l.SDK().Node().HeaderByNumber(context.Background(), big.NewInt(int64(height)))
 	if err != nil {
 		err = fmt.Errorf("Fetch block header error %v", err)
 		return nil, nil, err
@@ -178,7 +188,7 @@ func (l *Listener) Header(height uint64) (header []byte, hash []byte, err error)
 }
 
 func (l *Listener) ScanDst(height uint64) (txs []*msg.Tx, err error) {
-	ccm, err := eccm_abi.NewEthCrossChainManager(l.ccm, l.sdk.Node())
+	ccm, err := eccm_abi.NewEthCrossChainManager(l.ccm, l.SDK().Node())
 	if err != nil {
 		return nil, err
 	}
@@ -213,7 +223,7 @@ func (l *Listener) ScanDst(height uint64) (txs []*msg.Tx, err error) {
 }
 
 func (l *Listener) Scan(height uint64) (txs []*msg.Tx, err error) {
-	ccm, err := eccm_abi.NewEthCrossChainManager(l.ccm, l.sdk.Node())
+	ccm, err := eccm_abi.NewEthCrossChainManager(l.ccm, l.SDK().Node())
 	if err != nil {
 		return nil, err
 	}
@@ -259,7 +269,7 @@ func (l *Listener) Scan(height uint64) (txs []*msg.Tx, err error) {
 }
 
 func (l *Listener) GetTxBlock(hash string) (height uint64, err error) {
-	receipt, err := l.sdk.Node().TransactionReceipt(context.Background(), common.HexToHash(hash))
+	receipt, err := l.SDK().Node().TransactionReceipt(context.Background(), common.HexToHash(hash))
 	if err != nil {
 		return
 	}
@@ -280,7 +290,7 @@ func (l *Listener) ListenCheck() time.Duration {
 }
 
 func (l *Listener) Nodes() chains.Nodes {
-	return l.sdk.ChainSDK
+	return l.SDK().ChainSDK
 }
 
 func (l *Listener) ChainId() uint64 {
@@ -296,11 +306,12 @@ func (l *Listener) Name() string {
 }
 
 func (l *Listener) SDK() *eth.SDK {
-	return l.sdk
+	sdk, _ := l.sdk.Load().(*eth.SDK)
+	return sdk
 }
 
 func (l *Listener) LatestHeight() (uint64, error) {
-	return l.sdk.Node().GetLatestHeight()
+	return l.SDK().Node().GetLatestHeight()
 }
 
 func (l *Listener) LastHeaderSync(force, last uint64) (height uint64, err error) {
@@ -326,7 +337,7 @@ func (l *Listener) Validate(tx *msg.Tx) (err error) {
 		err = fmt.Errorf("%s scan event mapping key error %v", l.name, err)
 		return
 	}
-	proof, err := l.sdk.Node().StorageAt(context.Background(), l.ccd, common.BytesToHash(key), nil)
+	proof, err := l.SDK().Node().StorageAt(context.Background(), l.ccd, common.BytesToHash(key), nil)
 	if err != nil {
 		return fmt.Errorf("get proof value failure %v", err)
 	}
@@ -355,7 +366,7 @@ func (l *Listener) ScanEvents(height uint64, ch chan tools.CardEvent) (err error
 
 	events := []tools.CardEvent{}
 	for _, address := range l.config.LockProxyContract {
-		p, err := lock_proxy_abi.NewLockProxy(common.HexToAddress(address), l.sdk.Node().Client)
+		p, err := lock_proxy_abi.NewLockProxy(common.HexToAddress(address), l.SDK().Node().Client)
 		if err != nil { return err }
 
 		setManagerProxyEvents, err := p.FilterSetManagerProxyEvent(opt)
@@ -0,0 +1,163 @@
+/*
+ * Copyright (C) 2021 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package eth
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// MockSigner is a local signing service with in memory keys, serving both the clef compatible json rpc
+// and the http signing api for tests
+type MockSigner struct {
+	keys map[common.Address]*ecdsa.PrivateKey
+	list []common.Address
+}
+
+func NewMockSigner(keys ...*ecdsa.PrivateKey) *MockSigner {
+	s := &MockSigner{keys: map[common.Address]*ecdsa.PrivateKey{}}
+	for _, key := range keys {
+		address := crypto.PubkeyToAddress(key.PublicKey)
+		s.keys[address] = key
+		s.list = append(s.list, address)
+	}
+	return s
+}
+
+func (s *MockSigner) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/accounts":
+		s.reply(w, &SignerAccountsResponse{Accounts: s.list}, nil)
+	case "/sign":
+		req := new(SignerRequest)
+		err := json.NewDecoder(r.Body).Decode(req)
+		if err != nil {
+			s.reply(w, nil, err)
+			return
+		}
+		tx := new(types.Transaction)
+		err = tx.UnmarshalBinary(req.Tx)
+		if err != nil {
+			s.reply(w, nil, err)
+			return
+		}
+		res, err := s.sign(req.Account, tx, (*big.Int)(req.ChainID))
+		s.reply(w, res, err)
+	default:
+		s.serveRpc(w, r)
+	}
+}
+
+func (s *MockSigner) reply(w http.ResponseWriter, res interface{}, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		res = &SignerError{Error: err.Error()}
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+func (s *MockSigner) serveRpc(w http.ResponseWriter, r *http.Request) {
+	req := new(struct {
+		Id     uint64            `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	})
+	var (
+		result interface{}
+		err    error
+	)
+	err = json.NewDecoder(r.Body).Decode(req)
+	if err == nil {
+		switch req.Method {
+		case "account_list":
+			result = s.list
+		case "account_signTransaction":
+			result, err = s.signArgs(req.Params)
+		default:
+			err = fmt.Errorf("the method %s does not exist/is not available", req.Method)
+		}
+	}
+	res := map[string]interface{}{"jsonrpc": "2.0", "id": req.Id}
+	if err != nil {
+		res["error"] = map[string]interface{}{"code": -32000, "message": err.Error()}
+	} else {
+		res["result"] = result
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func (s *MockSigner) signArgs(params []json.RawMessage) (*SignerTxResponse, error) {
+	if len(params) != 1 {
+		return nil, fmt.Errorf("invalid params")
+	}
+	args := new(SignerTxArgs)
+	err := json.Unmarshal(params[0], args)
+	if err != nil {
+		return nil, err
+	}
+	if args.ChainID == nil || args.Data == nil {
+		return nil, fmt.Errorf("chain id and data are required")
+	}
+	var to *common.Address
+	if args.To != nil {
+		address := args.To.Address()
+		to = &address
+	}
+	var tx *types.Transaction
+	if args.MaxFeePerGas != nil {
+		tx = types.NewTx(&types.DynamicFeeTx{
+			ChainID: (*big.Int)(args.ChainID), Nonce: uint64(args.Nonce), GasTipCap: (*big.Int)(args.MaxPriorityFeePerGas),
+			GasFeeCap: (*big.Int)(args.MaxFeePerGas), Gas: uint64(args.Gas), To: to, Value: (*big.Int)(&args.Value), Data: *args.Data,
+		})
+	} else {
+		tx = types.NewTx(&types.LegacyTx{
+			Nonce: uint64(args.Nonce), GasPrice: (*big.Int)(args.GasPrice), Gas: uint64(args.Gas), To: to,
+			Value: (*big.Int)(&args.Value), Data: *args.Data,
+		})
+	}
+	return s.sign(args.From.Address(), tx, (*big.Int)(args.ChainID))
+}
+
+func (s *MockSigner) sign(account common.Address, tx *types.Transaction, chainID *big.Int) (*SignerTxResponse, error) {
+	key, ok := s.keys[account]
+	if !ok {
+		return nil, fmt.Errorf("unknown account %s", account)
+	}
+	if chainID == nil {
+		return nil, fmt.Errorf("chain id is required")
+	}
+	signed, err := types.SignTx(tx, types.LatestSignerForChainID(chainID), key)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := signed.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return &SignerTxResponse{Raw: hexutil.Bytes(raw)}, nil
+}
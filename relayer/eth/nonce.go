@@ -0,0 +1,428 @@
+/*
+ * Copyright (C) 2021 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package eth
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/polynetwork/bridge-common/log"
+	"github.com/polynetwork/bridge-common/wallet"
+	"github.com/polynetwork/poly-relayer/bus"
+)
+
+const (
+	NONCE_CHECK_INTERVAL      = 30 * time.Second
+	DEFAULT_NONCE_GAP_TIMEOUT = 5 * time.Minute
+	CANCEL_TX_GAS_LIMIT       = 21000
+)
+
+// NonceNode is the chain node used by the nonce manager
+type NonceNode interface {
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+	PendingNonceAt(ctx context.Context, account common.Address) (uint64, error)
+	SuggestGasPrice(ctx context.Context) (*big.Int, error)
+	ChainID(ctx context.Context) (*big.Int, error)
+	SendTransaction(ctx context.Context, tx *types.Transaction) error
+}
+
+// Nonces of an account
+type accountNonces struct {
+	synced   bool
+	restored bool            // Whether the backup was consulted, only done on the first sync after startup
+	next     uint64          // Next new nonce
+	released []uint64        // Nonces below next released by failed sends, reused first
+	gap      uint64          // Lowest nonce missing on chain
+	gapSince time.Time       // Zero when no gap
+	provider wallet.Provider // Signer of the cancel txs
+}
+
+// Nonce reserved by a signed tx waiting for the send result
+type nonceReservation struct {
+	address common.Address
+	nonce   uint64
+}
+
+// NonceManager assigns the nonces of the submitter accounts in memory instead of fetching the confirmed
+// nonce from the node for each tx. The nonces are resynced from the pending nonce on nonce errors, and
+// the gaps left by failed or dropped txs are filled with cancel txs when no tx takes them in time.
+type NonceManager struct {
+	chain      uint64
+	node       func() NonceNode
+	store      bus.NonceStore // Backup of the next nonces, optional
+	gapTimeout time.Duration  // Negative to disable gap filling
+	mu         sync.Mutex
+	accounts   map[common.Address]*accountNonces
+	pending    map[common.Hash]*nonceReservation
+}
+
+func NewNonceManager(chain uint64, node func() NonceNode, gapTimeout time.Duration) *NonceManager {
+	if gapTimeout == 0 {
+		gapTimeout = DEFAULT_NONCE_GAP_TIMEOUT
+	}
+	return &NonceManager{
+		chain: chain, node: node, gapTimeout: gapTimeout,
+		accounts: map[common.Address]*accountNonces{},
+		pending:  map[common.Hash]*nonceReservation{},
+	}
+}
+
+// SetStore sets the store to back up the nonces
+func (m *NonceManager) SetStore(store bus.NonceStore) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.store = store
+}
+
+func (m *NonceManager) account(address common.Address) *accountNonces {
+	a, ok := m.accounts[address]
+	if !ok {
+		a = new(accountNonces)
+		m.accounts[address] = a
+	}
+	return a
+}
+
+// Sync the next nonce with the pending nonce of the account on chain. The backup is used if higher on the
+// first sync only, as it covers the txs sent before the restart but not yet seen by the node, while the
+// later resyncs are caused by the nonce errors and the backup could be stale.
+func (m *NonceManager) sync(address common.Address, a *accountNonces) (err error) {
+	next, err := m.node().PendingNonceAt(context.Background(), address)
+	if err != nil {
+		return
+	}
+	if !a.restored && m.store != nil {
+		backup, e := m.store.GetNonce(context.Background(), m.chain, address.Hex())
+		if e != nil {
+			log.Error("Failed to get nonce backup", "chain", m.chain, "account", address, "err", e)
+		} else if backup > next {
+			log.Warn("Nonce backup is ahead of the chain pending nonce", "chain", m.chain, "account", address, "backup", backup, "pending", next)
+			next = backup
+		}
+	}
+	if a.synced && a.next != next {
+		log.Info("Resynced account nonce", "chain", m.chain, "account", address, "previous", a.next, "next", next)
+	}
+	a.next, a.released, a.synced, a.restored = next, nil, true, true
+	m.backup(address, next)
+	return
+}
+
+func (m *NonceManager) backup(address common.Address, next uint64) {
+	if m.store == nil {
+		return
+	}
+	err := m.store.SetNonce(context.Background(), m.chain, address.Hex(), next)
+	if err != nil {
+		log.Error("Failed to back up nonce", "chain", m.chain, "account", address, "err", err)
+	}
+}
+
+// Acquire takes the lowest released nonce or the next new nonce of the account
+func (m *NonceManager) Acquire(address common.Address) (nonce uint64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a := m.account(address)
+	if !a.synced {
+		err = m.sync(address, a)
+		if err != nil {
+			return
+		}
+	}
+	if len(a.released) > 0 {
+		nonce, a.released = a.released[0], a.released[1:]
+		return
+	}
+	nonce = a.next
+	a.next++
+	return
+}
+
+// Release returns the unused nonce to the account
+func (m *NonceManager) Release(address common.Address, nonce uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.release(address, nonce)
+}
+
+func (m *NonceManager) release(address common.Address, nonce uint64) {
+	a := m.account(address)
+	if !a.synced || nonce >= a.next {
+		return
+	}
+	if nonce+1 == a.next {
+		a.next--
+		return
+	}
+	for _, n := range a.released {
+		if n == nonce {
+			return
+		}
+	}
+	a.released = append(a.released, nonce)
+	sort.Slice(a.released, func(i, j int) bool { return a.released[i] < a.released[j] })
+}
+
+// Complete applies the send result of the signed tx. The nonce is released when the tx was rejected, and
+// the account is resynced on nonce errors.
+func (m *NonceManager) Complete(hash string, err error) {
+	if hash == "" {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.pending[common.HexToHash(hash)]
+	if !ok {
+		return
+	}
+	delete(m.pending, common.HexToHash(hash))
+	a := m.account(r.address)
+	switch {
+	case err == nil || IsKnownTx(err):
+		m.backup(r.address, a.next)
+	case IsNonceError(err):
+		log.Warn("Nonce error detected, resyncing account nonce", "chain", m.chain, "account", r.address, "nonce", r.nonce, "err", err)
+		a.synced = false
+	default:
+		m.release(r.address, r.nonce)
+	}
+}
+
+// IsNonceError checks whether the send error is caused by a wrong nonce
+func IsNonceError(err error) bool {
+	if err == nil {
+		return false
+	}
+	info := err.Error()
+	for _, e := range []string{"nonce too low", "nonce too high", "replacement transaction underpriced"} {
+		if strings.Contains(info, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsKnownTx checks whether the send error means the same tx is already in the pool of the node, which is
+// taken as a successful send
+func IsKnownTx(err error) bool {
+	if err == nil {
+		return false
+	}
+	info := err.Error()
+	return strings.Contains(info, "already known") || strings.Contains(info, "known transaction")
+}
+
+// Wrap the account provider to sign the txs with the managed nonces
+func (m *NonceManager) Wrap(p wallet.Provider) wallet.Provider {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, a := range p.Accounts() {
+		m.account(a.Address).provider = p
+	}
+	return &nonceProvider{Provider: p, nonces: m}
+}
+
+type nonceProvider struct {
+	wallet.Provider
+	nonces *NonceManager
+}
+
+func (p *nonceProvider) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (signed *types.Transaction, err error) {
+	nonce, err := p.nonces.Acquire(account.Address)
+	if err != nil {
+		return
+	}
+	signed, err = p.Provider.SignTx(account, withNonce(tx, nonce), chainID)
+	if err != nil {
+		p.nonces.Release(account.Address, nonce)
+		return
+	}
+	p.nonces.mu.Lock()
+	p.nonces.pending[signed.Hash()] = &nonceReservation{account.Address, nonce}
+	p.nonces.mu.Unlock()
+	return
+}
+
+// Copy the tx with the nonce
+func withNonce(tx *types.Transaction, nonce uint64) *types.Transaction {
+	switch tx.Type() {
+	case types.DynamicFeeTxType:
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID: tx.ChainId(), Nonce: nonce, GasTipCap: tx.GasTipCap(), GasFeeCap: tx.GasFeeCap(), Gas: tx.Gas(),
+			To: tx.To(), Value: tx.Value(), Data: tx.Data(), AccessList: tx.AccessList(),
+		})
+	case types.AccessListTxType:
+		return types.NewTx(&types.AccessListTx{
+			ChainID: tx.ChainId(), Nonce: nonce, GasPrice: tx.GasPrice(), Gas: tx.Gas(),
+			To: tx.To(), Value: tx.Value(), Data: tx.Data(), AccessList: tx.AccessList(),
+		})
+	}
+	return types.NewTx(&types.LegacyTx{
+		Nonce: nonce, GasPrice: tx.GasPrice(), Gas: tx.Gas(), To: tx.To(), Value: tx.Value(), Data: tx.Data(),
+	})
+}
+
+// Start checking the nonce gaps of the accounts periodically
+func (m *NonceManager) Start(ctx context.Context, wg *sync.WaitGroup) {
+	if m.gapTimeout < 0 {
+		return
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer bus.Guard(ctx, "nonce manager")
+		ticker := time.NewTicker(NONCE_CHECK_INTERVAL)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.CheckGaps()
+			}
+		}
+	}()
+}
+
+// CheckGaps detects the nonces missing on chain below the next nonces, and fills the gaps lasting longer
+// than the gap timeout with cancel txs
+func (m *NonceManager) CheckGaps() {
+	m.mu.Lock()
+	addresses := []common.Address{}
+	for address, a := range m.accounts {
+		if a.synced {
+			addresses = append(addresses, address)
+		}
+	}
+	m.mu.Unlock()
+	for _, address := range addresses {
+		err := m.checkGap(address)
+		if err != nil {
+			log.Error("Failed to check nonce gap", "chain", m.chain, "account", address, "err", err)
+		}
+	}
+}
+
+func (m *NonceManager) checkGap(address common.Address) (err error) {
+	node := m.node()
+	confirmed, err := node.NonceAt(context.Background(), address, nil)
+	if err != nil {
+		return
+	}
+	pending, err := node.PendingNonceAt(context.Background(), address)
+	if err != nil {
+		return
+	}
+	nonces, provider, err := m.claimGap(address, confirmed, pending)
+	if err != nil || len(nonces) == 0 {
+		return
+	}
+
+	// Sign and send without the lock, so the submitters are not blocked by the node
+	filled := 0
+	for _, nonce := range nonces {
+		err = m.cancel(node, provider, address, nonce)
+		if err != nil {
+			break
+		}
+		filled++
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, nonce := range nonces[filled:] {
+		m.release(address, nonce)
+	}
+	return
+}
+
+// Detect the nonce gap of the account, and claim the missing nonces to fill when the gap lasts longer than
+// the gap timeout, so they are not taken by the new txs while filling.
+func (m *NonceManager) claimGap(address common.Address, confirmed, pending uint64) (nonces []uint64, provider wallet.Provider, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a := m.account(address)
+	if !a.synced {
+		return
+	}
+	for len(a.released) > 0 && a.released[0] < confirmed {
+		a.released = a.released[1:]
+	}
+	switch {
+	case pending > a.next:
+		// Txs sent by others with the account
+		err = m.sync(address, a)
+		return
+	case pending >= a.next:
+		a.gapSince = time.Time{}
+		return
+	}
+
+	// The node knows no tx of the nonce while higher nonces were sent
+	gap := pending
+	if a.gapSince.IsZero() || a.gap != gap {
+		log.Warn("Nonce gap detected", "chain", m.chain, "account", address, "gap", gap, "next", a.next, "confirmed", confirmed)
+		a.gap, a.gapSince = gap, time.Now()
+		return
+	}
+	if time.Since(a.gapSince) < m.gapTimeout || a.provider == nil {
+		return
+	}
+	// Fill all the nonces up to the next in one pass, as the nonces released by the failed sends are not
+	// persisted and the dropped txs leave no trace. The nonces taken by the queued txs are skipped by the node.
+	for nonce := gap; nonce < a.next; nonce++ {
+		nonces = append(nonces, nonce)
+	}
+	a.released, a.gapSince = nil, time.Time{}
+	return nonces, a.provider, nil
+}
+
+// Fill the nonce gap with a zero value transfer to the account itself
+func (m *NonceManager) cancel(node NonceNode, provider wallet.Provider, address common.Address, nonce uint64) (err error) {
+	chainID, err := node.ChainID(context.Background())
+	if err != nil {
+		return
+	}
+	gasPrice, err := node.SuggestGasPrice(context.Background())
+	if err != nil {
+		return
+	}
+	tx := types.NewTransaction(nonce, address, big.NewInt(0), CANCEL_TX_GAS_LIMIT, gasPrice, nil)
+	tx, err = provider.SignTx(accounts.Account{Address: address}, tx, chainID)
+	if err != nil {
+		return
+	}
+	err = node.SendTransaction(context.Background(), tx)
+	switch {
+	case err == nil || IsKnownTx(err):
+		log.Info("Sent cancel tx to fill nonce gap", "chain", m.chain, "account", address, "nonce", nonce, "hash", tx.Hash())
+		return nil
+	case strings.Contains(err.Error(), "nonce too low") || strings.Contains(err.Error(), "replacement transaction underpriced"):
+		// The nonce is taken by a queued or confirmed tx
+		log.Info("Nonce gap already taken", "chain", m.chain, "account", address, "nonce", nonce, "err", err)
+		return nil
+	}
+	return
+}
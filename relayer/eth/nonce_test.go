@@ -0,0 +1,175 @@
+package eth
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/polynetwork/poly-relayer/bus"
+	"github.com/polynetwork/poly-relayer/config"
+)
+
+type testNonceNode struct {
+	confirmed, pending uint64
+	sent               []*types.Transaction
+	errs               map[uint64]error // Send errors by nonce
+}
+
+func (n *testNonceNode) NonceAt(context.Context, common.Address, *big.Int) (uint64, error) {
+	return n.confirmed, nil
+}
+
+func (n *testNonceNode) PendingNonceAt(context.Context, common.Address) (uint64, error) {
+	return n.pending, nil
+}
+
+func (n *testNonceNode) SuggestGasPrice(context.Context) (*big.Int, error) {
+	return big.NewInt(1e9), nil
+}
+
+func (n *testNonceNode) ChainID(context.Context) (*big.Int, error) {
+	return big.NewInt(5), nil
+}
+
+func (n *testNonceNode) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	if err := n.errs[tx.Nonce()]; err != nil {
+		return err
+	}
+	n.sent = append(n.sent, tx)
+	return nil
+}
+
+func TestNonceManager(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	mock := httptest.NewServer(NewMockSigner(key))
+	defer mock.Close()
+	signer, err := NewRemoteSigner(&config.SignerConfig{Url: mock.URL, Insecure: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := signer.Accounts()[0]
+	node := &testNonceNode{confirmed: 7, pending: 10}
+	m := NewNonceManager(2, func() NonceNode { return node }, 1)
+	p := m.Wrap(signer)
+
+	sign := func(expected uint64) string {
+		tx := types.NewTransaction(0, common.HexToAddress("0x01"), big.NewInt(0), 21000, big.NewInt(1e9), nil)
+		signed, err := p.SignTx(account, tx, big.NewInt(5))
+		if err != nil {
+			t.Fatalf("Failed to sign tx %v", err)
+		}
+		if signed.Nonce() != expected {
+			t.Fatalf("Expected nonce %d, got %d", expected, signed.Nonce())
+		}
+		return signed.Hash().Hex()
+	}
+
+	m.Complete(sign(10), nil)
+	h11 := sign(11)
+	m.Complete(sign(12), nil)
+	// Rejected tx releases the nonce for the next tx
+	m.Complete(h11, errors.New("Estimate gas limit error"))
+	m.Complete(sign(11), nil)
+	h13 := sign(13)
+	m.Complete(h13, errors.New("rpc timeout"))
+	m.Complete(sign(13), nil)
+
+	// Nonce errors resync the account from the pending nonce
+	node.pending = 20
+	m.Complete(sign(14), errors.New("nonce too low"))
+	m.Complete(sign(20), nil)
+
+	// Gap at the pending nonce is filled with a cancel tx once it lasts longer than the timeout
+	node.confirmed, node.pending = 20, 20
+	m.CheckGaps()
+	if len(node.sent) != 0 {
+		t.Fatalf("Gap should not be filled before the timeout")
+	}
+	m.CheckGaps()
+	if len(node.sent) != 1 || node.sent[0].Nonce() != 20 || *node.sent[0].To() != account.Address {
+		t.Fatalf("Expected a cancel tx with nonce 20, sent %v", node.sent)
+	}
+	node.pending = 21
+	m.CheckGaps()
+	m.Complete(sign(21), nil)
+
+	_, err = m.Wrap(signer).SignTx(accounts.Account{Address: common.HexToAddress("0x02")}, types.NewTransaction(0, account.Address, big.NewInt(0), 21000, big.NewInt(1), nil), big.NewInt(5))
+	if err == nil {
+		t.Fatalf("Expected signing with unknown account to fail")
+	}
+	m.mu.Lock()
+	if a := m.accounts[common.HexToAddress("0x02")]; a == nil || len(a.released) != 0 || a.next != 21 {
+		t.Fatalf("Failed sign should release the nonce, got %+v", a)
+	}
+	m.mu.Unlock()
+}
+
+func TestNonceManagerGaps(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	mock := httptest.NewServer(NewMockSigner(key))
+	defer mock.Close()
+	signer, err := NewRemoteSigner(&config.SignerConfig{Url: mock.URL, Insecure: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := signer.Accounts()[0]
+	store, _ := bus.NewMemoryStore("", 0)
+	defer store.Close()
+	nonces := bus.NewStoreNonceStore(store)
+	nonces.SetNonce(context.Background(), 2, account.Address.Hex(), 30)
+
+	node := &testNonceNode{confirmed: 7, pending: 10}
+	m := NewNonceManager(2, func() NonceNode { return node }, 1)
+	m.SetStore(nonces)
+	p := m.Wrap(signer)
+	sign := func() (uint64, string) {
+		tx := types.NewTransaction(0, common.HexToAddress("0x01"), big.NewInt(0), 21000, big.NewInt(1e9), nil)
+		signed, err := p.SignTx(account, tx, big.NewInt(5))
+		if err != nil {
+			t.Fatalf("Failed to sign tx %v", err)
+		}
+		return signed.Nonce(), signed.Hash().Hex()
+	}
+
+	// Backup ahead of the node is used on the first sync only
+	nonce, hash := sign()
+	if nonce != 30 {
+		t.Fatalf("Expected nonce from the backup 30, got %d", nonce)
+	}
+	m.Complete(hash, errors.New("nonce too high"))
+	node.pending = 12
+	nonce, hash = sign()
+	if nonce != 12 {
+		t.Fatalf("Expected resync from the pending nonce 12, got %d", nonce)
+	}
+	// Already known tx is a successful send
+	m.Complete(hash, errors.New("already known"))
+	for i := 0; i < 3; i++ {
+		_, hash = sign()
+		m.Complete(hash, nil)
+	}
+
+	// All the missing nonces are filled in one pass, a failed send releases the rest
+	node.confirmed, node.pending = 12, 12
+	node.errs = map[uint64]error{13: errors.New("replacement transaction underpriced"), 15: errors.New("rpc timeout")}
+	m.CheckGaps()
+	m.CheckGaps()
+	if len(node.sent) != 2 || node.sent[0].Nonce() != 12 || node.sent[1].Nonce() != 14 {
+		t.Fatalf("Expected cancel txs with nonces 12 and 14, sent %v", node.sent)
+	}
+	nonce, _ = sign()
+	if nonce != 15 {
+		t.Fatalf("Expected the unfilled nonce 15 to be released, got %d", nonce)
+	}
+	nonce, _ = sign()
+	if nonce != 16 {
+		t.Fatalf("Expected the next nonce 16, got %d", nonce)
+	}
+}
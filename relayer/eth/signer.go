@@ -0,0 +1,335 @@
+/*
+ * Copyright (C) 2021 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package eth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/polynetwork/bridge-common/log"
+	"github.com/polynetwork/poly-relayer/config"
+)
+
+const (
+	SIGNER_API_CLEF = "clef" // Clef compatible json rpc: account_list and account_signTransaction
+	SIGNER_API_HTTP = "http" // Simple http signing api: GET /accounts and POST /sign
+
+	DEFAULT_SIGNER_TIMEOUT = 30 * time.Second
+)
+
+// RemoteSigner is a wallet account provider with the keys held by a remote signing service
+type RemoteSigner struct {
+	config   *config.SignerConfig
+	client   *http.Client
+	accounts []accounts.Account
+	id       uint64 // Json rpc request id
+}
+
+// ValidateSigner checks the remote signer config, the signer must be served over mutual tls unless insecure
+func ValidateSigner(conf *config.SignerConfig) error {
+	if conf.Url == "" {
+		return fmt.Errorf("Remote signer url is required")
+	}
+	switch conf.Api {
+	case "", SIGNER_API_CLEF, SIGNER_API_HTTP:
+	default:
+		return fmt.Errorf("Unknown remote signer api %s", conf.Api)
+	}
+	if conf.Insecure {
+		return nil
+	}
+	u, err := url.Parse(conf.Url)
+	if err != nil {
+		return fmt.Errorf("Invalid remote signer url %v", err)
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("Remote signer url must be https, set Insecure to allow %s", u.Scheme)
+	}
+	if conf.TLS == nil || conf.TLS.Cert == "" || conf.TLS.Key == "" {
+		return fmt.Errorf("Remote signer client certificate is required for mutual tls, set Insecure to skip")
+	}
+	return nil
+}
+
+func NewRemoteSigner(conf *config.SignerConfig) (s *RemoteSigner, err error) {
+	err = ValidateSigner(conf)
+	if err != nil {
+		return
+	}
+	if conf.Insecure {
+		log.Warn("Remote signer is insecure, the signing requests are not authenticated", "url", conf.Url)
+	}
+	timeout := time.Duration(conf.Timeout) * time.Second
+	if timeout == 0 {
+		timeout = DEFAULT_SIGNER_TIMEOUT
+	}
+	s = &RemoteSigner{config: conf, client: &http.Client{Timeout: timeout}}
+	if conf.TLS != nil {
+		tlsConfig, err := conf.TLS.Load()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load remote signer tls config %v", err)
+		}
+		s.client.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+		if conf.TLS.InsecureSkipVerify {
+			log.Warn("Remote signer server certificate is not verified", "url", conf.Url)
+		}
+	}
+
+	available, err := s.listAccounts()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list remote signer accounts %v", err)
+	}
+	if len(conf.Accounts) == 0 {
+		s.accounts = available
+		return
+	}
+	for _, address := range conf.Accounts {
+		account := accounts.Account{Address: common.HexToAddress(address)}
+		found := false
+		for _, a := range available {
+			found = found || a.Address == account.Address
+		}
+		if !found {
+			return nil, fmt.Errorf("Account %s is not available in the remote signer", address)
+		}
+		s.accounts = append(s.accounts, account)
+	}
+	return
+}
+
+func (s *RemoteSigner) Init(account accounts.Account) error {
+	return nil
+}
+
+func (s *RemoteSigner) Accounts() []accounts.Account {
+	return s.accounts
+}
+
+func (s *RemoteSigner) SignHash(account accounts.Account, hash []byte) ([]byte, error) {
+	return nil, fmt.Errorf("Remote signer does not sign hashes")
+}
+
+// SignTx signs the tx with the remote signer, and verifies the signed tx matches the tx and the account
+func (s *RemoteSigner) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (signed *types.Transaction, err error) {
+	if s.config.Api == SIGNER_API_HTTP {
+		signed, err = s.signHttp(account, tx, chainID)
+	} else {
+		signed, err = s.signClef(account, tx, chainID)
+	}
+	if err != nil {
+		return
+	}
+	signer := types.LatestSignerForChainID(chainID)
+	if signer.Hash(signed) != signer.Hash(tx) {
+		return nil, fmt.Errorf("Remote signer returned a different tx %s", signed.Hash())
+	}
+	sender, err := types.Sender(signer, signed)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid signature from remote signer %v", err)
+	}
+	if sender != account.Address {
+		return nil, fmt.Errorf("Remote signer signed with account %s instead of %s", sender, account.Address)
+	}
+	return
+}
+
+func (s *RemoteSigner) listAccounts() (list []accounts.Account, err error) {
+	var addresses []common.Address
+	if s.config.Api == SIGNER_API_HTTP {
+		res := new(SignerAccountsResponse)
+		err = s.request(http.MethodGet, "/accounts", nil, res)
+		addresses = res.Accounts
+	} else {
+		err = s.call("account_list", nil, &addresses)
+	}
+	for _, address := range addresses {
+		list = append(list, accounts.Account{Address: address})
+	}
+	return
+}
+
+// Transaction args of account_signTransaction
+type SignerTxArgs struct {
+	From                 common.MixedcaseAddress  `json:"from"`
+	To                   *common.MixedcaseAddress `json:"to"`
+	Gas                  hexutil.Uint64           `json:"gas"`
+	GasPrice             *hexutil.Big             `json:"gasPrice,omitempty"`
+	MaxFeePerGas         *hexutil.Big             `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas *hexutil.Big             `json:"maxPriorityFeePerGas,omitempty"`
+	Value                hexutil.Big              `json:"value"`
+	Nonce                hexutil.Uint64           `json:"nonce"`
+	Data                 *hexutil.Bytes           `json:"data"`
+	ChainID              *hexutil.Big             `json:"chainId,omitempty"`
+}
+
+func (s *RemoteSigner) signClef(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	data := hexutil.Bytes(tx.Data())
+	args := &SignerTxArgs{
+		From:    common.NewMixedcaseAddress(account.Address),
+		Gas:     hexutil.Uint64(tx.Gas()),
+		Value:   hexutil.Big(*tx.Value()),
+		Nonce:   hexutil.Uint64(tx.Nonce()),
+		Data:    &data,
+		ChainID: (*hexutil.Big)(chainID),
+	}
+	if tx.To() != nil {
+		to := common.NewMixedcaseAddress(*tx.To())
+		args.To = &to
+	}
+	if tx.Type() == types.DynamicFeeTxType {
+		args.MaxFeePerGas = (*hexutil.Big)(tx.GasFeeCap())
+		args.MaxPriorityFeePerGas = (*hexutil.Big)(tx.GasTipCap())
+	} else {
+		args.GasPrice = (*hexutil.Big)(tx.GasPrice())
+	}
+	res := new(SignerTxResponse)
+	err := s.call("account_signTransaction", []interface{}{args}, res)
+	if err != nil {
+		return nil, err
+	}
+	return decodeTx(res.Raw)
+}
+
+func (s *RemoteSigner) signHttp(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	req := &SignerRequest{Account: account.Address, ChainID: (*hexutil.Big)(chainID), Tx: raw}
+	res := new(SignerTxResponse)
+	err = s.request(http.MethodPost, "/sign", req, res)
+	if err != nil {
+		return nil, err
+	}
+	return decodeTx(res.Raw)
+}
+
+func decodeTx(raw []byte) (*types.Transaction, error) {
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("Empty signed tx from remote signer")
+	}
+	tx := new(types.Transaction)
+	err := tx.UnmarshalBinary(raw)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode signed tx %v", err)
+	}
+	return tx, nil
+}
+
+// Request of the http signing api, the tx is the unsigned tx in binary
+type SignerRequest struct {
+	Account common.Address `json:"account"`
+	ChainID *hexutil.Big   `json:"chainId"`
+	Tx      hexutil.Bytes  `json:"tx"`
+}
+
+type SignerTxResponse struct {
+	Raw hexutil.Bytes `json:"raw"`
+}
+
+type SignerAccountsResponse struct {
+	Accounts []common.Address `json:"accounts"`
+}
+
+type SignerError struct {
+	Error string `json:"error"`
+}
+
+func (s *RemoteSigner) request(method, path string, body, result interface{}) (err error) {
+	var data []byte
+	if body != nil {
+		data, err = json.Marshal(body)
+		if err != nil {
+			return
+		}
+	}
+	req, err := http.NewRequest(method, strings.TrimRight(s.config.Url, "/")+path, bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	data, err = ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		e := new(SignerError)
+		json.Unmarshal(data, e)
+		return fmt.Errorf("Remote signer request failed with status %d %s", resp.StatusCode, e.Error)
+	}
+	return json.Unmarshal(data, result)
+}
+
+type jsonRpcRequest struct {
+	JsonRpc string        `json:"jsonrpc"`
+	Id      uint64        `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+type jsonRpcResponse struct {
+	Id     uint64          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (s *RemoteSigner) call(method string, params []interface{}, result interface{}) (err error) {
+	if params == nil {
+		params = []interface{}{}
+	}
+	req := &jsonRpcRequest{JsonRpc: "2.0", Id: atomic.AddUint64(&s.id, 1), Method: method, Params: params}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return
+	}
+	resp, err := s.client.Post(s.config.Url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	res := new(jsonRpcResponse)
+	err = json.NewDecoder(resp.Body).Decode(res)
+	if err != nil {
+		return fmt.Errorf("Remote signer %s failed with status %d %v", method, resp.StatusCode, err)
+	}
+	if res.Error != nil {
+		return fmt.Errorf("Remote signer %s error %d %s", method, res.Error.Code, res.Error.Message)
+	}
+	return json.Unmarshal(res.Result, result)
+}
@@ -0,0 +1,150 @@
+package eth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/polynetwork/poly-relayer/config"
+)
+
+// Issue a certificate signed by the parent, self signed when parent is nil
+func issueCert(t *testing.T, dir, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, usage x509.ExtKeyUsage) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		template.ExtKeyUsage = nil
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return cert, key
+}
+
+func TestRemoteSigner(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := issueCert(t, dir, "ca", nil, nil, x509.ExtKeyUsageAny)
+	issueCert(t, dir, "server", ca, caKey, x509.ExtKeyUsageServerAuth)
+	issueCert(t, dir, "client", ca, caKey, x509.ExtKeyUsageClientAuth)
+
+	key1, _ := crypto.GenerateKey()
+	key2, _ := crypto.GenerateKey()
+	mock := httptest.NewUnstartedServer(NewMockSigner(key1, key2))
+	serverCert, err := tls.LoadX509KeyPair(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	mock.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}, ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	mock.StartTLS()
+	defer mock.Close()
+
+	tlsConfig := &config.TLSConfig{
+		CA:   filepath.Join(dir, "ca.crt"),
+		Cert: filepath.Join(dir, "client.crt"),
+		Key:  filepath.Join(dir, "client.key"),
+	}
+	_, err = NewRemoteSigner(&config.SignerConfig{Url: mock.URL, TLS: &config.TLSConfig{CA: tlsConfig.CA}, Insecure: true})
+	if err == nil {
+		t.Fatalf("Expected the signer to reject clients without certificate")
+	}
+
+	account := crypto.PubkeyToAddress(key2.PublicKey)
+	to := common.HexToAddress("0x01")
+	chainID := big.NewInt(5)
+	for _, api := range []string{SIGNER_API_CLEF, SIGNER_API_HTTP} {
+		signer, err := NewRemoteSigner(&config.SignerConfig{Url: mock.URL, Api: api, TLS: tlsConfig})
+		if err != nil {
+			t.Fatalf("Failed to create %s signer %v", api, err)
+		}
+		if len(signer.Accounts()) != 2 {
+			t.Fatalf("Unexpected %s signer accounts %v", api, signer.Accounts())
+		}
+		signer, err = NewRemoteSigner(&config.SignerConfig{Url: mock.URL, Api: api, TLS: tlsConfig, Accounts: []string{account.Hex()}})
+		if err != nil || len(signer.Accounts()) != 1 || signer.Accounts()[0].Address != account {
+			t.Fatalf("Failed to select %s signer account %v", api, err)
+		}
+
+		txs := []*types.Transaction{
+			types.NewTransaction(3, to, big.NewInt(0), 21000, big.NewInt(1e9), []byte{1, 2, 3}),
+			types.NewTx(&types.DynamicFeeTx{Nonce: 4, GasTipCap: big.NewInt(1e9), GasFeeCap: big.NewInt(3e9), Gas: 21000, To: &to, Value: big.NewInt(1), Data: []byte{4}}),
+		}
+		for _, tx := range txs {
+			signed, err := signer.SignTx(signer.Accounts()[0], tx, chainID)
+			if err != nil {
+				t.Fatalf("Failed to sign tx type %d with %s signer %v", tx.Type(), api, err)
+			}
+			sender, err := types.Sender(types.LatestSignerForChainID(chainID), signed)
+			if err != nil || sender != account || signed.Nonce() != tx.Nonce() {
+				t.Fatalf("Unexpected signed tx sender %s err %v", sender, err)
+			}
+		}
+
+		_, err = signer.SignTx(accounts.Account{Address: common.HexToAddress("0x02")}, txs[0], chainID)
+		if err == nil {
+			t.Fatalf("Expected signing with unknown account to fail with %s signer", api)
+		}
+	}
+}
+
+func TestValidateSigner(t *testing.T) {
+	cert := &config.TLSConfig{Cert: "client.crt", Key: "client.key"}
+	cases := []struct {
+		conf  *config.SignerConfig
+		valid bool
+	}{
+		{&config.SignerConfig{Url: "https://signer", TLS: cert}, true},
+		{&config.SignerConfig{Url: "https://signer", Api: SIGNER_API_HTTP, TLS: cert}, true},
+		{&config.SignerConfig{Url: "http://127.0.0.1:8550", Insecure: true}, true},
+		{&config.SignerConfig{}, false},
+		{&config.SignerConfig{Url: "https://signer", Api: "unknown", TLS: cert}, false},
+		{&config.SignerConfig{Url: "http://signer", TLS: cert}, false},
+		{&config.SignerConfig{Url: "https://signer"}, false},
+		{&config.SignerConfig{Url: "https://signer", TLS: &config.TLSConfig{CA: "ca.crt"}}, false},
+	}
+	for i, tc := range cases {
+		err := ValidateSigner(tc.conf)
+		if (err == nil) != tc.valid {
+			t.Errorf("Case %d expected valid %v, got %v", i, tc.valid, err)
+		}
+	}
+}
@@ -19,6 +19,7 @@ package harmony
 
 import (
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/polynetwork/bridge-common/base"
@@ -50,7 +51,7 @@ const (
 
 func GetLastEpochBlock(height uint64) (prev, next uint64) {
 	start, blocks := EPOCH_START_TESTNET, EPOCH_BLOCKS_TESTNET
-	if config.CONFIG.Env == "mainnet" {
+	if config.Current().Env == "mainnet" {
 		start, blocks = EPOCH_START_MAINNET, EPOCH_BLOCKS_MAINNET
 	}
 	step := (height - start) % blocks
@@ -137,7 +138,7 @@ func (l *Listener) SideChain() (sc *side_chain_manager.SideChain, err error) {
 		BlocksToWait: 1,
 	}
 	ctx := &Context{}
-	if config.CONFIG.Env != "mainnet" {
+	if config.Current().Env != "mainnet" {
 		ctx.NetworkID = 1
 	}
 	sc.ExtraInfo, err = json.Marshal(ctx)
@@ -148,3 +149,7 @@ func (l *Listener) Defer() int {
 	return 2
 }
 
+// UpdateNodes is not supported in place, as the harmony sdk is created along with the eth one
+func (l *Listener) UpdateNodes(nodes []string) error {
+	return fmt.Errorf("Harmony listener nodes can not be updated in place")
+}
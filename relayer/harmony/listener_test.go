@@ -7,7 +7,7 @@ import (
 )
 
 func TestGetLastEpochBlock(t *testing.T) {
-	config.CONFIG.Env = "mainnet"
+	config.Use(&config.Config{Env: "mainnet"})
 	prev, next := GetLastEpochBlock(23592960)
 	if prev != 23592959 {
 		t.Errorf("Prev for mainnet gives the wrong result")
@@ -21,7 +21,6 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"sync"
 	"time"
 
 	"github.com/polynetwork/bridge-common/base"
@@ -33,8 +32,7 @@ import (
 )
 
 type HeaderSyncHandler struct {
-	context.Context
-	wg        *sync.WaitGroup
+	Worker
 	listener  IChainListener
 	submitter *poly.Submitter
 	state     bus.ChainStore // sync height mark
@@ -55,9 +53,8 @@ func NewHeaderSyncHandler(config *config.HeaderSyncConfig) *HeaderSyncHandler {
 	}
 }
 
-func (h *HeaderSyncHandler) Init(ctx context.Context, wg *sync.WaitGroup) (err error) {
-	h.Context = ctx
-	h.wg = wg
+func (h *HeaderSyncHandler) Init(ctx context.Context) (err error) {
+	h.init(ctx)
 
 	err = h.submitter.Init(h.config.Poly)
 	if err != nil {
@@ -73,19 +70,24 @@ func (h *HeaderSyncHandler) Init(ctx context.Context, wg *sync.WaitGroup) (err e
 		return
 	}
 
-	h.state = bus.NewRedisChainStore(
-		bus.ChainHeightKey{ChainId: h.config.ChainId, Type: bus.KEY_HEIGHT_HEADER}, bus.New(h.config.Bus.Redis),
+	h.state = bus.NewChainStore(
+		h.config.Bus, bus.ChainHeightKey{ChainId: h.config.ChainId, Type: bus.KEY_HEIGHT_HEADER},
 		h.config.Bus.HeightUpdateInterval,
 	)
-	h.input = bus.NewRedisChainStore(
-		bus.ChainHeightKey{ChainId: h.config.ChainId, Type: bus.KEY_HEIGHT_HEADER_RESET}, bus.New(h.config.Bus.Redis),
+	// Reject the height marks of the previous leaders when running as a singleton
+	err = h.state.Fence(ctx)
+	if err != nil {
+		return
+	}
+	h.input = bus.NewChainStore(
+		h.config.Bus, bus.ChainHeightKey{ChainId: h.config.ChainId, Type: bus.KEY_HEIGHT_HEADER_RESET},
 		h.config.Bus.HeightUpdateInterval,
 	)
-	h.latest = bus.NewRedisChainStore(
-		bus.ChainHeightKey{ChainId: h.config.ChainId, Type: bus.KEY_HEIGHT_CHAIN}, bus.New(h.config.Bus.Redis), 0,
+	h.latest = bus.NewChainStore(
+		h.config.Bus, bus.ChainHeightKey{ChainId: h.config.ChainId, Type: bus.KEY_HEIGHT_CHAIN}, 0,
 	)
-	h.sync = bus.NewRedisChainStore(
-		bus.ChainHeightKey{ChainId: h.config.ChainId, Type: bus.KEY_HEIGHT_CHAIN_HEADER}, bus.New(h.config.Bus.Redis), 0,
+	h.sync = bus.NewChainStore(
+		h.config.Bus, bus.ChainHeightKey{ChainId: h.config.ChainId, Type: bus.KEY_HEIGHT_CHAIN_HEADER}, 0,
 	)
 
 	return
@@ -155,8 +157,8 @@ func (h *HeaderSyncHandler) RollbackToCommonAncestor(height, target uint64) uint
 }
 
 func (h *HeaderSyncHandler) watch() {
-	h.wg.Add(1)
 	defer h.wg.Done()
+	defer bus.Guard(h.Context, "header watch")
 	ticker := time.NewTicker(3 * time.Second)
 	last := uint64(0)
 	for {
@@ -190,8 +192,8 @@ func (h *HeaderSyncHandler) watch() {
 }
 
 func (h *HeaderSyncHandler) start(ch chan msg.Header) {
-	h.wg.Add(1)
 	defer h.wg.Done()
+	defer bus.Guard(h.Context, "header sync")
 	confirms := uint64(h.listener.Defer())
 	var (
 		latest uint64
@@ -266,15 +268,23 @@ func (h *HeaderSyncHandler) Start() (err error) {
 	if err != nil {
 		return
 	}
+	h.wg.Add(2)
 	go h.watch()
 	go h.start(ch)
 	return
 }
 
+// Stop fetching headers and wait for the in flight header submission, the header sync mark is flushed by the submitter
 func (h *HeaderSyncHandler) Stop() (err error) {
+	h.stop()
 	return
 }
 
 func (h *HeaderSyncHandler) Chain() uint64 {
 	return h.config.ChainId
 }
+
+// UpdateNodes switches the listener to the new chain nodes
+func (h *HeaderSyncHandler) UpdateNodes(nodes []string) error {
+	return updateNodes(h.listener, nodes)
+}
@@ -19,8 +19,10 @@ package relayer
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
@@ -37,8 +39,9 @@ import (
 )
 
 var (
-	_PATCHER *bus.RedisTxBus
-	_SKIP    *bus.RedisSkipCheck
+	_PATCHER bus.TxBus
+	_SKIP    bus.SkipCheck
+	_ROLES   bus.RoleStatusStore
 )
 
 func Http(ctx *cli.Context) (err error) {
@@ -47,15 +50,16 @@ func Http(ctx *cli.Context) (err error) {
 	host := ctx.String("host")
 	submit := ctx.Bool("submit")
 	if port == 0 {
-		port = config.CONFIG.Port
+		port = config.Current().Port
 	}
 	if host == "" {
-		host = config.CONFIG.Host
+		host = config.Current().Host
 	}
 
 	// Init patcher
-	_PATCHER = bus.NewRedisPatchTxBus(bus.New(config.CONFIG.Bus.Redis), 0)
-	_SKIP = bus.NewRedisSkipCheck(bus.New(config.CONFIG.Bus.Redis))
+	_PATCHER = bus.NewPatchTxBus(config.Current().Bus, 0)
+	_SKIP = bus.NewSkipCheck(config.Current().Bus)
+	_ROLES = bus.NewRoleStatusStore(config.Current().Bus)
 	err = SetupController()
 	if err != nil {
 		return
@@ -67,16 +71,24 @@ func Http(ctx *cli.Context) (err error) {
 		metrics.Init("relayer")
 		go recordMetrics()
 		http.HandleFunc("/api/v1/patch", PatchTx)
-		http.HandleFunc("/api/v1/skip", SkipTx)
+		http.HandleFunc("/api/v1/skip", Admin(SkipTx))
+		http.HandleFunc("/api/v1/unskip", Admin(UnskipTx))
+		http.HandleFunc("/api/v1/listskip", ListSkipTx)
 		http.HandleFunc("/api/v1/skipcheck", SkipCheckTx)
 		http.HandleFunc("/api/v1/composetx", controller.ComposeDstTx)
+		http.HandleFunc("/api/v1/roles", ListRoles)
+		http.HandleFunc("/api/v1/pauserole", Admin(ControlRoleApi(ROLE_ACTION_PAUSE)))
+		http.HandleFunc("/api/v1/resumerole", Admin(ControlRoleApi(ROLE_ACTION_RESUME)))
+		http.HandleFunc("/api/v1/startrole", Admin(ControlRoleApi(ROLE_ACTION_START)))
+		http.HandleFunc("/api/v1/stoprole", Admin(ControlRoleApi(ROLE_ACTION_STOP)))
+		http.HandleFunc("/api/v1/reload", Admin(ReloadConfig))
 	}
 	http.ListenAndServe(fmt.Sprintf("%v:%v", host, port), nil)
 	return
 }
 
 func recordMetrics() {
-	h := NewStatusHandler(config.CONFIG.Bus.Redis)
+	h := NewStatusHandler(config.Current().Bus)
 	timer := time.NewTicker(2 * time.Second)
 	for range timer.C {
 		start := time.Now()
@@ -108,26 +120,170 @@ func recordMetrics() {
 			qPoly, _ := h.Len(chain, msg.POLY)
 			metrics.Record(qSrc, "queue_size.src.%s", name)
 			metrics.Record(qPoly, "queue_size.poly.%s", name)
+			pending, _ := h.Pending(chain, msg.POLY)
+			for consumer, count := range pending {
+				consumer = strings.NewReplacer(".", "_", ":", "_").Replace(consumer)
+				metrics.Record(count, "queue_pending.poly.%s.%s", name, consumer)
+			}
+			qDelayed, _ := h.LenDelayed(chain, msg.POLY)
+			metrics.Record(qDelayed, "queue_size.delayed.%s", name)
 		}
-		qDelayed, _ := h.LenDelayed()
+		qDelayed, _ := h.LenLegacyDelayed()
 		metrics.Record(qDelayed, "queue_size.delayed")
+		candidates, token, _ := h.Candidates(bus.ROLE_POLY_SYNC)
+		standby := 0
+		for _, c := range candidates {
+			owner := strings.NewReplacer(".", "_", ":", "_").Replace(c.Owner)
+			leading := 0
+			if c.Leading {
+				leading = 1
+			} else {
+				standby++
+			}
+			metrics.Record(leading, "leader.poly_sync.%s.leading", owner)
+			metrics.Record(c.Lag(), "leader.poly_sync.%s.lag", owner)
+		}
+		metrics.Record(standby, "leader.poly_sync.standby")
+		metrics.Record(token, "leader.poly_sync.token")
 		log.Info("metrics tick", "elapse", time.Since(start))
 	}
 }
 
+type operatorKey struct{}
+
+// Operator of the admin request recorded by the audits, the admin token holder at the remote host
+func adminOperator(r *http.Request) string {
+	name, _ := r.Context().Value(operatorKey{}).(string)
+	return name
+}
+
+// Admin guards the handler with the configured admin token in the bearer authorization header
+func Admin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := config.Current().AdminToken
+		if token == "" {
+			http.Error(w, "admin endpoints are disabled without admin token", http.StatusForbidden)
+			return
+		}
+		auth := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(auth), []byte(token)) != 1 {
+			log.Warn("Rejected unauthorized admin request", "path", r.URL.Path, "remote", r.RemoteAddr)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		handler(w, r.WithContext(context.WithValue(r.Context(), operatorKey{}, "admin@"+host)))
+	}
+}
+
 func SkipTx(w http.ResponseWriter, r *http.Request) {
-	hash := r.FormValue("hash")
-	err := _SKIP.Skip(context.Background(), &msg.Tx{PolyHash: hash})
+	chain, _ := strconv.ParseUint(r.FormValue("chain"), 10, 64)
+	ttl, _ := strconv.ParseInt(r.FormValue("ttl"), 10, 64)
+	entry := &bus.SkipEntry{
+		Hash:     r.FormValue("hash"),
+		Operator: adminOperator(r),
+		Reason:   r.FormValue("reason"),
+		DstChain: chain,
+	}
+	if ttl > 0 {
+		entry.Expiry = time.Now().Unix() + ttl
+	}
+	err := _SKIP.Skip(context.Background(), entry)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	} else {
-		Json(w, &msg.Tx{PolyHash: hash})
+		Json(w, entry)
+	}
+}
+
+func UnskipTx(w http.ResponseWriter, r *http.Request) {
+	entry := &bus.SkipEntry{
+		Hash:     r.FormValue("hash"),
+		Operator: adminOperator(r),
+		Reason:   r.FormValue("reason"),
+	}
+	ok, err := _SKIP.Unskip(context.Background(), entry)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	} else if !ok {
+		http.Error(w, "hash was not marked to skip", http.StatusNotFound)
+	} else {
+		Json(w, entry)
+	}
+}
+
+func ListSkipTx(w http.ResponseWriter, r *http.Request) {
+	entries, err := _SKIP.ListSkip(context.Background())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	} else {
+		Json(w, entries)
+	}
+}
+
+func ListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := _ROLES.ListRoles(context.Background())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	controls, err := _ROLES.RoleControls(context.Background())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	chain, _ := strconv.ParseUint(r.FormValue("chain"), 10, 64)
+	res := struct {
+		Roles    []*bus.RoleStatus
+		Controls []*bus.RoleControl
+	}{[]*bus.RoleStatus{}, []*bus.RoleControl{}}
+	for _, role := range roles {
+		if chain == 0 || role.Chain == chain {
+			res.Roles = append(res.Roles, role)
+		}
+	}
+	for _, c := range controls {
+		if chain == 0 || c.Chain == chain {
+			res.Controls = append(res.Controls, c)
+		}
+	}
+	Json(w, res)
+}
+
+func ReloadConfig(w http.ResponseWriter, r *http.Request) {
+	n, err := _ROLES.RequestReload(context.Background())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	} else {
+		Json(w, map[string]uint64{"Request": n})
+	}
+}
+
+func ControlRoleApi(action string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		chain, _ := strconv.ParseUint(r.FormValue("chain"), 10, 64)
+		control := &bus.RoleControl{
+			Role:     r.FormValue("role"),
+			Chain:    chain,
+			Operator: adminOperator(r),
+			Reason:   r.FormValue("reason"),
+		}
+		err := ControlRole(_ROLES, action, control)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		} else {
+			Json(w, control)
+		}
 	}
 }
 
 func SkipCheckTx(w http.ResponseWriter, r *http.Request) {
 	hash := r.FormValue("hash")
-	tx := &msg.Tx{PolyHash: hash}
+	chain, _ := strconv.ParseUint(r.FormValue("chain"), 10, 64)
+	tx := &msg.Tx{PolyHash: hash, DstChainId: chain}
 	skip, err := _SKIP.CheckSkip(context.Background(), tx)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -189,7 +345,7 @@ func Patch(ctx *cli.Context) (err error) {
 		tx.SrcHeight = height
 		tx.SrcChainId = chain
 	}
-	err = bus.NewRedisPatchTxBus(bus.New(config.CONFIG.Bus.Redis), 0).Patch(context.Background(), tx)
+	err = bus.NewPatchTxBus(config.Current().Bus, 0).Patch(context.Background(), tx)
 	if err != nil {
 		log.Error("Patch tx failed", "err", err)
 		log.Json(log.ERROR, tx)
@@ -140,6 +140,8 @@ func (s *Submitter) Stop() error {
 func (s *Submitter) run(account *sdk.Account, mq bus.TxBus, delay bus.DelayedTxBus, compose msg.PolyComposer) error {
 	s.wg.Add(1)
 	defer s.wg.Done()
+	defer bus.Guard(s.Context, "submitter")
+	mq = bus.ForConsumer(mq, account.Address.ToBase58())
 	for {
 		select {
 		case <-s.Done():
@@ -156,29 +158,37 @@ func (s *Submitter) run(account *sdk.Account, mq bus.TxBus, delay bus.DelayedTxB
 			time.Sleep(time.Second)
 			continue
 		}
-		log.Info("Processing poly tx", "poly_hash", tx.PolyHash, "account", account.Address)
-		err = s.ProcessTx(tx, compose)
-		if err == nil {
-			err = s.SubmitTx(tx)
-		}
+		s.process(account, tx, mq, delay, compose)
+		err = mq.Ack(context.Background(), tx)
 		if err != nil {
-			log.Error("Process poly tx error", "chain", s.name, "err", err)
-			log.Json(log.ERROR, tx)
-			if errors.Is(err, msg.ERR_INVALID_TX) || errors.Is(err, msg.ERR_TX_BYPASS) {
-				log.Error("Skipped poly tx for error", "poly_hash", tx.PolyHash, "err", err)
-				continue
-			}
-			tx.Attempts++
-			if errors.Is(err, msg.ERR_TX_EXEC_FAILURE) {
-				tsp := time.Now().Unix() + 60*3
-				bus.SafeCall(s.Context, tx, "push to delay queue", func() error { return delay.Delay(context.Background(), tx, tsp) })
-				continue
-			} else {
-				bus.SafeCall(s.Context, tx, "push back to tx bus", func() error { return mq.Push(context.Background(), tx) })
-			}
+			log.Error("Failed to ack poly tx", "chain", s.name, "poly_hash", tx.PolyHash, "err", err)
+		}
+	}
+}
+
+func (s *Submitter) process(account *sdk.Account, tx *msg.Tx, mq bus.TxBus, delay bus.DelayedTxBus, compose msg.PolyComposer) {
+	log.Info("Processing poly tx", "poly_hash", tx.PolyHash, "account", account.Address)
+	err := s.ProcessTx(tx, compose)
+	if err == nil {
+		err = s.SubmitTx(tx)
+	}
+	if err != nil {
+		log.Error("Process poly tx error", "chain", s.name, "err", err)
+		log.Json(log.ERROR, tx)
+		if errors.Is(err, msg.ERR_INVALID_TX) || errors.Is(err, msg.ERR_TX_BYPASS) {
+			log.Error("Skipped poly tx for error", "poly_hash", tx.PolyHash, "err", err)
+			return
+		}
+		tx.Fail(err)
+		if errors.Is(err, msg.ERR_TX_EXEC_FAILURE) {
+			tsp := time.Now().Unix() + 60*3
+			bus.SafeCall(s.Context, tx, "push to delay queue", func() error { return delay.Delay(context.Background(), tx, tsp) })
+			return
 		} else {
-			log.Info("Submitted poly tx", "poly_hash", tx.PolyHash, "chain", s.name, "dst_hash", tx.DstHash)
+			bus.SafeCall(s.Context, tx, "push back to tx bus", func() error { return mq.Push(context.Background(), tx) })
 		}
+	} else {
+		log.Info("Submitted poly tx", "poly_hash", tx.PolyHash, "chain", s.name, "dst_hash", tx.DstHash)
 	}
 }
 
@@ -118,7 +118,7 @@ func (s *Submitter) ComposeTx(tx *msg.Tx) (err error) {
 		return err
 	}
 
-	if tx.MerkleValue.MakeTxParam == nil || !config.CONFIG.AllowMethod(tx.MerkleValue.MakeTxParam.Method) {
+	if tx.MerkleValue.MakeTxParam == nil || !config.Current().AllowMethod(tx.MerkleValue.MakeTxParam.Method) {
 		method := "missing param"
 		if tx.MerkleValue.MakeTxParam != nil {
 			method = tx.MerkleValue.MakeTxParam.Method
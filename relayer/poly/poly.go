@@ -50,6 +50,7 @@ type Submitter struct {
 	sync     *config.HeaderSyncConfig
 	composer msg.SrcComposer
 	state    bus.ChainStore // Header sync marking
+	skip     bus.SkipCheck
 
 	// Check last header commit
 	lastCommit   uint64
@@ -161,7 +162,7 @@ func (s *Submitter) submitHeadersWithLoop(chainId uint64, headers [][]byte, head
 		select {
 		case <-s.Done():
 			log.Warn("Header submitter exiting with headers not submitted", "chain", chainId)
-			return nil
+			return s.Err()
 		default:
 			if attempt > 30 || (attempt > 3 && chainId == base.HARMONY) {
 				log.Error("Header submit too many failed attempts", "chain", chainId, "attempts", attempt)
@@ -199,7 +200,7 @@ func (s *Submitter) submit(tx *msg.Tx) error {
 		return fmt.Errorf("%s submitter src tx %s param is missing or src chain id not specified", s.name, tx.SrcHash)
 	}
 
-	if !config.CONFIG.AllowMethod(tx.Param.Method) {
+	if !config.Current().AllowMethod(tx.Param.Method) {
 		log.Error("Invalid src tx method", "src_hash", tx.SrcHash, "chain", s.name, "method", tx.Param.Method)
 		return nil
 	}
@@ -306,8 +307,8 @@ func (s *Submitter) ReadyBlock() (height uint64) {
 }
 
 func (s *Submitter) consume(mq bus.SortedTxBus) error {
-	s.wg.Add(1)
 	defer s.wg.Done()
+	defer bus.Guard(s.Context, "poly submitter")
 	ticker := time.NewTicker(300 * time.Millisecond)
 	defer ticker.Stop()
 
@@ -330,49 +331,54 @@ func (s *Submitter) consume(mq bus.SortedTxBus) error {
 		default:
 		}
 
-		tx, block, err := mq.Pop(s.Context)
+		tx, _, err := mq.Claim(s.Context, height)
 		if err != nil {
-			log.Error("Bus pop error", "err", err)
+			log.Error("Bus claim error", "err", err)
+			time.Sleep(time.Second)
 			continue
 		}
 		if tx == nil {
+			// Nothing ready at current height, wait for new txs or block height update
 			time.Sleep(200 * time.Millisecond)
 			continue
 		}
 
-		if block <= height {
-			log.Info("Processing src tx", "src_hash", tx.SrcHash, "src_chain", tx.SrcChainId, "dst_chain", tx.DstChainId)
-			err = s.submit(tx)
-			if err == nil {
-				log.Info("Submitted src tx to poly", "src_hash", tx.SrcHash, "poly_hash", tx.PolyHash)
-				continue
-			}
+		if skipped, _ := s.skip.CheckSkip(s.Context, tx); skipped {
+			log.Warn("Skipping src tx for marked to skip", "chain", s.name, "src_hash", tx.SrcHash)
+			bus.SafeCall(s.Context, tx, "ack tx bus", func() error { return mq.Ack(context.Background(), tx) })
+			continue
+		}
 
-			if errors.Is(err, msg.ERR_Tx_VERIFYMERKLEPROOF) {
-				log.Warn("src tx submit to poly verifyMerkleProof failed, clear src proof", "chain", s.name, "src hash", tx.SrcHash, "err", err)
-				tx.SrcProofHex = ""
-				tx.SrcProof = []byte{}
-			}
+		log.Info("Processing src tx", "src_hash", tx.SrcHash, "src_chain", tx.SrcChainId, "dst_chain", tx.DstChainId)
+		err = s.submit(tx)
+		if err == nil {
+			log.Info("Submitted src tx to poly", "src_hash", tx.SrcHash, "poly_hash", tx.PolyHash)
+			bus.SafeCall(s.Context, tx, "ack tx bus", func() error { return mq.Ack(context.Background(), tx) })
+			continue
+		}
 
-			if strings.Contains(err.Error(), "side chain") && strings.Contains(err.Error(), "not registered") {
-				log.Warn("Submit src tx to poly error", "chain", s.name, "err", err, "proof_height", tx.SrcProofHeight)
-				continue
-			}
+		if errors.Is(err, msg.ERR_Tx_VERIFYMERKLEPROOF) {
+			log.Warn("src tx submit to poly verifyMerkleProof failed, clear src proof", "chain", s.name, "src hash", tx.SrcHash, "err", err)
+			tx.SrcProofHex = ""
+			tx.SrcProof = []byte{}
+		}
 
-			block = height + 10
-			tx.Attempts++
-			log.Error("Submit src tx to poly error", "chain", s.name, "err", err, "proof_height", tx.SrcProofHeight, "next_try", block)
-			bus.SafeCall(s.Context, tx, "push back to tx bus", func() error { return mq.Push(context.Background(), tx, block) })
-		} else {
-			bus.SafeCall(s.Context, tx, "push back to tx bus", func() error { return mq.Push(context.Background(), tx, block) })
-			time.Sleep(200 * time.Millisecond)
+		if strings.Contains(err.Error(), "side chain") && strings.Contains(err.Error(), "not registered") {
+			log.Warn("Submit src tx to poly error", "chain", s.name, "err", err, "proof_height", tx.SrcProofHeight)
+			bus.SafeCall(s.Context, tx, "ack tx bus", func() error { return mq.Ack(context.Background(), tx) })
+			continue
 		}
+
+		block := height + 10
+		tx.Fail(err)
+		log.Error("Submit src tx to poly error", "chain", s.name, "err", err, "proof_height", tx.SrcProofHeight, "next_try", block)
+		bus.SafeCall(s.Context, tx, "requeue tx bus", func() error { return mq.Requeue(context.Background(), tx, block) })
 	}
 }
 
 func (s *Submitter) run(mq bus.TxBus) error {
-	s.wg.Add(1)
 	defer s.wg.Done()
+	defer bus.Guard(s.Context, "poly submitter")
 	ticker := time.NewTicker(800 * time.Millisecond)
 	defer ticker.Stop()
 
@@ -414,7 +420,7 @@ func (s *Submitter) run(mq bus.TxBus) error {
 			err = s.submit(tx)
 			if err != nil {
 				log.Error("Submit src tx to poly error", "chain", s.name, "err", err, "proof_height", tx.SrcProofHeight)
-				tx.Attempts++
+				tx.Fail(err)
 				if errors.Is(err, msg.ERR_Tx_VERIFYMERKLEPROOF) {
 					log.Warn("src tx submit to poly verifyMerkleProof failed, clear src proof", "chain", s.name, "src hash", tx.SrcHash, "err", err)
 					tx.SrcProofHex = ""
@@ -444,12 +450,14 @@ func (s *Submitter) Start(ctx context.Context, wg *sync.WaitGroup, mq bus.Sorted
 	s.composer = composer
 	s.Context = ctx
 	s.wg = wg
+	s.skip = bus.NewSkipCheck(config.Current().Bus)
 
 	if s.config.Procs == 0 {
 		s.config.Procs = 1
 	}
 	for i := 0; i < s.config.Procs; i++ {
 		log.Info("Starting poly submitter worker", "index", i, "procs", s.config.Procs, "chain", s.name, "topic", mq.Topic())
+		s.wg.Add(1)
 		go s.consume(mq)
 	}
 	return nil
@@ -479,6 +487,7 @@ func (s *Submitter) StartSync(
 	}
 
 	ch = make(chan msg.Header, s.sync.Buffer)
+	s.wg.Add(1)
 	go s.startSync(ch, reset)
 	return
 }
@@ -532,7 +541,7 @@ func (s *Submitter) syncHeaderLoop(ch <-chan msg.Header, reset chan<- uint64) {
 				headers = nil
 			}
 			err := s.SubmitHeadersWithLoop(s.sync.ChainId, headers, &header)
-			if err != nil {
+			if err != nil && s.Err() == nil {
 				reset <- header.Height - 2
 			}
 		}
@@ -579,24 +588,34 @@ COMMIT:
 			commit = false
 			// NOTE err reponse here will revert header sync with delta -100
 			err := s.SubmitHeadersWithLoop(s.sync.ChainId, headers, hdr)
-			if err != nil {
+			if err != nil && s.Err() == nil {
 				reset <- height - uint64(len(headers)) - 2
 			}
 			headers = [][]byte{}
 		}
 	}
 	if len(headers) > 0 {
-		s.SubmitHeadersWithLoop(s.sync.ChainId, headers, hdr)
+		// Headers not submitted yet will be synced again from the height mark
+		log.Info("Header sync dropping pending headers", "chain", s.sync.ChainId, "size", len(headers), "height", height)
 	}
 }
 
 func (s *Submitter) startSync(ch <-chan msg.Header, reset chan<- uint64) {
+	defer s.wg.Done()
+	defer bus.Guard(s.Context, "header submitter")
 	if s.sync.Batch == 1 {
 		s.syncHeaderLoop(ch, reset)
 	} else {
 		s.syncHeaderBatchLoop(ch, reset)
 	}
-	log.Info("Header sync exiting loop now")
+	// Flush the header sync mark, which is only written periodically
+	if s.lastCommit > 0 {
+		err := s.state.UpdateHeight(context.Background(), s.lastCommit)
+		if err != nil {
+			log.Error("Failed to flush header sync height", "chain", s.sync.ChainId, "height", s.lastCommit, "err", err)
+		}
+	}
+	log.Info("Header sync exiting loop now", "chain", s.sync.ChainId, "height", s.lastCommit)
 }
 
 func (s *Submitter) Poly() *poly.SDK {
@@ -0,0 +1,384 @@
+/*
+ * Copyright (C) 2021 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package relayer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/polynetwork/bridge-common/base"
+	"github.com/polynetwork/bridge-common/log"
+	"github.com/polynetwork/bridge-common/util"
+	"github.com/polynetwork/poly-relayer/bus"
+	"github.com/polynetwork/poly-relayer/config"
+	"github.com/polynetwork/poly-relayer/msg"
+)
+
+// Rewrite the queued txs with the current envelope version
+func BusMigrate(ctx *cli.Context) (err error) {
+	if ctx.Bool("keys") {
+		moved, err := bus.MigrateKeys(context.Background(), config.Current().Bus)
+		fmt.Printf("Moved %v bus keys to the key layout of the config:\n", len(moved))
+		for _, key := range moved {
+			fmt.Printf("  %s\n", key)
+		}
+		return err
+	}
+	chains := base.CHAINS
+	if chain := ctx.Uint64("chain"); chain != 0 {
+		chains = []uint64{chain}
+	}
+	stats, err := bus.MigrateTxs(context.Background(), config.Current().Bus, chains)
+	fmt.Printf("Migrating queued txs to version %v:\n", msg.TX_VERSION)
+	for _, s := range stats {
+		fmt.Printf("  %s total: %v migrated: %v failed: %v\n", s.Key, s.Total, s.Migrated, s.Failed)
+	}
+	return
+}
+
+func adminQueue(ctx *cli.Context) (admin bus.QueueAdmin, q bus.Queue, err error) {
+	ty, err := parseTxType(ctx.String("type"))
+	if err != nil {
+		return
+	}
+	q, err = bus.NewQueue(ctx.String("queue"), ctx.Uint64("chain"), ty, bus.HashTag(config.Current().Bus))
+	if err != nil {
+		return
+	}
+	admin = bus.NewQueueAdmin(config.Current().Bus)
+	return
+}
+
+func printEntry(e *bus.QueueEntry) {
+	line := fmt.Sprintf("  #%v", e.Index)
+	if e.Field != "" {
+		line += fmt.Sprintf(" field: %s", e.Field)
+	}
+	if e.Score != 0 {
+		line += fmt.Sprintf(" score: %v", int64(e.Score))
+	}
+	if e.Tx == nil {
+		line += fmt.Sprintf(" value: %s", e.Value)
+	} else {
+		line += fmt.Sprintf(" src: %s poly: %s dst: %s attempts: %v", e.Tx.SrcHash, e.Tx.PolyHash, e.Tx.DstHash, e.Tx.Attempts)
+	}
+	fmt.Println(line)
+}
+
+func QueueList(ctx *cli.Context) (err error) {
+	admin, q, err := adminQueue(ctx)
+	if err != nil {
+		return
+	}
+	size, err := admin.Len(context.Background(), q)
+	if err != nil {
+		return
+	}
+	entries, err := admin.Range(context.Background(), q, ctx.Int("offset"), ctx.Int("limit"))
+	if err != nil {
+		return
+	}
+	fmt.Printf("Queue %s, size %v:\n", q.Key, size)
+	for _, e := range entries {
+		printEntry(e)
+	}
+	return
+}
+
+func QueuePeek(ctx *cli.Context) (err error) {
+	admin, q, err := adminQueue(ctx)
+	if err != nil {
+		return
+	}
+	entries, err := admin.Range(context.Background(), q, ctx.Int("offset"), ctx.Int("limit"))
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		fmt.Printf("Queue %s entry #%v:\n", q.Key, e.Index)
+		fmt.Println(util.Verbose(e))
+	}
+	return
+}
+
+// Search the queue for the hash, all the queues of the chain are searched when queue is unspecified
+func QueueSearch(ctx *cli.Context) (err error) {
+	hash := ctx.String("hash")
+	var queues []bus.Queue
+	if ctx.String("queue") == "" {
+		chains := base.CHAINS
+		if chain := ctx.Uint64("chain"); chain != 0 {
+			chains = []uint64{chain}
+		}
+		hashTag := bus.HashTag(config.Current().Bus)
+		skip, _ := bus.NewQueue(bus.QUEUE_SKIP, 0, 0, hashTag)
+		queues = append(bus.TxQueues(chains, hashTag), skip)
+	} else {
+		_, q, err := adminQueue(ctx)
+		if err != nil {
+			return err
+		}
+		queues = append(queues, q)
+	}
+	admin := bus.NewQueueAdmin(config.Current().Bus)
+	count := 0
+	for _, q := range queues {
+		entries, err := admin.Range(context.Background(), q, 0, 0)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if e.Match(hash) {
+				count++
+				fmt.Printf("Queue %s:\n", q.Key)
+				printEntry(e)
+			}
+		}
+	}
+	fmt.Printf("Found %v entries of hash %s\n", count, hash)
+	return
+}
+
+// Select the entry at the index, or the entries matching the hash
+func selectEntries(ctx *cli.Context, admin bus.QueueAdmin, q bus.Queue) (entries []*bus.QueueEntry, err error) {
+	if ctx.IsSet("index") {
+		return admin.Range(context.Background(), q, ctx.Int("index"), 1)
+	}
+	hash := ctx.String("hash")
+	all := ctx.Bool("all")
+	if hash == "" && !all {
+		return nil, fmt.Errorf("Either index, hash or all should be specified to select the queue entries")
+	}
+	list, err := admin.Range(context.Background(), q, 0, 0)
+	if err != nil {
+		return
+	}
+	for _, e := range list {
+		if all || e.Match(hash) {
+			entries = append(entries, e)
+		}
+	}
+	return
+}
+
+// Remove one entry from the queue
+func QueueRemove(ctx *cli.Context) (err error) {
+	admin, q, err := adminQueue(ctx)
+	if err != nil {
+		return
+	}
+	if ctx.Bool("all") {
+		return fmt.Errorf("Only one entry can be removed at a time")
+	}
+	entries, err := selectEntries(ctx, admin, q)
+	if err != nil {
+		return
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("No entry selected in queue %s", q.Key)
+	}
+	if len(entries) > 1 {
+		return fmt.Errorf("Multiple entries matched in queue %s, specify the index instead", q.Key)
+	}
+	ok, err := admin.Remove(context.Background(), q, entries[0])
+	if err != nil {
+		return
+	}
+	if !ok {
+		return fmt.Errorf("Entry #%v was changed in queue %s", entries[0].Index, q.Key)
+	}
+	log.Info("Removed queue entry", "queue", q.Key, "index", entries[0].Index)
+	return
+}
+
+// Score of the entry in the target sorted queue: src height for sorted queue, due time for delayed queue
+func targetScore(ctx *cli.Context, q bus.Queue, e *bus.QueueEntry) float64 {
+	if ctx.IsSet("score") {
+		return ctx.Float64("score")
+	}
+	if ctx.IsSet("delay") {
+		return float64(time.Now().Unix() + ctx.Int64("delay"))
+	}
+	if q.Name == bus.QUEUE_SORTED && e.Tx != nil {
+		if e.Tx.SrcProofHeight > 0 {
+			return float64(e.Tx.SrcProofHeight)
+		}
+		return float64(e.Tx.SrcHeight)
+	}
+	if q.Name == bus.QUEUE_DELAYED || q.Name == bus.QUEUE_LEGACY_DELAYED {
+		return float64(time.Now().Unix())
+	}
+	return e.Score
+}
+
+// Move the selected entries to the target queue, the entries are added to the target before removed
+func QueueMove(ctx *cli.Context) (err error) {
+	admin, q, err := adminQueue(ctx)
+	if err != nil {
+		return
+	}
+	chain := ctx.Uint64("chain")
+	if ctx.IsSet("to-chain") {
+		chain = ctx.Uint64("to-chain")
+	}
+	tyName := ctx.String("type")
+	if ctx.IsSet("to-type") {
+		tyName = ctx.String("to-type")
+	}
+	ty, err := parseTxType(tyName)
+	if err != nil {
+		return
+	}
+	target, err := bus.NewQueue(ctx.String("to"), chain, ty, bus.HashTag(config.Current().Bus))
+	if err != nil {
+		return
+	}
+	if target.Key == q.Key {
+		return fmt.Errorf("Target queue is the same as the source queue %s", q.Key)
+	}
+	if target.Raw != q.Raw {
+		return fmt.Errorf("Entries of queue %s can not be moved to queue %s", q.Key, target.Key)
+	}
+	entries, err := selectEntries(ctx, admin, q)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if target.Kind == bus.QUEUE_HASH && e.Tx == nil && e.Field == "" {
+			return fmt.Errorf("Entry #%v of queue %s can not be decoded to move to %s", e.Index, q.Key, target.Key)
+		}
+		moved := *e
+		moved.Score = targetScore(ctx, target, e)
+		if target.Kind != bus.QUEUE_HASH {
+			moved.Field = ""
+		}
+		err = admin.Add(context.Background(), target, &moved)
+		if err != nil {
+			return
+		}
+		_, err = admin.Remove(context.Background(), q, e)
+		if err != nil {
+			return
+		}
+		log.Info("Moved queue entry", "from", q.Key, "to", target.Key, "index", e.Index)
+	}
+	fmt.Printf("Moved %v entries from %s to %s\n", len(entries), q.Key, target.Key)
+	return
+}
+
+// Re-score the selected entries of the sorted or delayed queue
+func QueueRescore(ctx *cli.Context) (err error) {
+	admin, q, err := adminQueue(ctx)
+	if err != nil {
+		return
+	}
+	if q.Kind != bus.QUEUE_ZSET {
+		return fmt.Errorf("Queue %s is not sorted", q.Key)
+	}
+	if !ctx.IsSet("score") && !ctx.IsSet("delay") {
+		return fmt.Errorf("Either score or delay should be specified")
+	}
+	entries, err := selectEntries(ctx, admin, q)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		score := targetScore(ctx, q, e)
+		ok, err := admin.Rescore(context.Background(), q, e, score)
+		if err != nil {
+			return err
+		}
+		if ok {
+			log.Info("Rescored queue entry", "queue", q.Key, "index", e.Index, "score", int64(score))
+		}
+	}
+	return
+}
+
+// Export the queue entries as json lines, txs are exported in json regardless of the bus codec
+func QueueExport(ctx *cli.Context) (err error) {
+	admin, q, err := adminQueue(ctx)
+	if err != nil {
+		return
+	}
+	entries, err := admin.Range(context.Background(), q, 0, 0)
+	if err != nil {
+		return
+	}
+	var w io.Writer = os.Stdout
+	if path := ctx.String("file"); path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("Failed to create export file %v", err)
+		}
+		defer f.Close()
+		w = f
+	}
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		err = enc.Encode(e)
+		if err != nil {
+			return
+		}
+	}
+	log.Info("Exported queue entries", "queue", q.Key, "count", len(entries))
+	return
+}
+
+// Import the json lines exported by queue export
+func QueueImport(ctx *cli.Context) (err error) {
+	admin, q, err := adminQueue(ctx)
+	if err != nil {
+		return
+	}
+	f, err := os.Open(ctx.String("file"))
+	if err != nil {
+		return fmt.Errorf("Failed to open import file %v", err)
+	}
+	defer f.Close()
+	var entries []*bus.QueueEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1<<20), 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		e := new(bus.QueueEntry)
+		err = json.Unmarshal(scanner.Bytes(), e)
+		if err != nil {
+			return fmt.Errorf("Failed to parse import file line %v %v", line, err)
+		}
+		entries = append(entries, e)
+	}
+	if err = scanner.Err(); err != nil {
+		return fmt.Errorf("Failed to read import file %v", err)
+	}
+	err = admin.Add(context.Background(), q, entries...)
+	if err != nil {
+		return
+	}
+	log.Info("Imported queue entries", "queue", q.Key, "count", len(entries))
+	return
+}
@@ -57,12 +57,26 @@ type IChainListener interface {
 }
 
 type Handler interface {
-	Init(context.Context, *sync.WaitGroup) error
+	Init(context.Context) error
 	Chain() uint64
 	Start() error
 	Stop() error
 }
 
+// NodesUpdater switches the chain nodes without a restart, implemented by the handlers and listeners able to
+type NodesUpdater interface {
+	UpdateNodes([]string) error
+}
+
+// Switch the listener to the new nodes if supported
+func updateNodes(listener IChainListener, nodes []string) error {
+	updater, ok := listener.(NodesUpdater)
+	if !ok {
+		return fmt.Errorf("Listener of chain %d does not support node updates", listener.ChainId())
+	}
+	return updater.UpdateNodes(nodes)
+}
+
 type IChainSubmitter interface {
 	Init(*config.SubmitterConfig) error
 	Submit(msg.Message) error
@@ -119,13 +133,13 @@ func GetSubmitter(chain uint64) (submitter IChainSubmitter) {
 
 func PolySubmitter() (sub *po.Submitter, err error) {
 	sub = new(po.Submitter)
-	err = sub.Init(&config.CONFIG.Poly.PolySubmitterConfig)
+	err = sub.Init(&config.Current().Poly.PolySubmitterConfig)
 	return
 }
 
 func PolyListener() (l *po.Listener, err error) {
 	l = new(po.Listener)
-	err = l.Init(config.CONFIG.Poly.PolyTxSync.ListenerConfig, nil)
+	err = l.Init(config.Current().Poly.PolyTxSync.ListenerConfig, nil)
 	return
 }
 
@@ -149,7 +163,7 @@ func DstSubmitter(chain uint64) (sub IChainSubmitter, err error) {
 		err = fmt.Errorf("No submitter for chain %d available", chain)
 		return
 	}
-	conf := config.CONFIG.Chains[chain]
+	conf := config.Current().Chains[chain]
 	if conf == nil || conf.PolyTxCommit == nil {
 		return nil, fmt.Errorf("No config available for submitter of chain %d", chain)
 	}
@@ -163,7 +177,7 @@ func ChainSubmitter(chain uint64) (sub IChainSubmitter, err error) {
 		err = fmt.Errorf("No submitter for chain %d available", chain)
 		return
 	}
-	conf := config.CONFIG.Chains[chain]
+	conf := config.Current().Chains[chain]
 	if conf == nil || conf.PolyTxCommit == nil {
 		return nil, fmt.Errorf("No config available for submitter of chain %d", chain)
 	}
@@ -177,7 +191,7 @@ func ChainListener(chain uint64, poly *poly.SDK) (l IChainListener, err error) {
 		err = fmt.Errorf("No listener for chain %d available", chain)
 		return
 	}
-	conf := config.CONFIG.Chains[chain]
+	conf := config.Current().Chains[chain]
 	if conf == nil || conf.SrcTxSync == nil {
 		return nil, fmt.Errorf("No config available for listener of chain %d", chain)
 	}
@@ -187,5 +201,5 @@ func ChainListener(chain uint64, poly *poly.SDK) (l IChainListener, err error) {
 }
 
 func Bridge() (sdk *bridge.SDK, err error) {
-	return bridge.WithOptions(0, config.CONFIG.Bridge, time.Minute, 100)
+	return bridge.WithOptions(0, config.Current().Bridge, time.Minute, 100)
 }
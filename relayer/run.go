@@ -19,81 +19,346 @@ package relayer
 
 import (
 	"context"
+	"fmt"
 	"reflect"
 	"sync"
 	"time"
 
 	"github.com/polynetwork/bridge-common/base"
 	"github.com/polynetwork/bridge-common/log"
+	"github.com/polynetwork/poly-relayer/bus"
 	"github.com/polynetwork/poly-relayer/config"
 )
 
+const (
+	DEFAULT_SHUTDOWN_TIMEOUT = 30 * time.Second
+	ROLE_STATUS_INTERVAL     = 10 * time.Second
+)
+
 type Server struct {
-	ctx    context.Context
-	wg     *sync.WaitGroup
-	config *config.Config
-	roles  []Handler
+	ctx      context.Context
+	wg       *sync.WaitGroup
+	config   *config.Config
+	roles    []*Supervisor
+	store    bus.RoleStatusStore
+	reloads  uint64     // Config reload requests handled
+	mu       sync.Mutex // Serializes the role state changes
+	stopping bool
 }
 
-func Start(ctx context.Context, wg *sync.WaitGroup, config *config.Config) error {
-	server := &Server{ctx, wg, config, nil}
-	return server.Start()
+func Start(ctx context.Context, wg *sync.WaitGroup, config *config.Config) (*Server, error) {
+	server := &Server{ctx: ctx, wg: wg, config: config}
+	return server, server.Start()
 }
 
 func (s *Server) Start() (err error) {
-	// Create poly tx sync handler
-	if s.config.Active(base.POLY) && s.config.Poly != nil {
-		s.parseHandlers(base.POLY, s.config.Poly.PolyTxSync)
+	// Create the role supervisors
+	for _, role := range roleConfigs(s.config) {
+		s.roles = append(s.roles, s.supervisor(role))
 	}
 
-	// Create handlers
-	for id, chain := range s.config.Chains {
-		if s.config.Active(id) {
-			s.parseHandlers(id, chain.HeaderSync, chain.SrcTxSync, chain.SrcTxCommit, chain.PolyTxCommit)
+	// Apply the role controls persisted in the bus
+	var controls []*bus.RoleControl
+	if s.config.Bus != nil {
+		s.store = bus.NewRoleStatusStore(s.config.Bus)
+		controls, err = s.store.RoleControls(context.Background())
+		if err != nil {
+			return
+		}
+		s.reloads, err = s.store.ReloadRequests(context.Background())
+		if err != nil {
+			return
+		}
+	}
+	roles := []*Supervisor{}
+	for _, role := range s.roles {
+		state := role.Desired(controls)
+		if state == bus.ROLE_STATE_RUNNING {
+			roles = append(roles, role)
+		} else {
+			log.Info("Role is not started", "role", role.Role(), "chain", role.Chain(), "state", state)
+			role.setState(state, nil)
 		}
 	}
 
 	// Initialize
-	for i, handler := range s.roles {
-		log.Info("Initializing role", "index", i, "total", len(s.roles), "type", reflect.TypeOf(handler), "chain", handler.Chain())
-		err = handler.Init(s.ctx, s.wg)
+	for i, handler := range roles {
+		log.Info("Initializing role", "index", i, "total", len(roles), "role", handler.Role(), "chain", handler.Chain())
+		err = handler.Init(s.ctx)
 		if err != nil {
 			return
 		}
 	}
 
 	// Start the roles
-	for i, handler := range s.roles {
-		log.Info("Starting role", "index", i, "total", len(s.roles), "type", reflect.TypeOf(handler), "chain", handler.Chain())
+	for i, handler := range roles {
+		log.Info("Starting role", "index", i, "total", len(roles), "role", handler.Role(), "chain", handler.Chain())
 		err = handler.Start()
 		if err != nil {
 			return
 		}
 	}
+
+	if s.store != nil {
+		s.wg.Add(1)
+		go s.syncRoles()
+	}
 	return
 }
 
-func (s *Server) parseHandlers(chain uint64, confs ...interface{}) {
-	for _, conf := range confs {
-		handler := s.parseHandler(chain, conf)
-		if handler != nil {
-			s.roles = append(s.roles, handler)
+// Roles returns the status of the roles of this instance
+func (s *Server) Roles() (list []*bus.RoleStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	instance := s.config.Bus.Consumer
+	if instance == "" {
+		instance = bus.ConsumerName()
+	}
+	now := time.Now().Unix()
+	for _, role := range s.roles {
+		status := role.Status()
+		status.Instance = instance
+		status.Updated = now
+		list = append(list, &status)
+	}
+	return
+}
+
+// Apply the role controls changed at runtime and the config reload requests, and report the role status
+// to the bus periodically for the status command and the http api
+func (s *Server) syncRoles() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(ROLE_STATUS_INTERVAL)
+	defer ticker.Stop()
+	for {
+		err := s.store.ReportRoles(context.Background(), s.Roles())
+		if err != nil {
+			log.Error("Failed to report role status", "err", err)
+		}
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		reloads, err := s.store.ReloadRequests(context.Background())
+		if err != nil {
+			log.Error("Failed to fetch config reload requests", "err", err)
+		} else if reloads > s.reloads {
+			s.reloads = reloads
+			log.Info("Reloading config per request", "requests", reloads)
+			err = s.Reload()
+			if err != nil {
+				log.Error("Failed to reload config", "err", err)
+			}
+		}
+		controls, err := s.store.RoleControls(context.Background())
+		if err != nil {
+			log.Error("Failed to fetch role controls", "err", err)
+		} else {
+			s.mu.Lock()
+			if !s.stopping {
+				s.applyControls(controls)
+			}
+			s.mu.Unlock()
 		}
 	}
 }
 
-func (s *Server) parseHandler(chain uint64, conf interface{}) (handler Handler) {
-	if reflect.ValueOf(conf).IsZero() || !reflect.ValueOf(conf).Elem().FieldByName("Enabled").Interface().(bool) {
+// Reload the config and roles files. Data level settings are updated in place, roles with other config
+// changes are restarted, and roles added or removed in the roles file are started or stopped.
+func (s *Server) Reload() (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopping {
+		return fmt.Errorf("Relayer is stopping")
+	}
+	conf, err := s.config.Reload()
+	if err != nil {
 		return
 	}
+	var controls []*bus.RoleControl
+	if s.store != nil {
+		controls, err = s.store.RoleControls(context.Background())
+		if err != nil {
+			return
+		}
+	}
+
+	confs := map[string]*roleConfig{}
+	for _, c := range roleConfigs(conf) {
+		confs[fmt.Sprintf("%s/%d", c.role, c.chain)] = c
+	}
+	roles := []*Supervisor{}
+	for _, role := range s.roles {
+		key := fmt.Sprintf("%s/%d", role.Role(), role.Chain())
+		c, ok := confs[key]
+		if !ok {
+			log.Info("Removing role for config reload", "role", role.Role(), "chain", role.Chain())
+			if role.active {
+				role.Stop()
+			}
+			continue
+		}
+		delete(confs, key)
+		e := role.Update(s.ctx, c.conf, c.enabled)
+		if e != nil {
+			log.Error("Failed to apply role config", "role", role.Role(), "chain", role.Chain(), "err", e)
+		}
+		roles = append(roles, role)
+	}
+	for _, c := range confs {
+		log.Info("Adding role for config reload", "role", c.role, "chain", c.chain)
+		roles = append(roles, s.supervisor(c))
+	}
+	s.roles = roles
+	s.config = conf
+	config.Use(conf)
+	s.applyControls(controls)
+	log.Info("Config reloaded", "roles", len(s.roles))
+	return
+}
+
+// Start or stop the roles per the role controls and the roles file
+func (s *Server) applyControls(controls []*bus.RoleControl) {
+	for _, role := range s.roles {
+		state := role.Desired(controls)
+		switch {
+		case state == bus.ROLE_STATE_RUNNING && !role.active:
+			log.Info("Starting role per role control", "role", role.Role(), "chain", role.Chain())
+			err := role.Resume(s.ctx)
+			if err != nil {
+				log.Error("Failed to start role", "role", role.Role(), "chain", role.Chain(), "err", err)
+			}
+		case state != bus.ROLE_STATE_RUNNING && role.active:
+			log.Info("Stopping role per role control", "role", role.Role(), "chain", role.Chain(), "state", state)
+			err := role.Suspend(state)
+			if err != nil {
+				log.Error("Failed to stop role", "role", role.Role(), "chain", role.Chain(), "err", err)
+			}
+		case !role.active:
+			role.setState(state, nil)
+		}
+	}
+}
+
+// Stop the started roles in reverse start order and wait for their goroutines, gives up when the shutdown timeout
+// is exceeded. The roles run outside of the process wait group, which covers the role status sync only.
+func (s *Server) Stop() (err error) {
+	timeout := time.Duration(s.config.ShutdownTimeout) * time.Second
+	if timeout == 0 {
+		timeout = DEFAULT_SHUTDOWN_TIMEOUT
+	}
+	deadline := time.After(timeout)
+
+	// Wait for the role state changes in progress
+	locked := make(chan struct{})
+	go func() {
+		s.mu.Lock()
+		s.stopping = true
+		s.mu.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-deadline:
+		return fmt.Errorf("Roles stop timeout after %v, role state change in progress", timeout)
+	}
+
+	for i := len(s.roles) - 1; i >= 0; i-- {
+		handler := s.roles[i]
+		if !handler.active {
+			continue
+		}
+		log.Info("Stopping role", "index", i, "total", len(s.roles), "role", handler.Role(), "chain", handler.Chain())
+		done := make(chan error, 1)
+		go func() { done <- handler.Stop() }()
+		select {
+		case e := <-done:
+			if e != nil {
+				log.Error("Failed to stop role", "index", i, "role", handler.Role(), "chain", handler.Chain(), "err", e)
+			}
+		case <-deadline:
+			return fmt.Errorf("Roles stop timeout after %v, %d roles not stopped", timeout, i+1)
+		}
+	}
+	return
+}
+
+type roleConfig struct {
+	role    string
+	chain   uint64
+	conf    interface{}
+	enabled bool
+}
+
+// List the configured roles of the active chains
+func roleConfigs(c *config.Config) (list []*roleConfig) {
+	add := func(chain uint64, confs ...interface{}) {
+		for _, conf := range confs {
+			if configured(chain, conf) {
+				enabled := reflect.ValueOf(conf).Elem().FieldByName("Enabled").Interface().(bool)
+				list = append(list, &roleConfig{roleName(conf), chain, conf, enabled})
+			}
+		}
+	}
+
+	if c.Active(base.POLY) && c.Poly != nil {
+		add(base.POLY, c.Poly.PolyTxSync)
+	}
+	for id, chain := range c.Chains {
+		if c.Active(id) {
+			add(id, chain.HeaderSync, chain.SrcTxSync, chain.SrcTxCommit, chain.PolyTxCommit)
+		}
+	}
+	return
+}
+
+func (s *Server) supervisor(c *roleConfig) *Supervisor {
+	chain := c.chain
+	return NewSupervisor(c.role, chain, c.conf, c.enabled, s.config.MaxRoleFailures, func(conf interface{}) Handler {
+		return s.parseHandler(chain, conf)
+	})
+}
+
+func roleName(conf interface{}) string {
+	switch conf.(type) {
+	case *config.HeaderSyncConfig:
+		return config.ROLE_HEADER_SYNC
+	case *config.SrcTxSyncConfig:
+		return config.ROLE_TX_LISTEN
+	case *config.SrcTxCommitConfig:
+		return config.ROLE_TX_COMMIT
+	case *config.PolyTxSyncConfig:
+		return config.ROLE_POLY_LISTEN
+	case *config.PolyTxCommitConfig:
+		return config.ROLE_POLY_COMMIT
+	}
+	return reflect.TypeOf(conf).String()
+}
+
+// Check whether the role config is present and the role is supported on the chain
+func configured(chain uint64, conf interface{}) bool {
+	if reflect.ValueOf(conf).IsZero() {
+		return false
+	}
 	switch chain {
 	case base.OK, base.MATIC, base.HEIMDALL:
-		return nil
+		return false
+	}
+	return true
+}
+
+func (s *Server) parseHandler(chain uint64, conf interface{}) (handler Handler) {
+	if !configured(chain, conf) {
+		return
 	}
 
 	switch c := conf.(type) {
 	case *config.HeaderSyncConfig:
 		handler = NewHeaderSyncHandler(c)
+		if c.Leader {
+			handler = NewSingletonHandler(handler, c.Bus, bus.ChainRole(bus.ROLE_HEADER_SYNC, chain))
+		}
 	case *config.SrcTxSyncConfig:
 		handler = NewSrcTxSyncHandler(c)
 	case *config.SrcTxCommitConfig:
@@ -73,7 +73,7 @@ func GetSideChain(chainID uint64) ISideChain {
 }
 
 func GetPolyWallets() (accounts []*poly_go_sdk.Account, err error) {
-	err = filepath.Walk(config.CONFIG.Poly.ExtraWallets.Path,
+	err = filepath.Walk(config.Current().Poly.ExtraWallets.Path,
 		func(path string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
@@ -82,7 +82,7 @@ func GetPolyWallets() (accounts []*poly_go_sdk.Account, err error) {
 				return nil
 			}
 			log.Info("Loading wallet file", "path", path)
-			c := *config.CONFIG.Poly.ExtraWallets
+			c := *config.Current().Poly.ExtraWallets
 			c.Path = path
 			account, err := wallet.NewPolySigner(&c)
 			if err != nil {
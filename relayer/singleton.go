@@ -0,0 +1,110 @@
+/*
+ * Copyright (C) 2021 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package relayer
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/polynetwork/bridge-common/log"
+	"github.com/polynetwork/poly-relayer/bus"
+	"github.com/polynetwork/poly-relayer/config"
+)
+
+// SingletonHandler runs the wrapped handler only while holding the leadership of the role. The handler
+// is initialized and started with the term context on each election, and stopped once the term ends.
+type SingletonHandler struct {
+	Handler
+	Worker
+	leader *bus.Leader
+}
+
+func NewSingletonHandler(handler Handler, conf *config.BusConfig, role string) *SingletonHandler {
+	return &SingletonHandler{Handler: handler, leader: bus.NewLeader(conf, role)}
+}
+
+func (h *SingletonHandler) Init(ctx context.Context) (err error) {
+	h.init(ctx)
+	return
+}
+
+func (h *SingletonHandler) Start() (err error) {
+	h.wg.Add(1)
+	go h.run()
+	return
+}
+
+// Stop the wrapped handler if leading, and stop campaigning
+func (h *SingletonHandler) Stop() (err error) {
+	h.stop()
+	return
+}
+
+func (h *SingletonHandler) run() {
+	defer h.wg.Done()
+	defer bus.Guard(h.Context, "singleton")
+	for {
+		term, err := h.leader.Campaign(h.Context, h.wg)
+		if err != nil {
+			return
+		}
+		log.Info("Starting singleton role", "role", h.leader.Role(), "type", reflect.TypeOf(h.Handler), "token", term.Token)
+		err = h.Handler.Init(term)
+		if err == nil {
+			err = h.Handler.Start()
+		}
+		if err != nil {
+			log.Error("Failed to start singleton role", "role", h.leader.Role(), "err", err)
+			h.leader.Resign()
+		} else {
+			<-term.Done()
+			h.Handler.Stop()
+		}
+
+		select {
+		case <-h.Done():
+			return
+		case <-time.After(time.Second):
+			log.Warn("Singleton role stopped, standing by", "role", h.leader.Role(), "token", term.Token)
+		}
+	}
+}
+
+// Run the function while holding the leadership of the role, blocks until the context is canceled
+// or the leadership is lost.
+func runAsLeader(ctx context.Context, conf *config.BusConfig, role string, f func(context.Context) error) error {
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+	leader := bus.NewLeader(conf, role)
+	term, err := leader.Campaign(ctx, wg)
+	if err != nil {
+		return err
+	}
+	err = f(term)
+	if err != nil {
+		leader.Resign()
+		return err
+	}
+	<-term.Done()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return bus.ErrLeadershipLost
+}
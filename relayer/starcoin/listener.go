@@ -61,8 +61,8 @@ func (l *Listener) Init(config *config.ListenerConfig, poly *poly.SDK) (err erro
 	l.GetProofHeight = l.getProofHeight
 	l.GetProof = l.getProof
 	l.sdk, err = starcoin.WithOptions(config.ChainId, config.Nodes, time.Minute, 1)
-	l.state = bus.NewRedisChainStore(
-		bus.ChainHeightKey{ChainId: config.ChainId, Type: bus.KEY_HEIGHT_HEADER}, bus.New(config.Bus.Redis),
+	l.state = bus.NewChainStore(
+		config.Bus, bus.ChainHeightKey{ChainId: config.ChainId, Type: bus.KEY_HEIGHT_HEADER},
 		config.Bus.HeightUpdateInterval,
 	)
 	return
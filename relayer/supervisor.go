@@ -0,0 +1,358 @@
+/*
+ * Copyright (C) 2021 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package relayer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/polynetwork/bridge-common/base"
+	"github.com/polynetwork/bridge-common/log"
+	"github.com/polynetwork/poly-relayer/bus"
+	"github.com/polynetwork/poly-relayer/config"
+)
+
+const (
+	DEFAULT_ROLE_MAX_FAILURES = 5
+	ROLE_BACKOFF_MIN          = time.Second
+	ROLE_BACKOFF_MAX          = 5 * time.Minute
+	ROLE_STABLE_PERIOD        = 10 * time.Minute // Consecutive failures are reset once the role runs longer than this
+
+	ROLE_ACTION_PAUSE  = "pause"
+	ROLE_ACTION_RESUME = "resume"
+	ROLE_ACTION_START  = "start"
+	ROLE_ACTION_STOP   = "stop"
+)
+
+type roleFailure struct {
+	generation int
+	err        error
+}
+
+// Supervisor runs a role and restarts it with exponential backoff when its goroutines panic or exit
+// early. The role is marked failed and left stopped after too many consecutive failures.
+type Supervisor struct {
+	Worker
+	create      func(conf interface{}) Handler
+	conf        interface{} // Role config
+	handler     Handler
+	enabled     bool // Enabled in the roles file
+	active      bool // Started and not stopped yet
+	generation  int
+	failures    chan roleFailure
+	maxFailures int
+	mu          sync.Mutex
+	status      bus.RoleStatus
+}
+
+func NewSupervisor(role string, chain uint64, conf interface{}, enabled bool, maxFailures int, create func(interface{}) Handler) *Supervisor {
+	if maxFailures <= 0 {
+		maxFailures = DEFAULT_ROLE_MAX_FAILURES
+	}
+	return &Supervisor{
+		create:      create,
+		conf:        conf,
+		enabled:     enabled,
+		failures:    make(chan roleFailure, 10),
+		maxFailures: maxFailures,
+		status:      bus.RoleStatus{Role: role, Chain: chain, State: bus.ROLE_STATE_STOPPED},
+	}
+}
+
+func (s *Supervisor) Chain() uint64 {
+	return s.status.Chain
+}
+
+func (s *Supervisor) Role() string {
+	return s.status.Role
+}
+
+// Status returns a copy of the role status
+func (s *Supervisor) Status() bus.RoleStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+func (s *Supervisor) setState(state string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status.State != state {
+		s.status.State = state
+		s.status.Since = time.Now().Unix()
+	}
+	if err != nil {
+		s.status.LastError = err.Error()
+	}
+}
+
+// Count the failure and returns the consecutive failures
+func (s *Supervisor) fail(err error) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status.State == bus.ROLE_STATE_RUNNING && time.Since(time.Unix(s.status.Since, 0)) > ROLE_STABLE_PERIOD {
+		s.status.Failures = 0
+	}
+	s.status.Failures++
+	s.status.LastError = err.Error()
+	return s.status.Failures
+}
+
+func (s *Supervisor) Init(ctx context.Context) (err error) {
+	s.init(ctx)
+	return s.initHandler()
+}
+
+// Create and initialize a new handler of the role, with the failures of its goroutines reported
+func (s *Supervisor) initHandler() (err error) {
+	s.generation++
+	generation := s.generation
+	report := func(err error) {
+		select {
+		case s.failures <- roleFailure{generation, err}:
+		default:
+		}
+	}
+	s.handler = s.create(s.conf)
+	return s.safe("init", func() error {
+		return s.handler.Init(bus.WithFailure(s.Context, report))
+	})
+}
+
+// Call the handler method with the panic recovered as an error
+func (s *Supervisor) safe(name string, f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s %s panic: %v", s.status.Role, name, r)
+		}
+	}()
+	return f()
+}
+
+func (s *Supervisor) Start() (err error) {
+	err = s.safe("start", s.handler.Start)
+	if err != nil {
+		return
+	}
+	s.active = true
+	s.setState(bus.ROLE_STATE_RUNNING, nil)
+	s.wg.Add(1)
+	go s.supervise()
+	return
+}
+
+// Stop supervising and stop the role
+func (s *Supervisor) Stop() (err error) {
+	s.stop()
+	if s.handler != nil {
+		err = s.safe("stop", s.handler.Stop)
+	}
+	s.active = false
+	s.setState(bus.ROLE_STATE_STOPPED, nil)
+	return
+}
+
+// Suspend stops the role and keeps it in the state until resumed
+func (s *Supervisor) Suspend(state string) (err error) {
+	err = s.Stop()
+	s.setState(state, nil)
+	return
+}
+
+// Resume starts the stopped role again with the failure count reset
+func (s *Supervisor) Resume(ctx context.Context) (err error) {
+	s.mu.Lock()
+	s.status.Failures = 0
+	s.mu.Unlock()
+	err = s.Init(ctx)
+	if err == nil {
+		err = s.Start()
+	}
+	if err != nil {
+		s.Stop()
+		s.setState(bus.ROLE_STATE_FAILED, err)
+	}
+	return
+}
+
+// Update applies the reloaded role config. Data level settings and listener nodes are updated in place,
+// while the role is restarted with the new config if running for the other changes, or when the nodes
+// can not be switched in place.
+func (s *Supervisor) Update(ctx context.Context, conf interface{}, enabled bool) (err error) {
+	s.enabled = enabled
+	if !config.RoleChanged(s.conf, conf) {
+		switch c := s.conf.(type) {
+		case *config.SrcTxCommitConfig:
+			c.Update(conf.(*config.SrcTxCommitConfig))
+		case *config.PolyTxCommitConfig:
+			c.Update(conf.(*config.PolyTxCommitConfig))
+		}
+		if !config.NodesChanged(s.conf, conf) {
+			return
+		}
+		err = s.updateNodes(config.ListenerNodes(conf))
+		if err == nil {
+			log.Info("Role nodes updated", "role", s.status.Role, "chain", s.status.Chain, "running", s.active)
+			return
+		}
+		log.Warn("Failed to update role nodes in place", "role", s.status.Role, "chain", s.status.Chain, "err", err)
+	}
+	log.Info("Role config changed", "role", s.status.Role, "chain", s.status.Chain, "running", s.active)
+	s.conf = conf
+	if s.active {
+		err = s.Stop()
+		if err != nil {
+			log.Error("Failed to stop role for config change", "role", s.status.Role, "chain", s.status.Chain, "err", err)
+		}
+		err = s.Resume(ctx)
+	}
+	return
+}
+
+// Switch the running handler to the new listener nodes, which are kept in the role config for the next start
+func (s *Supervisor) updateNodes(nodes []string) (err error) {
+	if s.active {
+		updater, ok := s.handler.(NodesUpdater)
+		if !ok {
+			return fmt.Errorf("Role %s does not support node updates", s.status.Role)
+		}
+		err = s.safe("update nodes", func() error { return updater.UpdateNodes(nodes) })
+		if err != nil {
+			return
+		}
+	}
+	if c, ok := s.conf.(interface{ SetNodes([]string) }); ok {
+		c.SetNodes(nodes)
+	}
+	return
+}
+
+// Desired returns the state of the role wanted by the role controls or the roles file
+func (s *Supervisor) Desired(controls []*bus.RoleControl) string {
+	for _, c := range controls {
+		if c.Role == s.status.Role && c.Chain == s.status.Chain {
+			return c.State
+		}
+	}
+	if s.enabled {
+		return bus.ROLE_STATE_RUNNING
+	}
+	return bus.ROLE_STATE_STOPPED
+}
+
+func (s *Supervisor) supervise() {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-s.Done():
+			return
+		case f := <-s.failures:
+			if f.generation == s.generation {
+				s.restart(f.err)
+			}
+		}
+	}
+}
+
+// Restart the role with backoff until it starts or is marked failed
+func (s *Supervisor) restart(err error) {
+	for err != nil {
+		failures := s.fail(err)
+		log.Error("Role failure detected", "role", s.status.Role, "chain", s.status.Chain, "failures", failures, "err", err)
+		e := s.safe("stop", s.handler.Stop)
+		if e != nil {
+			log.Error("Failed to stop the failed role", "role", s.status.Role, "chain", s.status.Chain, "err", e)
+		}
+		if failures >= s.maxFailures {
+			log.Error("Role marked as failed for too many failures", "role", s.status.Role, "chain", s.status.Chain, "failures", failures)
+			s.setState(bus.ROLE_STATE_FAILED, nil)
+			return
+		}
+
+		s.setState(bus.ROLE_STATE_RESTARTING, nil)
+		backoff := ROLE_BACKOFF_MIN << uint(failures-1)
+		if backoff > ROLE_BACKOFF_MAX {
+			backoff = ROLE_BACKOFF_MAX
+		}
+		log.Info("Restarting role", "role", s.status.Role, "chain", s.status.Chain, "backoff", backoff)
+		select {
+		case <-s.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		err = s.initHandler()
+		if err == nil {
+			err = s.safe("start", s.handler.Start)
+		}
+	}
+	s.mu.Lock()
+	s.status.Restarts++
+	s.mu.Unlock()
+	s.setState(bus.ROLE_STATE_RUNNING, nil)
+}
+
+// ControlRole persists the desired state of the role on the chain per the action. Paused roles are
+// resumed to follow the roles file again, while start and stop override the roles file until changed.
+func ControlRole(store bus.RoleStatusStore, action string, control *bus.RoleControl) (err error) {
+	switch control.Role {
+	case config.ROLE_POLY_LISTEN:
+		if control.Chain != base.POLY {
+			return fmt.Errorf("Role %s is only available on poly chain", control.Role)
+		}
+	case config.ROLE_HEADER_SYNC, config.ROLE_TX_LISTEN, config.ROLE_TX_COMMIT, config.ROLE_POLY_COMMIT:
+		if control.Chain == base.POLY || control.Chain == 0 {
+			return fmt.Errorf("Role %s is not available on chain %d", control.Role, control.Chain)
+		}
+	default:
+		return fmt.Errorf("Unknown role %s", control.Role)
+	}
+
+	ctx := context.Background()
+	switch action {
+	case ROLE_ACTION_PAUSE:
+		control.State = bus.ROLE_STATE_PAUSED
+	case ROLE_ACTION_START:
+		control.State = bus.ROLE_STATE_RUNNING
+	case ROLE_ACTION_STOP:
+		control.State = bus.ROLE_STATE_STOPPED
+	case ROLE_ACTION_RESUME:
+		controls, err := store.RoleControls(ctx)
+		if err != nil {
+			return err
+		}
+		paused := false
+		for _, c := range controls {
+			paused = paused || (c.Role == control.Role && c.Chain == control.Chain && c.State == bus.ROLE_STATE_PAUSED)
+		}
+		if !paused {
+			return fmt.Errorf("Role %s of chain %d is not paused", control.Role, control.Chain)
+		}
+		control.State = ""
+	default:
+		return fmt.Errorf("Unknown role action %s", action)
+	}
+	control.Updated = time.Now().Unix()
+	err = store.ControlRole(ctx, control)
+	if err == nil {
+		log.Info("Updated role control", "action", action, "role", control.Role, "chain", control.Chain, "operator", control.Operator, "reason", control.Reason)
+	}
+	return
+}
@@ -33,11 +33,12 @@ import (
 )
 
 type PolyTxCommitHandler struct {
-	context.Context
-	wg *sync.WaitGroup
+	Worker
 
 	bus       bus.TxBus
 	queue     bus.DelayedTxBus // Delayed tx bus
+	dlq       bus.DeadLetterBus
+	budget    bus.RetryBudget
 	submitter IChainSubmitter
 	composer  *poly.Submitter
 	config    *config.PolyTxCommitConfig
@@ -53,12 +54,11 @@ func NewPolyTxCommitHandler(config *config.PolyTxCommitConfig) *PolyTxCommitHand
 	}
 }
 
-func (h *PolyTxCommitHandler) Init(ctx context.Context, wg *sync.WaitGroup) (err error) {
-	h.Context = ctx
-	h.wg = wg
+func (h *PolyTxCommitHandler) Init(ctx context.Context) (err error) {
+	h.init(ctx)
 
-	if h.config.CheckFee {
-		h.bridge, err = bridge.WithOptions(0, config.CONFIG.Bridge, time.Minute, 10)
+	if h.config.FeeCheck() {
+		h.bridge, err = bridge.WithOptions(0, config.Current().Bridge, time.Minute, 10)
 		if err != nil {
 			return
 		}
@@ -78,8 +78,10 @@ func (h *PolyTxCommitHandler) Init(ctx context.Context, wg *sync.WaitGroup) (err
 		return
 	}
 
-	h.bus = bus.NewRedisTxBus(bus.New(h.config.Bus.Redis), h.config.ChainId, msg.POLY)
-	h.queue = bus.NewRedisDelayedTxBus(bus.New(h.config.Bus.Redis))
+	h.bus = bus.NewTxBus(h.config.Bus, h.config.ChainId, msg.POLY)
+	h.dlq = bus.NewDeadLetterBus(h.config.Bus, h.config.ChainId, msg.POLY)
+	h.budget = bus.NewRetryBudget(h.config.RetryBudget)
+	h.queue = bus.WithRetryBudget(bus.NewDelayedTxBus(h.config.Bus, h.config.ChainId, msg.POLY), h.dlq, h.budget)
 	return
 }
 
@@ -106,21 +108,33 @@ func (h *PolyTxCommitHandler) Start() (err error) {
 	}
 	{
 		bus := &CommitFilter{
-			name:     base.GetChainName(h.config.ChainId),
-			TxBus:    mq,
-			checkFee: h.config.CheckFee,
-			delay:    h.queue,
-			ch:       make(chan *msg.Tx, 100),
-			bridge:   h.bridge,
+			name:   base.GetChainName(h.config.ChainId),
+			TxBus:  mq,
+			config: h.config,
+			delay:  h.queue,
+			dlq:    h.dlq,
+			budget: h.budget,
+			ch:     make(chan *msg.Tx, 100),
+			bridge: h.bridge,
 		}
+		h.wg.Add(1)
 		go bus.Pipe(h.Context, h.wg)
 		mq = bus
 	}
+	if h.config.DrainDelayed {
+		skip := bus.NewSkipCheck(h.config.Bus)
+		h.wg.Add(1)
+		go drainDelayed(h.Context, h.wg, base.GetChainName(h.config.ChainId), []bus.DelayedTxBus{h.queue}, skip, func(tx *msg.Tx) error {
+			return h.bus.Push(context.Background(), tx)
+		})
+	}
 	err = h.submitter.Start(h.Context, h.wg, mq, h.queue, h.Compose)
 	return
 }
 
+// Stop the intake and wait for the in flight txs, the txs buffered for fee check are pushed back to the tx bus
 func (h *PolyTxCommitHandler) Stop() (err error) {
+	h.stop()
 	return
 }
 
@@ -131,8 +145,10 @@ func (h *PolyTxCommitHandler) Chain() uint64 {
 type CommitFilter struct {
 	name string
 	bus.TxBus
-	checkFee bool
+	config *config.PolyTxCommitConfig
 	delay  bus.DelayedTxBus
+	dlq    bus.DeadLetterBus
+	budget bus.RetryBudget
 	ch     chan *msg.Tx
 	bridge *bridge.SDK
 }
@@ -161,6 +177,13 @@ func (b *CommitFilter) flush(ctx context.Context, txs []*msg.Tx) (err error) {
 			PolyHash: tx.PolyHash,
 		}
 	}
+	// Fee check can be turned on by config reload
+	if b.bridge == nil {
+		b.bridge, err = bridge.WithOptions(0, config.Current().Bridge, time.Minute, 10)
+		if err != nil {
+			return
+		}
+	}
 	log.Info("Sending check fee request", "size", len(state), "chain", b.name)
 	err = b.bridge.Node().CheckFee(state)
 	if err != nil {
@@ -185,25 +208,34 @@ func (b *CommitFilter) flush(ctx context.Context, txs []*msg.Tx) (err error) {
 			log.Info("CheckFee EstimatePay", "poly_hash", tx.PolyHash, "paidGas", tx.PaidGas, "min", feeMin, "paid", feePaid)
 		} else if check.Skip() {
 			log.Warn("Skipping poly for marked as not target in fee check", "poly_hash", tx.PolyHash)
+			b.ack(tx)
 		} else if check.Missing() {
-			tx.Attempts++
+			tx.Fail(msg.ERR_FEE_CHECK_FAILURE)
 			log.Info("CheckFee tx missing in bridge, delay for 2 seconds", "poly_hash", tx.PolyHash)
 			tsp := time.Now().Unix() + 5
 			bus.SafeCall(ctx, tx, "push to delay queue", func() error { return b.delay.Delay(context.Background(), tx, tsp) })
-
+			b.ack(tx)
 		} else {
-			tx.Attempts++
+			tx.Fail(msg.ERR_PAID_FEE_TOO_LOW)
 			log.Info("CheckFee tx not paid, delay for 10 minutes", "poly_hash", tx.PolyHash, "min", feeMin, "paid", feePaid)
 			tsp := time.Now().Unix() + 600
 			bus.SafeCall(ctx, tx, "push to delay queue", func() error { return b.delay.Delay(context.Background(), tx, tsp) })
+			b.ack(tx)
 		}
 	}
 	return
 }
 
+func (b *CommitFilter) ack(tx *msg.Tx) {
+	err := b.TxBus.Ack(context.Background(), tx)
+	if err != nil {
+		log.Error("Failed to ack poly tx", "chain", b.name, "poly_hash", tx.PolyHash, "err", err)
+	}
+}
+
 func (b *CommitFilter) Pipe(ctx context.Context, wg *sync.WaitGroup) {
-	wg.Add(1)
 	defer wg.Done()
+	defer bus.Guard(ctx, "fee check")
 	txs := []*msg.Tx{}
 	flush := false
 LOOP:
@@ -220,16 +252,19 @@ LOOP:
 			if tx != nil {
 				if tx.PolyHash == "" {
 					log.Error("Invalid poly tx, poly hash missing", "body", tx.Encode())
+					b.ack(tx)
 					continue
 				}
-				if tx.Attempts > 1000 && base.ENV == "testnet" {
-					log.Error("Dropping failed tx for too many retries in testnet", "chain", b.name, "poly_hash", tx.PolyHash)
+				if b.budget.Exceeded(tx) {
+					log.Error("Moving failed tx to dead letter queue for too many retries", "chain", b.name, "poly_hash", tx.PolyHash)
+					bus.SafeCall(ctx, tx, "push to dead letter queue", func() error { return b.dlq.Put(context.Background(), tx) })
+					b.ack(tx)
 					continue
 				}
 				log.Info("Check fee pending", "chain", b.name, "poly_hash", tx.PolyHash, "process_pending", len(b.ch))
 
 				// Skip tx check fee
-				if !b.checkFee {
+				if !b.config.FeeCheck() {
 					tx.CheckFeeOff = true
 					b.ch <- tx
 				} else if tx.SkipFee() {
@@ -260,16 +295,17 @@ LOOP:
 	close(b.ch)
 	for tx := range b.ch {
 		bus.SafeCall(ctx, tx, "push back to tx bus", func() error { return b.TxBus.Push(context.Background(), tx) })
+		b.ack(tx)
 	}
 	for _, tx := range txs {
 		bus.SafeCall(ctx, tx, "push back to tx bus", func() error { return b.TxBus.Push(context.Background(), tx) })
+		b.ack(tx)
 	}
 	log.Info("Check fee queu exiting now...", "chain", b.name)
 }
 
 type SrcTxCommitHandler struct {
-	context.Context
-	wg *sync.WaitGroup
+	Worker
 
 	bus       bus.SortedTxBus
 	submitter *poly.Submitter
@@ -285,9 +321,8 @@ func NewSrcTxCommitHandler(config *config.SrcTxCommitConfig) *SrcTxCommitHandler
 	}
 }
 
-func (h *SrcTxCommitHandler) Init(ctx context.Context, wg *sync.WaitGroup) (err error) {
-	h.Context = ctx
-	h.wg = wg
+func (h *SrcTxCommitHandler) Init(ctx context.Context) (err error) {
+	h.init(ctx)
 
 	h.config.Poly.ChainId = h.config.ChainId
 	err = h.submitter.Init(h.config.Poly)
@@ -299,7 +334,11 @@ func (h *SrcTxCommitHandler) Init(ctx context.Context, wg *sync.WaitGroup) (err
 		return fmt.Errorf("Unabled to create listener for chain %s", base.GetChainName(h.config.ChainId))
 	}
 
-	h.bus = bus.NewRedisSortedTxBus(bus.New(h.config.Bus.Redis), h.config.ChainId, msg.SRC)
+	h.bus = bus.WithSortedRetryBudget(
+		bus.NewSortedTxBus(h.config.Bus, h.config.ChainId, msg.SRC),
+		bus.NewDeadLetterBus(h.config.Bus, h.config.ChainId, msg.SRC),
+		bus.NewRetryBudget(h.config.RetryBudget),
+	)
 	err = h.listener.Init(h.config.ListenerConfig, h.submitter.Poly())
 	return
 }
@@ -313,10 +352,17 @@ func (h *SrcTxCommitHandler) Start() (err error) {
 	return
 }
 
+// Stop the intake and wait for the in flight txs
 func (h *SrcTxCommitHandler) Stop() (err error) {
+	h.stop()
 	return
 }
 
 func (h *SrcTxCommitHandler) Chain() uint64 {
 	return h.config.ChainId
 }
+
+// UpdateNodes switches the listener to the new chain nodes
+func (h *SrcTxCommitHandler) UpdateNodes(nodes []string) error {
+	return updateNodes(h.listener, nodes)
+}
@@ -33,8 +33,7 @@ import (
 )
 
 type SrcTxSyncHandler struct {
-	context.Context
-	wg *sync.WaitGroup
+	Worker
 
 	listener IChainListener
 	bus      bus.SortedTxBus
@@ -51,9 +50,8 @@ func NewSrcTxSyncHandler(config *config.SrcTxSyncConfig) *SrcTxSyncHandler {
 	}
 }
 
-func (h *SrcTxSyncHandler) Init(ctx context.Context, wg *sync.WaitGroup) (err error) {
-	h.Context = ctx
-	h.wg = wg
+func (h *SrcTxSyncHandler) Init(ctx context.Context) (err error) {
+	h.init(ctx)
 
 	if h.listener == nil {
 		return fmt.Errorf("Unabled to create listener for chain %s", base.GetChainName(h.config.ChainId))
@@ -65,13 +63,17 @@ func (h *SrcTxSyncHandler) Init(ctx context.Context, wg *sync.WaitGroup) (err er
 		return
 	}
 
-	h.state = bus.NewRedisChainStore(
-		bus.ChainHeightKey{ChainId: h.config.ChainId, Type: bus.KEY_HEIGHT_TX}, bus.New(h.config.Bus.Redis),
+	h.state = bus.NewChainStore(
+		h.config.Bus, bus.ChainHeightKey{ChainId: h.config.ChainId, Type: bus.KEY_HEIGHT_TX},
 		h.config.Bus.HeightUpdateInterval,
 	)
+	err = h.state.Fence(ctx)
+	if err != nil {
+		return
+	}
 
-	h.bus = bus.NewRedisSortedTxBus(bus.New(h.config.Bus.Redis), h.config.ChainId, msg.SRC)
-	h.patch = bus.NewRedisPatchTxBus(bus.New(h.config.Bus.Redis), h.config.ChainId)
+	h.bus = bus.NewSortedTxBus(h.config.Bus, h.config.ChainId, msg.SRC)
+	h.patch = bus.NewPatchTxBus(h.config.Bus, h.config.ChainId)
 	return
 }
 
@@ -81,14 +83,15 @@ func (h *SrcTxSyncHandler) Start() (err error) {
 		return
 	}
 
+	h.wg.Add(2)
 	go h.start()
 	go h.patchTxs()
 	return
 }
 
 func (h *SrcTxSyncHandler) patchTxs() {
-	h.wg.Add(1)
 	defer h.wg.Done()
+	defer bus.Guard(h.Context, "src tx patch")
 	for {
 		select {
 		case <-h.Done():
@@ -108,45 +111,53 @@ func (h *SrcTxSyncHandler) patchTxs() {
 			continue
 		}
 		log.Info("Received patch tx request", "tx", tx.Encode())
-
-		height := tx.SrcHeight
-		if height == 0 && tx.SrcHash != "" {
-			height, err = h.listener.GetTxBlock(tx.SrcHash)
-			if err != nil {
-				log.Error("Failed to get tx block", "hash", tx.SrcHash, "chain", h.config.ChainId)
-				continue
-			}
-		}
-
-		if height == 0 {
-			log.Error("Failed to patch tx for height is invalid", "chain", h.config.ChainId, "body", tx.Encode())
-			continue
+		h.patchTx(tx)
+		err = h.patch.Ack(context.Background(), tx)
+		if err != nil {
+			log.Error("Failed to ack patch tx request", "chain", h.config.ChainId, "err", err)
 		}
+	}
+}
 
-		txs, err := h.listener.Scan(height)
+func (h *SrcTxSyncHandler) patchTx(tx *msg.Tx) {
+	var err error
+	height := tx.SrcHeight
+	if height == 0 && tx.SrcHash != "" {
+		height, err = h.listener.GetTxBlock(tx.SrcHash)
 		if err != nil {
-			log.Error("Fetch block txs error", "chain", h.config.ChainId, "height", height, "err", err)
+			log.Error("Failed to get tx block", "hash", tx.SrcHash, "chain", h.config.ChainId)
+			return
 		}
+	}
 
-		count := 0
-		for _, t := range txs {
-			if tx.SrcHash == "" || util.LowerHex(tx.SrcHash) == util.LowerHex(t.SrcHash) {
-				count++
-				log.Info("Found patch target src tx", "hash", t.SrcHash, "chain", h.config.ChainId, "height", height)
-				bus.SafeCall(h.Context, t, "push to tx bus", func() error {
-					return h.bus.Push(context.Background(), t, 0)
-				})
-			} else {
-				log.Info("Found src tx in block not targeted", "hash", t.SrcHash, "chain", h.config.ChainId, "height", height)
-			}
+	if height == 0 {
+		log.Error("Failed to patch tx for height is invalid", "chain", h.config.ChainId, "body", tx.Encode())
+		return
+	}
+
+	txs, err := h.listener.Scan(height)
+	if err != nil {
+		log.Error("Fetch block txs error", "chain", h.config.ChainId, "height", height, "err", err)
+	}
+
+	count := 0
+	for _, t := range txs {
+		if tx.SrcHash == "" || util.LowerHex(tx.SrcHash) == util.LowerHex(t.SrcHash) {
+			count++
+			log.Info("Found patch target src tx", "hash", t.SrcHash, "chain", h.config.ChainId, "height", height)
+			bus.SafeCall(h.Context, t, "push to tx bus", func() error {
+				return h.bus.Push(context.Background(), t, 0)
+			})
+		} else {
+			log.Info("Found src tx in block not targeted", "hash", t.SrcHash, "chain", h.config.ChainId, "height", height)
 		}
-		log.Info("Patching src txs per request", "count", count)
 	}
+	log.Info("Patching src txs per request", "count", count)
 }
 
 func (h *SrcTxSyncHandler) start() (err error) {
-	h.wg.Add(1)
 	defer h.wg.Done()
+	defer bus.Guard(h.Context, "src tx sync")
 	confirms := base.BlocksToSkip(h.config.ChainId)
 	var (
 		latest uint64
@@ -164,11 +175,17 @@ func (h *SrcTxSyncHandler) start() (err error) {
 		if latest < h.height+confirms {
 			latest, ok = h.listener.Nodes().WaitTillHeight(h.Context, h.height+confirms, h.listener.ListenCheck())
 			if !ok {
+				h.height--
 				continue
 			}
 		}
 		log.Info("Scanning txs in block", "height", h.height, "chain", h.config.ChainId)
 		txs, err := h.listener.Scan(h.height)
+		if err == nil {
+			// Avoid pushing txs after another instance took over, a stale leader passing the check is stopped by
+			// the fenced height mark, and its duplicate pushes replace the queued entries of the same tx
+			err = bus.Fence(h.Context)
+		}
 		if err == nil {
 			for _, tx := range txs {
 				log.Info("Found src tx", "hash", tx.SrcHash, "chain", h.config.ChainId, "height", h.height)
@@ -190,7 +207,12 @@ func (h *SrcTxSyncHandler) start() (err error) {
 	return
 }
 
+// Stop scanning and wait for the in flight pushes, then flush the tx sync height mark
 func (h *SrcTxSyncHandler) Stop() (err error) {
+	h.stop()
+	if h.height > 0 {
+		err = h.state.UpdateHeight(context.Background(), h.height)
+	}
 	return
 }
 
@@ -198,16 +220,23 @@ func (h *SrcTxSyncHandler) Chain() uint64 {
 	return h.config.ChainId
 }
 
+// UpdateNodes switches the listener to the new chain nodes
+func (h *SrcTxSyncHandler) UpdateNodes(nodes []string) error {
+	return updateNodes(h.listener, nodes)
+}
+
 type PolyTxSyncHandler struct {
+	// Context of the leadership term
 	context.Context
-	wg *sync.WaitGroup
+	wg     *sync.WaitGroup
+	worker Worker
 
 	listener IChainListener
-	bus      bus.TxBus        // main poly tx queue
-	patch    bus.TxBus        // path poly tx queue
-	queue    bus.DelayedTxBus // delayed poly tx queue
+	bus      bus.TxBus // main poly tx queue
+	patch    bus.TxBus // path poly tx queue
 	state    bus.ChainStore
 	skip     bus.SkipCheck
+	leader   *bus.Leader
 	height   uint64
 	config   *config.PolyTxSyncConfig
 }
@@ -219,9 +248,8 @@ func NewPolyTxSyncHandler(config *config.PolyTxSyncConfig) *PolyTxSyncHandler {
 	}
 }
 
-func (h *PolyTxSyncHandler) Init(ctx context.Context, wg *sync.WaitGroup) (err error) {
-	h.Context = ctx
-	h.wg = wg
+func (h *PolyTxSyncHandler) Init(ctx context.Context) (err error) {
+	h.worker.init(ctx)
 	if h.listener == nil {
 		return fmt.Errorf("Unabled to create listener for chain %s", base.GetChainName(h.config.ChainId))
 	}
@@ -230,50 +258,123 @@ func (h *PolyTxSyncHandler) Init(ctx context.Context, wg *sync.WaitGroup) (err e
 		return
 	}
 
-	h.state = bus.NewRedisChainStore(
-		bus.ChainHeightKey{ChainId: h.config.ChainId, Type: bus.KEY_HEIGHT_TX}, bus.New(h.config.Bus.Redis),
+	h.state = bus.NewChainStore(
+		h.config.Bus, bus.ChainHeightKey{ChainId: h.config.ChainId, Type: bus.KEY_HEIGHT_TX},
 		h.config.Bus.HeightUpdateInterval,
 	)
 
-	h.bus = bus.NewRedisTxBus(bus.New(h.config.Bus.Redis), h.config.ChainId, msg.POLY)
-	h.patch = bus.NewRedisPatchTxBus(bus.New(h.config.Bus.Redis), base.POLY)
-	h.queue = bus.NewRedisDelayedTxBus(bus.New(h.config.Bus.Redis))
-	h.skip = bus.NewRedisSkipCheck(bus.New(h.config.Bus.Redis))
-	ok, err := bus.NewStatusLock(bus.New(h.config.Bus.Redis), bus.POLY_SYNC).Start(ctx, h.wg)
-	if err != nil {
-		return err
-	}
-	if !ok {
-		err = fmt.Errorf("Only one poly tx listener is expected to run.")
-	}
+	h.bus = bus.NewTxBus(h.config.Bus, h.config.ChainId, msg.POLY)
+	h.patch = bus.NewPatchTxBus(h.config.Bus, base.POLY)
+	h.skip = bus.NewSkipCheck(h.config.Bus)
+	h.leader = bus.NewLeader(h.config.Bus, bus.ROLE_POLY_SYNC)
 	return
 }
 
 func (h *PolyTxSyncHandler) Start() (err error) {
-	h.height, err = h.state.GetHeight(context.Background())
+	h.worker.wg.Add(1)
+	go h.run(h.worker.Context, h.worker.wg)
+	return
+}
+
+// Stand by with the listener initialized until elected, then sync from the stored height mark until the term ends
+func (h *PolyTxSyncHandler) run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer bus.Guard(ctx, "poly tx sync")
+	for {
+		standby, stop := context.WithCancel(ctx)
+		go h.standby(standby)
+		term, err := h.leader.Campaign(ctx, wg)
+		stop()
+		if err != nil {
+			return
+		}
+
+		workers := &sync.WaitGroup{}
+		err = h.lead(term, workers)
+		if err != nil {
+			log.Error("Failed to start poly tx sync", "err", err)
+			h.leader.Resign()
+		}
+		<-term.Done()
+		workers.Wait()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (h *PolyTxSyncHandler) lead(term *bus.Term, wg *sync.WaitGroup) (err error) {
+	h.Context = term
+	h.wg = wg
+	// Height marks of the previous terms are rejected from now on
+	err = h.state.Fence(term)
+	if err != nil {
+		return
+	}
+	h.height, err = h.state.GetHeight(term)
 	if err != nil {
 		return
 	}
+	log.Info("Poly tx sync taking over", "height", h.height, "token", term.Token)
 
+	wg.Add(3)
 	go h.start()
 	go h.checkDelayed()
 	go h.patchTxs()
 	return
 }
 
+// Report the height mark to resume from and the lag behind the chain while standing by
+func (h *PolyTxSyncHandler) standby(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for {
+		mark, err := h.state.GetHeight(ctx)
+		if err == nil {
+			var latest uint64
+			latest, err = h.listener.LatestHeight()
+			if err == nil {
+				leader, token, _ := h.leader.Leader(ctx)
+				log.Info("Poly tx sync standing by", "mark", mark, "latest", latest, "leader", leader, "token", token)
+				err = h.leader.Report(ctx, mark, latest)
+			}
+		}
+		if err != nil {
+			log.Error("Poly tx sync standby check error", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 func (h *PolyTxSyncHandler) start() (err error) {
-	h.wg.Add(1)
 	defer h.wg.Done()
+	defer bus.Guard(h.Context, "poly tx sync")
 	confirms := uint64(h.listener.Defer())
 	var (
 		latest uint64
 		ok     bool
 	)
+	report := time.NewTicker(10 * time.Second)
+	defer report.Stop()
 	for {
 		select {
 		case <-h.Done():
 			log.Info("Poly tx sync handler is exiting...", "chain", h.config.ChainId, "height", h.height)
+			if h.worker.Err() != nil {
+				// Stopping rather than lost the leadership, flush the height mark for the next leader
+				h.state.UpdateHeight(context.Background(), h.height)
+			}
 			return nil
+		case <-report.C:
+			h.leader.Report(context.Background(), h.height, latest)
 		default:
 		}
 
@@ -281,11 +382,17 @@ func (h *PolyTxSyncHandler) start() (err error) {
 		if latest < h.height+confirms {
 			latest, ok = h.listener.Nodes().WaitTillHeight(h.Context, h.height+confirms, h.listener.ListenCheck())
 			if !ok {
+				h.height--
 				continue
 			}
 		}
 		log.Info("Scanning poly txs in block", "height", h.height, "chain", h.config.ChainId)
 		txs, err := h.listener.Scan(h.height)
+		if err == nil {
+			// Avoid pushing txs after another instance took over, a stale leader passing the check is stopped by
+			// the fenced height mark, and its duplicate pushes replace the queued entries of the same tx
+			err = bus.Fence(h.Context)
+		}
 		if err == nil {
 			for _, tx := range txs {
 				log.Info("Found poly tx", "hash", tx.PolyHash)
@@ -303,53 +410,60 @@ func (h *PolyTxSyncHandler) start() (err error) {
 	return
 }
 
-func (h *PolyTxSyncHandler) checkDelayed() (err error) {
-	h.wg.Add(1)
-	defer h.wg.Done()
-	for {
-		select {
-		case <-h.Done():
-			log.Info("Delayed poly tx sync handler is exiting...", "chain", h.config.ChainId, "height", h.height)
-			return nil
-		default:
-		}
+func (h *PolyTxSyncHandler) checkDelayed() {
+	// Drain the per chain delayed queues and the legacy shared delayed queue
+	queues := []bus.DelayedTxBus{bus.NewLegacyDelayedTxBus(h.config.Bus)}
+	for _, chain := range base.CHAINS {
+		queues = append(queues, bus.NewDelayedTxBus(h.config.Bus, chain, msg.POLY))
+	}
+	drainDelayed(h.Context, h.wg, "poly", queues, h.skip, func(tx *msg.Tx) error {
+		return h.bus.PushToChain(context.Background(), tx)
+	})
+}
 
-		tx, score, err := h.queue.Pop(h.Context)
-		if err != nil {
-			log.Error("Deplayed poly tx queue pop error", "err", err)
-			continue
-		}
-		if tx != nil && score > 0 {
-			skip, _ := h.skip.CheckSkip(h.Context, tx)
-			if skip {
-				log.Warn("Skipping tx for marked to skip", "poly_hash", tx.PolyHash)
+// Move the due txs of the delayed queues to the tx queues until exit signal received, the caller adds to the
+// wait group before starting it
+func drainDelayed(ctx context.Context, wg *sync.WaitGroup, name string, queues []bus.DelayedTxBus, skip bus.SkipCheck, push func(*msg.Tx) error) {
+	defer wg.Done()
+	defer bus.Guard(ctx, "delayed tx drain")
+	for {
+		count := 0
+		for _, queue := range queues {
+			txs, err := queue.PopDue(ctx, 100)
+			if err != nil {
+				log.Error("Delayed tx queue pop error", "topic", queue.Topic(), "err", err)
 				continue
 			}
-			if score <= time.Now().Unix() {
-				bus.SafeCall(h.Context, tx, "push to delay queue", func() error {
+			for _, tx := range txs {
+				count++
+				skipped, _ := skip.CheckSkip(ctx, tx)
+				if skipped {
+					log.Warn("Skipping tx for marked to skip", "poly_hash", tx.PolyHash)
+					continue
+				}
+				bus.SafeCall(ctx, tx, "push delayed tx to tx bus", func() error {
 					log.Info("Pushing back delayed tx", "chain", tx.DstChainId, "poly_hash", tx.PolyHash)
-					return h.bus.PushToChain(context.Background(), tx)
-				})
-				continue
-			} else {
-				bus.SafeCall(h.Context, tx, "push to delay queue", func() error {
-					log.Trace("Pushing back delayed tx for not active yet", "chain", tx.DstChainId, "poly_hash", tx.PolyHash)
-					return h.queue.Delay(context.Background(), tx, score)
+					return push(tx)
 				})
 			}
 		}
+
+		wait := time.Second
+		if count > 0 {
+			wait = 0
+		}
 		select {
-		case <-h.Done():
-			log.Info("Delayed poly tx sync handler is exiting...", "chain", h.config.ChainId, "height", h.height)
-			return nil
-		case <-time.After(time.Second):
+		case <-ctx.Done():
+			log.Info("Delayed tx drain is exiting...", "name", name)
+			return
+		case <-time.After(wait):
 		}
 	}
 }
 
 func (h *PolyTxSyncHandler) patchTxs() {
-	h.wg.Add(1)
 	defer h.wg.Done()
+	defer bus.Guard(h.Context, "poly tx patch")
 	for {
 		select {
 		case <-h.Done():
@@ -370,43 +484,54 @@ func (h *PolyTxSyncHandler) patchTxs() {
 		}
 
 		log.Info("Received patch tx request", "tx", tx.Encode())
-		height := uint64(tx.PolyHeight)
-		if height == 0 && tx.PolyHash != "" {
-			height, err = h.listener.GetTxBlock(tx.PolyHash)
-			if err != nil {
-				log.Error("Failed to get poly tx block", "hash", tx.PolyHash, "chain", h.config.ChainId)
-				continue
-			}
-		}
-
-		if height == 0 {
-			log.Error("Failed to patch poly tx for height is invalid", "chain", h.config.ChainId, "body", tx.Encode())
-			continue
+		h.patchTx(tx)
+		err = h.patch.Ack(context.Background(), tx)
+		if err != nil {
+			log.Error("Failed to ack patch tx request", "chain", h.config.ChainId, "err", err)
 		}
+	}
+}
 
-		txs, err := h.listener.Scan(height)
+func (h *PolyTxSyncHandler) patchTx(tx *msg.Tx) {
+	var err error
+	height := uint64(tx.PolyHeight)
+	if height == 0 && tx.PolyHash != "" {
+		height, err = h.listener.GetTxBlock(tx.PolyHash)
 		if err != nil {
-			log.Error("Fetch poly block txs error", "chain", h.config.ChainId, "height", height, "err", err)
+			log.Error("Failed to get poly tx block", "hash", tx.PolyHash, "chain", h.config.ChainId)
+			return
 		}
+	}
 
-		count := 0
-		for _, t := range txs {
-			if tx.PolyHash == "" || util.LowerHex(tx.PolyHash) == util.LowerHex(t.PolyHash) {
-				count++
-				log.Info("Found patch target poly tx", "hash", t.PolyHash, "chain", h.config.ChainId, "height", height)
-				t.CapturePatchParams(tx)
-				bus.SafeCall(h.Context, t, "push to target chain tx bus", func() error {
-					return h.bus.PushToChain(context.Background(), t)
-				})
-			} else {
-				log.Info("Found poly tx in block not targeted", "hash", t.PolyHash, "chain", h.config.ChainId, "height", height)
-			}
+	if height == 0 {
+		log.Error("Failed to patch poly tx for height is invalid", "chain", h.config.ChainId, "body", tx.Encode())
+		return
+	}
+
+	txs, err := h.listener.Scan(height)
+	if err != nil {
+		log.Error("Fetch poly block txs error", "chain", h.config.ChainId, "height", height, "err", err)
+	}
+
+	count := 0
+	for _, t := range txs {
+		if tx.PolyHash == "" || util.LowerHex(tx.PolyHash) == util.LowerHex(t.PolyHash) {
+			count++
+			log.Info("Found patch target poly tx", "hash", t.PolyHash, "chain", h.config.ChainId, "height", height)
+			t.CapturePatchParams(tx)
+			bus.SafeCall(h.Context, t, "push to target chain tx bus", func() error {
+				return h.bus.PushToChain(context.Background(), t)
+			})
+		} else {
+			log.Info("Found poly tx in block not targeted", "hash", t.PolyHash, "chain", h.config.ChainId, "height", height)
 		}
-		log.Info("Patching poly txs per request", "count", count)
 	}
+	log.Info("Patching poly txs per request", "count", count)
 }
 
+// Stop scanning or standing by, and wait for the in flight pushes
 func (h *PolyTxSyncHandler) Stop() (err error) {
+	h.worker.stop()
 	return
 }
 
@@ -0,0 +1,45 @@
+/*
+ * Copyright (C) 2021 The poly network Authors
+ * This file is part of The poly network library.
+ *
+ * The  poly network  is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Lesser General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * The  poly network  is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Lesser General Public License for more details.
+ * You should have received a copy of the GNU Lesser General Public License
+ * along with The poly network .  If not, see <http://www.gnu.org/licenses/>.
+ */
+
+package relayer
+
+import (
+	"context"
+	"sync"
+)
+
+// Worker holds the context and the goroutines of a handler run. The context is canceled on stop to stop
+// the intake, and stop returns once the goroutines finished the in flight work and exited. Each run owns
+// a new wait group, so a restarted handler never joins the group of the previous run.
+type Worker struct {
+	context.Context
+	wg     *sync.WaitGroup
+	cancel context.CancelFunc
+}
+
+func (w *Worker) init(ctx context.Context) {
+	w.Context, w.cancel = context.WithCancel(ctx)
+	w.wg = new(sync.WaitGroup)
+}
+
+func (w *Worker) stop() {
+	if w.cancel == nil {
+		return
+	}
+	w.cancel()
+	w.wg.Wait()
+}